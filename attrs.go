@@ -0,0 +1,49 @@
+package filestore
+
+import (
+	"os"
+	"time"
+)
+
+// attributeModes are the bits of the modes of files stored in the mode column of the Versions
+// table, the permission bits and the type bit of symbolic links stored as such.
+const attributeModes = os.ModePerm | os.ModeSymlink
+
+// fileAttributes returns the mode and modification time of a file as they are stored in the mode
+// and mtime columns of the Versions table, where zero means that they are unknown.
+func fileAttributes(mode os.FileMode, modified time.Time) (int64, int64) {
+	var mtime int64
+	if !modified.IsZero() {
+		mtime = modified.UnixNano()
+	}
+	return int64(mode & attributeModes), mtime
+}
+
+// versionAttributes returns the mode and modification time stored in the mode and mtime columns
+// of the Versions table.
+func versionAttributes(mode, mtime int64) (os.FileMode, time.Time) {
+	var modified time.Time
+	if mtime != 0 {
+		modified = time.Unix(0, mtime).UTC()
+	}
+	return os.FileMode(mode) & attributeModes, modified
+}
+
+// restoreMode returns the permissions of the restored file of version, which are the RestoreMode
+// of the filestore if it is set and the permission bits of the source file otherwise, or zero if
+// they are unknown.
+func (fs *Filestore) restoreMode(version FileVersion) os.FileMode {
+	if fs.RestoreMode != 0 {
+		return fs.RestoreMode
+	}
+	return version.Mode.Perm()
+}
+
+// restoreModified sets the modification time of the restored file dst of version to the one of
+// its source file if it is known.
+func restoreModified(version FileVersion, dst string) error {
+	if version.Modified.IsZero() {
+		return nil
+	}
+	return os.Chtimes(dst, time.Now(), version.Modified)
+}
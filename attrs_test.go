@@ -0,0 +1,94 @@
+package filestore
+
+import (
+	"bytes"
+	"errors"
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+	"time"
+)
+
+// checkAttributes fails unless the file at path has the permissions mode and modification time
+// modified.
+func checkAttributes(t *testing.T, path string, mode os.FileMode, modified time.Time) {
+	t.Helper()
+	info, err := os.Stat(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.Mode().Perm() != mode || !info.ModTime().Equal(modified) {
+		t.Fatalf("%s has mode %v and mtime %v, want %v and %v", path, info.Mode().Perm(), info.ModTime(), mode, modified)
+	}
+}
+
+func TestModeAndMtime(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("Windows has no Unix permissions")
+	}
+	fs, src := newTestStore(t)
+	path := filepath.Join(src, "run.sh")
+	writeFile(t, path, "#!/bin/sh\n")
+	modified := time.Date(2020, 1, 2, 3, 4, 5, 123456789, time.UTC)
+	if err := os.Chmod(path, 0751); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chtimes(path, modified, modified); err != nil {
+		t.Fatal(err)
+	}
+	if err := fs.Add(path, "", "1"); err != nil {
+		t.Fatal(err)
+	}
+	v, err := fs.Get(path)
+	if err != nil || v.Mode != 0751 || !v.Modified.Equal(modified) {
+		t.Fatalf("Get = %v, %v, %v, want mode %v and mtime %v", v.Mode, v.Modified, err, os.FileMode(0751), modified)
+	}
+	dst := t.TempDir()
+	if err := fs.Restore(v, dst); err != nil {
+		t.Fatal(err)
+	}
+	checkAttributes(t, filepath.Join(dst, "run.sh"), 0751, modified)
+	if err := os.Remove(path); err != nil {
+		t.Fatal(err)
+	}
+	if err := fs.RestoreAtSource(v); err != nil {
+		t.Fatal(err)
+	}
+	checkAttributes(t, path, 0751, modified)
+	// RestoreMode overrides the recorded mode
+	fs.RestoreMode = 0600
+	dst = t.TempDir()
+	if err := fs.Restore(v, dst); err != nil {
+		t.Fatal(err)
+	}
+	checkAttributes(t, filepath.Join(dst, "run.sh"), 0600, modified)
+	// the attributes are kept by ExportTar and ImportTar and by PullMetadata
+	var archive bytes.Buffer
+	if err := fs.ExportTar(&archive, ExportOptions{}); err != nil {
+		t.Fatal(err)
+	}
+	imported, _ := openTestStore(t, NewFilestore(filepath.Join(t.TempDir(), "imported"), 0))
+	if err := imported.ImportTar(&archive, ImportOptions{}); err != nil {
+		t.Fatal(err)
+	}
+	if v, err := imported.Get(path); err != nil || v.Mode != 0751 || !v.Modified.Equal(modified) {
+		t.Fatalf("imported version has mode %v and mtime %v, %v, want %v and %v", v.Mode, v.Modified, err, os.FileMode(0751), modified)
+	}
+	pulled, _ := openTestStore(t, NewFilestore(filepath.Join(t.TempDir(), "pulled"), 0))
+	if _, err := pulled.PullMetadata(fs); err != nil {
+		t.Fatal(err)
+	}
+	if v, err := pulled.Get(path); err != nil || v.Mode != 0751 || !v.Modified.Equal(modified) {
+		t.Fatalf("pulled version has mode %v and mtime %v, %v, want %v and %v", v.Mode, v.Modified, err, os.FileMode(0751), modified)
+	}
+	if _, err := fs.Repair(RepairOptions{}); err != nil {
+		t.Fatal(err)
+	}
+	if err := fs.ReindexFTS(); errors.Is(err, ErrNoFTS) {
+		return
+	}
+	if results, err := fs.Search("run", 10); err != nil || len(results) == 0 || results[0].Mode != 0751 {
+		t.Fatalf("Search = %v, %v, want the version with its mode", results, err)
+	}
+}
@@ -0,0 +1,243 @@
+package filestore
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+var ErrBackupExists = errors.New("filestore backup destination is not empty")
+
+// backupMetadataName is the name of the file with the metadata of incremental backups.
+const backupMetadataName = "metadata.jsonl"
+
+// Backup copies the filestore to the directory dst while it is open, so that backups do not
+// require closing it. The database is copied with SQLite's online backup API, or with VACUUM
+// INTO when built with the pure Go driver, which yields a consistent snapshot even while versions
+// are added, followed by the blobs and chunks it refers to. Contents deleted during the backup are kept until it has finished, so the backup is
+// complete unless other processes delete them. Contents pulled from another filestore that have
+// not been fetched are not copied and remain to be fetched by the backup. dst is created if it
+// does not exist and must be empty otherwise. The backup can be opened as a filestore with the
+// same options and key as the original.
+func (fs *Filestore) Backup(dst string) (err error) {
+	op := newOp("Backup", dst)
+	defer op.done(&err)
+	if err := fs.ensureOpen(); err != nil {
+		return err
+	}
+	if entries, err := os.ReadDir(dst); err == nil && len(entries) > 0 {
+		return ErrBackupExists
+	}
+	if err := ensureDirectory(dst, fs.dirMode()); err != nil {
+		return err
+	}
+	backup := NewFilestore(dst, fs.Options)
+	fs.holdDeletions()
+	defer fs.releaseDeletions()
+	if err := fs.backupDB(backup.dbPath()); err != nil {
+		return err
+	}
+	db, err := sql.Open(driverName, backup.dbPath())
+	if err != nil {
+		return fs.dbError(err)
+	}
+	defer db.Close()
+	return fs.backupFiles(db, backup.Root(), "select checksum from Files where origin is null and not chunked;", "select checksum from Chunks;")
+}
+
+// BackupSince writes an incremental backup of the versions added after since to the directory
+// dst, which is created if it does not exist and must be empty otherwise. It contains the
+// metadata of the versions as written by ExportMetadata in the file metadata.jsonl and the blobs
+// and chunks that no earlier version uses, so that nightly backups are cheap. Deletions and
+// versions imported with earlier dates are not included. To layer an incremental backup on a
+// full backup made with Backup, copy its directories into the directory of the full backup and
+// import its metadata.jsonl into the full backup with ImportMetadata, in the order in which the
+// backups were made.
+func (fs *Filestore) BackupSince(dst string, since time.Time) (err error) {
+	op := newOp("BackupSince", dst)
+	defer op.done(&err)
+	if err := fs.ensureOpen(); err != nil {
+		return err
+	}
+	if entries, err := os.ReadDir(dst); err == nil && len(entries) > 0 {
+		return ErrBackupExists
+	}
+	if err := ensureDirectory(dst, fs.dirMode()); err != nil {
+		return err
+	}
+	fs.holdDeletions()
+	defer fs.releaseDeletions()
+	// read within a transaction, so that the metadata and contents are consistent
+	tx, err := fs.db.Begin()
+	if err != nil {
+		return fs.dbError(err)
+	}
+	defer tx.Rollback()
+	f, err := os.Create(filepath.Join(dst, backupMetadataName))
+	if err != nil {
+		return err
+	}
+	if err := fs.exportMetadata(tx, f, since); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+	// contents and chunks used by versions added after since but not before
+	const newFiles = "select file from Versions where date > ?1 except select file from Versions where date <= ?1"
+	return fs.backupFiles(tx, asDirectoryPath(dst),
+		"select checksum from Files where origin is null and not chunked and file_id in ("+newFiles+");",
+		"select checksum from Chunks where chunk_id in (select chunk from FileChunks where file in ("+newFiles+")) and chunk_id not in (select chunk from FileChunks where file in (select file from Versions where date <= ?1));",
+		ToDBDate(since.UTC()))
+}
+
+// backupFiles copies the blob directories of the contents whose checksums are selected by
+// blobQuery and the chunks whose checksums are selected by chunkQuery, both queried with q and
+// the arguments args, to the filestore directory root.
+func (fs *Filestore) backupFiles(q querier, root, blobQuery, chunkQuery string, args ...interface{}) error {
+	blobs, err := backupChecksums(q, blobQuery, args...)
+	if err != nil {
+		return fs.dbError(err)
+	}
+	for _, checksum := range blobs {
+		if err := fs.backupDir(fs.Root()+checksum, root+checksum, nil); err != nil {
+			return fmt.Errorf("filestore could not back up contents %s: %w", checksum, err)
+		}
+	}
+	chunks, err := backupChecksums(q, chunkQuery, args...)
+	if err != nil {
+		return fs.dbError(err)
+	}
+	byDir := make(map[string]map[string]bool)
+	for _, checksum := range chunks {
+		if byDir[checksum[:2]] == nil {
+			byDir[checksum[:2]] = make(map[string]bool)
+		}
+		byDir[checksum[:2]][checksum] = true
+	}
+	for dir, checksums := range byDir {
+		if err := fs.backupDir(filepath.Join(fs.Root()+"chunks", dir), filepath.Join(root+"chunks", dir), checksums); err != nil {
+			return fmt.Errorf("filestore could not back up chunks: %w", err)
+		}
+	}
+	return nil
+}
+
+// backupDB copies the database of the filestore to a new database at path in a single step, so
+// that the copy is consistent.
+func (fs *Filestore) backupDB(path string) error {
+	ctx := context.Background()
+	src, err := fs.db.Conn(ctx)
+	if err != nil {
+		return fs.dbError(err)
+	}
+	defer src.Close()
+	if err := backupConn(ctx, src, path); err != nil {
+		return fs.dbError(err)
+	}
+	return nil
+}
+
+// backupChecksums returns the checksums selected by query with the arguments args.
+func backupChecksums(q querier, query string, args ...interface{}) ([]string, error) {
+	rows, err := q.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var checksums []string
+	for rows.Next() {
+		var checksum string
+		if err := rows.Scan(&checksum); err != nil {
+			return nil, err
+		}
+		checksums = append(checksums, checksum)
+	}
+	return checksums, rows.Err()
+}
+
+// backupDir copies the files of the directory src to the directory dst, which is created. If
+// checksums is not nil, only files named by one of its checksums and the extension of their
+// codec are copied.
+func (fs *Filestore) backupDir(src, dst string, checksums map[string]bool) error {
+	names, err := fs.listStored(src)
+	if err != nil {
+		return err
+	}
+	if err := ensureDirectory(dst, fs.dirMode()); err != nil {
+		return err
+	}
+	plain, err := newCodec(CompressionNone)
+	if err != nil {
+		return err
+	}
+	for _, name := range names {
+		if checksums != nil && !checksums[strings.SplitN(name, ".", 2)[0]] {
+			continue
+		}
+		if err := fs.restoreStored(filepath.Join(src, name), filepath.Join(dst, name), plain, 0, nil); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// holdDeletions defers removing the files of deleted contents of the database of the filestore
+// until releaseDeletions is called as often as holdDeletions.
+func (fs *Filestore) holdDeletions() {
+	registry.Lock()
+	defer registry.Unlock()
+	if shared, ok := registry.dbs[fs.dbKey]; ok {
+		shared.holds++
+	}
+}
+
+// releaseDeletions ends a hold of holdDeletions and removes the files of contents deleted during
+// the holds if it was the last one.
+func (fs *Filestore) releaseDeletions() {
+	registry.Lock()
+	shared, ok := registry.dbs[fs.dbKey]
+	if !ok || shared.holds == 0 {
+		registry.Unlock()
+		return
+	}
+	shared.holds--
+	var held []string
+	if shared.holds == 0 {
+		held, shared.held = shared.held, nil
+	}
+	registry.Unlock()
+	if len(held) == 0 {
+		return
+	}
+	unlock, err := fs.lockBlobs()
+	if err != nil {
+		// the files are left for Repair
+		return
+	}
+	defer unlock()
+	for _, path := range held {
+		fs.removeStored(path)
+	}
+}
+
+// removeDeleted removes the files of deleted contents, or defers removing them while deletions
+// are held.
+func (fs *Filestore) removeDeleted(paths []string) {
+	registry.Lock()
+	if shared, ok := registry.dbs[fs.dbKey]; ok && shared.holds > 0 {
+		shared.held = append(shared.held, paths...)
+		registry.Unlock()
+		return
+	}
+	registry.Unlock()
+	for _, path := range paths {
+		fs.removeStored(path)
+	}
+}
@@ -0,0 +1,134 @@
+package filestore
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	iofs "io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/rasteric/flags"
+)
+
+func testBackup(t *testing.T, opts flags.Bits) {
+	fs, src := openTestStore(t, NewFilestore(filepath.Join(t.TempDir(), "store"), opts))
+	path := filepath.Join(src, "a.txt")
+	data := strings.Repeat("abcdefgh", 100000)
+	addFile(t, fs, path, data, "a", "1")
+	vb := addFile(t, fs, filepath.Join(src, "b.txt"), "b", "b", "1")
+	blob := filepath.Join(fs.Root(), vb.Checksum)
+	_, statErr := os.Stat(blob)
+	// contents deleted while a backup is running are kept until it is done
+	fs.holdDeletions()
+	if err := fs.DeleteVersion(vb); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(blob); (err == nil) != (statErr == nil) {
+		t.Fatalf("Stat of held contents = %v, want %v", err, statErr)
+	}
+	dst := filepath.Join(t.TempDir(), "backup")
+	if err := fs.Backup(dst); err != nil {
+		t.Fatal(err)
+	}
+	fs.releaseDeletions()
+	if _, err := os.Stat(blob); err == nil {
+		t.Fatal("deleted contents kept after releasing them")
+	}
+	if err := fs.Backup(dst); !errors.Is(err, ErrBackupExists) {
+		t.Fatalf("Backup to an existing backup = %v, want ErrBackupExists", err)
+	}
+	backup, _ := openTestStore(t, NewFilestore(dst, opts))
+	if report, err := backup.Verify(VerifyOptions{}); err != nil || !report.OK() {
+		t.Fatalf("Verify of the backup = %v, %v", report.Problems, err)
+	}
+	v, err := backup.Get(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	r, err := backup.OpenVersion(v)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, err := io.ReadAll(r)
+	r.Close()
+	if err != nil || string(got) != data {
+		t.Fatalf("read %d bytes, %v from the backup, want %d bytes", len(got), err, len(data))
+	}
+}
+
+func TestBackup(t *testing.T) {
+	t.Run("plain", func(t *testing.T) { testBackup(t, 0) })
+	t.Run("chunked and compressed", func(t *testing.T) { testBackup(t, Compress|Chunked) })
+	t.Run("shared", func(t *testing.T) { testBackup(t, Shared) })
+}
+
+// copyDir copies the files below directory src into directory dst, creating directories as needed.
+func copyDir(t *testing.T, src, dst string) {
+	t.Helper()
+	err := filepath.WalkDir(src, func(path string, d iofs.DirEntry, err error) error {
+		if err != nil || d.IsDir() {
+			return err
+		}
+		rel, err := filepath.Rel(src, path)
+		if err != nil {
+			return err
+		}
+		writeFile(t, filepath.Join(dst, rel), readFile(t, path))
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+func testBackupSince(t *testing.T, opts flags.Bits) {
+	fs, src := openTestStore(t, NewFilestore(filepath.Join(t.TempDir(), "store"), opts))
+	a, b := filepath.Join(src, "a.txt"), filepath.Join(src, "b.txt")
+	data := strings.Repeat("abcdefgh", 100000)
+	addFile(t, fs, a, data, "a", "1")
+	full := filepath.Join(t.TempDir(), "full")
+	if err := fs.Backup(full); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := fs.db.Exec("update Versions set date=?;", ToDBDate(time.Now().Add(-time.Hour))); err != nil {
+		t.Fatal(err)
+	}
+	since := time.Now().Add(-30 * time.Minute)
+	addFile(t, fs, a, data+"more", "a", "2")
+	addFile(t, fs, b, "b", "b", "1")
+	inc := filepath.Join(t.TempDir(), "incremental")
+	if err := fs.BackupSince(inc, since); err != nil {
+		t.Fatal(err)
+	}
+	// layer the incremental backup on the full one
+	metadata, err := os.ReadFile(filepath.Join(inc, "metadata.jsonl"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Remove(filepath.Join(inc, "metadata.jsonl")); err != nil {
+		t.Fatal(err)
+	}
+	copyDir(t, inc, full)
+	backup, _ := openTestStore(t, NewFilestore(full, opts))
+	if err := backup.ImportMetadata(bytes.NewReader(metadata)); err != nil {
+		t.Fatal(err)
+	}
+	if report, err := backup.Verify(VerifyOptions{}); err != nil || !report.OK() {
+		t.Fatalf("Verify of the backups = %v, %v", report.Problems, err)
+	}
+	if versions, err := backup.Versions(a, -1); err != nil || len(versions) != 2 {
+		t.Fatalf("Versions of a = %v, %v, want 2 versions", versions, err)
+	}
+	if versions, err := backup.Versions(b, -1); err != nil || len(versions) != 1 {
+		t.Fatalf("Versions of b = %v, %v, want 1 version", versions, err)
+	}
+}
+
+func TestBackupSince(t *testing.T) {
+	t.Run("plain", func(t *testing.T) { testBackupSince(t, 0) })
+	t.Run("chunked and compressed", func(t *testing.T) { testBackupSince(t, Compress|Chunked) })
+}
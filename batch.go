@@ -0,0 +1,48 @@
+package filestore
+
+import (
+	"fmt"
+)
+
+// AddEntry describes a file to be added by AddBatch.
+type AddEntry struct {
+	Path    string // the path of the file to add
+	Info    string // the info string of the new version
+	Version string // the semantic version of the new version
+}
+
+// AddBatch adds versions of all the given files within a single database transaction, which
+// is much faster than calling Add for each of them. Either all files are added or, if an
+// error occurs, none of them. Errors concerning a file record its path and, once known, its
+// checksum in the FilestoreError.
+func (fs *Filestore) AddBatch(entries []AddEntry) (err error) {
+	op := newOp("AddBatch", "")
+	defer op.done(&err)
+	if err := fs.ensureOpen(); err != nil {
+		return err
+	}
+	checksums := make([]string, len(entries))
+	for i, entry := range entries {
+		op.path = entry.Path
+		check, err := fs.checksum(entry.Path, nil)
+		if err != nil {
+			return fmt.Errorf("filestore checksum failed for %s: %w", entry.Path, err)
+		}
+		checksums[i] = check
+	}
+	// errors of the transaction concern no particular file
+	op.path = ""
+	tx, err := fs.begin()
+	if err != nil {
+		return err
+	}
+	for i, entry := range entries {
+		op.path, op.checksum = entry.Path, checksums[i]
+		if err := tx.addVersion(entry.Path, entry.Info, entry.Version, checksums[i]); err != nil {
+			tx.rollback()
+			return err
+		}
+	}
+	op.path, op.checksum = "", ""
+	return tx.commit()
+}
@@ -0,0 +1,70 @@
+package filestore
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestAddBatch(t *testing.T) {
+	fs, src := newTestStore(t)
+	a, b := filepath.Join(src, "a.txt"), filepath.Join(src, "b.txt")
+	writeFile(t, a, "a")
+	writeFile(t, b, "b")
+	if err := fs.AddBatch([]AddEntry{{Path: a, Info: "first", Version: "1"}, {Path: b, Info: "second", Version: "1"}}); err != nil {
+		t.Fatal(err)
+	}
+	for _, path := range []string{a, b} {
+		if !fs.Has(path) {
+			t.Fatalf("%s has not been added", path)
+		}
+	}
+}
+
+func TestAddBatchRecordsFailedPath(t *testing.T) {
+	fs, src := newTestStore(t)
+	a, missing := filepath.Join(src, "a.txt"), filepath.Join(src, "missing.txt")
+	writeFile(t, a, "a")
+	err := fs.AddBatch([]AddEntry{{Path: a}, {Path: missing}})
+	var fe *FilestoreError
+	if !errors.As(err, &fe) || fe.Path != missing {
+		t.Fatalf("AddBatch error = %v, want a FilestoreError for %s", err, missing)
+	}
+	if fs.Has(a) {
+		t.Fatal("a failed batch has added versions")
+	}
+}
+
+func TestAddBatchAtomic(t *testing.T) {
+	fs, src := newTestStore(t)
+	a, b, c := filepath.Join(src, "a.txt"), filepath.Join(src, "b.txt"), filepath.Join(src, "c.txt")
+	writeFile(t, a, "same")
+	writeFile(t, b, "same")
+	writeFile(t, c, "other")
+	// contents are stored once within a batch
+	if err := fs.AddBatch([]AddEntry{{Path: a, Version: "1"}, {Path: b, Version: "1"}}); err != nil {
+		t.Fatal(err)
+	}
+	var contents int
+	if err := fs.db.QueryRow("select count(*) from Files;").Scan(&contents); err != nil || contents != 1 {
+		t.Fatalf("%d contents stored, %v, want 1", contents, err)
+	}
+	// a failed batch leaves neither versions nor contents behind
+	if err := fs.AddBatch([]AddEntry{{Path: c}, {Path: a, Version: "2"}, {Path: filepath.Join(src, "missing.txt")}}); err == nil {
+		t.Fatal("AddBatch with a missing file succeeded")
+	}
+	if fs.Has(c) {
+		t.Fatal("a failed batch has added versions")
+	}
+	if versions, err := fs.Versions(a, -1); err != nil || len(versions) != 1 {
+		t.Fatalf("Versions = %v, %v, want only the version of the first batch", versions, err)
+	}
+	check, err := fs.Checksum(c)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(fs.localPath(filepath.Base(c), check)); !os.IsNotExist(err) {
+		t.Fatalf("the contents of a failed batch remain stored: %v", err)
+	}
+}
@@ -0,0 +1,105 @@
+// Package bench compares the performance of filestore configurations on the machine it runs on,
+// so that codecs, hash algorithms and options can be chosen before a filestore is filled.
+//
+// For example, the following prints how fast each codec is with the options of a filestore:
+//
+//	results, err := bench.Run("/var/lib/store", bench.Codecs(bench.Config{Options: filestore.Shared}), filestore.BenchmarkOptions{})
+//	if err == nil {
+//		bench.Write(os.Stdout, results)
+//	}
+package bench
+
+import (
+	"fmt"
+	"io"
+	"text/tabwriter"
+
+	"github.com/rasteric/filestore"
+	"github.com/rasteric/flags"
+)
+
+// Config is a configuration of a filestore to benchmark.
+type Config struct {
+	Name        string     // the name of the configuration in results, generated if empty
+	Options     flags.Bits // the options of the filestore
+	Compression string     // the codec of the filestore
+	Hash        string     // the hash algorithm of the filestore
+	Key         []byte     // the key of the filestore, required with the Encrypted option
+}
+
+// name returns the name of the configuration, made of its codec and hash algorithm if it has none.
+func (c Config) name() string {
+	if c.Name != "" {
+		return c.Name
+	}
+	compression, hash := c.Compression, c.Hash
+	if compression == "" {
+		compression = "default"
+	}
+	if hash == "" {
+		hash = filestore.HashBlake2b512
+	}
+	return compression + "/" + hash
+}
+
+// Result is the result of benchmarking a configuration.
+type Result struct {
+	Config Config
+	filestore.BenchmarkResult
+}
+
+// Codecs returns a configuration for each codec that is otherwise like base.
+func Codecs(base Config) []Config {
+	var configs []Config
+	for _, compression := range []string{filestore.CompressionNone, filestore.CompressionSnappy, filestore.CompressionLZ4,
+		filestore.CompressionZstd, filestore.CompressionGzip} {
+		c := base
+		c.Name, c.Compression = "", compression
+		configs = append(configs, c)
+	}
+	return configs
+}
+
+// Hashes returns a configuration for each hash algorithm that is otherwise like base.
+func Hashes(base Config) []Config {
+	var configs []Config
+	for _, hash := range []string{filestore.HashBlake2b512, filestore.HashBlake3, filestore.HashSHA256, filestore.HashXXH3} {
+		c := base
+		c.Name, c.Hash = "", hash
+		configs = append(configs, c)
+	}
+	return configs
+}
+
+// Run benchmarks each configuration with SelfBenchmark in a temporary filestore in dir, which
+// should be on the storage the filestore will be kept on, and returns the results in order.
+func Run(dir string, configs []Config, opts filestore.BenchmarkOptions) ([]Result, error) {
+	results := make([]Result, 0, len(configs))
+	for _, c := range configs {
+		fs := filestore.NewFilestore(dir, c.Options)
+		fs.Compression, fs.Hash, fs.Key = c.Compression, c.Hash, c.Key
+		r, err := fs.SelfBenchmark(opts)
+		if err != nil {
+			return results, fmt.Errorf("benchmark of %s failed: %w", c.name(), err)
+		}
+		c.Name = c.name()
+		results = append(results, Result{Config: c, BenchmarkResult: r})
+	}
+	return results, nil
+}
+
+// Write writes the results to w as a table with the throughput of each operation and the
+// storage taken relative to the size of the files.
+func Write(w io.Writer, results []Result) error {
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', tabwriter.AlignRight)
+	fmt.Fprintln(tw, "config\tadd MB/s\tget/s\tsearch/s\trestore MB/s\tstored %\t")
+	for _, r := range results {
+		stored := 0.0
+		if r.Bytes > 0 {
+			stored = 100 * float64(r.StoredBytes) / float64(r.Bytes)
+		}
+		fmt.Fprintf(tw, "%s\t%.1f\t%.0f\t%.0f\t%.1f\t%.1f\t\n", r.Config.Name, r.AddRate()/1e6, r.GetRate(),
+			r.SearchRate(), r.RestoreRate()/1e6, stored)
+	}
+	return tw.Flush()
+}
@@ -0,0 +1,160 @@
+package filestore
+
+import (
+	"fmt"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// BenchmarkOptions are the options of SelfBenchmark.
+type BenchmarkOptions struct {
+	Files    int   // the number of files added, 100 if zero
+	FileSize int64 // the size of each file in bytes, 1 MiB if zero
+}
+
+// BenchmarkResult holds the measurements of SelfBenchmark.
+type BenchmarkResult struct {
+	Files       int           // the number of files added
+	Bytes       int64         // the total size of the files
+	StoredBytes int64         // the number of bytes taken by their blobs and chunks
+	Add         time.Duration // the time taken to add all files
+	Get         time.Duration // the time taken to get the latest version of each file
+	Search      time.Duration // the time taken to search for each file by its info string
+	Restore     time.Duration // the time taken to restore each file
+}
+
+// AddRate returns the number of bytes added per second.
+func (r BenchmarkResult) AddRate() float64 {
+	return rate(float64(r.Bytes), r.Add)
+}
+
+// GetRate returns the number of versions gotten per second.
+func (r BenchmarkResult) GetRate() float64 {
+	return rate(float64(r.Files), r.Get)
+}
+
+// SearchRate returns the number of searches per second.
+func (r BenchmarkResult) SearchRate() float64 {
+	return rate(float64(r.Files), r.Search)
+}
+
+// RestoreRate returns the number of bytes restored per second.
+func (r BenchmarkResult) RestoreRate() float64 {
+	return rate(float64(r.Bytes), r.Restore)
+}
+
+// rate returns n per second if it took d, or 0 if d is zero.
+func rate(n float64, d time.Duration) float64 {
+	if d <= 0 {
+		return 0
+	}
+	return n / d.Seconds()
+}
+
+// SelfBenchmark measures how fast files are added, gotten, searched and restored with the
+// configuration of the filestore on the hardware it is stored on, so that codecs, hash algorithms
+// and options can be compared before committing to them. It creates a temporary filestore in the
+// directory of the filestore with the same options, codec, hash algorithm, keys and tag rules,
+// and removes it when done. The filestore itself is not changed and need not be open. The files
+// added are generated from a fixed seed and are partly compressible, so that the results of
+// different configurations are comparable.
+func (fs *Filestore) SelfBenchmark(opts BenchmarkOptions) (_ BenchmarkResult, err error) {
+	op := newOp("SelfBenchmark", fs.Dir)
+	defer op.done(&err)
+	if opts.Files <= 0 {
+		opts.Files = 100
+	}
+	if opts.FileSize <= 0 {
+		opts.FileSize = 1 << 20
+	}
+	if fs.memory == "" {
+		if err := ensureDirectory(fs.Root(), fs.dirMode()); err != nil {
+			return BenchmarkResult{}, err
+		}
+	}
+	tmp, err := os.MkdirTemp(fs.tempDir(), "bench-")
+	if err != nil {
+		return BenchmarkResult{}, err
+	}
+	defer os.RemoveAll(tmp)
+	src, dst := filepath.Join(tmp, "src"), filepath.Join(tmp, "restore")
+	for _, dir := range []string{src, dst} {
+		if err := os.Mkdir(dir, 0700); err != nil {
+			return BenchmarkResult{}, err
+		}
+	}
+	paths := make([]string, opts.Files)
+	for i := range paths {
+		paths[i] = filepath.Join(src, fmt.Sprintf("file%d.dat", i))
+		if err := os.WriteFile(paths[i], benchmarkData(int64(i), opts.FileSize), 0600); err != nil {
+			return BenchmarkResult{}, err
+		}
+	}
+	bench := &Filestore{Dir: filepath.Join(tmp, "store"), Options: fs.Options &^ (ReadOnly | PruneOnQuota),
+		Hash: fs.Hash, Compression: fs.Compression, Incompressible: fs.Incompressible, SegmentCacheSize: fs.SegmentCacheSize,
+		SigningKey: fs.SigningKey, VerifyKey: fs.VerifyKey, Key: fs.Key, TagRules: fs.TagRules}
+	if err := bench.Open(); err != nil {
+		return BenchmarkResult{}, err
+	}
+	defer bench.Close()
+	result := BenchmarkResult{Files: opts.Files, Bytes: int64(opts.Files) * opts.FileSize}
+	start := time.Now()
+	for i, path := range paths {
+		if err := bench.Add(path, fmt.Sprintf("benchmark file%d", i), "1"); err != nil {
+			return result, err
+		}
+	}
+	result.Add = time.Since(start)
+	versions := make([]FileVersion, len(paths))
+	start = time.Now()
+	for i, path := range paths {
+		if versions[i], err = bench.Get(path); err != nil {
+			return result, err
+		}
+	}
+	result.Get = time.Since(start)
+	start = time.Now()
+	for i := range paths {
+		if _, err := bench.SimpleSearch([]string{fmt.Sprintf("file%d", i)}, 10); err != nil {
+			return result, err
+		}
+	}
+	result.Search = time.Since(start)
+	start = time.Now()
+	for _, v := range versions {
+		if err := bench.Restore(v, dst); err != nil {
+			return result, err
+		}
+	}
+	result.Restore = time.Since(start)
+	stats, err := bench.Stats()
+	if err != nil {
+		return result, err
+	}
+	result.StoredBytes = stats.StoredBytes
+	return result, nil
+}
+
+// benchmarkData returns size bytes generated from seed, alternating between random bytes and
+// repeated text so that the data is partly compressible.
+func benchmarkData(seed, size int64) []byte {
+	r := rand.New(rand.NewSource(seed))
+	text := []byte("the quick brown fox jumps over the lazy dog ")
+	data := make([]byte, size)
+	for i := int64(0); i < size; i += 4096 {
+		block := data[i:]
+		if len(block) > 4096 {
+			block = block[:4096]
+		}
+		if r.Intn(2) == 0 {
+			r.Read(block)
+		} else {
+			for j := range block {
+				block[j] = text[j%len(text)]
+			}
+		}
+	}
+	return data
+}
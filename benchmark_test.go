@@ -0,0 +1,27 @@
+package filestore
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestSelfBenchmark(t *testing.T) {
+	fs := NewFilestore(filepath.Join(t.TempDir(), "store"), Compress|Chunked)
+	result, err := fs.SelfBenchmark(BenchmarkOptions{Files: 10, FileSize: 200000})
+	if err != nil {
+		t.Fatal(err)
+	}
+	// the generated files are partly compressible
+	if result.StoredBytes == 0 || result.StoredBytes >= result.Bytes || result.AddRate() <= 0 {
+		t.Fatalf("SelfBenchmark = %+v, want fewer bytes stored than added", result)
+	}
+	// the temporary filestore is removed
+	entries, err := os.ReadDir(fs.Root())
+	if err != nil && !os.IsNotExist(err) {
+		t.Fatal(err)
+	}
+	if len(entries) != 0 {
+		t.Fatalf("%d entries left in the filestore directory, want none", len(entries))
+	}
+}
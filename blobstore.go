@@ -0,0 +1,334 @@
+package filestore
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+var ErrNotLocal = errors.New("filestore contents are not stored in a local directory")
+
+// BlobStore stores the blobs and chunks holding the contents of a filestore, while the database
+// with the metadata stays in the root directory. Data is stored under keys, which are
+// slash-separated paths in the directory layout of the filestore: "<checksum>/<name>" for blobs
+// and "chunks/<first two digits>/<checksum>" for chunks, followed by the extension of their
+// codec. Implementations must be safe for concurrent use.
+type BlobStore interface {
+	// Put stores the data read from r under key, replacing data stored under it before.
+	Put(key string, r io.Reader) error
+	// Get returns a reader of the data stored under key, which must be closed after use. The error
+	// satisfies errors.Is(err, os.ErrNotExist) if there is no such key.
+	Get(key string) (io.ReadCloser, error)
+	// Delete deletes the data stored under key. Deleting a key that does not exist is no error.
+	Delete(key string) error
+	// Exists returns true if data is stored under key.
+	Exists(key string) (bool, error)
+	// List returns the keys starting with prefix in lexical order.
+	List(prefix string) ([]string, error)
+}
+
+// DirBlobStore is a BlobStore keeping data in files in a directory, whose paths are the keys.
+// It is the layout a filestore uses in its root directory if its Blobs field is nil. Files are
+// written to a temporary name first, so that readers never see partial data.
+type DirBlobStore struct {
+	Dir      string      // the directory of the files
+	DirMode  os.FileMode // permissions of created directories, 0700 if zero
+	FileMode os.FileMode // permissions of created files, default permissions if zero
+}
+
+// Path returns the path of the file of key, which is in the extended-length form on Windows if
+// it is longer than the limit of the Windows API.
+func (s *DirBlobStore) Path(key string) string {
+	return longPath(filepath.Join(s.Dir, filepath.FromSlash(key)))
+}
+
+// Put stores the data read from r in the file of key.
+func (s *DirBlobStore) Put(key string, r io.Reader) error {
+	path := s.Path(key)
+	mode := s.DirMode
+	if mode == 0 {
+		mode = 0700
+	}
+	if err := ensureDirectory(filepath.Dir(path), mode); err != nil {
+		return err
+	}
+	f, err := os.CreateTemp(filepath.Dir(path), ".put-")
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(f, r); err != nil {
+		f.Close()
+		os.Remove(f.Name())
+		return err
+	}
+	if s.FileMode != 0 {
+		if err := f.Chmod(s.FileMode); err != nil {
+			f.Close()
+			os.Remove(f.Name())
+			return err
+		}
+	}
+	if err := f.Close(); err != nil {
+		os.Remove(f.Name())
+		return err
+	}
+	if err := os.Rename(f.Name(), path); err != nil {
+		os.Remove(f.Name())
+		return err
+	}
+	return nil
+}
+
+// Get opens the file of key.
+func (s *DirBlobStore) Get(key string) (io.ReadCloser, error) {
+	return os.Open(s.Path(key))
+}
+
+// Delete removes the file of key.
+func (s *DirBlobStore) Delete(key string) error {
+	if err := os.Remove(s.Path(key)); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	return nil
+}
+
+// Exists returns true if there is a regular file for key.
+func (s *DirBlobStore) Exists(key string) (bool, error) {
+	info, err := os.Stat(s.Path(key))
+	if os.IsNotExist(err) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	return info.Mode().IsRegular(), nil
+}
+
+// List returns the keys of the regular files whose keys start with prefix. Only the directory
+// containing the prefix is walked.
+func (s *DirBlobStore) List(prefix string) ([]string, error) {
+	root := s.Path(prefix[:strings.LastIndex(prefix, "/")+1])
+	var keys []string
+	err := filepath.WalkDir(root, func(path string, entry os.DirEntry, err error) error {
+		if err != nil {
+			if os.IsNotExist(err) && path == root {
+				return filepath.SkipDir
+			}
+			return err
+		}
+		if !entry.Type().IsRegular() || strings.HasPrefix(entry.Name(), ".put-") {
+			return nil
+		}
+		rel, err := filepath.Rel(shortPath(s.Dir), shortPath(path))
+		if err != nil {
+			return err
+		}
+		if key := filepath.ToSlash(rel); strings.HasPrefix(key, prefix) {
+			keys = append(keys, key)
+		}
+		return nil
+	})
+	return keys, err
+}
+
+// localBlobs returns true if contents are stored in files in the root directory, which can be
+// linked, cloned and read at random.
+func (fs *Filestore) localBlobs() bool {
+	return fs.Blobs == nil
+}
+
+// blobStore returns the store of the contents of the filestore.
+func (fs *Filestore) blobStore() BlobStore {
+	if fs.Blobs != nil {
+		return fs.Blobs
+	}
+	return &DirBlobStore{Dir: fs.Root(), DirMode: fs.dirMode(), FileMode: fs.fileMode()}
+}
+
+// blobKey returns the key of the blob or chunk at path, a path in the root directory as returned
+// by blobFile and chunkPath.
+func (fs *Filestore) blobKey(path string) string {
+	rel, err := filepath.Rel(shortPath(fs.Root()), shortPath(path))
+	if err != nil {
+		return filepath.ToSlash(path)
+	}
+	return filepath.ToSlash(rel)
+}
+
+// openStored opens the blob or chunk at path for reading.
+func (fs *Filestore) openStored(path string) (io.ReadCloser, error) {
+	if fs.localBlobs() {
+		return os.Open(path)
+	}
+	return fs.Blobs.Get(fs.blobKey(path))
+}
+
+// storedExists returns true if the blob or chunk at path exists.
+func (fs *Filestore) storedExists(path string) (bool, error) {
+	return fs.blobStore().Exists(fs.blobKey(path))
+}
+
+// putFile stores the file at src as the blob at dst with codec c and returns the stored size.
+// Local blobs are cloned or copied preserving holes, otherwise the encoded data is staged in a
+// temporary file. Reading src is recorded in tracker, which may be nil.
+func (fs *Filestore) putFile(src, dst string, c codec, tracker *progressTracker) (int64, error) {
+	if fs.localBlobs() {
+		if err := ensureDirectory(filepath.Dir(dst), fs.dirMode()); err != nil {
+			return 0, err
+		}
+		if err := copyFile(src, dst, c, false, fs.fileMode(), tracker); err != nil {
+			os.Remove(dst)
+			return 0, err
+		}
+		info, err := os.Stat(dst)
+		if err != nil {
+			return 0, err
+		}
+		return info.Size(), nil
+	}
+	tmp, err := os.MkdirTemp(fs.tempDir(), "import-")
+	if err != nil {
+		return 0, err
+	}
+	defer os.RemoveAll(tmp)
+	staged := filepath.Join(tmp, "blob")
+	if err := copyFile(src, staged, c, false, 0, tracker); err != nil {
+		return 0, err
+	}
+	f, err := os.Open(staged)
+	if err != nil {
+		return 0, err
+	}
+	defer f.Close()
+	info, err := f.Stat()
+	if err != nil {
+		return 0, err
+	}
+	return info.Size(), fs.Blobs.Put(fs.blobKey(dst), f)
+}
+
+// putData stores data as the chunk at dst.
+func (fs *Filestore) putData(dst string, data []byte) error {
+	return fs.blobStore().Put(fs.blobKey(dst), bytes.NewReader(data))
+}
+
+// restoreStored writes the decoded contents of the blob at src stored with codec c to the file
+// dst, which gets the permissions perm if it is not zero. Local blobs are cloned if possible.
+// Reading src is recorded in tracker, which may be nil.
+func (fs *Filestore) restoreStored(src, dst string, c codec, perm os.FileMode, tracker *progressTracker) error {
+	if fs.localBlobs() {
+		return copyFile(src, dst, c, true, perm, tracker)
+	}
+	r, err := fs.Blobs.Get(fs.blobKey(src))
+	if err != nil {
+		return err
+	}
+	defer r.Close()
+	var dec io.Reader = tracker.reader(r)
+	if !c.plain() {
+		cr, err := c.reader(dec)
+		if err != nil {
+			return err
+		}
+		defer cr.Close()
+		dec = cr
+	}
+	f, err := os.Create(dst)
+	if err != nil {
+		return err
+	}
+	if perm != 0 {
+		if err := f.Chmod(perm); err != nil {
+			f.Close()
+			return err
+		}
+	}
+	if _, err := io.Copy(f, dec); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+// seekableStored opens the blob at path for random access. Blobs that are not local are copied
+// to a temporary file, whose path is returned so that it can be removed after use.
+func (fs *Filestore) seekableStored(path string) (f *os.File, temp string, err error) {
+	if fs.localBlobs() {
+		f, err := os.Open(path)
+		return f, "", err
+	}
+	r, err := fs.Blobs.Get(fs.blobKey(path))
+	if err != nil {
+		return nil, "", err
+	}
+	defer r.Close()
+	if f, err = os.CreateTemp(fs.tempDir(), "fetch-"); err != nil {
+		return nil, "", err
+	}
+	if _, err := io.Copy(f, r); err != nil {
+		f.Close()
+		os.Remove(f.Name())
+		return nil, "", err
+	}
+	return f, f.Name(), nil
+}
+
+// listStored returns the names of the entries directly in the directory dir of the root
+// directory, which are the names of files and subdirectories of stored keys.
+func (fs *Filestore) listStored(dir string) ([]string, error) {
+	if fs.localBlobs() {
+		entries, err := os.ReadDir(dir)
+		if err != nil {
+			return nil, err
+		}
+		names := make([]string, len(entries))
+		for i, entry := range entries {
+			names[i] = entry.Name()
+		}
+		return names, nil
+	}
+	prefix := fs.blobKey(dir) + "/"
+	if prefix == "./" {
+		prefix = ""
+	}
+	keys, err := fs.Blobs.List(prefix)
+	if err != nil {
+		return nil, err
+	}
+	var names []string
+	seen := make(map[string]bool)
+	for _, key := range keys {
+		name := strings.SplitN(strings.TrimPrefix(key, prefix), "/", 2)[0]
+		if !seen[name] {
+			seen[name] = true
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	return names, nil
+}
+
+// removeStored removes the blob, chunk or blob directory at path. Paths outside the blob store,
+// such as stable paths, are removed from the root directory.
+func (fs *Filestore) removeStored(path string) {
+	if fs.localBlobs() {
+		os.RemoveAll(path)
+		return
+	}
+	key := fs.blobKey(path)
+	switch {
+	case strings.HasPrefix(key, stableDir+"/") || strings.HasPrefix(key, "../"):
+		os.RemoveAll(path)
+	case isHex(key):
+		keys, _ := fs.Blobs.List(key + "/")
+		for _, k := range keys {
+			fs.Blobs.Delete(k)
+		}
+	default:
+		fs.Blobs.Delete(key)
+	}
+}
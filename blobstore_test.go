@@ -0,0 +1,186 @@
+package filestore
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/rasteric/flags"
+)
+
+// memBlobs is a BlobStore that keeps the blobs in memory.
+type memBlobs struct {
+	mu   sync.Mutex
+	data map[string][]byte
+}
+
+func (m *memBlobs) Put(key string, r io.Reader) error {
+	b, err := io.ReadAll(r)
+	if err != nil {
+		return err
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.data[key] = b
+	return nil
+}
+
+func (m *memBlobs) Get(key string) (io.ReadCloser, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	b, ok := m.data[key]
+	if !ok {
+		return nil, &os.PathError{Op: "get", Path: key, Err: os.ErrNotExist}
+	}
+	return io.NopCloser(bytes.NewReader(b)), nil
+}
+
+func (m *memBlobs) Delete(key string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	delete(m.data, key)
+	return nil
+}
+
+func (m *memBlobs) Exists(key string) (bool, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	_, ok := m.data[key]
+	return ok, nil
+}
+
+func (m *memBlobs) List(prefix string) ([]string, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	var keys []string
+	for k := range m.data {
+		if strings.HasPrefix(k, prefix) {
+			keys = append(keys, k)
+		}
+	}
+	sort.Strings(keys)
+	return keys, nil
+}
+
+func testBlobStore(t *testing.T, opts flags.Bits) {
+	blobs := &memBlobs{data: make(map[string][]byte)}
+	fs := NewFilestore(filepath.Join(t.TempDir(), "store"), opts)
+	fs.Blobs = blobs
+	fs, src := openTestStore(t, fs)
+	path := filepath.Join(src, "a.txt")
+	data := strings.Repeat("hello world ", 50000)
+	v := addFile(t, fs, path, data, "a", "1")
+	if len(blobs.data) == 0 {
+		t.Fatal("no blobs stored in the blob store")
+	}
+	for key := range blobs.data {
+		if strings.Contains(key, `\`) || strings.HasPrefix(key, "/") || strings.HasPrefix(key, ".") {
+			t.Fatalf("blob key %q, want a relative slash-separated key", key)
+		}
+	}
+	entries, err := os.ReadDir(fs.Root())
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, e := range entries {
+		if isHex(e.Name()) || e.Name() == "chunks" {
+			t.Fatalf("blob %s stored in the root directory", e.Name())
+		}
+	}
+	dst := t.TempDir()
+	if err := fs.Restore(v, dst); err != nil {
+		t.Fatal(err)
+	}
+	if got := readFile(t, filepath.Join(dst, "a.txt")); got != data {
+		t.Fatalf("restored %d bytes, want %d", len(got), len(data))
+	}
+	r, err := fs.OpenSeekable(v)
+	if err != nil {
+		t.Fatal(err)
+	}
+	buf := make([]byte, 5)
+	_, err = r.ReadAt(buf, 12)
+	r.Close()
+	if err != nil || string(buf) != "hello" {
+		t.Fatalf("ReadAt = %q, %v, want %q", buf, err, "hello")
+	}
+	if report, err := fs.Verify(VerifyOptions{}); err != nil || !report.OK() {
+		t.Fatalf("Verify = %v, %v", report.Problems, err)
+	}
+	if _, err := fs.Export(v.Checksum, time.Minute); !errors.Is(err, ErrNotLocal) {
+		t.Fatalf("Export = %v, want ErrNotLocal", err)
+	}
+	// backups are local filestores
+	backup := filepath.Join(t.TempDir(), "backup")
+	if err := fs.Backup(backup); err != nil {
+		t.Fatal(err)
+	}
+	restored, _ := openTestStore(t, NewFilestore(backup, opts))
+	rv, err := restored.Get(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var w bytes.Buffer
+	if err := restored.RestoreTo(rv, &w); err != nil || w.String() != data {
+		t.Fatalf("RestoreTo from the backup = %d bytes, %v, want %d bytes", w.Len(), err, len(data))
+	}
+	// orphans in the blob store are found
+	if err := blobs.Put("abcdef/x.bin", strings.NewReader("x")); err != nil {
+		t.Fatal(err)
+	}
+	if report, err := fs.Verify(VerifyOptions{}); err != nil || len(report.Problems) != 1 {
+		t.Fatalf("Verify = %v, %v, want the orphan", report.Problems, err)
+	}
+	if err := blobs.Delete("abcdef/x.bin"); err != nil {
+		t.Fatal(err)
+	}
+	if err := fs.DeleteVersion(v); err != nil {
+		t.Fatal(err)
+	}
+	if len(blobs.data) != 0 {
+		t.Fatalf("%d blobs left after deleting the only version", len(blobs.data))
+	}
+}
+
+func TestBlobStore(t *testing.T) {
+	t.Run("plain", func(t *testing.T) { testBlobStore(t, 0) })
+	t.Run("compressed", func(t *testing.T) { testBlobStore(t, Compress) })
+	t.Run("chunked", func(t *testing.T) { testBlobStore(t, Chunked|Compress) })
+}
+
+func TestDirBlobStore(t *testing.T) {
+	s := &DirBlobStore{Dir: t.TempDir()}
+	for key, data := range map[string]string{"ab/c.txt": "1", "ab/d.txt": "2", "chunks/00/e": "3"} {
+		if err := s.Put(key, strings.NewReader(data)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if keys, err := s.List("ab"); err != nil || len(keys) != 2 {
+		t.Fatalf("List(%q) = %v, %v, want 2 keys", "ab", keys, err)
+	}
+	if keys, err := s.List(""); err != nil || len(keys) != 3 {
+		t.Fatalf("List(%q) = %v, %v, want 3 keys", "", keys, err)
+	}
+	if keys, err := s.List("zz/"); err != nil || len(keys) != 0 {
+		t.Fatalf("List(%q) = %v, %v, want no keys", "zz/", keys, err)
+	}
+	if ok, err := s.Exists("ab/c.txt"); err != nil || !ok {
+		t.Fatalf("Exists = %v, %v, want true", ok, err)
+	}
+	// deleting is idempotent
+	for i := 0; i < 2; i++ {
+		if err := s.Delete("ab/c.txt"); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if ok, err := s.Exists("ab/c.txt"); err != nil || ok {
+		t.Fatalf("Exists = %v, %v after Delete, want false", ok, err)
+	}
+}
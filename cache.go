@@ -0,0 +1,135 @@
+package filestore
+
+import (
+	"container/list"
+	"encoding/hex"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+)
+
+// blobCache keeps decompressed copies of blobs in a directory, named by their checksum, and
+// evicts the least recently used copies when the total size exceeds a budget. The order of use
+// survives reopening the cache because it is stored in the modification times of the copies.
+type blobCache struct {
+	dir     string                   // the cache directory
+	size    int64                    // maximum total size in bytes
+	used    int64                    // current total size in bytes
+	lru     *list.List               // cache entries, most recently used first
+	entries map[string]*list.Element // cache entries by checksum
+	mutex   sync.Mutex
+}
+
+// cacheEntry is an element of the LRU list of a blobCache.
+type cacheEntry struct {
+	checksum string
+	size     int64
+}
+
+// openBlobCache opens the cache in directory dir, creating it with permissions perm if
+// necessary, and registers the copies already in it.
+func openBlobCache(dir string, size int64, perm os.FileMode) (*blobCache, error) {
+	if err := ensureDirectory(dir, perm); err != nil {
+		return nil, err
+	}
+	c := &blobCache{dir: dir, size: size, lru: list.New(), entries: make(map[string]*list.Element)}
+	files, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+	infos := make([]os.FileInfo, 0, len(files))
+	for _, file := range files {
+		if _, err := hex.DecodeString(file.Name()); err != nil || !file.Type().IsRegular() {
+			continue
+		}
+		info, err := file.Info()
+		if err != nil {
+			continue
+		}
+		infos = append(infos, info)
+	}
+	sort.Slice(infos, func(i, j int) bool {
+		return infos[i].ModTime().After(infos[j].ModTime())
+	})
+	for _, info := range infos {
+		c.entries[info.Name()] = c.lru.PushBack(&cacheEntry{checksum: info.Name(), size: info.Size()})
+		c.used += info.Size()
+	}
+	c.evict(0)
+	return c, nil
+}
+
+// path returns the path of the cached copy of the blob with the given checksum.
+func (c *blobCache) path(checksum string) string {
+	return filepath.Join(c.dir, checksum)
+}
+
+// lookup returns the path of the cached copy of the blob with the given checksum and true,
+// or false if there is no such copy.
+func (c *blobCache) lookup(checksum string) (string, bool) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	elem, ok := c.entries[checksum]
+	if !ok {
+		return "", false
+	}
+	c.touch(elem)
+	return c.path(checksum), true
+}
+
+// get returns the path of the cached copy of the blob with the given checksum and true. If there
+// is no copy yet, it is created by calling fill with the destination path. False is returned if
+// the copy could not be created or is too large for the cache.
+func (c *blobCache) get(checksum string, fill func(dst string) error) (string, bool) {
+	if path, ok := c.lookup(checksum); ok {
+		return path, true
+	}
+	tmp, err := os.CreateTemp(c.dir, "fill-*")
+	if err != nil {
+		return "", false
+	}
+	tmp.Close()
+	defer os.Remove(tmp.Name())
+	if err := fill(tmp.Name()); err != nil {
+		return "", false
+	}
+	info, err := os.Stat(tmp.Name())
+	if err != nil || info.Size() > c.size {
+		return "", false
+	}
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	if elem, ok := c.entries[checksum]; ok {
+		c.touch(elem)
+		return c.path(checksum), true
+	}
+	c.evict(info.Size())
+	if err := os.Rename(tmp.Name(), c.path(checksum)); err != nil {
+		return "", false
+	}
+	c.entries[checksum] = c.lru.PushFront(&cacheEntry{checksum: checksum, size: info.Size()})
+	c.used += info.Size()
+	return c.path(checksum), true
+}
+
+// touch marks the entry as most recently used. The caller must hold the mutex.
+func (c *blobCache) touch(elem *list.Element) {
+	c.lru.MoveToFront(elem)
+	now := time.Now()
+	os.Chtimes(c.path(elem.Value.(*cacheEntry).checksum), now, now)
+}
+
+// evict removes least recently used copies until n more bytes fit into the cache. The caller
+// must hold the mutex.
+func (c *blobCache) evict(n int64) {
+	for c.used+n > c.size && c.lru.Len() > 0 {
+		elem := c.lru.Back()
+		entry := elem.Value.(*cacheEntry)
+		os.Remove(c.path(entry.checksum))
+		c.lru.Remove(elem)
+		delete(c.entries, entry.checksum)
+		c.used -= entry.size
+	}
+}
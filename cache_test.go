@@ -0,0 +1,48 @@
+package filestore
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestCache(t *testing.T) {
+	dir := t.TempDir()
+	fs := NewFilestore(filepath.Join(dir, "store"), Compress)
+	fs.CacheDir = filepath.Join(dir, "cache")
+	fs.CacheSize = 10
+	fs, src := openTestStore(t, fs)
+	var paths []string
+	for _, data := range []string{"aaaa", "bbbb", "cccc"} {
+		path := filepath.Join(src, data)
+		addFile(t, fs, path, data, "", "1")
+		paths = append(paths, path)
+	}
+	// Get returns decompressed copies from the cache
+	for _, path := range paths {
+		v, err := fs.Get(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := readFile(t, v.Local); got != filepath.Base(path) {
+			t.Fatalf("cached copy of %s holds %q", path, got)
+		}
+	}
+	// the least recently used copy is evicted to keep within the size of the cache
+	entries, err := os.ReadDir(fs.CacheDir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 2 {
+		t.Fatalf("cache holds %d copies, want 2", len(entries))
+	}
+	// copies are shared by versions with the same contents
+	v := addFile(t, fs, filepath.Join(src, "other"), "cccc", "", "1")
+	dst := t.TempDir()
+	if err := fs.Restore(v, dst); err != nil {
+		t.Fatal(err)
+	}
+	if got := readFile(t, filepath.Join(dst, "other")); got != "cccc" {
+		t.Fatalf("restored %q, want %q", got, "cccc")
+	}
+}
@@ -0,0 +1,419 @@
+package filestore
+
+import (
+	"bytes"
+	"database/sql"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+
+	"golang.org/x/crypto/blake2b"
+)
+
+// sizes of content-defined chunks in bytes
+const (
+	chunkMin = 16 << 10  // no cut point is searched before this size
+	chunkAvg = 64 << 10  // the normal size, up to which cut points are harder to find
+	chunkMax = 256 << 10 // chunks are cut at this size at the latest
+)
+
+// masks of the gear hash for finding cut points before and after the normal size, which select
+// two bits more and two bits less than needed for the average size (normalized chunking)
+const (
+	chunkMaskS uint64 = 0xffffc00000000000 // 18 bits
+	chunkMaskL uint64 = 0xfffc000000000000 // 14 bits
+)
+
+// gearTable holds the random values of the gear hash for each byte. It is generated with
+// splitmix64 from a fixed seed and must never change, or stored files would no longer share
+// chunks with new ones.
+var gearTable = func() [256]uint64 {
+	var table [256]uint64
+	state := uint64(0x6a09e667f3bcc908)
+	for i := range table {
+		state += 0x9e3779b97f4a7c15
+		z := state
+		z = (z ^ (z >> 30)) * 0xbf58476d1ce4e5b9
+		z = (z ^ (z >> 27)) * 0x94d049bb133111eb
+		table[i] = z ^ (z >> 31)
+	}
+	return table
+}()
+
+// chunkCut returns the length of the first chunk of data with the FastCDC algorithm.
+func chunkCut(data []byte) int {
+	n := len(data)
+	if n <= chunkMin {
+		return n
+	}
+	if n > chunkMax {
+		n = chunkMax
+	}
+	normal := chunkAvg
+	if n < normal {
+		normal = n
+	}
+	var fp uint64
+	i := chunkMin
+	for ; i < normal; i++ {
+		fp = (fp << 1) + gearTable[data[i]]
+		if fp&chunkMaskS == 0 {
+			return i + 1
+		}
+	}
+	for ; i < n; i++ {
+		fp = (fp << 1) + gearTable[data[i]]
+		if fp&chunkMaskL == 0 {
+			return i + 1
+		}
+	}
+	return n
+}
+
+// chunker splits the data of a reader into content-defined chunks.
+type chunker struct {
+	r          io.Reader
+	buf        []byte
+	start, end int  // the unchunked data in buf
+	eof        bool // true if r has been read completely
+}
+
+// newChunker returns a chunker reading from r.
+func newChunker(r io.Reader) *chunker {
+	return &chunker{r: r, buf: make([]byte, chunkMax)}
+}
+
+// next returns the next chunk, which is only valid until the following call, or io.EOF if all
+// data has been chunked.
+func (c *chunker) next() ([]byte, error) {
+	if c.end-c.start < chunkMax && !c.eof {
+		copy(c.buf, c.buf[c.start:c.end])
+		c.end -= c.start
+		c.start = 0
+		n, err := io.ReadFull(c.r, c.buf[c.end:])
+		c.end += n
+		if err == io.EOF || err == io.ErrUnexpectedEOF {
+			c.eof = true
+		} else if err != nil {
+			return nil, err
+		}
+	}
+	if c.start == c.end {
+		return nil, io.EOF
+	}
+	n := chunkCut(c.buf[c.start:c.end])
+	chunk := c.buf[c.start : c.start+n]
+	c.start += n
+	return chunk, nil
+}
+
+// chunkRef refers to a chunk of the contents of a file.
+type chunkRef struct {
+	checksum string // the checksum of the chunk
+	offset   int64  // the offset of the chunk in the contents
+	size     int64  // the size of the chunk
+	codec    codec  // the codec of the chunk file
+}
+
+// chunkPath returns the path of the chunk with the given checksum compressed with codec c.
+// Chunks are stored in subdirectories of the chunks directory named by the first two digits of
+// their checksums.
+func (fs *Filestore) chunkPath(checksum string, c codec) string {
+	return longPath(filepath.Join(fs.Root()+"chunks", checksum[:2], checksum) + c.ext)
+}
+
+// storeChunks splits the file at path into chunks and stores those not stored yet compressed
+// with c, and encrypted with their own data keys if the filestore is encrypted, within tx if it
+// is not nil. It returns the IDs of the chunks in order, the size of the file, the number of
+// bytes newly stored and the paths of the chunk files created. Reading the file is recorded in
+// tracker, which may be nil.
+func (fs *Filestore) storeChunks(tx *sql.Tx, path string, c codec, tracker *progressTracker) (ids []int64, size, stored int64, created []string, err error) {
+	var q querier = fs.db
+	if tx != nil {
+		q = tx
+	}
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, 0, 0, nil, err
+	}
+	defer f.Close()
+	chunker := newChunker(tracker.reader(f))
+	for {
+		data, err := chunker.next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, 0, 0, created, err
+		}
+		sum := blake2b.Sum256(data)
+		checksum := hex.EncodeToString(sum[:])
+		size += int64(len(data))
+		var id int64
+		err = q.QueryRow("select chunk_id from Chunks where checksum=?;", checksum).Scan(&id)
+		if err == nil {
+			ids = append(ids, id)
+			continue
+		}
+		if err != sql.ErrNoRows {
+			return nil, 0, 0, created, fs.dbError(err)
+		}
+		cc, err := fs.sealCodec(c)
+		if err != nil {
+			return nil, 0, 0, created, err
+		}
+		dst := fs.chunkPath(checksum, cc)
+		n, err := fs.writeChunk(dst, data, cc)
+		if err != nil {
+			fs.removeStored(dst)
+			return nil, 0, 0, created, fmt.Errorf("filestore failed to store chunk %s: %w", dst, err)
+		}
+		created = append(created, dst)
+		stored += n
+		result, err := q.Exec("insert into Chunks(checksum, codec, sealed_key, size, stored) values(?, ?, ?, ?, ?);",
+			checksum, cc.name, cc.sealedKey, len(data), n)
+		if err != nil {
+			return nil, 0, 0, created, fs.dbError(err)
+		}
+		if id, err = result.LastInsertId(); err != nil {
+			return nil, 0, 0, created, fs.dbError(err)
+		}
+		ids = append(ids, id)
+	}
+	return ids, size, stored, created, nil
+}
+
+// writeChunk stores the data of a chunk as the chunk at dst with codec c and returns its stored
+// size.
+func (fs *Filestore) writeChunk(dst string, data []byte, c codec) (int64, error) {
+	var buf bytes.Buffer
+	w, err := c.writer(&buf)
+	if err != nil {
+		return 0, err
+	}
+	if _, err := w.Write(data); err != nil {
+		w.Close()
+		return 0, err
+	}
+	if err := w.Close(); err != nil {
+		return 0, err
+	}
+	if err := fs.putData(dst, buf.Bytes()); err != nil {
+		return 0, err
+	}
+	return int64(buf.Len()), nil
+}
+
+// insertFileChunks records the chunks of the file with the given ID, within tx if it is not nil.
+func (fs *Filestore) insertFileChunks(tx *sql.Tx, fileID int64, ids []int64) error {
+	var q querier = fs.db
+	if tx != nil {
+		q = tx
+	}
+	for seq, id := range ids {
+		if _, err := q.Exec("insert into FileChunks(file, seq, chunk) values(?, ?, ?);", fileID, seq, id); err != nil {
+			return fs.dbError(err)
+		}
+	}
+	return nil
+}
+
+// chunkList returns the chunks of the contents with the given checksum in order, or nil if the
+// contents are not stored in chunks.
+func (fs *Filestore) chunkList(q querier, checksum string) ([]chunkRef, error) {
+	var chunked bool
+	err := q.QueryRow("select chunked from Files where checksum=?;", checksum).Scan(&chunked)
+	if err == sql.ErrNoRows || (err == nil && !chunked) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fs.dbError(err)
+	}
+	return fs.chunkRefs(q, checksum, true)
+}
+
+// chunkRefs returns the chunks of the contents with the given checksum in order. The codecs of
+// encrypted chunks decrypt them if unseal is true. Otherwise, their data keys are not opened,
+// which suffices to determine the paths of the chunks.
+func (fs *Filestore) chunkRefs(q querier, checksum string, unseal bool) ([]chunkRef, error) {
+	rows, err := q.Query("select Chunks.checksum, Chunks.codec, Chunks.sealed_key, Chunks.size from FileChunks inner join Chunks on FileChunks.chunk=Chunks.chunk_id inner join Files on FileChunks.file=Files.file_id where Files.checksum=? order by seq;", checksum)
+	if err != nil {
+		return nil, fs.dbError(err)
+	}
+	defer rows.Close()
+	chunks := make([]chunkRef, 0)
+	var offset int64
+	for rows.Next() {
+		ref := chunkRef{offset: offset}
+		var codecName string
+		var sealed []byte
+		if err := rows.Scan(&ref.checksum, &codecName, &sealed, &ref.size); err != nil {
+			return nil, fs.dbError(err)
+		}
+		if ref.codec, err = newCodec(codecName); err != nil {
+			return nil, err
+		}
+		if unseal {
+			if ref.codec, err = fs.unsealCodec(ref.codec, sealed); err != nil {
+				return nil, err
+			}
+		}
+		chunks = append(chunks, ref)
+		offset += ref.size
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fs.dbError(err)
+	}
+	return chunks, nil
+}
+
+// readChunk returns the data of a chunk, which is kept in the segment cache.
+func (fs *Filestore) readChunk(ref chunkRef) ([]byte, error) {
+	cache := fs.segmentCache()
+	key := segmentKey{checksum: ref.checksum}
+	if data, ok := cache.get(key); ok {
+		return data, nil
+	}
+	f, err := fs.openStored(fs.chunkPath(ref.checksum, ref.codec))
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	r, err := ref.codec.reader(f)
+	if err != nil {
+		return nil, err
+	}
+	defer r.Close()
+	data := make([]byte, ref.size)
+	if _, err := io.ReadFull(r, data); err != nil {
+		return nil, err
+	}
+	cache.put(key, data)
+	return data, nil
+}
+
+// deleteChunks deletes the chunk list of the file with the given ID within tx, as well as the
+// chunks no other file uses. The paths of the files of these chunks are returned, so they can
+// be removed after a successful commit.
+func (fs *Filestore) deleteChunks(tx *sql.Tx, fileID int64) ([]string, error) {
+	rows, err := tx.Query("select chunk_id, checksum, codec from Chunks where chunk_id in (select chunk from FileChunks where file=?1) and not exists (select 1 from FileChunks where chunk=chunk_id and file<>?1);", fileID)
+	if err != nil {
+		return nil, fs.dbError(err)
+	}
+	var ids []int64
+	var paths []string
+	for rows.Next() {
+		var id int64
+		var checksum, codecName string
+		if err := rows.Scan(&id, &checksum, &codecName); err != nil {
+			rows.Close()
+			return nil, fs.dbError(err)
+		}
+		c, err := newCodec(codecName)
+		if err != nil {
+			rows.Close()
+			return nil, err
+		}
+		ids = append(ids, id)
+		paths = append(paths, fs.chunkPath(checksum, c))
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, fs.dbError(err)
+	}
+	if _, err := tx.Exec("delete from FileChunks where file=?;", fileID); err != nil {
+		return nil, fs.dbError(err)
+	}
+	for _, id := range ids {
+		if _, err := tx.Exec("delete from Chunks where chunk_id=?;", id); err != nil {
+			return nil, fs.dbError(err)
+		}
+	}
+	return paths, nil
+}
+
+// chunkReader reads the contents of a file stored in chunks.
+type chunkReader struct {
+	fs     *Filestore
+	chunks []chunkRef // the chunks not read yet
+	data   []byte     // the unread data of the current chunk
+}
+
+// Read reads the next bytes of the contents.
+func (r *chunkReader) Read(p []byte) (int, error) {
+	for len(r.data) == 0 {
+		if len(r.chunks) == 0 {
+			return 0, io.EOF
+		}
+		data, err := r.fs.readChunk(r.chunks[0])
+		if err != nil {
+			return 0, err
+		}
+		r.data, r.chunks = data, r.chunks[1:]
+	}
+	n := copy(p, r.data)
+	r.data = r.data[n:]
+	return n, nil
+}
+
+// Close does nothing, since chunks are read completely when needed.
+func (r *chunkReader) Close() error {
+	return nil
+}
+
+// readChunksAt reads len(p) bytes at offset off of contents stored in chunks.
+func (fs *Filestore) readChunksAt(chunks []chunkRef, p []byte, off int64) (int, error) {
+	// find the chunk containing off
+	i := sort.Search(len(chunks), func(i int) bool { return chunks[i].offset+chunks[i].size > off })
+	n := 0
+	for n < len(p) {
+		if i >= len(chunks) {
+			return n, io.EOF
+		}
+		data, err := fs.readChunk(chunks[i])
+		if err != nil {
+			return n, err
+		}
+		m := copy(p[n:], data[off-chunks[i].offset:])
+		n += m
+		off += int64(m)
+		i++
+	}
+	return n, nil
+}
+
+// copyContents writes the contents of version to the file dst, which gets the permissions perm
+// if it is not zero. Writing is recorded in tracker, which may be nil.
+func (fs *Filestore) copyContents(version FileVersion, dst string, perm os.FileMode, tracker *progressTracker) error {
+	chunks, err := fs.chunkList(fs.db, version.Checksum)
+	if err != nil {
+		return err
+	}
+	if chunks == nil {
+		c, err := fs.blobCodec(fs.db, version.Checksum)
+		if err != nil {
+			return err
+		}
+		return fs.restoreStored(fs.blobFile(version.Name, version.Checksum, c), dst, c, perm, tracker)
+	}
+	var size int64
+	if len(chunks) > 0 {
+		size = chunks[len(chunks)-1].offset + chunks[len(chunks)-1].size
+	}
+	tracker.setTotal(size)
+	f, err := os.Create(dst)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	if perm != 0 {
+		if err := f.Chmod(perm); err != nil {
+			return err
+		}
+	}
+	_, err = io.Copy(f, tracker.reader(&chunkReader{fs: fs, chunks: chunks}))
+	return err
+}
@@ -0,0 +1,122 @@
+package filestore
+
+import (
+	"bytes"
+	"io"
+	iofs "io/fs"
+	"math/rand"
+	"path/filepath"
+	"testing"
+
+	"github.com/rasteric/flags"
+)
+
+// countChunks returns the number of chunks in the database and the number of chunk files.
+func countChunks(t *testing.T, fs *Filestore) (rows, files int) {
+	t.Helper()
+	if err := fs.db.QueryRow("select count(*) from Chunks;").Scan(&rows); err != nil {
+		t.Fatal(err)
+	}
+	paths, err := filepath.Glob(filepath.Join(fs.Root(), "chunks", "*", "*"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return rows, len(paths)
+}
+
+func testChunked(t *testing.T, opts flags.Bits) {
+	fs, src := openTestStore(t, NewFilestore(filepath.Join(t.TempDir(), "store"), Chunked|opts))
+	data := make([]byte, 3<<20)
+	rand.New(rand.NewSource(2)).Read(data)
+	// b shares most contents with a but has bytes inserted near the start
+	other := append(append(append([]byte{}, data[:1000]...), "inserted"...), data[1000:]...)
+	a, b := filepath.Join(src, "a.bin"), filepath.Join(src, "b.bin")
+	va := addFile(t, fs, a, string(data), "", "1")
+	vb := addFile(t, fs, b, string(other), "", "1")
+	var size, stored int64
+	if err := fs.db.QueryRow("select size, stored from Files where checksum=?;", vb.Checksum).Scan(&size, &stored); err != nil {
+		t.Fatal(err)
+	}
+	if size != int64(len(other)) || stored > 600<<10 {
+		t.Fatalf("stored %d bytes of %d, want only the chunks not shared with a", stored, size)
+	}
+	var buf bytes.Buffer
+	if err := fs.RestoreTo(vb, &buf); err != nil || !bytes.Equal(buf.Bytes(), other) {
+		t.Fatalf("RestoreTo restored %d bytes, %v, want the contents of b", buf.Len(), err)
+	}
+	r, err := fs.OpenSeekable(va)
+	if err != nil {
+		t.Fatal(err)
+	}
+	p := make([]byte, 100000)
+	if n, err := r.ReadAt(p, 1<<20); n != len(p) || err != nil || !bytes.Equal(p, data[1<<20:1<<20+len(p)]) {
+		t.Fatalf("ReadAt = %d, %v, want the contents at the offset", n, err)
+	}
+	if size, err := r.Size(); err != nil || size != int64(len(data)) {
+		t.Fatalf("Size = %d, %v, want %d", size, err, len(data))
+	}
+	if _, err := r.Seek(-10, io.SeekEnd); err != nil {
+		t.Fatal(err)
+	}
+	if rest, err := io.ReadAll(r); err != nil || !bytes.Equal(rest, data[len(data)-10:]) {
+		t.Fatalf("read %x, %v after seeking, want the last 10 bytes", rest, err)
+	}
+	r.Close()
+	dst := t.TempDir()
+	if err := fs.Restore(va, dst); err != nil {
+		t.Fatal(err)
+	}
+	if got := readFile(t, filepath.Join(dst, "a.bin")); got != string(data) {
+		t.Fatal("restored contents differ from the contents of a")
+	}
+	if got, err := iofs.ReadFile(fs.FS(), viewName(b)); err != nil || !bytes.Equal(got, other) {
+		t.Fatalf("FS read %d bytes, %v, want the contents of b", len(got), err)
+	}
+	ve := addFile(t, fs, filepath.Join(src, "empty"), "", "", "1")
+	buf.Reset()
+	if err := fs.RestoreTo(ve, &buf); err != nil || buf.Len() != 0 {
+		t.Fatalf("RestoreTo of empty contents = %d bytes, %v", buf.Len(), err)
+	}
+	// chunks are deleted when no contents use them anymore
+	chunks, _ := countChunks(t, fs)
+	if err := fs.DeleteVersion(va); err != nil {
+		t.Fatal(err)
+	}
+	if rows, files := countChunks(t, fs); rows >= chunks || rows != files {
+		t.Fatalf("%d chunks with %d files left of %d, want fewer", rows, files, chunks)
+	}
+	if err := fs.DeleteVersion(vb); err != nil {
+		t.Fatal(err)
+	}
+	if rows, files := countChunks(t, fs); files != 0 {
+		t.Fatalf("%d chunks with %d files left, want none", rows, files)
+	}
+}
+
+func TestChunked(t *testing.T) {
+	t.Run("plain", func(t *testing.T) { testChunked(t, 0) })
+	t.Run("compressed", func(t *testing.T) { testChunked(t, Compress) })
+}
+
+func TestChunkerSizes(t *testing.T) {
+	data := make([]byte, 8<<20)
+	rand.New(rand.NewSource(3)).Read(data)
+	c := newChunker(bytes.NewReader(data))
+	n, total := 0, 0
+	for {
+		chunk, err := c.next()
+		if err == io.EOF {
+			break
+		} else if err != nil {
+			t.Fatal(err)
+		}
+		if len(chunk) > chunkMax || len(chunk) < chunkMin && total+len(chunk) != len(data) {
+			t.Fatalf("chunk of %d bytes, want between %d and %d", len(chunk), chunkMin, chunkMax)
+		}
+		n++
+		total += len(chunk)
+	}
+	if total != len(data) || n < 64 || n > 256 {
+		t.Fatalf("%d chunks of %d bytes, want between 64 and 256 chunks of %d bytes", n, total, len(data))
+	}
+}
@@ -0,0 +1,32 @@
+//go:build darwin
+
+package filestore
+
+import (
+	"os"
+
+	"golang.org/x/sys/unix"
+)
+
+// cloneFile makes dst a copy of src that shares its data blocks with src using clonefile(2),
+// which is supported by APFS. It returns false if src cannot be cloned, for instance because dst
+// is on another file system, and the contents must be copied instead.
+func cloneFile(src, dst string, perm os.FileMode) bool {
+	// clonefile requires that dst does not exist, so an existing file is only replaced on success
+	tmp := dst + ".filestore-clone"
+	os.Remove(tmp)
+	if err := unix.Clonefile(src, tmp, unix.CLONE_NOOWNERCOPY); err != nil {
+		return false
+	}
+	if perm != 0 {
+		if err := os.Chmod(tmp, perm); err != nil {
+			os.Remove(tmp)
+			return false
+		}
+	}
+	if err := os.Rename(tmp, dst); err != nil {
+		os.Remove(tmp)
+		return false
+	}
+	return true
+}
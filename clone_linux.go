@@ -0,0 +1,31 @@
+//go:build linux
+
+package filestore
+
+import (
+	"os"
+
+	"golang.org/x/sys/unix"
+)
+
+// cloneFile makes dst a copy of src that shares its data blocks with src using the FICLONE ioctl,
+// which is supported by file systems like Btrfs and XFS. It returns false if src cannot be cloned,
+// for instance because dst is on another file system, and the contents must be copied instead.
+func cloneFile(src, dst string, perm os.FileMode) bool {
+	fin, err := os.Open(src)
+	if err != nil {
+		return false
+	}
+	defer fin.Close()
+	fout, err := os.Create(dst)
+	if err != nil {
+		return false
+	}
+	defer fout.Close()
+	if perm != 0 {
+		if err := fout.Chmod(perm); err != nil {
+			return false
+		}
+	}
+	return unix.IoctlFileClone(int(fout.Fd()), int(fin.Fd())) == nil
+}
@@ -0,0 +1,10 @@
+//go:build !linux && !darwin
+
+package filestore
+
+import "os"
+
+// cloneFile returns false, since cloning files is not supported on this platform.
+func cloneFile(src, dst string, perm os.FileMode) bool {
+	return false
+}
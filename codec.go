@@ -0,0 +1,152 @@
+package filestore
+
+import (
+	"database/sql"
+	"errors"
+	"io"
+	"path/filepath"
+	"strings"
+
+	"github.com/golang/snappy"
+	"github.com/klauspost/compress/gzip"
+	"github.com/klauspost/compress/zstd"
+	"github.com/pierrec/lz4/v4"
+	"github.com/rasteric/flags"
+)
+
+var ErrUnknownCompression = errors.New("filestore compression codec is unknown")
+
+// Names of the codecs that can be used to compress blobs by setting the Compression field of a
+// Filestore. The codec of each blob is recorded, so a filestore may contain blobs compressed
+// with different codecs.
+const (
+	CompressionNone   = "none"
+	CompressionSnappy = "snappy"
+	CompressionZstd   = "zstd"
+	CompressionGzip   = "gzip"
+	CompressionLZ4    = "lz4"
+)
+
+// codec compresses and decompresses blobs, and encrypts and decrypts them if it has a key.
+type codec struct {
+	name      string
+	ext       string // the suffix of the names of blobs compressed with the codec
+	reader    func(r io.Reader) (io.ReadCloser, error)
+	writer    func(w io.Writer) (io.WriteCloser, error)
+	key       []byte // the data key of an encrypted blob, nil if the blob is not encrypted
+	sealedKey []byte // the data key sealed with the key of the filestore
+}
+
+// codecs contains the supported codecs by name.
+var codecs = map[string]codec{
+	CompressionNone: {name: CompressionNone,
+		reader: func(r io.Reader) (io.ReadCloser, error) { return io.NopCloser(r), nil },
+		writer: func(w io.Writer) (io.WriteCloser, error) { return nopWriteCloser{w}, nil }},
+	CompressionSnappy: {name: CompressionSnappy, ext: ".snappy",
+		reader: func(r io.Reader) (io.ReadCloser, error) { return io.NopCloser(snappy.NewReader(r)), nil },
+		writer: func(w io.Writer) (io.WriteCloser, error) { return snappy.NewBufferedWriter(w), nil }},
+	CompressionZstd: {name: CompressionZstd, ext: ".zst",
+		reader: func(r io.Reader) (io.ReadCloser, error) {
+			d, err := zstd.NewReader(r)
+			if err != nil {
+				return nil, err
+			}
+			return d.IOReadCloser(), nil
+		},
+		writer: func(w io.Writer) (io.WriteCloser, error) { return zstd.NewWriter(w) }},
+	CompressionGzip: {name: CompressionGzip, ext: ".gz",
+		reader: func(r io.Reader) (io.ReadCloser, error) { return gzip.NewReader(r) },
+		writer: func(w io.Writer) (io.WriteCloser, error) { return gzip.NewWriter(w), nil }},
+	CompressionLZ4: {name: CompressionLZ4, ext: ".lz4",
+		reader: func(r io.Reader) (io.ReadCloser, error) { return io.NopCloser(lz4.NewReader(r)), nil },
+		writer: func(w io.Writer) (io.WriteCloser, error) { return lz4.NewWriter(w), nil }},
+}
+
+// plain returns true if blobs are stored unchanged with the codec.
+func (c codec) plain() bool {
+	return c.name == CompressionNone && c.key == nil
+}
+
+// nopWriteCloser is a writer whose Close does nothing.
+type nopWriteCloser struct {
+	io.Writer
+}
+
+// Close does nothing.
+func (nopWriteCloser) Close() error {
+	return nil
+}
+
+// newCodec returns the codec with the given name.
+func newCodec(name string) (codec, error) {
+	c, ok := codecs[name]
+	if !ok {
+		return codec{}, ErrUnknownCompression
+	}
+	return c, nil
+}
+
+// compression returns the name of the codec of new blobs. Unless the Compression field is set,
+// blobs are compressed with Snappy if the filestore has the Compress option.
+func (fs *Filestore) compression() string {
+	switch {
+	case fs.Compression != "":
+		return fs.Compression
+	case flags.Has(fs.Options, Compress):
+		return CompressionSnappy
+	}
+	return CompressionNone
+}
+
+// DefaultIncompressible contains the extensions of files that are stored uncompressed unless the
+// Incompressible field of a Filestore is set, because their contents are compressed already.
+var DefaultIncompressible = []string{
+	".7z", ".aac", ".avif", ".br", ".bz2", ".docx", ".epub", ".flac", ".gif", ".gz", ".heic",
+	".jar", ".jpeg", ".jpg", ".lz4", ".m4a", ".m4v", ".mkv", ".mov", ".mp3", ".mp4", ".odt",
+	".ogg", ".opus", ".png", ".rar", ".snappy", ".tgz", ".webm", ".webp", ".xlsx", ".xz",
+	".zip", ".zst",
+}
+
+// incompressible returns true if the file at path is to be stored uncompressed because its
+// extension is one of those of already compressed files.
+func (fs *Filestore) incompressible(path string) bool {
+	exts := fs.Incompressible
+	if exts == nil {
+		exts = DefaultIncompressible
+	}
+	ext := filepath.Ext(path)
+	for _, e := range exts {
+		if strings.EqualFold(e, ext) {
+			return true
+		}
+	}
+	return false
+}
+
+// fileCodec returns the codec with which the file at path is stored, which is the codec of new
+// blobs unless the file is incompressible.
+func (fs *Filestore) fileCodec(path string) (codec, error) {
+	if fs.incompressible(path) {
+		return codecs[CompressionNone], nil
+	}
+	return newCodec(fs.compression())
+}
+
+// blobCodec returns the codec of the blob with the given checksum, decrypting it if it is
+// encrypted, or the codec of new blobs if the filestore has no such blob.
+func (fs *Filestore) blobCodec(q querier, checksum string) (codec, error) {
+	var name string
+	var sealed []byte
+	err := q.QueryRow("select codec, sealed_key from Files where checksum=?;", checksum).Scan(&name, &sealed)
+	if err == sql.ErrNoRows {
+		return newCodec(fs.compression())
+	}
+	if err != nil {
+		return codec{}, fs.dbError(err)
+	}
+	c, err := newCodec(name)
+	if err != nil {
+		return codec{}, err
+	}
+	return fs.unsealCodec(c, sealed)
+}
@@ -0,0 +1,107 @@
+package filestore
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestCodecs(t *testing.T) {
+	fs, src := newTestStore(t)
+	data := strings.Repeat("hello codec world ", 20000)
+	compressions := []string{CompressionNone, CompressionSnappy, CompressionZstd, CompressionGzip, CompressionLZ4}
+	var versions []FileVersion
+	for _, chunked := range []bool{false, true} {
+		if chunked {
+			fs.Options |= Chunked
+		}
+		for _, compression := range compressions {
+			fs.Compression = compression
+			path := filepath.Join(src, compression)
+			if chunked {
+				path += "-chunked"
+			}
+			versions = append(versions, addFile(t, fs, path, path+data, "", "1"))
+		}
+	}
+	// contents are read with the codec they were stored with
+	fs.Compression = CompressionNone
+	fs.Options &^= Chunked
+	for _, v := range versions {
+		want := []byte(v.Path + data)
+		r, err := fs.OpenVersion(v)
+		if err != nil {
+			t.Fatal(err)
+		}
+		got, err := io.ReadAll(r)
+		r.Close()
+		if err != nil || !bytes.Equal(got, want) {
+			t.Fatalf("read %d bytes, %v of %s, want %d bytes", len(got), err, v.Name, len(want))
+		}
+		vr, err := fs.OpenSeekable(v)
+		if err != nil {
+			t.Fatal(err)
+		}
+		buf := make([]byte, 100)
+		if _, err := vr.ReadAt(buf, 200000); err != nil || !bytes.Equal(buf, want[200000:200100]) {
+			t.Fatalf("ReadAt of %s = %q, %v", v.Name, buf, err)
+		}
+		if size, err := vr.Size(); err != nil || size != int64(len(want)) {
+			t.Fatalf("Size of %s = %d, %v, want %d", v.Name, size, err, len(want))
+		}
+		vr.Close()
+		dst := t.TempDir()
+		if err := fs.Restore(v, dst); err != nil {
+			t.Fatal(err)
+		}
+		if got := readFile(t, filepath.Join(dst, v.Name)); got != string(want) {
+			t.Fatalf("restored %d bytes of %s, want %d bytes", len(got), v.Name, len(want))
+		}
+		if err := fs.DeleteVersion(v); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := fs.Close(); err != nil {
+		t.Fatal(err)
+	}
+	fs.Compression = "brotli"
+	if err := fs.Open(); !errors.Is(err, ErrUnknownCompression) {
+		t.Fatalf("Open with an unknown compression = %v, want ErrUnknownCompression", err)
+	}
+}
+
+// storedCodec returns the name of the codec the contents of v are stored with.
+func storedCodec(t *testing.T, fs *Filestore, v FileVersion) string {
+	t.Helper()
+	var name string
+	if err := fs.db.QueryRow("select codec from Files where checksum=?;", v.Checksum).Scan(&name); err != nil {
+		t.Fatal(err)
+	}
+	return name
+}
+
+func TestIncompressible(t *testing.T) {
+	for _, chunked := range []bool{false, true} {
+		fs, src := newTestStore(t)
+		fs.Compression = CompressionZstd
+		if chunked {
+			fs.Options |= Chunked
+		}
+		data := strings.Repeat("\x00", 10000)
+		// extensions are matched ignoring case
+		va := addFile(t, fs, filepath.Join(src, "a.JPG"), data, "", "1")
+		vb := addFile(t, fs, filepath.Join(src, "b.txt"), data+"\x01", "", "1")
+		if a, b := storedCodec(t, fs, va), storedCodec(t, fs, vb); a != CompressionNone || b != CompressionZstd {
+			t.Fatalf("contents stored with codecs %s and %s, want none for the image", a, b)
+		}
+		for v, want := range map[FileVersion]string{va: data, vb: data + "\x01"} {
+			var buf bytes.Buffer
+			if err := fs.RestoreTo(v, &buf); err != nil || buf.String() != want {
+				t.Fatalf("RestoreTo = %d bytes, %v, want %d bytes", buf.Len(), err, len(want))
+			}
+		}
+	}
+}
@@ -0,0 +1,419 @@
+package filestore
+
+import (
+	"crypto/cipher"
+	"crypto/rand"
+	"database/sql"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+
+	"github.com/rasteric/flags"
+	"golang.org/x/crypto/chacha20poly1305"
+)
+
+var ErrInvalidKey = errors.New("filestore encryption key must be 32 bytes long")
+var ErrNoKey = errors.New("filestore encryption key is needed but was not given")
+var ErrWrongKey = errors.New("filestore encryption key is not the key of the filestore")
+var ErrDecryption = errors.New("filestore could not decrypt blob, which is damaged or was tampered with")
+
+// KeySize is the size in bytes of the Key of an encrypted filestore.
+const KeySize = chacha20poly1305.KeySize
+
+// cryptSegmentSize is the number of bytes of plain data encrypted and authenticated together.
+const cryptSegmentSize = 64 * 1024
+
+// encryptedBlobName is the name under which encrypted blobs are stored instead of the name of
+// the file first added with their contents.
+const encryptedBlobName = "blob"
+
+// keyCheckKey is the key under which a data key sealed with the key of the filestore is stored
+// in the Settings table, which is used to check that the correct key is given.
+const keyCheckKey = "key_check"
+
+// sealedKeyData is the additional data authenticated with each sealed data key.
+var sealedKeyData = []byte("filestore data key")
+
+// encrypted returns true if blobs added to the filestore are encrypted.
+func (fs *Filestore) encrypted() bool {
+	return flags.Has(fs.Options, Encrypted)
+}
+
+// checkKey verifies the Key of the filestore against the stored key check, which is created
+// unless readOnly is true if the filestore has none yet.
+func (fs *Filestore) checkKey(readOnly bool) error {
+	if fs.Key == nil {
+		if fs.encrypted() {
+			return ErrNoKey
+		}
+		return nil
+	}
+	if len(fs.Key) != KeySize {
+		return ErrInvalidKey
+	}
+	var value string
+	err := fs.db.QueryRow("select value from Settings where name=?;", keyCheckKey).Scan(&value)
+	if err == nil {
+		sealed, err := hex.DecodeString(value)
+		if err != nil {
+			return fmt.Errorf("filestore contains invalid key check: %w", err)
+		}
+		_, err = fs.openKey(sealed)
+		return err
+	}
+	if readOnly {
+		return nil
+	}
+	if err != sql.ErrNoRows {
+		return fs.dbError(err)
+	}
+	_, sealed, err := fs.newDataKey()
+	if err != nil {
+		return err
+	}
+	if _, err := fs.db.Exec("insert into Settings(name, value) values(?, ?);", keyCheckKey,
+		hex.EncodeToString(sealed)); err != nil {
+		return fs.dbError(err)
+	}
+	return nil
+}
+
+// newDataKey returns a new random data key and the key sealed with the key of the filestore.
+func (fs *Filestore) newDataKey() ([]byte, []byte, error) {
+	key := make([]byte, KeySize)
+	if _, err := rand.Read(key); err != nil {
+		return nil, nil, err
+	}
+	sealed, err := sealKey(fs.Key, key)
+	if err != nil {
+		return nil, nil, err
+	}
+	return key, sealed, nil
+}
+
+// openKey returns the data key sealed with the key of the filestore.
+func (fs *Filestore) openKey(sealed []byte) ([]byte, error) {
+	if fs.Key == nil {
+		return nil, ErrNoKey
+	}
+	return openSealedKey(fs.Key, sealed)
+}
+
+// sealKey returns the data key encrypted with master, preceded by the random nonce used.
+func sealKey(master, key []byte) ([]byte, error) {
+	aead, err := chacha20poly1305.NewX(master)
+	if err != nil {
+		return nil, ErrInvalidKey
+	}
+	nonce := make([]byte, aead.NonceSize(), aead.NonceSize()+len(key)+aead.Overhead())
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, err
+	}
+	return aead.Seal(nonce, nonce, key, sealedKeyData), nil
+}
+
+// openSealedKey returns the data key sealed with master, or ErrWrongKey if it was sealed with
+// another key.
+func openSealedKey(master, sealed []byte) ([]byte, error) {
+	aead, err := chacha20poly1305.NewX(master)
+	if err != nil {
+		return nil, ErrInvalidKey
+	}
+	if len(sealed) < aead.NonceSize() {
+		return nil, ErrWrongKey
+	}
+	key, err := aead.Open(nil, sealed[:aead.NonceSize()], sealed[aead.NonceSize():], sealedKeyData)
+	if err != nil {
+		return nil, ErrWrongKey
+	}
+	return key, nil
+}
+
+// RotateKey replaces the key of the filestore oldKey with newKey by sealing the data keys of
+// all encrypted blobs and chunks with newKey, without encrypting their contents again. It
+// either succeeds for all data keys or changes nothing, and sets the Key field to newKey on
+// success. Other filestores opened on the same directory must be reopened with newKey.
+func (fs *Filestore) RotateKey(oldKey, newKey []byte) (err error) {
+	op := newOp("RotateKey", fs.Dir)
+	defer op.done(&err)
+	if err := fs.ensureOpen(); err != nil {
+		return err
+	}
+	if len(oldKey) != KeySize || len(newKey) != KeySize {
+		return ErrInvalidKey
+	}
+	var value string
+	if err := fs.db.QueryRow("select value from Settings where name=?;", keyCheckKey).Scan(&value); err != nil {
+		if err == sql.ErrNoRows {
+			return ErrWrongKey
+		}
+		return fs.dbError(err)
+	}
+	check, err := hex.DecodeString(value)
+	if err != nil {
+		return fmt.Errorf("filestore contains invalid key check: %w", err)
+	}
+	if check, err = resealKey(check, oldKey, newKey); err != nil {
+		return err
+	}
+	tx, err := fs.db.Begin()
+	if err != nil {
+		return fs.dbError(err)
+	}
+	defer func() {
+		if err != nil {
+			tx.Rollback()
+		}
+	}()
+	if _, err := tx.Exec("update Settings set value=? where name=?;", hex.EncodeToString(check), keyCheckKey); err != nil {
+		return fs.dbError(err)
+	}
+	if err := fs.resealKeys(tx, "Files", "file_id", oldKey, newKey); err != nil {
+		return err
+	}
+	if err := fs.resealKeys(tx, "Chunks", "chunk_id", oldKey, newKey); err != nil {
+		return err
+	}
+	if err := tx.Commit(); err != nil {
+		return fs.dbError(err)
+	}
+	fs.Key = newKey
+	return nil
+}
+
+// resealKeys seals the data keys in the sealed_key column of table with newKey instead of
+// oldKey within tx. The rows are identified by the column id.
+func (fs *Filestore) resealKeys(tx *sql.Tx, table, id string, oldKey, newKey []byte) error {
+	rows, err := tx.Query("select " + id + ", sealed_key from " + table + " where sealed_key is not null;")
+	if err != nil {
+		return fs.dbError(err)
+	}
+	type sealedKey struct {
+		id     int64
+		sealed []byte
+	}
+	var keys []sealedKey
+	for rows.Next() {
+		var k sealedKey
+		if err := rows.Scan(&k.id, &k.sealed); err != nil {
+			rows.Close()
+			return fs.dbError(err)
+		}
+		keys = append(keys, k)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return fs.dbError(err)
+	}
+	for _, k := range keys {
+		sealed, err := resealKey(k.sealed, oldKey, newKey)
+		if err != nil {
+			return err
+		}
+		if _, err := tx.Exec("update "+table+" set sealed_key=? where "+id+"=?;", sealed, k.id); err != nil {
+			return fs.dbError(err)
+		}
+	}
+	return nil
+}
+
+// resealKey returns the data key sealed with oldKey sealed with newKey instead.
+func resealKey(sealed, oldKey, newKey []byte) ([]byte, error) {
+	key, err := openSealedKey(oldKey, sealed)
+	if err != nil {
+		return nil, err
+	}
+	return sealKey(newKey, key)
+}
+
+// sealCodec returns codec c encrypting with a new data key, if the filestore is encrypted.
+func (fs *Filestore) sealCodec(c codec) (codec, error) {
+	if !fs.encrypted() {
+		return c, nil
+	}
+	key, sealed, err := fs.newDataKey()
+	if err != nil {
+		return codec{}, err
+	}
+	return c.encrypting(key, sealed), nil
+}
+
+// unsealCodec returns codec c decrypting with the data key sealed, or c itself if sealed is nil
+// because the blob is not encrypted.
+func (fs *Filestore) unsealCodec(c codec, sealed []byte) (codec, error) {
+	if sealed == nil {
+		return c, nil
+	}
+	key, err := fs.openKey(sealed)
+	if err != nil {
+		return codec{}, err
+	}
+	return c.encrypting(key, sealed), nil
+}
+
+// encrypting returns a copy of c that encrypts the compressed data with key, which is stored
+// sealed with the key of the filestore as sealed.
+func (c codec) encrypting(key, sealed []byte) codec {
+	inner := c
+	c.key, c.sealedKey = key, sealed
+	c.reader = func(r io.Reader) (io.ReadCloser, error) {
+		d, err := newDecrypter(r, key)
+		if err != nil {
+			return nil, err
+		}
+		return inner.reader(d)
+	}
+	c.writer = func(w io.Writer) (io.WriteCloser, error) {
+		e, err := newEncrypter(w, key)
+		if err != nil {
+			return nil, err
+		}
+		cw, err := inner.writer(e)
+		if err != nil {
+			return nil, err
+		}
+		return &chainedWriteCloser{WriteCloser: cw, next: e}, nil
+	}
+	return c
+}
+
+// chainedWriteCloser is a writer that closes another writer it writes to after itself.
+type chainedWriteCloser struct {
+	io.WriteCloser
+	next io.Closer
+}
+
+// Close closes the writer and then the next writer.
+func (w *chainedWriteCloser) Close() error {
+	if err := w.WriteCloser.Close(); err != nil {
+		return err
+	}
+	return w.next.Close()
+}
+
+// cryptNonce returns the nonce of the segment with the given index, which marks whether it is
+// the last segment so that truncated blobs are detected.
+func cryptNonce(index uint64, last bool) []byte {
+	nonce := make([]byte, chacha20poly1305.NonceSize)
+	binary.BigEndian.PutUint64(nonce[3:11], index)
+	if last {
+		nonce[11] = 1
+	}
+	return nonce
+}
+
+// encrypter encrypts the data written to it in segments of cryptSegmentSize bytes, each of
+// which is authenticated. It must be closed to write the last segment, which may be empty.
+type encrypter struct {
+	w     io.Writer
+	aead  cipher.AEAD
+	buf   []byte // the plain data of the current segment
+	index uint64 // the index of the current segment
+}
+
+func newEncrypter(w io.Writer, key []byte) (*encrypter, error) {
+	aead, err := chacha20poly1305.New(key)
+	if err != nil {
+		return nil, err
+	}
+	return &encrypter{w: w, aead: aead, buf: make([]byte, 0, cryptSegmentSize+aead.Overhead())}, nil
+}
+
+// Write encrypts p, writing all segments completed before it.
+func (e *encrypter) Write(p []byte) (int, error) {
+	n := 0
+	for len(p) > 0 {
+		if len(e.buf) == cryptSegmentSize {
+			if err := e.flush(false); err != nil {
+				return n, err
+			}
+		}
+		m := copy(e.buf[len(e.buf):cryptSegmentSize], p)
+		e.buf = e.buf[:len(e.buf)+m]
+		p = p[m:]
+		n += m
+	}
+	return n, nil
+}
+
+// Close writes the last segment, but does not close the underlying writer.
+func (e *encrypter) Close() error {
+	return e.flush(true)
+}
+
+// flush encrypts and writes the current segment.
+func (e *encrypter) flush(last bool) error {
+	sealed := e.aead.Seal(e.buf[:0], cryptNonce(e.index, last), e.buf, nil)
+	e.buf = e.buf[:0]
+	e.index++
+	_, err := e.w.Write(sealed)
+	return err
+}
+
+// decrypter decrypts data written by an encrypter. It returns ErrDecryption if a segment
+// fails to authenticate or the data is truncated.
+type decrypter struct {
+	r     io.Reader
+	aead  cipher.AEAD
+	raw   []byte // encrypted data read ahead
+	have  int    // the number of bytes in raw
+	plain []byte // decrypted data not read yet
+	buf   []byte // the storage of plain
+	index uint64 // the index of the next segment
+	done  bool   // true after the last segment has been decrypted
+	err   error
+}
+
+func newDecrypter(r io.Reader, key []byte) (*decrypter, error) {
+	aead, err := chacha20poly1305.New(key)
+	if err != nil {
+		return nil, err
+	}
+	// one byte more than a segment is read to find out whether another segment follows
+	return &decrypter{r: r, aead: aead, raw: make([]byte, cryptSegmentSize+aead.Overhead()+1),
+		buf: make([]byte, 0, cryptSegmentSize)}, nil
+}
+
+// Read reads decrypted data.
+func (d *decrypter) Read(p []byte) (int, error) {
+	for len(d.plain) == 0 {
+		if d.err != nil {
+			return 0, d.err
+		}
+		if d.done {
+			return 0, io.EOF
+		}
+		d.err = d.next()
+	}
+	n := copy(p, d.plain)
+	d.plain = d.plain[n:]
+	return n, nil
+}
+
+// next reads and decrypts the next segment.
+func (d *decrypter) next() error {
+	n, err := io.ReadFull(d.r, d.raw[d.have:])
+	d.have += n
+	last := false
+	switch err {
+	case nil:
+	case io.EOF, io.ErrUnexpectedEOF:
+		last = true
+	default:
+		return err
+	}
+	size := d.have
+	if !last {
+		size = len(d.raw) - 1
+	}
+	plain, err := d.aead.Open(d.buf[:0], cryptNonce(d.index, last), d.raw[:size], nil)
+	if err != nil {
+		return ErrDecryption
+	}
+	d.index++
+	d.have = copy(d.raw, d.raw[size:d.have])
+	d.plain, d.done = plain, last
+	return nil
+}
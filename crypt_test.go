@@ -0,0 +1,182 @@
+package filestore
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/rasteric/flags"
+)
+
+func TestEncryptedStream(t *testing.T) {
+	key := bytes.Repeat([]byte{7}, KeySize)
+	rng := rand.New(rand.NewSource(1))
+	for _, n := range []int{0, 1, cryptSegmentSize - 1, cryptSegmentSize, cryptSegmentSize + 1, 3 * cryptSegmentSize, 200000} {
+		data := make([]byte, n)
+		rng.Read(data)
+		var buf bytes.Buffer
+		e, err := newEncrypter(&buf, key)
+		if err != nil {
+			t.Fatal(err)
+		}
+		// writes need not be aligned with segments
+		for _, part := range [][]byte{data[:n/3], data[n/3:]} {
+			if _, err := e.Write(part); err != nil {
+				t.Fatal(err)
+			}
+		}
+		if err := e.Close(); err != nil {
+			t.Fatal(err)
+		}
+		encrypted := buf.Bytes()
+		if n > 16 && bytes.Contains(encrypted, data) {
+			t.Fatalf("encrypted stream of %d bytes contains the plain data", n)
+		}
+		d, err := newDecrypter(bytes.NewReader(encrypted), key)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got, err := io.ReadAll(d); err != nil || !bytes.Equal(got, data) {
+			t.Fatalf("decrypted %d bytes, %v, want %d bytes", len(got), err, n)
+		}
+		// truncated streams are detected, even if whole segments are missing
+		for _, cut := range []int{1, 16, 17, len(encrypted) - cryptSegmentSize} {
+			if cut <= 0 || cut > len(encrypted) {
+				continue
+			}
+			d, err := newDecrypter(bytes.NewReader(encrypted[:len(encrypted)-cut]), key)
+			if err == nil {
+				_, err = io.ReadAll(d)
+			}
+			if !errors.Is(err, ErrDecryption) {
+				t.Fatalf("reading a stream of %d bytes truncated by %d bytes = %v, want ErrDecryption", n, cut, err)
+			}
+		}
+	}
+}
+
+func testEncryptedStore(t *testing.T, opts flags.Bits) {
+	fs := NewFilestore(filepath.Join(t.TempDir(), "store"), Encrypted|opts)
+	if err := fs.Open(); !errors.Is(err, ErrNoKey) {
+		fs.Close()
+		t.Fatalf("Open without key = %v, want ErrNoKey", err)
+	}
+	fs.Key = bytes.Repeat([]byte{3}, KeySize)
+	_, src := openTestStore(t, fs)
+	path := filepath.Join(src, "secret-name.txt")
+	data := strings.Repeat("top secret payload ", 20000)
+	v := addFile(t, fs, path, data, "", "1")
+	// neither names nor contents are stored in plain outside of the database
+	err := filepath.Walk(fs.Root(), func(p string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if strings.Contains(p, "secret-name") {
+			t.Fatalf("file %s has the name of the source file", p)
+		}
+		if info.Mode().IsRegular() && !strings.Contains(filepath.Base(p), ".db") {
+			if strings.Contains(readFile(t, p), "top secret") {
+				t.Fatalf("file %s contains the plain contents", p)
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var buf bytes.Buffer
+	if err := fs.RestoreTo(v, &buf); err != nil || buf.String() != data {
+		t.Fatalf("RestoreTo = %d bytes, %v, want %d bytes", buf.Len(), err, len(data))
+	}
+	r, err := fs.OpenSeekable(v)
+	if err != nil {
+		t.Fatal(err)
+	}
+	p := make([]byte, 10)
+	if _, err := r.ReadAt(p, 100000); err != nil || string(p) != data[100000:100010] {
+		t.Fatalf("ReadAt = %q, %v, want %q", p, err, data[100000:100010])
+	}
+	if size, err := r.Size(); err != nil || size != int64(len(data)) {
+		t.Fatalf("Size = %d, %v, want %d", size, err, len(data))
+	}
+	r.Close()
+	dst := t.TempDir()
+	if err := fs.Restore(v, dst); err != nil {
+		t.Fatal(err)
+	}
+	if got := readFile(t, filepath.Join(dst, "secret-name.txt")); got != data {
+		t.Fatalf("restored %d bytes, want %d bytes", len(got), len(data))
+	}
+	if err := fs.Close(); err != nil {
+		t.Fatal(err)
+	}
+	fs.Key = bytes.Repeat([]byte{4}, KeySize)
+	if err := fs.Open(); !errors.Is(err, ErrWrongKey) {
+		fs.Close()
+		t.Fatalf("Open with another key = %v, want ErrWrongKey", err)
+	}
+	fs.Key = []byte("short")
+	if err := fs.Open(); !errors.Is(err, ErrInvalidKey) {
+		fs.Close()
+		t.Fatalf("Open with a short key = %v, want ErrInvalidKey", err)
+	}
+	// without the key, the metadata can be read but the contents cannot
+	fs.Key = nil
+	fs.Options &^= Encrypted
+	openTestStore(t, fs)
+	if v, err = fs.Get(path); err != nil {
+		t.Fatal(err)
+	}
+	if err := fs.RestoreTo(v, io.Discard); !errors.Is(err, ErrNoKey) {
+		t.Fatalf("RestoreTo without key = %v, want ErrNoKey", err)
+	}
+}
+
+func TestEncryptedStore(t *testing.T) {
+	t.Run("plain", func(t *testing.T) { testEncryptedStore(t, 0) })
+	t.Run("compressed", func(t *testing.T) { testEncryptedStore(t, Compress) })
+	t.Run("chunked", func(t *testing.T) { testEncryptedStore(t, Chunked) })
+	t.Run("chunked and compressed", func(t *testing.T) { testEncryptedStore(t, Chunked|Compress) })
+}
+
+func TestRotateKey(t *testing.T) {
+	oldKey, newKey := bytes.Repeat([]byte{1}, KeySize), bytes.Repeat([]byte{2}, KeySize)
+	fs := NewFilestore(filepath.Join(t.TempDir(), "store"), Encrypted)
+	fs.Key = oldKey
+	_, src := openTestStore(t, fs)
+	contents := map[string]string{filepath.Join(src, "a"): "alpha", filepath.Join(src, "b"): "beta beta"}
+	addFile(t, fs, filepath.Join(src, "a"), "alpha", "", "1")
+	fs.Options |= Chunked
+	addFile(t, fs, filepath.Join(src, "b"), "beta beta", "", "1")
+	if err := fs.RotateKey(newKey, oldKey); !errors.Is(err, ErrWrongKey) {
+		t.Fatalf("RotateKey with the wrong old key = %v, want ErrWrongKey", err)
+	}
+	if err := fs.RotateKey(oldKey, newKey); err != nil {
+		t.Fatal(err)
+	}
+	if err := fs.Close(); err != nil {
+		t.Fatal(err)
+	}
+	fs.Key = oldKey
+	if err := fs.Open(); !errors.Is(err, ErrWrongKey) {
+		fs.Close()
+		t.Fatalf("Open with the old key = %v, want ErrWrongKey", err)
+	}
+	fs.Key = newKey
+	openTestStore(t, fs)
+	for path, want := range contents {
+		v, err := fs.Get(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var buf bytes.Buffer
+		if err := fs.RestoreTo(v, &buf); err != nil || buf.String() != want {
+			t.Fatalf("RestoreTo = %q, %v, want %q", buf.String(), err, want)
+		}
+	}
+}
@@ -2,11 +2,44 @@ package filestore
 
 import "time"
 
+// dbDateLayout is the layout of dates in the database, which is RFC 3339 in UTC with nanoseconds
+// padded to a fixed width, so that dates sort as strings in the order of time.
+const dbDateLayout = "2006-01-02T15:04:05.000000000Z07:00"
+
+// legacyDBDateLayout is the layout of dates in the database before it recorded nanoseconds, which
+// are in UTC as well.
+const legacyDBDateLayout = "2006-01-02 15:04:05"
+
+// ParseDBDate parses a date in the format of the database. Dates in the format of earlier
+// versions of this package, with seconds in UTC, are accepted as well.
 func ParseDBDate(date string) (time.Time, error) {
-	layout := "2006-01-02 15:04:05"
-	return time.Parse(layout, date)
+	t, err := time.Parse(time.RFC3339Nano, date)
+	if err != nil {
+		if legacy, legacyErr := time.Parse(legacyDBDateLayout, date); legacyErr == nil {
+			return legacy, nil
+		}
+		return time.Time{}, err
+	}
+	return t.UTC(), nil
 }
 
+// ToDBDate returns the date in the format of the database, which is RFC 3339 in UTC with
+// nanoseconds.
 func ToDBDate(date time.Time) string {
-	return date.Format("2006-01-02 15:04:05")
+	return date.UTC().Format(dbDateLayout)
+}
+
+// dbNow returns the current time in the format of the database.
+func dbNow() string {
+	return ToDBDate(time.Now())
+}
+
+// legacyDBDate returns a date of the database in the format of earlier versions of this package
+// if it has no fractional seconds, so that it is the date as it was before being migrated.
+func legacyDBDate(date string) (string, bool) {
+	t, err := ParseDBDate(date)
+	if err != nil || t.Nanosecond() != 0 {
+		return "", false
+	}
+	return t.Format(legacyDBDateLayout), true
 }
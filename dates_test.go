@@ -0,0 +1,59 @@
+package filestore
+
+import (
+	"fmt"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestDBDates(t *testing.T) {
+	date := time.Date(2021, 5, 6, 7, 8, 9, 123, time.FixedZone("UTC+2", 7200))
+	s := ToDBDate(date)
+	if s != "2021-05-06T05:08:09.000000123Z" {
+		t.Fatalf("ToDBDate = %q, want RFC 3339 in UTC with nanoseconds", s)
+	}
+	if parsed, err := ParseDBDate(s); err != nil || !parsed.Equal(date) {
+		t.Fatalf("ParseDBDate(%q) = %v, %v, want %v", s, parsed, err, date)
+	}
+	// dates of earlier versions of the package are accepted
+	if parsed, err := ParseDBDate("2021-05-06 07:08:09"); err != nil || !parsed.Equal(time.Date(2021, 5, 6, 7, 8, 9, 0, time.UTC)) {
+		t.Fatalf("ParseDBDate of a legacy date = %v, %v", parsed, err)
+	}
+}
+
+func TestVersionDates(t *testing.T) {
+	fs, src := newTestStore(t)
+	path := filepath.Join(src, "a.txt")
+	for i := 0; i < 5; i++ {
+		addFile(t, fs, path, fmt.Sprint(i), "", fmt.Sprint(i))
+	}
+	// versions added within a second are ordered
+	versions, err := fs.Versions(path, -1)
+	if err != nil || len(versions) != 5 || versions[0].Version != "4" {
+		t.Fatalf("Versions = %v, %v, want 5 versions with the latest first", versions, err)
+	}
+	for i := 1; i < len(versions); i++ {
+		if !versions[i].From.Before(versions[i-1].From) {
+			t.Fatalf("version %d dated %v, not before %v", i, versions[i].From, versions[i-1].From)
+		}
+	}
+	var date string
+	if err := fs.db.QueryRow("select date from Versions where version_id=?;", versions[0].ID).Scan(&date); err != nil {
+		t.Fatal(err)
+	}
+	if parsed, err := time.Parse(dbDateLayout, date); err != nil || !parsed.Equal(versions[0].From) {
+		t.Fatalf("date %q stored, want %v in the layout of the database", date, versions[0].From)
+	}
+	tree := filepath.Join(src, "tree")
+	writeFile(t, filepath.Join(tree, "f"), "f")
+	if _, err := fs.AddTree(tree, "", ""); err != nil {
+		t.Fatal(err)
+	}
+	if snapshots, err := fs.Snapshots(); err != nil || len(snapshots) != 1 || time.Since(snapshots[0].Date) > time.Minute {
+		t.Fatalf("Snapshots = %v, %v, want a snapshot dated now", snapshots, err)
+	}
+	if report, err := fs.Report(24 * time.Hour); err != nil || report.Adds != 6 || len(report.AddsPerDay) == 0 {
+		t.Fatalf("Report = %+v, %v, want 6 adds today", report, err)
+	}
+}
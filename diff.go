@@ -0,0 +1,341 @@
+package filestore
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"strings"
+	"unicode/utf8"
+)
+
+// maxTextDiffSize is the maximum size of versions for which Diff produces a unified diff. Larger
+// versions are compared like binary files.
+const maxTextDiffSize = 1 << 20
+
+// diffContext is the number of unchanged lines shown around changes in a unified diff.
+const diffContext = 3
+
+// DiffResult is the result of comparing two versions with Diff. The unified diff is only
+// produced if both versions are text, which means valid UTF-8 without NUL bytes, of at most
+// 1 MiB. Otherwise the result only summarizes the differences of the bytes.
+type DiffResult struct {
+	Identical       bool   // true if both versions have the same contents
+	Binary          bool   // true if the versions were compared as binary files
+	Unified         string // the unified diff of text versions, empty if identical or binary
+	SizeA           int64  // the size of the contents of version a
+	SizeB           int64  // the size of the contents of version b
+	FirstDifference int64  // the offset of the first differing byte, -1 if identical
+	DifferentBytes  int64  // the number of differing bytes at the same offsets plus the difference in size
+}
+
+// Diff compares the contents of versions a and b and returns a unified diff of the lines if they
+// are text files, and a summary of the differing bytes in any case.
+func (fs *Filestore) Diff(a, b FileVersion) (_ DiffResult, err error) {
+	op := newOp("Diff", a.Path)
+	op.checksum = a.Checksum
+	defer op.done(&err)
+	if err := fs.ensureOpen(); err != nil {
+		return DiffResult{}, err
+	}
+	ra, err := fs.openBlob(a)
+	if err != nil {
+		return DiffResult{}, err
+	}
+	defer ra.Close()
+	rb, err := fs.openBlob(b)
+	if err != nil {
+		return DiffResult{}, err
+	}
+	defer rb.Close()
+	textA, isTextA, err := readText(ra)
+	if err != nil {
+		return DiffResult{}, err
+	}
+	textB, isTextB, err := readText(rb)
+	if err != nil {
+		return DiffResult{}, err
+	}
+	result := DiffResult{Binary: !isTextA || !isTextB}
+	result.FirstDifference, result.DifferentBytes, result.SizeA, result.SizeB, err = compareBytes(
+		io.MultiReader(bytes.NewReader(textA), ra), io.MultiReader(bytes.NewReader(textB), rb))
+	if err != nil {
+		return DiffResult{}, err
+	}
+	result.Identical = result.FirstDifference < 0
+	if result.Identical || result.Binary {
+		return result, nil
+	}
+	edits := diffLines(splitLines(string(textA)), splitLines(string(textB)))
+	result.Unified = unifiedDiff(diffLabel(a), diffLabel(b), edits)
+	return result, nil
+}
+
+// readText reads up to maxTextDiffSize+1 bytes from r and returns them and true if they are all of
+// the contents and text. Otherwise, the bytes read are returned with false.
+func readText(r io.Reader) ([]byte, bool, error) {
+	data, err := io.ReadAll(io.LimitReader(r, maxTextDiffSize+1))
+	if err != nil {
+		return nil, false, err
+	}
+	if len(data) > maxTextDiffSize || bytes.IndexByte(data, 0) >= 0 || !utf8.Valid(data) {
+		return data, false, nil
+	}
+	return data, true, nil
+}
+
+// compareBytes reads a and b to the end and returns the offset of the first differing byte or -1,
+// the number of differing bytes including the difference in size, and the sizes of a and b.
+func compareBytes(a, b io.Reader) (first, different, sizeA, sizeB int64, err error) {
+	bufA := make([]byte, 32<<10)
+	bufB := make([]byte, 32<<10)
+	first = -1
+	for {
+		na, errA := io.ReadFull(a, bufA)
+		nb, errB := io.ReadFull(b, bufB)
+		if errA != nil && errA != io.EOF && errA != io.ErrUnexpectedEOF {
+			return 0, 0, 0, 0, errA
+		}
+		if errB != nil && errB != io.EOF && errB != io.ErrUnexpectedEOF {
+			return 0, 0, 0, 0, errB
+		}
+		common := na
+		if nb < common {
+			common = nb
+		}
+		for i := 0; i < common; i++ {
+			if bufA[i] != bufB[i] {
+				if first < 0 {
+					first = sizeA + int64(i)
+				}
+				different++
+			}
+		}
+		sizeA += int64(na)
+		sizeB += int64(nb)
+		if na < len(bufA) || nb < len(bufB) {
+			break
+		}
+	}
+	// at least one reader has ended, count the rest of the other
+	restA, err := io.Copy(io.Discard, a)
+	if err != nil {
+		return 0, 0, 0, 0, err
+	}
+	restB, err := io.Copy(io.Discard, b)
+	if err != nil {
+		return 0, 0, 0, 0, err
+	}
+	sizeA += restA
+	sizeB += restB
+	if sizeA != sizeB {
+		common := sizeA
+		if sizeB < common {
+			common = sizeB
+		}
+		if first < 0 {
+			first = common
+		}
+		different += sizeA + sizeB - 2*common
+	}
+	return first, different, sizeA, sizeB, nil
+}
+
+// diffLabel returns the label of version v in the header of a unified diff.
+func diffLabel(v FileVersion) string {
+	return fmt.Sprintf("%s\t%s", v.Path, ToDBDate(v.From))
+}
+
+// splitLines splits text into lines, each including its trailing newline if there is one.
+func splitLines(text string) []string {
+	lines := strings.SplitAfter(text, "\n")
+	if lines[len(lines)-1] == "" {
+		lines = lines[:len(lines)-1]
+	}
+	return lines
+}
+
+// diffEdit is a line of a diff, which is kept (' '), deleted ('-') or inserted ('+').
+type diffEdit struct {
+	kind byte
+	line string
+}
+
+// diffLines returns an edit script transforming lines a into lines b. Common leading and trailing
+// lines are kept, the lines in between are compared with the algorithm of Myers.
+func diffLines(a, b []string) []diffEdit {
+	prefix := 0
+	for prefix < len(a) && prefix < len(b) && a[prefix] == b[prefix] {
+		prefix++
+	}
+	suffix := 0
+	for suffix < len(a)-prefix && suffix < len(b)-prefix && a[len(a)-1-suffix] == b[len(b)-1-suffix] {
+		suffix++
+	}
+	edits := make([]diffEdit, 0, len(a)+len(b))
+	for _, line := range a[:prefix] {
+		edits = append(edits, diffEdit{' ', line})
+	}
+	edits = append(edits, myersDiff(a[prefix:len(a)-suffix], b[prefix:len(b)-suffix])...)
+	for _, line := range a[len(a)-suffix:] {
+		edits = append(edits, diffEdit{' ', line})
+	}
+	return edits
+}
+
+// maxDiffCost is the maximum number of inserted and deleted lines for which myersDiff searches
+// the shortest edit script. Beyond it, all lines are replaced to limit time and memory.
+const maxDiffCost = 2048
+
+// myersDiff returns the shortest edit script transforming lines a into lines b, or an edit script
+// replacing all lines if it is longer than maxDiffCost.
+func myersDiff(a, b []string) []diffEdit {
+	n, m := len(a), len(b)
+	max := n + m
+	offset := max + 1
+	v := make([]int, 2*max+3)
+	// trace[d] holds the diagonals -d..d of v before round d
+	var trace [][]int
+	d := 0
+search:
+	for ; d <= max; d++ {
+		if d > maxDiffCost {
+			return replaceLines(a, b)
+		}
+		trace = append(trace, append([]int(nil), v[offset-d:offset+d+1]...))
+		for k := -d; k <= d; k += 2 {
+			var x int
+			if k == -d || (k != d && v[offset+k-1] < v[offset+k+1]) {
+				x = v[offset+k+1]
+			} else {
+				x = v[offset+k-1] + 1
+			}
+			y := x - k
+			for x < n && y < m && a[x] == b[y] {
+				x++
+				y++
+			}
+			v[offset+k] = x
+			if x >= n && y >= m {
+				break search
+			}
+		}
+	}
+	// backtrack from the end to the start, collecting the edits in reverse
+	edits := make([]diffEdit, 0, max)
+	x, y := n, m
+	for ; d > 0; d-- {
+		prev := trace[d]
+		k := x - y
+		prevK := k - 1
+		if k == -d || (k != d && prev[d+k-1] < prev[d+k+1]) {
+			prevK = k + 1
+		}
+		prevX := prev[d+prevK]
+		prevY := prevX - prevK
+		for x > prevX && y > prevY {
+			edits = append(edits, diffEdit{' ', a[x-1]})
+			x--
+			y--
+		}
+		if x == prevX {
+			edits = append(edits, diffEdit{'+', b[y-1]})
+			y--
+		} else {
+			edits = append(edits, diffEdit{'-', a[x-1]})
+			x--
+		}
+	}
+	for x > 0 && y > 0 {
+		edits = append(edits, diffEdit{' ', a[x-1]})
+		x--
+		y--
+	}
+	for i, j := 0, len(edits)-1; i < j; i, j = i+1, j-1 {
+		edits[i], edits[j] = edits[j], edits[i]
+	}
+	return edits
+}
+
+// replaceLines returns an edit script deleting all lines a and inserting all lines b.
+func replaceLines(a, b []string) []diffEdit {
+	edits := make([]diffEdit, 0, len(a)+len(b))
+	for _, line := range a {
+		edits = append(edits, diffEdit{'-', line})
+	}
+	for _, line := range b {
+		edits = append(edits, diffEdit{'+', line})
+	}
+	return edits
+}
+
+// unifiedDiff formats the edits as a unified diff with diffContext lines of context.
+func unifiedDiff(labelA, labelB string, edits []diffEdit) string {
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "--- %s\n+++ %s\n", labelA, labelB)
+	lineA, lineB := 0, 0 // lines of a and b before edit i
+	for i := 0; i < len(edits); {
+		if edits[i].kind == ' ' {
+			lineA++
+			lineB++
+			i++
+			continue
+		}
+		// a hunk starts with up to diffContext unchanged lines before the change at i
+		start := i
+		for start > 0 && i-start < diffContext && edits[start-1].kind == ' ' {
+			start--
+		}
+		startA, startB := lineA-(i-start), lineB-(i-start)
+		// it ends after diffContext unchanged lines, unless another change follows closely
+		end := i
+		for end < len(edits) {
+			if edits[end].kind != ' ' {
+				end++
+				continue
+			}
+			run := end
+			for run < len(edits) && edits[run].kind == ' ' {
+				run++
+			}
+			if run == len(edits) || run-end > 2*diffContext {
+				if run-end > diffContext {
+					run = end + diffContext
+				}
+				end = run
+				break
+			}
+			end = run
+		}
+		countA, countB := 0, 0
+		for _, e := range edits[start:end] {
+			if e.kind != '+' {
+				countA++
+			}
+			if e.kind != '-' {
+				countB++
+			}
+		}
+		fmt.Fprintf(&sb, "@@ -%s +%s @@\n", hunkRange(startA, countA), hunkRange(startB, countB))
+		for _, e := range edits[start:end] {
+			sb.WriteByte(e.kind)
+			sb.WriteString(e.line)
+			if !strings.HasSuffix(e.line, "\n") {
+				sb.WriteString("\n\\ No newline at end of file\n")
+			}
+		}
+		lineA, lineB = startA+countA, startB+countB
+		i = end
+	}
+	return sb.String()
+}
+
+// hunkRange formats the range of a hunk starting after line start with count lines.
+func hunkRange(start, count int) string {
+	if count == 0 {
+		return fmt.Sprintf("%d,0", start)
+	}
+	if count == 1 {
+		return fmt.Sprintf("%d", start+1)
+	}
+	return fmt.Sprintf("%d,%d", start+1, count)
+}
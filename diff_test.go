@@ -0,0 +1,145 @@
+package filestore
+
+import (
+	"math/rand"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+// hunkStart returns the index of the first line of a hunk range of a unified diff, like "-3,2".
+func hunkStart(t *testing.T, r string) int {
+	t.Helper()
+	fields := strings.SplitN(r[1:], ",", 2)
+	start, err := strconv.Atoi(fields[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(fields) == 2 && fields[1] == "0" {
+		// an empty range starts after the given line
+		return start
+	}
+	return start - 1
+}
+
+// applyUnified returns text with the unified diff applied, failing the test if it does not apply.
+func applyUnified(t *testing.T, text, unified string) string {
+	t.Helper()
+	a := splitLines(text)
+	lines := splitLines(unified)[2:]
+	var out []string
+	pos := 0
+	for i := 0; i < len(lines); {
+		header := strings.Fields(lines[i])
+		if len(header) != 4 || header[0] != "@@" {
+			t.Fatalf("malformed hunk header %q", lines[i])
+		}
+		start := hunkStart(t, header[1])
+		out = append(out, a[pos:start]...)
+		pos = start
+		for i++; i < len(lines) && !strings.HasPrefix(lines[i], "@@"); {
+			line := lines[i]
+			if i++; i < len(lines) && lines[i] == "\\ No newline at end of file\n" {
+				line = strings.TrimSuffix(line, "\n")
+				i++
+			}
+			if line[0] != '+' {
+				if pos >= len(a) || a[pos] != line[1:] {
+					t.Fatalf("diff does not apply at line %d:\n%s", pos+1, unified)
+				}
+				pos++
+			}
+			if line[0] != '-' {
+				out = append(out, line[1:])
+			}
+		}
+	}
+	return strings.Join(append(out, a[pos:]...), "")
+}
+
+func TestDiff(t *testing.T) {
+	fs, src := newTestStore(t)
+	path := filepath.Join(src, "a.txt")
+	var lines []string
+	for i := 0; i < 30; i++ {
+		lines = append(lines, strings.Repeat("x", i%5)+string(rune('a'+i%26)))
+	}
+	old := strings.Join(lines, "\n") + "\n"
+	lines[2] = "changed"
+	lines = append(lines[:10], lines[11:]...)
+	lines = append(lines[:20], append([]string{"inserted"}, lines[20:]...)...)
+	text := strings.Join(lines, "\n")
+	addFile(t, fs, path, old, "", "1")
+	addFile(t, fs, path, text, "", "2")
+	versions, err := fs.Versions(path, -1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	r, err := fs.Diff(versions[1], versions[0])
+	if err != nil || r.Binary || r.Identical {
+		t.Fatalf("Diff = %+v, %v, want a text diff", r, err)
+	}
+	if got := applyUnified(t, old, r.Unified); got != text {
+		t.Fatalf("applying the diff returns %q, want %q:\n%s", got, text, r.Unified)
+	}
+	if r, err := fs.Diff(versions[0], versions[0]); err != nil || !r.Identical || r.Unified != "" || r.FirstDifference != -1 {
+		t.Fatalf("Diff of a version with itself = %+v, %v, want identical", r, err)
+	}
+	bin := filepath.Join(src, "b.bin")
+	addFile(t, fs, bin, "\x00\x01\x02\x03", "", "1")
+	addFile(t, fs, bin, "\x00\x01\x09\x03\x04\x05", "", "2")
+	if versions, err = fs.Versions(bin, -1); err != nil {
+		t.Fatal(err)
+	}
+	r, err = fs.Diff(versions[1], versions[0])
+	if err != nil || !r.Binary || r.SizeA != 4 || r.SizeB != 6 || r.FirstDifference != 2 || r.DifferentBytes != 3 {
+		t.Fatalf("Diff of binary versions = %+v, %v", r, err)
+	}
+}
+
+func TestDiffUnified(t *testing.T) {
+	got := unifiedDiff("a", "b", diffLines(splitLines("1\n2\n3\n"), splitLines("1\n3\n4")))
+	want := "--- a\n+++ b\n@@ -1,3 +1,3 @@\n 1\n-2\n 3\n+4\n\\ No newline at end of file\n"
+	if got != want {
+		t.Fatalf("unifiedDiff = %q, want %q", got, want)
+	}
+}
+
+func TestDiffRandom(t *testing.T) {
+	rng := rand.New(rand.NewSource(1))
+	random := func() string {
+		var sb strings.Builder
+		n := rng.Intn(40)
+		for i := 0; i < n; i++ {
+			sb.WriteByte(byte('a' + rng.Intn(4)))
+			if rng.Intn(10) > 0 || i == n-1 && rng.Intn(2) == 0 {
+				sb.WriteByte('\n')
+			}
+		}
+		return sb.String()
+	}
+	for i := 0; i < 500; i++ {
+		a, b := random(), random()
+		if a == b {
+			continue
+		}
+		u := unifiedDiff("a", "b", diffLines(splitLines(a), splitLines(b)))
+		if got := applyUnified(t, a, u); got != b {
+			t.Fatalf("applying the diff of %q and %q returns %q:\n%s", a, b, got, u)
+		}
+	}
+}
+
+func TestDiffLarge(t *testing.T) {
+	var a, b []string
+	for i := 0; i < 20000; i++ {
+		a = append(a, string(rune('a'+i%26))+"\n")
+		b = append(b, string(rune('A'+i%26))+"\n")
+	}
+	b[0] = a[0]
+	// beyond maxDiffCost, all lines but the common prefix are replaced
+	if edits := diffLines(a, b); len(edits) != 1+2*19999 {
+		t.Fatalf("diffLines returned %d edits, want %d", len(edits), 1+2*19999)
+	}
+}
@@ -0,0 +1,180 @@
+package filestore
+
+import (
+	"encoding/hex"
+	"fmt"
+	"io"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// drillSamples is the number of versions restored and compared by Drill.
+const drillSamples = 20
+
+// DrillStep is a step of a recovery drill.
+type DrillStep struct {
+	Name     string        // "backup", "open", "verify" or "compare"
+	Duration time.Duration // the time the step took
+	Err      error         // why the step failed, nil if it passed
+}
+
+// DrillReport is the result of Drill.
+type DrillReport struct {
+	Steps      []DrillStep   // the steps run in order, ending with the first that failed
+	Verify     VerifyReport  // the report of verifying the backup
+	Versions   int           // the number of versions in the backup
+	Sampled    int           // the number of versions restored from the backup and compared
+	Mismatches []FileVersion // the sampled versions whose restored contents or metadata differ from the original
+}
+
+// Passed returns true if all steps of the drill passed.
+func (r DrillReport) Passed() bool {
+	if len(r.Steps) == 0 {
+		return false
+	}
+	for _, step := range r.Steps {
+		if step.Err != nil {
+			return false
+		}
+	}
+	return true
+}
+
+// String returns a summary of the drill with a line for each step.
+func (r DrillReport) String() string {
+	var b strings.Builder
+	if r.Passed() {
+		b.WriteString("recovery drill passed\n")
+	} else {
+		b.WriteString("recovery drill FAILED\n")
+	}
+	for _, step := range r.Steps {
+		result := "ok"
+		if step.Err != nil {
+			result = "failed: " + step.Err.Error()
+		}
+		fmt.Fprintf(&b, "%-8s %10s  %s\n", step.Name, step.Duration.Round(time.Millisecond), result)
+	}
+	fmt.Fprintf(&b, "%d versions, %d contents verified, %d versions sampled, %d mismatches\n",
+		r.Versions, r.Verify.Contents, r.Sampled, len(r.Mismatches))
+	return b.String()
+}
+
+// Drill proves that the filestore can be recovered from a backup. It backs the filestore up to
+// the directory dst with Backup, opens the backup as a scratch filestore, verifies all of its
+// contents, and restores a random sample of versions to files which are compared with the
+// checksums and metadata of the original versions. dst is created if it does not exist and must
+// be empty otherwise. It is removed if the drill passes and kept for inspection if it fails.
+// Failing steps are reported in the DrillReport, while an error is only returned if the drill
+// could not be run at all.
+func (fs *Filestore) Drill(dst string) (_ DrillReport, err error) {
+	op := newOp("Drill", dst)
+	defer op.done(&err)
+	if err := fs.ensureOpen(); err != nil {
+		return DrillReport{}, err
+	}
+	if entries, err := os.ReadDir(dst); err == nil && len(entries) > 0 {
+		return DrillReport{}, ErrBackupExists
+	}
+	var report DrillReport
+	step := func(name string, fn func() error) bool {
+		start := time.Now()
+		err := fn()
+		report.Steps = append(report.Steps, DrillStep{Name: name, Duration: time.Since(start), Err: err})
+		return err == nil
+	}
+	storeDir, filesDir := filepath.Join(dst, "store"), filepath.Join(dst, "files")
+	if !step("backup", func() error { return fs.Backup(storeDir) }) {
+		return report, nil
+	}
+	scratch := &Filestore{Dir: storeDir, Options: fs.Options &^ (ReadOnly | PruneOnQuota), Hash: fs.Hash,
+		VerifyKey: fs.VerifyKey, Key: fs.Key}
+	if !step("open", scratch.Open) {
+		return report, nil
+	}
+	defer scratch.Close()
+	if !step("verify", func() error {
+		verified, err := scratch.Verify(VerifyOptions{})
+		report.Verify = verified
+		if err == nil && !verified.OK() {
+			err = fmt.Errorf("filestore backup has %d problems, the first being %v", len(verified.Problems), verified.Problems[0].Err)
+		}
+		return err
+	}) {
+		return report, nil
+	}
+	if !step("compare", func() error { return fs.compareDrill(scratch, filesDir, &report) }) {
+		return report, nil
+	}
+	scratch.Close()
+	return report, os.RemoveAll(dst)
+}
+
+// compareDrill restores a random sample of the available versions of the backup scratch to
+// subdirectories of dir and compares them with the versions of the filestore, recording the
+// results in report.
+func (fs *Filestore) compareDrill(scratch *Filestore, dir string, report *DrillReport) error {
+	var versions []FileVersion
+	if err := scratch.Iterate(func(v FileVersion) bool {
+		report.Versions++
+		if v.Available {
+			versions = append(versions, v)
+		}
+		return true
+	}); err != nil {
+		return err
+	}
+	r := rand.New(rand.NewSource(time.Now().UnixNano()))
+	r.Shuffle(len(versions), func(i, j int) { versions[i], versions[j] = versions[j], versions[i] })
+	if len(versions) > drillSamples {
+		versions = versions[:drillSamples]
+	}
+	for i, v := range versions {
+		report.Sampled++
+		original, err := fs.GetByUUID(v.UUID)
+		if err != nil {
+			return fmt.Errorf("filestore version %s of %s is not in the original: %w", v.ShortID, v.Path, err)
+		}
+		restored := filepath.Join(dir, strconv.Itoa(i))
+		if err := ensureDirectory(restored, 0700); err != nil {
+			return err
+		}
+		if err := scratch.Restore(v, restored); err != nil {
+			return fmt.Errorf("filestore could not restore %s from the backup: %w", v.Path, err)
+		}
+		checksum, err := fileChecksum(filepath.Join(restored, v.Name), original.Hash)
+		if err != nil {
+			return err
+		}
+		if checksum != original.Checksum || v.Path != original.Path || v.Info != original.Info ||
+			v.Version != original.Version || !v.From.Equal(original.From) {
+			report.Mismatches = append(report.Mismatches, original)
+		}
+	}
+	if len(report.Mismatches) > 0 {
+		return fmt.Errorf("filestore backup differs from the original in %d of %d sampled versions", len(report.Mismatches), report.Sampled)
+	}
+	return nil
+}
+
+// fileChecksum returns the hex-encoded checksum of the file at path with the hash algorithm of
+// the given name.
+func fileChecksum(path, hashName string) (string, error) {
+	hasher, err := newHash(hashName)
+	if err != nil {
+		return "", err
+	}
+	f, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+	if _, err := io.Copy(hasher, f); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(hasher.Sum(nil)), nil
+}
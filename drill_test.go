@@ -0,0 +1,39 @@
+package filestore
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestDrill(t *testing.T) {
+	fs, src := newTestStore(t)
+	for i := 0; i < 30; i++ {
+		addFile(t, fs, filepath.Join(src, fmt.Sprintf("f%d.txt", i%3)), strings.Repeat("data", i+1), "v", "1")
+	}
+	dst := filepath.Join(t.TempDir(), "drill")
+	report, err := fs.Drill(dst)
+	if err != nil || !report.Passed() || report.Versions != 30 || report.Sampled != drillSamples {
+		t.Fatalf("Drill = %v, %v, want a passed drill of 30 versions", report, err)
+	}
+	if _, err := os.Stat(dst); !errors.Is(err, os.ErrNotExist) {
+		t.Fatalf("Stat of the backup = %v after a passed drill, want os.ErrNotExist", err)
+	}
+	// missing contents make the backup fail, which is kept for inspection
+	v, err := fs.Get(filepath.Join(src, "f0.txt"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.RemoveAll(fs.Root() + v.Checksum); err != nil {
+		t.Fatal(err)
+	}
+	if report, err = fs.Drill(dst); err != nil || report.Passed() {
+		t.Fatalf("Drill = %v, %v, want a failed drill", report, err)
+	}
+	if _, err := fs.Drill(dst); !errors.Is(err, ErrBackupExists) {
+		t.Fatalf("Drill to the kept backup = %v, want ErrBackupExists", err)
+	}
+}
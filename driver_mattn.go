@@ -0,0 +1,15 @@
+//go:build !sqlite_modernc
+
+package filestore
+
+import _ "github.com/mattn/go-sqlite3"
+
+// driverName is the name of the database/sql driver used for databases, which is the cgo driver
+// github.com/mattn/go-sqlite3 unless the package is built with the sqlite_modernc tag. Full-text
+// search requires building with the sqlite_fts5 tag.
+const driverName = "sqlite3"
+
+// dsnPragma returns the parameter of a data source name that sets the pragma name to value.
+func dsnPragma(name, value string) string {
+	return "_" + name + "=" + value
+}
@@ -0,0 +1,44 @@
+//go:build cgo && !sqlite_modernc
+
+package filestore
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+
+	sqlite3 "github.com/mattn/go-sqlite3"
+)
+
+// backupConn copies the database of the connection src to a new database at path with SQLite's
+// online backup API, in a single step so that the copy is consistent.
+func backupConn(ctx context.Context, src *sql.Conn, path string) error {
+	db, err := sql.Open(driverName, path)
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+	dst, err := db.Conn(ctx)
+	if err != nil {
+		return err
+	}
+	defer dst.Close()
+	return dst.Raw(func(dstConn interface{}) error {
+		return src.Raw(func(srcConn interface{}) error {
+			d, ok := dstConn.(*sqlite3.SQLiteConn)
+			s, ok2 := srcConn.(*sqlite3.SQLiteConn)
+			if !ok || !ok2 {
+				return errors.New("database driver does not support backups")
+			}
+			b, err := d.Backup("main", s, "main")
+			if err != nil {
+				return err
+			}
+			if _, err := b.Step(-1); err != nil {
+				b.Finish()
+				return err
+			}
+			return b.Finish()
+		})
+	})
+}
@@ -0,0 +1,16 @@
+//go:build !cgo && !sqlite_modernc
+
+package filestore
+
+import (
+	"context"
+	"database/sql"
+)
+
+// backupConn copies the database of the connection src to a new database at path with VACUUM
+// INTO, since the online backup API of github.com/mattn/go-sqlite3 is not available without cgo.
+// VACUUM INTO reads the database in a single transaction, so the copy is consistent.
+func backupConn(ctx context.Context, src *sql.Conn, path string) error {
+	_, err := src.ExecContext(ctx, "vacuum into ?;", path)
+	return err
+}
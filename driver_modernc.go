@@ -0,0 +1,27 @@
+//go:build sqlite_modernc
+
+package filestore
+
+import (
+	"context"
+	"database/sql"
+
+	_ "modernc.org/sqlite"
+)
+
+// driverName is the name of the database/sql driver used for databases, which is the pure Go
+// driver modernc.org/sqlite when the package is built with the sqlite_modernc tag, so that it
+// can be built without cgo. Its SQLite includes full-text search.
+const driverName = "sqlite"
+
+// dsnPragma returns the parameter of a data source name that sets the pragma name to value.
+func dsnPragma(name, value string) string {
+	return "_pragma=" + name + "(" + value + ")"
+}
+
+// backupConn copies the database of the connection src to a new database at path with VACUUM
+// INTO, which reads the database in a single transaction so that the copy is consistent.
+func backupConn(ctx context.Context, src *sql.Conn, path string) error {
+	_, err := src.ExecContext(ctx, "vacuum into ?;", path)
+	return err
+}
@@ -0,0 +1,31 @@
+package filestore
+
+import (
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestDriverPragmas(t *testing.T) {
+	fs := NewFilestore(filepath.Join(t.TempDir(), "store"), 0)
+	fs.BusyTimeout = 1234 * time.Millisecond
+	fs, _ = openTestStore(t, fs)
+	var mode string
+	var timeout int64
+	if err := fs.db.QueryRow("pragma journal_mode;").Scan(&mode); err != nil || mode != "wal" {
+		t.Fatalf("journal_mode = %q, %v, want wal", mode, err)
+	}
+	if err := fs.db.QueryRow("pragma busy_timeout;").Scan(&timeout); err != nil || timeout != 1234 {
+		t.Fatalf("busy_timeout = %d, %v, want 1234", timeout, err)
+	}
+	// read-only filestores cannot change the database
+	if err := fs.Close(); err != nil {
+		t.Fatal(err)
+	}
+	fs.Options |= ReadOnly
+	fs, _ = openTestStore(t, fs)
+	var queryOnly bool
+	if err := fs.db.QueryRow("pragma query_only;").Scan(&queryOnly); err != nil || !queryOnly {
+		t.Fatalf("query_only = %v, %v, want true", queryOnly, err)
+	}
+}
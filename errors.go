@@ -0,0 +1,68 @@
+package filestore
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"sync/atomic"
+)
+
+// FilestoreError is the type of the errors returned by the operations of a Filestore and its
+// transactions. It records the failed operation, an ID unique to the call within the process,
+// and the path and checksum concerned if they are known, so that errors from large batch jobs
+// can be correlated with specific files. Use errors.As to obtain it and errors.Is to check for
+// the underlying error.
+type FilestoreError struct {
+	Op       string // the name of the operation, e.g. "Add"
+	OpID     uint64 // the ID of the call of the operation
+	Path     string // the path of the file concerned, empty if unknown
+	Checksum string // the checksum of the contents concerned, empty if unknown
+	Err      error  // the underlying error
+}
+
+// Error returns the error message including the operation, ID, path and checksum.
+func (e *FilestoreError) Error() string {
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "filestore %s [op %d]", e.Op, e.OpID)
+	if e.Path != "" {
+		fmt.Fprintf(&sb, " path %s", e.Path)
+	}
+	if e.Checksum != "" {
+		fmt.Fprintf(&sb, " checksum %s", e.Checksum)
+	}
+	return sb.String() + ": " + e.Err.Error()
+}
+
+// Unwrap returns the underlying error.
+func (e *FilestoreError) Unwrap() error {
+	return e.Err
+}
+
+// lastOpID is the ID of the most recently started operation.
+var lastOpID uint64
+
+// operation is a call of a Filestore operation, whose errors are wrapped by done.
+type operation struct {
+	name     string
+	id       uint64
+	path     string
+	checksum string
+}
+
+// newOp starts a call of the operation with the given name concerning path, which may be empty.
+func newOp(name, path string) *operation {
+	return &operation{name: name, id: atomic.AddUint64(&lastOpID, 1), path: path}
+}
+
+// done wraps the error pointed to by err in a FilestoreError unless it is nil or already
+// wrapped, which happens when an operation calls another one.
+func (op *operation) done(err *error) {
+	if *err == nil {
+		return
+	}
+	var fe *FilestoreError
+	if errors.As(*err, &fe) {
+		return
+	}
+	*err = &FilestoreError{Op: op.name, OpID: op.id, Path: op.path, Checksum: op.checksum, Err: *err}
+}
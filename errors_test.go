@@ -0,0 +1,29 @@
+package filestore
+
+import (
+	"errors"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestFilestoreError(t *testing.T) {
+	fs, src := newTestStore(t)
+	path := filepath.Join(src, "missing.txt")
+	err := fs.Add(path, "", "1")
+	var fe *FilestoreError
+	if !errors.As(err, &fe) || fe.Op != "Add" || fe.OpID == 0 || fe.Path != path {
+		t.Fatalf("Add of a missing file = %#v, want a FilestoreError of Add with the path", err)
+	}
+	id := fe.OpID
+	err = fs.DeleteVersion(FileVersion{ID: 99, Path: path, Checksum: "abc"})
+	if !errors.As(err, &fe) || fe.Op != "DeleteVersion" || fe.Checksum != "abc" || !errors.Is(err, ErrUnknownVersion) {
+		t.Fatalf("DeleteVersion of an unknown version = %v, want a FilestoreError wrapping ErrUnknownVersion", err)
+	}
+	if fe.OpID == id {
+		t.Fatalf("calls share the operation ID %d", id)
+	}
+	if msg := err.Error(); !strings.Contains(msg, "DeleteVersion") || !strings.Contains(msg, "checksum abc") {
+		t.Fatalf("error message %q lacks the operation or checksum", msg)
+	}
+}
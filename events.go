@@ -0,0 +1,153 @@
+package filestore
+
+import (
+	"fmt"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// EventKind is the kind of an Event.
+type EventKind int
+
+const (
+	EventVersionAdded    EventKind = iota + 1 // a version has been added
+	EventVersionDeleted                       // a version has been deleted
+	EventVersionExpiring                      // a version will soon be removed by Prune
+	EventQuotaWarning                         // the filestore takes more than a warning threshold of its Quota
+)
+
+// String returns a lowercase name of the event kind.
+func (k EventKind) String() string {
+	switch k {
+	case EventVersionAdded:
+		return "version-added"
+	case EventVersionDeleted:
+		return "version-deleted"
+	case EventVersionExpiring:
+		return "version-expiring"
+	case EventQuotaWarning:
+		return "quota-warning"
+	}
+	return "unknown"
+}
+
+// Event informs hooks about a change of the filestore.
+type Event struct {
+	Kind    EventKind   // the kind of event
+	Version FileVersion // the version concerned, the zero FileVersion for EventQuotaWarning
+	// Date is the datetime of the event, or the datetime on which an expiring version expires.
+	// It is zero for versions expiring because the maximum number of versions is reached.
+	Date time.Time
+	// Used is the number of bytes taken and Threshold the fraction of the Quota crossed for an
+	// EventQuotaWarning.
+	Used      int64
+	Threshold float64
+}
+
+// Hook is a function called with the events of a filestore. Hooks are called synchronously after
+// the operation causing the event, so they should return quickly.
+type Hook func(Event)
+
+// AddHook registers a hook that is called with all subsequent events of the filestore.
+func (fs *Filestore) AddHook(hook Hook) {
+	fs.hooksMutex.Lock()
+	defer fs.hooksMutex.Unlock()
+	fs.hooks = append(fs.hooks, hook)
+}
+
+// subscription is a channel subscribed to the events of versions whose paths match a pattern.
+type subscription struct {
+	pattern string
+	ch      chan<- Event
+}
+
+// SubscribePath sends the subsequent events of versions whose paths match pattern to ch, so that
+// applications can react to changes of particular files. The pattern is a filepath.Match pattern
+// matched against the name of the file, its slash-separated path and every trailing part of the
+// path, so that "config/*.yaml" matches the YAML files of all directories named config. Events
+// are sent without blocking and dropped if ch is not ready, so ch should be buffered. A channel
+// may be subscribed with several patterns, and receives each event once.
+func (fs *Filestore) SubscribePath(pattern string, ch chan<- Event) error {
+	if _, err := filepath.Match(pattern, ""); err != nil {
+		return fmt.Errorf("filestore subscription has invalid pattern %q: %w", pattern, err)
+	}
+	fs.hooksMutex.Lock()
+	defer fs.hooksMutex.Unlock()
+	fs.subscriptions = append(fs.subscriptions, subscription{pattern: pattern, ch: ch})
+	return nil
+}
+
+// Unsubscribe stops sending events to ch for all patterns it was subscribed with.
+func (fs *Filestore) Unsubscribe(ch chan<- Event) {
+	fs.hooksMutex.Lock()
+	defer fs.hooksMutex.Unlock()
+	kept := fs.subscriptions[:0]
+	for _, s := range fs.subscriptions {
+		if s.ch != ch {
+			kept = append(kept, s)
+		}
+	}
+	fs.subscriptions = kept
+}
+
+// pathMatches returns true if pattern matches the name of the file at path, its slash-separated
+// path or a trailing part of the path following a slash.
+func pathMatches(pattern, path string) bool {
+	path = filepath.ToSlash(path)
+	if ok, _ := filepath.Match(pattern, filepath.Base(path)); ok {
+		return true
+	}
+	for {
+		if ok, _ := filepath.Match(pattern, path); ok {
+			return true
+		}
+		i := strings.Index(path, "/")
+		if i < 0 {
+			return false
+		}
+		path = path[i+1:]
+	}
+}
+
+// hasHooks returns true if hooks or subscriptions are registered.
+func (fs *Filestore) hasHooks() bool {
+	fs.hooksMutex.Lock()
+	defer fs.hooksMutex.Unlock()
+	return len(fs.hooks) > 0 || len(fs.subscriptions) > 0
+}
+
+// emit calls all hooks with the event and sends it to the subscriptions matching its version.
+func (fs *Filestore) emit(e Event) {
+	fs.hooksMutex.Lock()
+	hooks := append([]Hook(nil), fs.hooks...)
+	subscriptions := append([]subscription(nil), fs.subscriptions...)
+	fs.hooksMutex.Unlock()
+	for _, hook := range hooks {
+		hook(e)
+	}
+	if e.Version.Path == "" {
+		return
+	}
+	sent := make(map[chan<- Event]bool)
+	for _, s := range subscriptions {
+		if sent[s.ch] || !pathMatches(s.pattern, e.Version.Path) {
+			continue
+		}
+		sent[s.ch] = true
+		select {
+		case s.ch <- e:
+		default:
+		}
+	}
+}
+
+// emitAdded emits an EventVersionAdded for the version with the given ID if hooks are registered.
+func (fs *Filestore) emitAdded(q querier, id int64) {
+	if !fs.hasHooks() {
+		return
+	}
+	if v, err := fs.versionByID(q, id); err == nil {
+		fs.emit(Event{Kind: EventVersionAdded, Version: v, Date: v.From})
+	}
+}
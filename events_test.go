@@ -0,0 +1,65 @@
+package filestore
+
+import (
+	"errors"
+	"path/filepath"
+	"testing"
+)
+
+func TestSubscribePath(t *testing.T) {
+	fs, src := newTestStore(t)
+	ch := make(chan Event, 10)
+	for _, pattern := range []string{"config/*.yaml", "*.yaml"} {
+		if err := fs.SubscribePath(pattern, ch); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := fs.SubscribePath("[", ch); !errors.Is(err, filepath.ErrBadPattern) {
+		t.Fatalf("SubscribePath with an invalid pattern = %v, want filepath.ErrBadPattern", err)
+	}
+	// events are dropped if the channel is not ready
+	if err := fs.SubscribePath("*", make(chan Event)); err != nil {
+		t.Fatal(err)
+	}
+	a := filepath.Join(src, "config", "a.yaml")
+	addFile(t, fs, a, "a", "", "")
+	addFile(t, fs, filepath.Join(src, "config", "b.txt"), "b", "", "")
+	if len(ch) != 1 {
+		t.Fatalf("%d events sent, want the one of a.yaml", len(ch))
+	}
+	if e := <-ch; e.Kind != EventVersionAdded || e.Version.Path != a {
+		t.Fatalf("event %+v, want the version of %s added", e, a)
+	}
+	v, err := fs.Get(a)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := fs.DeleteVersion(v); err != nil {
+		t.Fatal(err)
+	}
+	if e := <-ch; e.Kind != EventVersionDeleted {
+		t.Fatalf("event %+v, want the version deleted", e)
+	}
+	fs.Unsubscribe(ch)
+	addFile(t, fs, a, "a", "", "")
+	if len(ch) != 0 {
+		t.Fatalf("%d events sent after Unsubscribe, want none", len(ch))
+	}
+}
+
+func TestPathMatches(t *testing.T) {
+	for _, c := range []struct {
+		pattern, path string
+		want          bool
+	}{
+		{"config/*.yaml", "/x/config/a.yaml", true},
+		{"config/*.yaml", "/x/configs/a.yaml", false},
+		{"/x/*/a.yaml", "/x/config/a.yaml", true},
+		{"*.yaml", "/x/config/a.yaml", true},
+		{"*.yaml", "/x/config/a.txt", false},
+	} {
+		if got := pathMatches(c.pattern, c.path); got != c.want {
+			t.Fatalf("pathMatches(%q, %q) = %v, want %v", c.pattern, c.path, got, c.want)
+		}
+	}
+}
@@ -3,19 +3,32 @@ package filestore
 import (
 	"io"
 	"os"
+	"path/filepath"
 	"unicode/utf8"
-
-	"github.com/golang/snappy"
 )
 
-// ensureDirectory creates a directory at path if possible,
-// returns an error otherwise.
+// ensureDirectory creates a directory at path with permissions perm if possible,
+// returns an error otherwise. Missing parent directories are created with the same
+// permissions.
 func ensureDirectory(path string, perm os.FileMode) error {
 	src, err := os.Stat(path)
 	if os.IsNotExist(err) {
+		// the umask applies to the permissions given to MkdirAll, so they are set afterwards
+		var created []string
+		for dir := filepath.Clean(path); ; dir = filepath.Dir(dir) {
+			if _, err := os.Stat(dir); !os.IsNotExist(err) || filepath.Dir(dir) == dir {
+				break
+			}
+			created = append(created, dir)
+		}
 		if err := os.MkdirAll(path, perm); err != nil {
 			return err
 		}
+		for _, dir := range created {
+			if err := os.Chmod(dir, perm); err != nil {
+				return err
+			}
+		}
 		return nil
 	}
 	if src.Mode().IsRegular() {
@@ -38,8 +51,19 @@ func asDirectoryPath(path string) string {
 }
 
 // copyFile copies file src to dst. If dst already exists, it is truncated and overwritten.
-// If useCompression is true, then the file data is compressed using Zlib.
-func copyFile(src, dst string, useCompression, restore bool) error {
+// Unless c stores data unchanged, the file data is compressed and encrypted with c, or decrypted
+// and decompressed if restore is true. Otherwise, src is cloned on file systems supporting it, or copied preserving
+// the holes of sparse files where the platform supports it. If perm is not zero,
+// dst gets exactly the permissions perm, otherwise new files are created like with os.Create.
+// The bytes read from src are recorded in tracker, which may be nil.
+func copyFile(src, dst string, c codec, restore bool, perm os.FileMode, tracker *progressTracker) error {
+	if c.plain() {
+		// contents are copied unchanged, so clone them if the file system supports it
+		if info, err := os.Stat(src); err == nil && info.Mode().IsRegular() && cloneFile(src, dst, perm) {
+			tracker.add(info.Size())
+			return nil
+		}
+	}
 	fin, err := os.Open(src)
 	if err != nil {
 		return err
@@ -51,27 +75,34 @@ func copyFile(src, dst string, useCompression, restore bool) error {
 		return err
 	}
 	defer fout.Close()
+	if perm != 0 {
+		if err := fout.Chmod(perm); err != nil {
+			return err
+		}
+	}
 
-	if useCompression {
+	if !c.plain() {
 		if restore {
 			// restoring means that we have to decompress
-			csrc := snappy.NewReader(fin)
-			_, err = io.Copy(fout, csrc)
+			csrc, err := c.reader(tracker.reader(fin))
 			if err != nil {
 				return err
 			}
-			return nil
+			defer csrc.Close()
+			_, err = io.Copy(fout, csrc)
+			return err
 		}
 		// not restoring, so compress the src to dst
-		cdst := snappy.NewWriter(fout)
-		defer cdst.Close()
-		_, err = io.Copy(cdst, fin)
+		cdst, err := c.writer(fout)
 		if err != nil {
 			return err
 		}
-		return nil
+		if _, err := io.Copy(cdst, tracker.reader(fin)); err != nil {
+			cdst.Close()
+			return err
+		}
+		return cdst.Close()
 	}
-	// no compression, just copy from src to dst
-	_, err = io.Copy(fout, fin)
-	return err
+	// no compression, just copy from src to dst preserving holes of sparse files
+	return copySparse(fout, fin, tracker)
 }
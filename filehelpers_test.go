@@ -0,0 +1,85 @@
+package filestore
+
+import (
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+)
+
+func TestEnsureDirectoryPermissions(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("permission bits are not supported on Windows")
+	}
+	base := t.TempDir()
+	leaf := filepath.Join(base, "a", "b", "c")
+	if err := ensureDirectory(leaf, 0711); err != nil {
+		t.Fatal(err)
+	}
+	for _, dir := range []string{filepath.Join(base, "a"), filepath.Join(base, "a", "b"), leaf} {
+		info, err := os.Stat(dir)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if perm := info.Mode().Perm(); perm != 0711 {
+			t.Errorf("%s has permissions %o, want 711", dir, perm)
+		}
+	}
+	if info, _ := os.Stat(base); info.Mode().Perm() == 0711 {
+		t.Error("permissions of an existing parent directory have been changed")
+	}
+	file := filepath.Join(base, "file")
+	writeFile(t, file, "")
+	if err := ensureDirectory(file, 0700); err != ErrDirectoryIsFile {
+		t.Fatalf("ensureDirectory on a file = %v, want ErrDirectoryIsFile", err)
+	}
+}
+
+func TestPermissions(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("permission bits are not supported on Windows")
+	}
+	fs := NewFilestore(filepath.Join(t.TempDir(), "store"), 0)
+	fs.DirMode, fs.FileMode, fs.RestoreMode = 0750, 0640, 0604
+	fs, src := openTestStore(t, fs)
+	v := addFile(t, fs, filepath.Join(src, "a.txt"), "a", "", "1")
+	dst := t.TempDir()
+	if err := fs.Restore(v, dst); err != nil {
+		t.Fatal(err)
+	}
+	for path, want := range map[string]os.FileMode{
+		fs.Root():                   0750,
+		filepath.Dir(v.Local):       0750,
+		v.Local:                     0640,
+		fs.dbPath():                 0640,
+		filepath.Join(dst, "a.txt"): 0604,
+	} {
+		info, err := os.Stat(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if perm := info.Mode().Perm(); perm != want {
+			t.Errorf("%s has permissions %o, want %o", path, perm, want)
+		}
+	}
+}
+
+func TestCopyFilePlain(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("permission bits are not supported on Windows")
+	}
+	dir := t.TempDir()
+	src, dst := filepath.Join(dir, "src"), filepath.Join(dir, "dst")
+	writeFile(t, src, "contents")
+	writeFile(t, dst, "longer old contents")
+	// contents are cloned on file systems supporting it and copied otherwise
+	if err := copyFile(src, dst, codecs[CompressionNone], true, 0600, nil); err != nil {
+		t.Fatal(err)
+	}
+	if got := readFile(t, dst); got != "contents" {
+		t.Fatalf("copied %q, want %q", got, "contents")
+	}
+	if info, err := os.Stat(dst); err != nil || info.Mode().Perm() != 0600 {
+		t.Fatalf("Stat = %v, %v, want permissions 600", info, err)
+	}
+}
@@ -1,6 +1,7 @@
 package filestore
 
 import (
+	"crypto/ed25519"
 	"database/sql"
 	"encoding/hex"
 	"errors"
@@ -8,37 +9,115 @@ import (
 	"io"
 	"os"
 	"path/filepath"
+	"strconv"
 	"strings"
 	"sync"
 	"time"
 
 	"github.com/dlclark/metaphone3"
-	_ "github.com/mattn/go-sqlite3"
 	"github.com/rasteric/flags"
-	"golang.org/x/crypto/blake2b"
 )
 
 var ErrDirectoryIsFile = errors.New("directory cannot be created because it is a file")
 var ErrNotOpen = errors.New("filestore is not open")
 var ErrInvalidDate = errors.New("filestore entry contains invalid date")
+var ErrNotFound = errors.New("filestore contains no versions of the given path")
+var ErrReadOnly = errors.New("filestore is read-only")
+var ErrNeedsMigration = errors.New("filestore database needs to be migrated by opening it once without the ReadOnly option")
 
-const Compress = flags.Flag0 // if option is set, then files are compressed with Snappy
+// DefaultBusyTimeout is how long operations wait for locks of the database held by other
+// processes before they fail, unless the BusyTimeout of the filestore is set.
+const DefaultBusyTimeout = 5 * time.Second
+
+// DefaultSegmentCacheSize is the maximum total size in bytes of the decompressed segments kept
+// in memory for OpenSeekable, unless the SegmentCacheSize of the filestore is set.
+const DefaultSegmentCacheSize = 16 << 20
+
+const Compress = flags.Flag0        // if option is set and no Compression is set, then files are compressed with Snappy
+const Shared = flags.Flag1          // if option is set, then the filestore is readable by the group
+const ReadOnly = flags.Flag2        // if option is set, then the filestore is opened for reading only and adding files fails with ErrReadOnly
+const Summarize = flags.Flag3       // if option is set, then a summary of the changes is stored with each added version
+const Chunked = flags.Flag4         // if option is set, then files are stored in content-defined chunks shared between files
+const RestoreLink = flags.Flag5     // if option is set, then uncompressed contents are restored as hard links to their blobs when possible
+const Encrypted = flags.Flag6       // if option is set, then added contents are encrypted with data keys sealed with Key
+const PruneOnQuota = flags.Flag7    // if option is set, then the oldest versions are pruned when adding a file would exceed the Quota
+const Umask = flags.Flag8           // if option is set, then the permissions of created directories and files are reduced by the umask of the process
+const Xattrs = flags.Flag9          // if option is set, then the extended attributes and ACLs of files are recorded when they are added and set when they are restored
+const NormalizePaths = flags.Flag10 // if option is set, then paths are stored in Unicode normalization form NFC, so that paths of macOS (NFD) and other systems match
+const FoldCase = flags.Flag11       // if option is set, then paths are stored case-folded and normalized, so that paths differing in case match, which folds the names of restored files as well
 
 // Filestore stores different versions of a file on the local hard disk and
 // allows you to retrieve them by path or global FileID.
 type Filestore struct {
 	Dir     string     // the root directory under which versions are stored
 	Options flags.Bits // flag options for configuring the filestore
+	// CacheDir is an optional directory, preferably on fast storage, in which decompressed
+	// copies of the latest versions obtained with Get are kept. It is not used if empty.
+	CacheDir  string
+	CacheSize int64 // the maximum total size in bytes of the files in CacheDir
+	// SegmentCacheSize is the maximum total size in bytes of decompressed segments of compressed
+	// contents kept in memory for random access with OpenSeekable, DefaultSegmentCacheSize if
+	// zero. No segments are cached if it is negative.
+	SegmentCacheSize int64
+	DirMode          os.FileMode        // permissions of the root directory and directories of blobs, see the Shared and Umask options
+	FileMode         os.FileMode        // permissions of the database, blobs and cached copies, see the Shared and Umask options
+	RestoreMode      os.FileMode        // permissions of restored files, those of the source files if zero
+	Symlinks         SymlinkPolicy      // how symbolic links are added, SymlinkFollow if zero
+	Retention        RetentionPolicy    // determines which versions are removed by Prune
+	BusyTimeout      time.Duration      // how long to wait for database locks held by other processes, DefaultBusyTimeout if zero
+	Quota            int64              // the maximum number of bytes taken by blobs and chunks, unlimited if zero
+	QuotaWarnings    []float64          // fractions of Quota whose crossing emits EventQuotaWarning, DefaultQuotaWarnings if nil
+	Ignore           []string           // filepath.Match patterns of files and directories skipped by AddTree and Watch
+	Roots            []string           // the directories versions are expected to be added from, see OutsideRoots
+	TagRules         []TagRule          // rules tagging added versions
+	Progress         Progress           // receives progress reports of adding and restoring files, may be nil
+	Hash             string             // the hash algorithm of the checksums of added files, HashBlake2b512 if empty
+	Tokenizer        string             // the FTS5 tokenizer of the full text index of a new filestore, e.g. TokenizerTrigram, TokenizerUnicode61 if empty
+	NewUUID          func() string      // returns the UUIDs of added versions, which must be unique, random UUIDs if nil
+	Compression      string             // the codec of added files, e.g. CompressionZstd, Snappy or none depending on Compress if empty
+	Incompressible   []string           // extensions of files stored uncompressed, DefaultIncompressible if nil
+	SigningKey       ed25519.PrivateKey // signs the checksum, path and date of every added version if set
+	VerifyKey        ed25519.PublicKey  // verifies signatures of versions, the public key of SigningKey if nil
+	// Key is the key of KeySize bytes with which the data keys of encrypted blobs are sealed. It
+	// is required if the Encrypted option is set and to read encrypted blobs. CacheDir is not used
+	// if a key is given, so that no decrypted copies are kept on disk.
+	Key []byte
+	// Blobs stores the blobs and chunks of the contents, which are kept in files in the root
+	// directory if it is nil. Contents cannot be linked, exported or given stable paths otherwise.
+	Blobs BlobStore
+	// RestoreTransformers transform the contents of restored versions in order, for example to
+	// convert line endings with ConvertLineEndings. Contents are restored unchanged if it is nil.
+	RestoreTransformers []RestoreTransformer
 	// following are various unexported internal properties
-	db                   *sql.DB       // database connection
-	mutex                *sync.RWMutex // for synchronization
-	queryIDStmt          *sql.Stmt     // used for querying
-	insertFileStmt       *sql.Stmt     // for adding files
-	insertVersionStmt    *sql.Stmt     // for adding files
-	hasVersionStmt       *sql.Stmt     // for checking a version exists with path as key
-	getVersionStmt       *sql.Stmt     // for obtaining the latest version (in terms of date)
-	getVersionsStmt      *sql.Stmt     // for obtaining all versions up to a limit
-	getVersionsAfterStmt *sql.Stmt     // for obtaining all versions after date with a limit
+	db                   *sql.DB        // database connection
+	mutex                *sync.RWMutex  // for synchronization
+	queryIDStmt          *sql.Stmt      // used for querying
+	insertFileStmt       *sql.Stmt      // for adding files
+	insertVersionStmt    *sql.Stmt      // for adding files
+	queryInfoStmt        *sql.Stmt      // for looking up info strings
+	insertInfoStmt       *sql.Stmt      // for adding info strings
+	hasVersionStmt       *sql.Stmt      // for checking a version exists with path as key
+	getVersionStmt       *sql.Stmt      // for obtaining the latest version (in terms of date)
+	getVersionsStmt      *sql.Stmt      // for obtaining all versions up to a limit
+	getVersionsAfterStmt *sql.Stmt      // for obtaining all versions after date with a limit
+	cache                *blobCache     // cache of decompressed latest versions, nil if not used
+	segments             *segmentCache  // cache of decompressed segments for random access
+	hooks                []Hook         // functions called with events
+	subscriptions        []subscription // channels receiving the events of matching paths
+	hooksMutex           sync.Mutex     // for synchronizing access to hooks
+	memory               string         // the name of the in-memory database of filestores created with NewMemoryFilestore
+	quotaWarned          float64        // the highest quota warning threshold crossed when last checked
+	watchers             int32          // the number of watchers started with Watch and not closed yet
+	webhooks             sync.WaitGroup // pending requests of webhooks
+	webhooksClosed       bool           // true if Close waits or has waited for the requests of webhooks
+	webhooksMutex        sync.Mutex     // for synchronizing adding requests to webhooks with waiting for them
+	dbKey                string         // the key of the database in the registry of open databases
+	suspended            bool           // true if the filestore has been suspended and not resumed yet
+	stateMutex           sync.Mutex     // for synchronizing opening, closing, suspending and resuming
+	shortIDSalt          uint64         // added to version IDs in short IDs
+	fetchMutex           sync.Mutex     // for fetching pulled contents one at a time
+	unsynced             []string       // blobs and chunks written since the last Sync
+	syncMutex            sync.Mutex     // for synchronizing access to unsynced
 }
 
 // NewFilestore returns a new filestore based on the given root directory and options.
@@ -46,43 +125,96 @@ func NewFilestore(root string, options flags.Bits) *Filestore {
 	return &Filestore{Dir: root, Options: options}
 }
 
-// Open opens the filestore and prepares it for access.
-func (fs *Filestore) Open() error {
-	if err := ensureDirectory(fs.Root(), 0700); err != nil {
-		return fmt.Errorf("filestore could not create root directory: %w", err)
+// Open opens the filestore and prepares it for access. Filestores opened on the same directory
+// with the same Shared and ReadOnly options within a process share their database handle, which
+// is closed when the last of them is closed. Read-only filestores cannot migrate the database of
+// a filestore created by an earlier version of this package, for which ErrNeedsMigration is
+// returned. ErrPathsNotNormalized is returned if the NormalizePaths or FoldCase option is set
+// for a filestore that has versions of paths added without it which it would no longer find.
+func (fs *Filestore) Open() (err error) {
+	op := newOp("Open", fs.Dir)
+	defer op.done(&err)
+	fs.stateMutex.Lock()
+	defer fs.stateMutex.Unlock()
+	fs.suspended = false
+	fs.webhooksMutex.Lock()
+	fs.webhooksClosed = false
+	fs.webhooksMutex.Unlock()
+	return fs.open()
+}
+
+func (fs *Filestore) open() (err error) {
+	if err := fs.openRoot(); err != nil {
+		return err
+	}
+	if _, err := newHash(fs.hashName()); err != nil {
+		return err
+	}
+	if _, err := newCodec(fs.compression()); err != nil {
+		return err
+	}
+	if fs.Key != nil && len(fs.Key) != KeySize {
+		return ErrInvalidKey
+	}
+	fs.segments = newSegmentCache(fs.segmentCacheSize())
+	if fs.CacheDir != "" && fs.Key == nil {
+		if fs.cache, err = openBlobCache(fs.CacheDir, fs.CacheSize, fs.dirMode()); err != nil {
+			return fmt.Errorf("filestore could not open the cache directory: %w", err)
+		}
 	}
-	fs.mutex = &sync.RWMutex{}
+	// now init the db, unless another filestore in this process has already opened it
+	if err := fs.acquireDB(func() error {
+		if flags.Has(fs.Options, ReadOnly) {
+			return fs.checkMigrated()
+		}
+		if err := fs.createTables(); err != nil {
+			return err
+		}
+		if mode := fs.fileMode(); mode != 0 && fs.memory == "" {
+			if err := os.Chmod(fs.dbPath(), mode); err != nil {
+				return fmt.Errorf("filestore could not set permissions of the database: %w", err)
+			}
+		}
+		return nil
+	}); err != nil {
+		return err
+	}
+	defer func() {
+		if err != nil {
+			fs.releaseDB()
+		}
+	}()
 	fs.mutex.Lock()
 	defer fs.mutex.Unlock()
-	// now init the db
-	var err error
-	fs.db, err = sql.Open("sqlite3", fs.dbPath())
-	if err != nil {
-		return fmt.Errorf("filestore could not open the database: %w", err)
+	if err := fs.loadShortIDSalt(flags.Has(fs.Options, ReadOnly)); err != nil {
+		return err
 	}
-	_, err = fs.db.Exec("create table if not exists Files (file_id integer primary key, checksum text not null);")
-	if err != nil {
-		return fs.dbError(err)
+	if err := fs.loadPolicy(); err != nil {
+		return err
 	}
-	_, err = fs.db.Exec("create unique index if not exists Files_Index on Files(checksum);")
+	if err := fs.checkKey(flags.Has(fs.Options, ReadOnly)); err != nil {
+		return err
+	}
+	if err := fs.checkStoredPaths(flags.Has(fs.Options, ReadOnly)); err != nil {
+		return err
+	}
+	fs.queryIDStmt, err = fs.db.Prepare("select file_id from Files where checksum=?;")
 	if err != nil {
 		return fs.dbError(err)
 	}
-	_, err = fs.db.Exec("create table if not exists Versions (version_id integer primary key, path text not null, info text not null, fuzzy text not null, version text not null, date text not null, file integer, foreign key(file) references Files(file_id));")
+	fs.insertFileStmt, err = fs.db.Prepare("insert into Files(checksum, hash, codec, sealed_key, size, stored, chunked) Values(?, ?, ?, ?, ?, ?, ?);")
 	if err != nil {
 		return fs.dbError(err)
 	}
-	_, err = fs.db.Exec("create virtual table if not exists VersionsFts using FTS5 (content='Versions',prefix='2 3 4',version_id,path,info,fuzzy,version,date,file);")
-
-	fs.queryIDStmt, err = fs.db.Prepare("select file_id from Files where checksum=?;")
+	fs.insertVersionStmt, err = fs.db.Prepare("insert into Versions(path, info_id, version, date, file, uuid, mode, mtime) values(?, ?, ?, ?, ?, ?, ?, ?);")
 	if err != nil {
 		return fs.dbError(err)
 	}
-	fs.insertFileStmt, err = fs.db.Prepare("insert into Files(checksum) Values(?);")
+	fs.queryInfoStmt, err = fs.db.Prepare("select info_id from Infos where info=?;")
 	if err != nil {
 		return fs.dbError(err)
 	}
-	fs.insertVersionStmt, err = fs.db.Prepare("insert into Versions(path, info, fuzzy, version, date, file) values(?, ?, ?, ?, datetime('now'), ?);")
+	fs.insertInfoStmt, err = fs.db.Prepare("insert or ignore into Infos(info, fuzzy) values(?, ?);")
 	if err != nil {
 		return fs.dbError(err)
 	}
@@ -90,23 +222,59 @@ func (fs *Filestore) Open() error {
 	if err != nil {
 		return fs.dbError(err)
 	}
-	fs.getVersionStmt, err = fs.db.Prepare("select version_id, path, info, fuzzy, version, date, checksum from Versions inner join Files on Versions.file=Files.file_id where Versions.path=? order by Versions.date desc limit 1;")
+	fs.getVersionStmt, err = fs.db.Prepare(selectVersions + " where Versions.path=? order by Versions.date desc, Versions.seq desc limit 1;")
 	if err != nil {
 		return fs.dbError(err)
 	}
-	fs.getVersionsStmt, err = fs.db.Prepare("select version_id, path, info, fuzzy, version, date, checksum from Versions inner join Files on Versions.file=Files.file_id where Versions.path=? order by Versions.date desc limit ?;")
+	fs.getVersionsStmt, err = fs.db.Prepare(selectVersions + " where Versions.path=? order by Versions.date desc, Versions.seq desc limit ?;")
 	if err != nil {
 		return fs.dbError(err)
 	}
-	fs.getVersionsAfterStmt, err = fs.db.Prepare("select version_id, path, info, fuzzy, version, date, checksum from Versions inner join Files on Versions.file=Files.file_id where Versions.path=? and Versions.date > ? order by Versions.date desc limit ?;")
+	fs.getVersionsAfterStmt, err = fs.db.Prepare(selectVersions + " where Versions.path=? and Versions.date > ? order by Versions.date desc, Versions.seq desc limit ?;")
 	if err != nil {
 		return fs.dbError(err)
 	}
 	return nil
 }
 
-// Close closes the filestore and frees associated resources.
-func (fs *Filestore) Close() error {
+// openRoot checks that the root directory exists if the filestore is read-only and creates it
+// otherwise. Filestores in memory have no root directory.
+func (fs *Filestore) openRoot() error {
+	if fs.memory != "" {
+		return nil
+	}
+	if flags.Has(fs.Options, ReadOnly) {
+		if _, err := os.Stat(fs.Root()); err != nil {
+			return fmt.Errorf("filestore could not open root directory: %w", err)
+		}
+	} else if err := ensureDirectory(fs.Root(), fs.dirMode()); err != nil {
+		return fmt.Errorf("filestore could not create root directory: %w", err)
+	}
+	return nil
+}
+
+// Close closes the filestore and frees associated resources. It waits for pending webhook requests.
+// ErrNotOpen is returned if the filestore is not open.
+func (fs *Filestore) Close() (err error) {
+	op := newOp("Close", fs.Dir)
+	defer op.done(&err)
+	fs.webhooksMutex.Lock()
+	fs.webhooksClosed = true
+	fs.webhooksMutex.Unlock()
+	fs.webhooks.Wait()
+	fs.stateMutex.Lock()
+	defer fs.stateMutex.Unlock()
+	if fs.suspended {
+		fs.suspended = false
+		return nil
+	}
+	if fs.db == nil {
+		return ErrNotOpen
+	}
+	return fs.close()
+}
+
+func (fs *Filestore) close() error {
 	fs.mutex.Lock()
 	defer fs.mutex.Unlock()
 	if err := fs.queryIDStmt.Close(); err != nil {
@@ -118,10 +286,19 @@ func (fs *Filestore) Close() error {
 	if err := fs.insertVersionStmt.Close(); err != nil {
 		return fs.dbError(err)
 	}
+	if err := fs.queryInfoStmt.Close(); err != nil {
+		return fs.dbError(err)
+	}
+	if err := fs.insertInfoStmt.Close(); err != nil {
+		return fs.dbError(err)
+	}
 	if err := fs.hasVersionStmt.Close(); err != nil {
 		return fs.dbError(err)
 	}
-	if err := fs.db.Close(); err != nil {
+	// the filestore is closed even if the database cannot be, so that it reports ErrNotOpen
+	err := fs.releaseDB()
+	fs.db = nil
+	if err != nil {
 		return fs.dbError(err)
 	}
 	return nil
@@ -131,6 +308,74 @@ func (fs *Filestore) dbError(err error) error {
 	return fmt.Errorf("filestore DB error: %w", err)
 }
 
+// dirMode returns the permissions of directories created in the filestore. By default, directories
+// are only accessible by the owner, or by the group as well if the filestore is shared. The group
+// of shared directories is inherited by new files. With the Umask option, the permissions are
+// reduced by the umask of the process.
+func (fs *Filestore) dirMode() os.FileMode {
+	mode := os.FileMode(0700)
+	switch {
+	case fs.DirMode != 0:
+		mode = fs.DirMode
+	case flags.Has(fs.Options, Shared):
+		mode = 0750 | os.ModeSetgid
+	}
+	return fs.umask(mode)
+}
+
+// fileMode returns the permissions of the database and blobs created in the filestore, or zero if
+// files are created with default permissions, which are reduced by the umask of the process in
+// any case. With the Umask option, the permissions are reduced by the umask as well.
+func (fs *Filestore) fileMode() os.FileMode {
+	if fs.FileMode == 0 && flags.Has(fs.Options, Shared) {
+		return fs.umask(0640)
+	}
+	return fs.umask(fs.FileMode)
+}
+
+// umask returns the permissions mode reduced by the umask of the process if the filestore has the
+// Umask option, and mode unchanged otherwise.
+func (fs *Filestore) umask(mode os.FileMode) os.FileMode {
+	if !flags.Has(fs.Options, Umask) || mode == 0 {
+		return mode
+	}
+	return mode &^ processUmask()
+}
+
+// dsn returns the data source name of the database, which configures the driver according
+// to the options. Databases on disk use a write-ahead log, so that readers and a writer in
+// different processes do not block each other.
+func (fs *Filestore) dsn() string {
+	path, params := fs.dbPath(), []string(nil)
+	if fs.memory != "" {
+		path, params = "file:"+fs.memory, []string{"vfs=memdb"}
+	}
+	params = append(params, dsnPragma("busy_timeout", strconv.FormatInt(fs.busyTimeout().Milliseconds(), 10)))
+	switch {
+	case flags.Has(fs.Options, ReadOnly):
+		params = append(params, dsnPragma("query_only", "true"))
+	case fs.memory == "":
+		params = append(params, dsnPragma("journal_mode", "WAL"))
+	}
+	return path + "?" + strings.Join(params, "&")
+}
+
+// busyTimeout returns how long to wait for locks of the database held by other processes.
+func (fs *Filestore) busyTimeout() time.Duration {
+	if fs.BusyTimeout > 0 {
+		return fs.BusyTimeout
+	}
+	return DefaultBusyTimeout
+}
+
+// segmentCacheSize returns the budget of the cache of decompressed segments.
+func (fs *Filestore) segmentCacheSize() int64 {
+	if fs.SegmentCacheSize != 0 {
+		return fs.SegmentCacheSize
+	}
+	return DefaultSegmentCacheSize
+}
+
 func (fs *Filestore) dbPath() string {
 	return fs.Root() + "db.sqlite3"
 }
@@ -147,74 +392,333 @@ func (fs *Filestore) Root() string {
 // Add adds a file with given path or updates the existing entries for the file.
 // The file is versioned  and a version stored with the given info, tag strings and
 // semantic version.
-func (fs *Filestore) Add(path, info, version string) error {
-	if fs.db == nil {
-		return ErrNotOpen
+func (fs *Filestore) Add(path, info, version string) (err error) {
+	op := newOp("Add", path)
+	defer op.done(&err)
+	if err := fs.ensureOpen(); err != nil {
+		return err
 	}
-	check, err := fs.Checksum(path)
+	tracker := fs.newProgress("Add", path, path, 2)
+	check, err := fs.checksum(path, tracker)
 	if err != nil {
 		return fmt.Errorf("filestore checksum failed for %s: %w", path, err)
 	}
-	return fs.addVersion(path, info, version, check)
+	op.checksum = check
+	if err := fs.makeRoomFor(path, check); err != nil {
+		return err
+	}
+	unlock, err := fs.lockBlobs()
+	if err != nil {
+		return err
+	}
+	return fs.addLocked(unlock, path, info, version, check, tracker)
 }
 
-func (fs *Filestore) addVersion(path, info, version, check string) error {
-	name := filepath.Base(path)
-	slashPath := filepath.ToSlash(path)
-	rows, err := fs.queryIDStmt.Query(check)
+// addVersion adds a version of the file at path with the given checksum, copying the file into
+// the filestore if its contents are not stored yet. If tx is not nil, the database is modified
+// within the transaction. The ID of the new version is returned as well as the paths of newly
+// created blobs or chunks, so they can be removed if the transaction is rolled back.
+// Copying the file is recorded in tracker, which may be nil.
+func (fs *Filestore) addVersion(tx *sql.Tx, path, info, version, check string, tracker *progressTracker) (int64, []string, error) {
+	if flags.Has(fs.Options, ReadOnly) {
+		return 0, nil, ErrReadOnly
+	}
+	src, link, err := fs.contentsFile(path)
 	if err != nil {
-		return fs.dbError(err)
+		return 0, nil, err
+	}
+	if link {
+		defer os.RemoveAll(filepath.Dir(src))
 	}
 	var fileID int64
-	fileID = 0
-	if rows.Next() {
-		rows.Scan(&fileID)
+	err = txStmt(tx, fs.queryIDStmt).QueryRow(check).Scan(&fileID)
+	if err != nil && err != sql.ErrNoRows {
+		return 0, nil, fs.dbError(err)
+	}
+	var summary *ChangeSummary
+	if flags.Has(fs.Options, Summarize) && !link {
+		if summary, err = fs.summarize(tx, path); err != nil {
+			return 0, nil, err
+		}
 	}
+	var created []string
 	if fileID == 0 {
-		// copy the file
-		dst := fs.localPath(name, check)
-		if err := ensureDirectory(filepath.Dir(dst), 0700); err != nil {
-			return fmt.Errorf("filestore unable to create directory %s: %w", dst, err)
+		if err := fs.checkQuota(tx, src); err != nil {
+			return 0, nil, err
 		}
-		if flags.Has(fs.Options, Compress) {
-			dst += ".snappy"
+		if fileID, created, err = fs.storeFile(tx, src, check, tracker); err != nil {
+			return 0, created, err
 		}
-		err := copyFile(path, dst, flags.Has(fs.Options, Compress), false)
-		if err != nil {
-			os.Remove(dst)
-			return fmt.Errorf("filestore failed to copy file \"%s\" to %s: %w", name, dst, err)
+	} else {
+		// contents pulled from another filestore are stored now that they are at hand
+		var q querier = fs.db
+		if tx != nil {
+			q = tx
 		}
-		result, err := fs.insertFileStmt.Exec(check)
-		if err != nil {
-			return fs.dbError(err)
+		var pulled bool
+		if err := q.QueryRow("select origin is not null from Files where file_id=?;", fileID).Scan(&pulled); err != nil {
+			return 0, nil, fs.dbError(err)
 		}
-		fileID, err = result.LastInsertId()
-		if err != nil {
-			return fs.dbError(err)
+		if pulled {
+			if err := fs.checkQuota(tx, src); err != nil {
+				return 0, nil, err
+			}
+			if created, err = fs.localizeFile(tx, fileID, src, check, tracker); err != nil {
+				return 0, created, err
+			}
+		}
+	}
+	stat, err := os.Stat(path)
+	if link {
+		stat, err = os.Lstat(path)
+	}
+	if err != nil {
+		return 0, created, err
+	}
+	entry := versionEntry{path: path, src: path, info: info, version: version, fileID: fileID, summary: summary}
+	entry.mode, entry.mtime = fileAttributes(stat.Mode(), stat.ModTime())
+	if flags.Has(fs.Options, Xattrs) && !link {
+		if entry.xattrs, err = readXattrs(path); err != nil {
+			return 0, created, fmt.Errorf("filestore could not read extended attributes of %s: %w", path, err)
 		}
 	}
-	_, err = fs.insertVersionStmt.Exec(slashPath, info, EncodeMetaphone(info), version, fileID)
-	return err
+	versionID, err := fs.insertVersion(tx, entry)
+	return versionID, created, err
+}
+
+// versionEntry describes a version added by insertVersion.
+type versionEntry struct {
+	path    string            // the path of the file
+	src     string            // the file with the contents of the version, matched by the TagRules
+	info    string            // the info string
+	version string            // the version string
+	fileID  int64             // the ID of the file entry of the contents
+	mode    int64             // the mode as returned by fileAttributes
+	mtime   int64             // the modification time as returned by fileAttributes
+	summary *ChangeSummary    // the changes from the previous version, nil if not summarized
+	xattrs  map[string][]byte // the extended attributes, nil if not recorded
+}
+
+// insertVersion adds the version described by entry, whose contents must be stored already,
+// within tx if it is not nil. The version is tagged by the TagRules and signed, and its ID is
+// returned.
+func (fs *Filestore) insertVersion(tx *sql.Tx, entry versionEntry) (int64, error) {
+	infoID, err := fs.internInfo(tx, entry.info)
+	if err != nil {
+		return 0, err
+	}
+	uuid, err := fs.newUUID()
+	if err != nil {
+		return 0, err
+	}
+	result, err := txStmt(tx, fs.insertVersionStmt).Exec(fs.storedPath(entry.path), infoID, entry.version, dbNow(), entry.fileID, uuid, entry.mode, entry.mtime)
+	if err != nil {
+		return 0, fs.dbError(err)
+	}
+	versionID, err := result.LastInsertId()
+	if err != nil {
+		return 0, fs.dbError(err)
+	}
+	if entry.summary != nil {
+		if err := fs.insertSummary(tx, versionID, entry.summary); err != nil {
+			return 0, err
+		}
+	}
+	var q querier = fs.db
+	if tx != nil {
+		q = tx
+	}
+	if err := fs.insertXattrs(q, versionID, entry.xattrs); err != nil {
+		return 0, err
+	}
+	if err := fs.applyTagRules(tx, versionID, entry.path, entry.src); err != nil {
+		return 0, err
+	}
+	if err := fs.signVersion(tx, versionID); err != nil {
+		return 0, err
+	}
+	return versionID, nil
+}
+
+// storeFile copies the file at path with the given checksum into the filestore and adds its file
+// entry. The ID of the entry is returned with the paths of the files created.
+func (fs *Filestore) storeFile(tx *sql.Tx, path, check string, tracker *progressTracker) (int64, []string, error) {
+	sc, created, err := fs.storeContents(tx, path, check, tracker)
+	if err != nil {
+		return 0, created, err
+	}
+	fileID, err := fs.insertFile(tx, check, fs.hashName(), sc)
+	return fileID, created, err
+}
+
+// insertFile adds the file entry of the contents stored by storeContents with the given checksum
+// computed with the hash algorithm of the given name, and returns its ID.
+func (fs *Filestore) insertFile(tx *sql.Tx, check, hashName string, sc storedContents) (int64, error) {
+	result, err := txStmt(tx, fs.insertFileStmt).Exec(check, hashName, sc.codec.name, sc.codec.sealedKey, sc.size, sc.stored, sc.chunks != nil)
+	if err != nil {
+		return 0, fs.dbError(err)
+	}
+	fileID, err := result.LastInsertId()
+	if err != nil {
+		return 0, fs.dbError(err)
+	}
+	if sc.chunks != nil {
+		if err := fs.insertFileChunks(tx, fileID, sc.chunks); err != nil {
+			return 0, err
+		}
+	}
+	return fileID, nil
+}
+
+// storedContents describes contents copied into the filestore by storeContents.
+type storedContents struct {
+	codec  codec   // the codec of the blob, or of the chunks before they are sealed
+	size   int64   // the size of the contents
+	stored int64   // the number of bytes newly stored
+	chunks []int64 // the IDs of the chunks in order, nil if the contents are stored in a single blob
+}
+
+// storeContents copies the file at path with the given checksum into the filestore, either as a
+// single blob or in chunks if the filestore has the Chunked option, and returns the paths of the
+// files created as well.
+func (fs *Filestore) storeContents(tx *sql.Tx, path, check string, tracker *progressTracker) (storedContents, []string, error) {
+	name := filepath.Base(path)
+	var sc storedContents
+	var created []string
+	var err error
+	if sc.codec, err = fs.fileCodec(path); err != nil {
+		return sc, nil, err
+	}
+	if flags.Has(fs.Options, Chunked) {
+		sc.chunks, sc.size, sc.stored, created, err = fs.storeChunks(tx, path, sc.codec, tracker)
+		fs.wrote(created...)
+		if sc.chunks == nil {
+			sc.chunks = make([]int64, 0)
+		}
+		return sc, created, err
+	}
+	// copy the file, under a neutral name if it is encrypted so that its name is not revealed
+	blobName := name
+	if fs.encrypted() {
+		if sc.codec, err = fs.sealCodec(sc.codec); err != nil {
+			return sc, nil, err
+		}
+		blobName = encryptedBlobName
+	}
+	dst := fs.localPath(blobName, check) + sc.codec.ext
+	if sc.stored, err = fs.putFile(path, dst, sc.codec, tracker); err != nil {
+		return sc, nil, fmt.Errorf("filestore failed to copy file \"%s\" to %s: %w", name, dst, err)
+	}
+	// the directory of the blob is removed with it, like when the contents are deleted
+	created = append(created, filepath.Dir(dst))
+	fs.wrote(dst)
+	info, err := os.Stat(path)
+	if err != nil {
+		return sc, created, err
+	}
+	sc.size = info.Size()
+	return sc, created, nil
+}
+
+// internInfo returns the ID of the info string in the Infos table, adding it if necessary.
+// The info string may have been added by another transaction since it was looked up, in which
+// case it is looked up again.
+func (fs *Filestore) internInfo(tx *sql.Tx, info string) (int64, error) {
+	var infoID int64
+	err := txStmt(tx, fs.queryInfoStmt).QueryRow(info).Scan(&infoID)
+	if err == nil {
+		return infoID, nil
+	}
+	if err != sql.ErrNoRows {
+		return 0, fs.dbError(err)
+	}
+	result, err := txStmt(tx, fs.insertInfoStmt).Exec(info, EncodeMetaphone(info))
+	if err != nil {
+		return 0, fs.dbError(err)
+	}
+	n, err := result.RowsAffected()
+	if err != nil {
+		return 0, fs.dbError(err)
+	}
+	if n == 0 {
+		if err := txStmt(tx, fs.queryInfoStmt).QueryRow(info).Scan(&infoID); err != nil {
+			return 0, fs.dbError(err)
+		}
+		return infoID, nil
+	}
+	if infoID, err = result.LastInsertId(); err != nil {
+		return 0, fs.dbError(err)
+	}
+	return infoID, nil
+}
+
+// txStmt returns the prepared statement stmt for use within transaction tx, or stmt itself
+// if tx is nil.
+func txStmt(tx *sql.Tx, stmt *sql.Stmt) *sql.Stmt {
+	if tx == nil {
+		return stmt
+	}
+	return tx.Stmt(stmt)
 }
 
 // localPath returns a local path in the root directory of the form
-// root/checksum/name but with platform-specific separators.
+// root/checksum/name but with platform-specific separators, in the extended-length form on
+// Windows if it is too long otherwise.
 func (fs *Filestore) localPath(name, checksum string) string {
-	return fs.Root() + checksum + string(os.PathSeparator) + name
+	return longPath(fs.Root() + checksum + string(os.PathSeparator) + name)
+}
+
+// segmentCache returns the cache of decompressed segments, which is created if the filestore
+// has not been opened.
+func (fs *Filestore) segmentCache() *segmentCache {
+	if fs.segments == nil {
+		fs.segments = newSegmentCache(fs.segmentCacheSize())
+	}
+	return fs.segments
+}
+
+// blobFile returns the path of the stored contents with the given checksum, compressed with
+// codec c. The contents are stored under the name of the file first added with them, so if there
+// is no blob with the given name, the directory of the checksum is searched for it.
+func (fs *Filestore) blobFile(name, checksum string, c codec) string {
+	name += c.ext
+	blob := fs.localPath(name, checksum)
+	if exists, err := fs.storedExists(blob); err == nil && exists {
+		return blob
+	}
+	names, err := fs.listStored(fs.Root() + checksum)
+	if err != nil || len(names) == 0 {
+		return blob
+	}
+	return fs.localPath(names[0], checksum)
 }
 
 // Checksum computes a 512 byte Blake2b checksum of a given file.
-func (fs *Filestore) Checksum(path string) (string, error) {
-	hasher, err := blake2b.New512(nil)
+func (fs *Filestore) Checksum(path string) (_ string, err error) {
+	op := newOp("Checksum", path)
+	defer op.done(&err)
+	return fs.checksum(path, nil)
+}
+
+// checksum computes the checksum of the file at path and records reading it in tracker, which
+// may be nil.
+func (fs *Filestore) checksum(path string, tracker *progressTracker) (string, error) {
+	hasher, err := newHash(fs.hashName())
 	if err != nil {
 		return "", err
 	}
+	if target, link, err := fs.symlinkTarget(path); err != nil {
+		return "", err
+	} else if link {
+		hasher.Write([]byte(target))
+		return hex.EncodeToString(hasher.Sum(nil)), nil
+	}
 	f, err := os.Open(path)
 	if err != nil {
 		return "", err
 	}
 	defer f.Close()
-	if _, err := io.Copy(hasher, f); err != nil {
+	if _, err := io.Copy(hasher, tracker.reader(f)); err != nil {
 		return "", err
 	}
 	return hex.EncodeToString(hasher.Sum(nil)[:]), nil
@@ -223,125 +727,466 @@ func (fs *Filestore) Checksum(path string) (string, error) {
 // Has returns true if versions of the file given by the filepath exist,
 // false otherwise.
 func (fs *Filestore) Has(file string) bool {
-	if fs.db == nil {
+	if fs.ensureOpen() != nil {
 		return false
 	}
 	var exists bool
-	err := fs.hasVersionStmt.QueryRow(filepath.ToSlash(file)).Scan(&exists)
+	err := fs.hasVersionStmt.QueryRow(fs.storedPath(file)).Scan(&exists)
 	if err != nil {
 		return false
 	}
 	return exists
 }
 
+// Paths returns the distinct source paths of all files in the filestore in ascending order,
+// skipping the first offset paths and returning at most limit paths. The paths are returned
+// in the os-specific format.
+func (fs *Filestore) Paths(limit, offset int) (_ []string, err error) {
+	op := newOp("Paths", "")
+	defer op.done(&err)
+	if err := fs.ensureOpen(); err != nil {
+		return nil, err
+	}
+	return fs.paths(fs.db, limit, offset)
+}
+
+func (fs *Filestore) paths(q querier, limit, offset int) ([]string, error) {
+	rows, err := q.Query("select distinct path from Versions order by path limit ? offset ?;", limit, offset)
+	if err != nil {
+		return nil, fs.dbError(err)
+	}
+	defer rows.Close()
+	paths := make([]string, 0)
+	for rows.Next() {
+		var path string
+		if err := rows.Scan(&path); err != nil {
+			return nil, fs.dbError(err)
+		}
+		paths = append(paths, filepath.FromSlash(path))
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fs.dbError(err)
+	}
+	return paths, nil
+}
+
 // FileVersion represents a particular version of a file.
 type FileVersion struct {
-	ID       int64     // file version ID (internal)
-	Name     string    // the name of the file, including suffix
-	Path     string    // the path from which the version was sourced (os path)
-	Local    string    // the path to the file content on disk in the local filestore (os path)
-	Info     string    // the info string
-	Fuzzy    string    // fuzzy into string
-	Version  string    // the version string
-	From     time.Time // the datetime on which this version was added
-	Checksum string    // the hex-encoded Blake2b checksum of the file contents of this version
+	ID       int64          // file version ID (internal)
+	ShortID  string         // compact identifier of the version unique within the filestore, see GetByShortID
+	Seq      int64          // the number of the version among the versions of its path, counting from 1 in the order they were added, see GetSeq
+	UUID     string         // globally unique identifier of the version, which is kept when versions are copied to other filestores
+	Name     string         // the name of the file, including suffix
+	Path     string         // the path from which the version was sourced (os path)
+	Local    string         // the path to the file content on disk in the local filestore (os path, extended-length if long on Windows), not valid for chunked contents
+	Info     string         // the info string
+	Fuzzy    string         // fuzzy into string
+	Version  string         // the version string
+	From     time.Time      // the datetime on which this version was added
+	Checksum string         // the hex-encoded checksum of the file contents of this version
+	Hash     string         // the name of the hash algorithm of the checksum, e.g. HashBlake2b512
+	Mode     os.FileMode    // the permission bits of the source file, with os.ModeSymlink if it is a stored link, zero if not recorded
+	Modified time.Time      // the modification time of the source file, zero if not recorded
+	Summary  *ChangeSummary // the changes from the previous version, nil if no summary was stored
+	Score    float64        // the relevance of the version to a full text search, higher for better matches, zero otherwise
+	// Available is false if the version was pulled from another filestore with PullMetadata and
+	// its contents have not been fetched yet, which happens when they are first read or with Fetch.
+	Available bool
 }
 
 // Get returns the latest version of a file at path, or an error if the file
 // is not in the filestore.
-func (fs *Filestore) Get(path string) (FileVersion, error) {
-	if fs.db == nil {
-		return FileVersion{}, ErrNotOpen
+func (fs *Filestore) Get(path string) (_ FileVersion, err error) {
+	op := newOp("Get", path)
+	defer op.done(&err)
+	if err := fs.ensureOpen(); err != nil {
+		return FileVersion{}, err
 	}
-	slashPath := filepath.ToSlash(path)
-	row := fs.getVersionStmt.QueryRow(slashPath)
+	return fs.get(fs.getVersionStmt, path)
+}
+
+// get returns the latest version of a file at path queried with stmt, which is getVersionStmt
+// or the same statement within a transaction.
+func (fs *Filestore) get(stmt *sql.Stmt, path string) (FileVersion, error) {
+	row := stmt.QueryRow(fs.storedPath(path))
 	v := FileVersion{}
 	var timeStr string
-	if err := row.Scan(&v.ID, &v.Path, &v.Info, &v.Fuzzy, &v.Version, &timeStr, &v.Checksum); err != nil {
+	var mode, mtime int64
+	var summary nullSummary
+	if err := row.Scan(&v.ID, &v.Path, &v.Info, &v.Fuzzy, &v.Version, &timeStr, &v.Checksum, &v.Hash, &v.Available, &v.UUID, &mode, &mtime, &v.Seq,
+		&summary.bytesAdded, &summary.bytesRemoved, &summary.linesAdded, &summary.linesRemoved, &summary.text); err != nil {
 		return FileVersion{}, fs.dbError(err)
 	}
-	var err error
-	v.Name = filepath.Base(path)
+	v.Summary = summary.get()
+	v.Mode, v.Modified = versionAttributes(mode, mtime)
+	v.ShortID = fs.shortID(v.ID)
+	v.Name = filepath.Base(v.Path)
 	//	v.Path = filepath.FromSlash(v.Path)
+	var err error
 	v.From, err = ParseDBDate(timeStr)
 	if err != nil {
 		return FileVersion{}, ErrInvalidDate
 	}
 	v.Local = fs.localPath(v.Name, v.Checksum)
+	if fs.cache != nil && v.Available {
+		if cached, ok := fs.cache.get(v.Checksum, func(dst string) error {
+			return fs.copyContents(v, dst, fs.fileMode(), nil)
+		}); ok {
+			v.Local = cached
+		}
+	}
 	return v, nil
 }
 
-// Restore restores the given file version to destination directory dst.
-func (fs *Filestore) Restore(version FileVersion, dst string) error {
-	useCompression := flags.Has(fs.Options, Compress)
+// GetAt returns the version of the file at path that was current at time t, which is the latest
+// version added at or before t. ErrNotFound is returned if there is no such version.
+func (fs *Filestore) GetAt(path string, t time.Time) (_ FileVersion, err error) {
+	op := newOp("GetAt", path)
+	defer op.done(&err)
+	if err := fs.ensureOpen(); err != nil {
+		return FileVersion{}, err
+	}
+	return fs.getAt(fs.db, path, t)
+}
+
+func (fs *Filestore) getAt(q querier, path string, t time.Time) (FileVersion, error) {
+	rows, err := q.Query(selectVersions+" where Versions.path=? and Versions.date <= ? order by Versions.date desc, version_id desc limit 1;",
+		fs.storedPath(path), ToDBDate(t.UTC()))
+	if err != nil {
+		return FileVersion{}, fs.dbError(err)
+	}
+	versions, err := fs.getVersions(rows)
+	if err != nil {
+		return FileVersion{}, err
+	}
+	if len(versions) == 0 {
+		return FileVersion{}, ErrNotFound
+	}
+	return versions[0], nil
+}
+
+// GetSeq returns the version of the file at path with the sequence number seq, so that GetSeq(path,
+// 7) returns the seventh version added. ErrNotFound is returned if there is no such version,
+// which is the case for deleted versions, since their numbers are not reused.
+func (fs *Filestore) GetSeq(path string, seq int64) (_ FileVersion, err error) {
+	op := newOp("GetSeq", path)
+	defer op.done(&err)
+	if err := fs.ensureOpen(); err != nil {
+		return FileVersion{}, err
+	}
+	rows, err := fs.db.Query(selectVersions+" where Versions.path=? and Versions.seq=?;", fs.storedPath(path), seq)
+	if err != nil {
+		return FileVersion{}, fs.dbError(err)
+	}
+	versions, err := fs.getVersions(rows)
+	if err != nil {
+		return FileVersion{}, err
+	}
+	if len(versions) == 0 {
+		return FileVersion{}, ErrNotFound
+	}
+	return versions[0], nil
+}
+
+// querier is implemented by *sql.DB and *sql.Tx.
+type querier interface {
+	Exec(query string, args ...interface{}) (sql.Result, error)
+	Query(query string, args ...interface{}) (*sql.Rows, error)
+	QueryRow(query string, args ...interface{}) *sql.Row
+}
+
+// versionByID returns the version with the given ID, or ErrUnknownVersion if there is none.
+func (fs *Filestore) versionByID(q querier, id int64) (FileVersion, error) {
+	rows, err := q.Query(selectVersions+" where version_id=?;", id)
+	if err != nil {
+		return FileVersion{}, fs.dbError(err)
+	}
+	versions, err := fs.getVersions(rows)
+	if err != nil {
+		return FileVersion{}, err
+	}
+	if len(versions) == 0 {
+		return FileVersion{}, ErrUnknownVersion
+	}
+	return versions[0], nil
+}
+
+// Restore restores the given file version to destination directory dst. The restored file gets
+// the permission bits and modification time of the source file of the version if they were
+// recorded, unless RestoreMode is set, which then determines the permissions. If the RestoreLink
+// option is set, the contents are stored uncompressed in a single blob on the same filesystem as
+// dst and no RestoreMode or RestoreTransformers are set, the restored file is a hard link to the
+// blob instead of a copy. It then shares its contents, permissions, extended attributes and
+// modification time with the filestore and must not be modified in place. With the Xattrs
+// option, the extended attributes recorded for the version are set on the restored file. The
+// contents are passed through the RestoreTransformers of the filestore. Symbolic links stored
+// with the SymlinkStore policy are recreated as links to their original targets. Restores from
+// read-only filestores are not recorded in the history.
+func (fs *Filestore) Restore(version FileVersion, dst string) (err error) {
+	op := newOp("Restore", version.Path)
+	op.checksum = version.Checksum
+	defer op.done(&err)
+	return fs.restore(version, dst, RestoreOptions{})
+}
+
+// RestoreOptions are the options of RestoreWith.
+type RestoreOptions struct {
+	Reason string // why the version is restored, recorded in the history
+	User   string // who restores the version, the user running the process if empty
+	// Marker adds a version of the path of the restored version with its contents, whose version
+	// string is "restored as of" followed by the date of the restored version, so that the
+	// restore shows as the latest version of the file. ErrReadOnly is returned for read-only
+	// filestores.
+	Marker bool
+	// Transformers transform the restored contents after the RestoreTransformers of the filestore.
+	Transformers []RestoreTransformer
+}
+
+// RestoreWith restores the given file version to destination directory dst like Restore and
+// records the reason and user of opts in the history, where they show in the Timeline. Restores
+// from read-only filestores are not recorded.
+func (fs *Filestore) RestoreWith(version FileVersion, dst string, opts RestoreOptions) (err error) {
+	op := newOp("RestoreWith", version.Path)
+	op.checksum = version.Checksum
+	defer op.done(&err)
+	return fs.restore(version, dst, opts)
+}
+
+func (fs *Filestore) restore(version FileVersion, dst string, opts RestoreOptions) error {
+	if err := fs.ensureOpen(); err != nil {
+		return err
+	}
+	readOnly := flags.Has(fs.Options, ReadOnly)
+	if opts.Marker && readOnly {
+		return ErrReadOnly
+	}
+	if err := fs.fetch(version.Checksum); err != nil {
+		return err
+	}
 	dst = asDirectoryPath(dst)
-	dstFile := dst + version.Name
-	srcFileName := version.Name
-	if useCompression {
-		srcFileName += ".snappy"
+	dstFile := longPath(dst + version.Name)
+	srcFile, cached := "", false
+	if fs.cache != nil {
+		srcFile, cached = fs.cache.lookup(version.Checksum)
 	}
-	srcFile := fs.localPath(srcFileName, version.Checksum)
-	return copyFile(srcFile, dstFile, useCompression, true)
+	if !cached {
+		c, err := fs.blobCodec(fs.db, version.Checksum)
+		if err != nil {
+			return err
+		}
+		srcFile = fs.blobFile(version.Name, version.Checksum, c)
+	}
+	tracker := fs.newProgress("Restore", version.Path, srcFile, 1)
+	transformers := append(append([]RestoreTransformer(nil), fs.RestoreTransformers...), opts.Transformers...)
+	perm := fs.restoreMode(version)
+	var err error
+	// hard links share the permissions, attributes and modification time of the blob, which are
+	// not changed, and those of symbolic links are not restored
+	attributes := true
+	switch {
+	case version.Mode&os.ModeSymlink != 0:
+		err = fs.restoreSymlink(version, dstFile)
+		attributes = false
+	case len(transformers) > 0:
+		err = fs.restoreTransformed(version, dstFile, transformers, perm, tracker)
+	case cached:
+		err = copyFile(srcFile, dstFile, codecs[CompressionNone], true, perm, tracker)
+	case fs.linkContents(version, dstFile):
+		attributes = false
+	default:
+		err = fs.copyContents(version, dstFile, perm, tracker)
+	}
+	if err == nil && attributes && flags.Has(fs.Options, Xattrs) {
+		err = fs.restoreXattrs(version, dstFile)
+	}
+	if err == nil && attributes {
+		err = restoreModified(version, dstFile)
+	}
+	if err != nil {
+		return err
+	}
+	tracker.finish()
+	if readOnly {
+		// the history cannot be written, but the version has been restored
+		return nil
+	}
+	user := opts.User
+	if user == "" {
+		user = currentUser()
+	}
+	if err := fs.addHistory(version.Path, historyRestored, shortPath(dstFile), version.ID, opts.Reason, user); err != nil {
+		return err
+	}
+	if opts.Marker {
+		return fs.addMarker(version, dstFile)
+	}
+	return nil
+}
+
+// linkContents hard-links the blob of version to dst, replacing an existing file, and returns
+// true if the RestoreLink option allows it and linking succeeds. Otherwise, the contents must
+// be copied, for instance because they are compressed or dst is on another filesystem.
+func (fs *Filestore) linkContents(version FileVersion, dst string) bool {
+	if !flags.Has(fs.Options, RestoreLink) || fs.RestoreMode != 0 || !fs.localBlobs() {
+		return false
+	}
+	if chunks, err := fs.chunkList(fs.db, version.Checksum); err != nil || chunks != nil {
+		return false
+	}
+	c, err := fs.blobCodec(fs.db, version.Checksum)
+	if err != nil || !c.plain() {
+		return false
+	}
+	src := fs.blobFile(version.Name, version.Checksum, c)
+	srcInfo, err := os.Stat(src)
+	if err != nil {
+		return false
+	}
+	if dstInfo, err := os.Stat(dst); err == nil && os.SameFile(srcInfo, dstInfo) {
+		return true
+	}
+	// link to a temporary name first, so that an existing file is only replaced on success
+	tmp := dst + ".filestore-link"
+	os.Remove(tmp)
+	if err := os.Link(src, tmp); err != nil {
+		return false
+	}
+	if err := os.Rename(tmp, dst); err != nil {
+		os.Remove(tmp)
+		return false
+	}
+	return true
 }
 
 // RestoreAtSource restores the version into the original source destination path from which
 // it was created. If a file already exists at this place (normally the case), it will be overwritten.
-func (fs *Filestore) RestoreAtSource(version FileVersion) error {
-	return fs.Restore(version, filepath.Dir(filepath.FromSlash(version.Path)))
+// Like Restore, it restores the permission bits and modification time of the source file.
+func (fs *Filestore) RestoreAtSource(version FileVersion) (err error) {
+	op := newOp("RestoreAtSource", version.Path)
+	op.checksum = version.Checksum
+	defer op.done(&err)
+	return fs.restore(version, filepath.Dir(filepath.FromSlash(version.Path)), RestoreOptions{})
 }
 
 // Versions returns FileVersion entries for all versions of a file. Nil is returned if there are no versions.
-func (fs *Filestore) Versions(path string, limit int) ([]FileVersion, error) {
-	if fs.db == nil {
-		return nil, ErrNotOpen
+func (fs *Filestore) Versions(path string, limit int) (_ []FileVersion, err error) {
+	op := newOp("Versions", path)
+	defer op.done(&err)
+	if err := fs.ensureOpen(); err != nil {
+		return nil, err
 	}
-	rows, err := fs.getVersionsStmt.Query(path, limit)
+	rows, err := fs.getVersionsStmt.Query(fs.storedPath(path), limit)
 	if err != nil {
 		return nil, fs.dbError(err)
 	}
 	return fs.getVersions(rows)
 }
 
+// selectVersions selects the columns read by scanVersion from versions joined with their files.
+const selectVersions = "select version_id, path, info, fuzzy, version, date, checksum, hash, origin is null, coalesce(uuid, ''), mode, mtime, seq, " + summaryColumns + " from Versions inner join Files on Versions.file=Files.file_id inner join Infos on Versions.info_id=Infos.info_id left join Summaries on Summaries.summary_of=version_id"
+
 func (fs *Filestore) getVersions(rows *sql.Rows) ([]FileVersion, error) {
+	defer rows.Close()
 	versions := make([]FileVersion, 0)
 	for rows.Next() {
-		v := FileVersion{}
-		var timeStr string
-		if err := rows.Scan(&v.ID, &v.Path, &v.Info, &v.Fuzzy, &v.Version, &timeStr, &v.Checksum); err != nil {
-			return nil, fs.dbError(err)
-		}
-		v.Path = filepath.FromSlash(v.Path)
-		v.Name = filepath.Base(v.Path)
-		var err error
-		v.From, err = ParseDBDate(timeStr)
+		v, err := fs.scanVersion(rows)
 		if err != nil {
-			return nil, ErrInvalidDate
+			return nil, err
 		}
-		v.Local = fs.localPath(v.Name, v.Checksum)
 		versions = append(versions, v)
 	}
+	if err := rows.Err(); err != nil {
+		return nil, fs.dbError(err)
+	}
 	return versions, nil
 }
 
+// scanVersion scans the current row of a query using selectVersions into a FileVersion. Additional
+// columns following those of selectVersions are scanned into extra.
+func (fs *Filestore) scanVersion(rows *sql.Rows, extra ...interface{}) (FileVersion, error) {
+	v := FileVersion{}
+	var timeStr string
+	var mode, mtime int64
+	var summary nullSummary
+	dest := []interface{}{&v.ID, &v.Path, &v.Info, &v.Fuzzy, &v.Version, &timeStr, &v.Checksum, &v.Hash, &v.Available, &v.UUID, &mode, &mtime, &v.Seq,
+		&summary.bytesAdded, &summary.bytesRemoved, &summary.linesAdded, &summary.linesRemoved, &summary.text}
+	if err := rows.Scan(append(dest, extra...)...); err != nil {
+		return FileVersion{}, fs.dbError(err)
+	}
+	v.Summary = summary.get()
+	v.Mode, v.Modified = versionAttributes(mode, mtime)
+	v.ShortID = fs.shortID(v.ID)
+	v.Path = filepath.FromSlash(v.Path)
+	v.Name = filepath.Base(v.Path)
+	var err error
+	v.From, err = ParseDBDate(timeStr)
+	if err != nil {
+		return FileVersion{}, ErrInvalidDate
+	}
+	v.Local = fs.localPath(v.Name, v.Checksum)
+	return v, nil
+}
+
 // VersionsAfter returns FileVersion entries for all versions of a file after the given date. Nil
 // is returned if there are no versions.
-func (fs *Filestore) VersionsAfter(path string, after time.Time, limit int) ([]FileVersion, error) {
-	if fs.db == nil {
-		return nil, ErrNotOpen
+func (fs *Filestore) VersionsAfter(path string, after time.Time, limit int) (_ []FileVersion, err error) {
+	op := newOp("VersionsAfter", path)
+	defer op.done(&err)
+	if err := fs.ensureOpen(); err != nil {
+		return nil, err
+	}
+	rows, err := fs.getVersionsAfterStmt.Query(fs.storedPath(path), ToDBDate(after), limit)
+	if err != nil {
+		return nil, fs.dbError(err)
+	}
+	return fs.getVersions(rows)
+}
+
+// VersionsBetween returns FileVersion entries for the versions of a file added at or after from
+// and before to, latest first. A zero from or to leaves the range open on that side.
+func (fs *Filestore) VersionsBetween(path string, from, to time.Time, limit int) (_ []FileVersion, err error) {
+	op := newOp("VersionsBetween", path)
+	defer op.done(&err)
+	if err := fs.ensureOpen(); err != nil {
+		return nil, err
 	}
-	rows, err := fs.getVersionsAfterStmt.Query(path, ToDBDate(after), limit)
+	cond, args := dateRange("Versions.date", from, to)
+	args = append([]interface{}{fs.storedPath(path)}, args...)
+	rows, err := fs.db.Query(selectVersions+" where Versions.path=?"+cond+" order by Versions.date desc, version_id desc limit ?;", append(args, limit)...)
 	if err != nil {
 		return nil, fs.dbError(err)
 	}
 	return fs.getVersions(rows)
 }
 
+// dateRange returns the conditions restricting the dates in column to those at or after from and
+// before to, each preceded by "and", and their arguments. Zero times add no condition.
+func dateRange(column string, from, to time.Time) (string, []interface{}) {
+	cond := ""
+	var args []interface{}
+	if !from.IsZero() {
+		cond += " and " + column + " >= ?"
+		args = append(args, ToDBDate(from.UTC()))
+	}
+	if !to.IsZero() {
+		cond += " and " + column + " < ?"
+		args = append(args, ToDBDate(to.UTC()))
+	}
+	return cond, args
+}
+
 // SimpleSearch returns FileVersion entries for all file info strings starting with terms, combined
 // with OR but sorted from more to less matching entries.
-func (fs *Filestore) SimpleSearch(words []string, limit int) ([]FileVersion, error) {
-	if fs.db == nil {
-		return nil, ErrNotOpen
+func (fs *Filestore) SimpleSearch(words []string, limit int) (_ []FileVersion, err error) {
+	op := newOp("SimpleSearch", "")
+	defer op.done(&err)
+	if err := fs.ensureOpen(); err != nil {
+		return nil, err
 	}
+	return fs.simpleSearch(fs.db, words, limit)
+}
+
+func (fs *Filestore) simpleSearch(q querier, words []string, limit int) ([]FileVersion, error) {
 	term := ""
 	for i, word := range words {
 		if i > 0 {
@@ -351,7 +1196,7 @@ func (fs *Filestore) SimpleSearch(words []string, limit int) ([]FileVersion, err
 		term += " or "
 		term += buildTerm("version", word)
 	}
-	rows, err := fs.db.Query("select version_id, path, info, fuzzy, version, date, checksum from Versions inner join Files on Versions.file=Files.file_id where "+term+" order by date limit ?;", limit)
+	rows, err := q.Query(selectVersions+" where "+term+" order by date limit ?;", limit)
 	if err != nil {
 		return nil, err
 	}
@@ -361,22 +1206,77 @@ func (fs *Filestore) SimpleSearch(words []string, limit int) ([]FileVersion, err
 // search performs an FTS5 term search on the database directly.
 // Warning: Search terms are not escaped! To escape them, individual terms in a query
 // must be put into double quotes and each double quote in a term must be turned into two double quotes "".
-func (fs *Filestore) search(term string, limit int) ([]FileVersion, error) {
-	if fs.db == nil {
-		return nil, ErrNotOpen
-	}
-	rows, err := fs.db.Query("select version_id, path, info, fuzzy, version, date, checksum from VersionsFts inner join Files on VersionsFts.file=Files.file_id where VersionsFts match ? order by date,rank limit ?;", term, limit)
+// Only versions added at or after from and before to are returned, unless they are zero.
+func (fs *Filestore) search(q querier, term string, from, to time.Time, limit int) ([]FileVersion, error) {
+	cond, args := dateRange("VersionsFts.date", from, to)
+	args = append(append([]interface{}{term}, args...), limit)
+	// rank is the bm25 score of the match, which is lower for better matches
+	rows, err := q.Query("select version_id, path, info, fuzzy, version, date, checksum, hash, origin is null, (select coalesce(uuid, '') from Versions where Versions.version_id=VersionsFts.version_id), (select mode from Versions where Versions.version_id=VersionsFts.version_id), (select mtime from Versions where Versions.version_id=VersionsFts.version_id), (select seq from Versions where Versions.version_id=VersionsFts.version_id), "+summaryColumns+", -rank from VersionsFts inner join Files on VersionsFts.file=Files.file_id left join Summaries on Summaries.summary_of=version_id where VersionsFts match ?"+cond+" order by rank, date desc limit ?;", args...)
 	if err != nil {
 		return nil, err
 	}
-	return fs.getVersions(rows)
+	defer rows.Close()
+	versions := make([]FileVersion, 0)
+	for rows.Next() {
+		var score float64
+		v, err := fs.scanVersion(rows, &score)
+		if err != nil {
+			return nil, err
+		}
+		v.Score = score
+		versions = append(versions, v)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fs.dbError(err)
+	}
+	return versions, nil
 }
 
-// Search performs an FTS5 term search on the database directly. This requires some knowledge of the database
+// Search performs an FTS5 term search on the database directly and returns the best matches first,
+// ranked by bm25 relevance, whose score is in the Score of the versions. This requires some knowledge of the database
 // organization and FTS5 queries. Warning: Search terms are not escaped! To escape them, individual terms in a query
 // must be put into double quotes and each double quote in a term must be turned into two double quotes "".
-func (fs *Filestore) Search(term string, limit int) ([]FileVersion, error) {
-	return fs.search(term, limit)
+// Use SearchWords to search for words entered by users.
+func (fs *Filestore) Search(term string, limit int) (_ []FileVersion, err error) {
+	op := newOp("Search", "")
+	defer op.done(&err)
+	if err := fs.ensureOpen(); err != nil {
+		return nil, err
+	}
+	return fs.search(fs.db, term, time.Time{}, time.Time{}, limit)
+}
+
+// Suggest returns up to limit terms of the info strings and paths of versions starting with
+// prefix, for completing search terms as they are typed. Terms found in more versions are
+// returned first. Like Search, it requires the full text search index.
+func (fs *Filestore) Suggest(prefix string, limit int) (_ []string, err error) {
+	op := newOp("Suggest", "")
+	defer op.done(&err)
+	if err := fs.ensureOpen(); err != nil {
+		return nil, err
+	}
+	// terms are case-folded in the index and all terms starting with prefix sort before prefix
+	// followed by the largest character of the basic multilingual plane
+	prefix = strings.ToLower(prefix)
+	rows, err := fs.db.Query("select term, sum(doc) as docs from VersionsFtsVocab where term >= ? and term < ? and col in ('info', 'path') group by term order by docs desc, term limit ?;",
+		prefix, prefix+"\uffff", limit)
+	if err != nil {
+		return nil, fs.dbError(err)
+	}
+	defer rows.Close()
+	terms := make([]string, 0)
+	for rows.Next() {
+		var term string
+		var docs int64
+		if err := rows.Scan(&term, &docs); err != nil {
+			return nil, fs.dbError(err)
+		}
+		terms = append(terms, term)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fs.dbError(err)
+	}
+	return terms, nil
 }
 
 // buildTerm constructs a simple LIKE substring search query for one word
@@ -0,0 +1,311 @@
+package filestore
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+	"time"
+)
+
+// newTestStore returns a new filestore in a temporary directory, opened like by openTestStore.
+func newTestStore(t *testing.T) (*Filestore, string) {
+	t.Helper()
+	return openTestStore(t, NewFilestore(filepath.Join(t.TempDir(), "store"), 0))
+}
+
+// openTestStore opens the filestore, which is closed at the end of the test, and returns it with a
+// new temporary directory for source files.
+func openTestStore(t *testing.T, fs *Filestore) (*Filestore, string) {
+	t.Helper()
+	if err := fs.Open(); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { fs.Close() })
+	return fs, t.TempDir()
+}
+
+// writeFile writes data to the file at path, creating its directory if necessary.
+func writeFile(t *testing.T, path, data string) {
+	t.Helper()
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(path, []byte(data), 0644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// addFile writes data to the file at path and adds it to the filestore as a new version.
+func addFile(t *testing.T, fs *Filestore, path, data, info, version string) FileVersion {
+	t.Helper()
+	writeFile(t, path, data)
+	if err := fs.Add(path, info, version); err != nil {
+		t.Fatal(err)
+	}
+	v, err := fs.Get(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return v
+}
+
+// requireFTS skips the test if the filestore has no full text search index, since SQLite has been
+// compiled without FTS5.
+func requireFTS(t *testing.T, fs *Filestore) {
+	t.Helper()
+	if err := fs.ReindexFTS(); errors.Is(err, ErrNoFTS) {
+		t.Skip("SQLite has been compiled without FTS5, run the tests with -tags sqlite_fts5 or -tags sqlite_modernc")
+	} else if err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestPaths(t *testing.T) {
+	fs, src := newTestStore(t)
+	for _, name := range []string{"c.txt", "a.txt", "b.txt"} {
+		path := filepath.Join(src, name)
+		addFile(t, fs, path, "1", "", "1")
+		addFile(t, fs, path, "2", "", "2")
+	}
+	paths, err := fs.Paths(2, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []string{filepath.Join(src, "b.txt"), filepath.Join(src, "c.txt")}
+	if fmt.Sprint(paths) != fmt.Sprint(want) {
+		t.Fatalf("Paths(2, 1) = %v, want %v", paths, want)
+	}
+}
+
+// readFile returns the contents of the file at path.
+func readFile(t *testing.T, path string) string {
+	t.Helper()
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(data)
+}
+
+func TestRestoreReadOnly(t *testing.T) {
+	fs, src := newTestStore(t)
+	v := addFile(t, fs, filepath.Join(src, "a.txt"), "contents", "", "1")
+	if err := fs.Close(); err != nil {
+		t.Fatal(err)
+	}
+	ro, _ := openTestStore(t, NewFilestore(fs.Dir, ReadOnly))
+	dst := t.TempDir()
+	if err := ro.Restore(v, dst); err != nil {
+		t.Fatal(err)
+	}
+	if got := readFile(t, filepath.Join(dst, "a.txt")); got != "contents" {
+		t.Fatalf("restored %q, want %q", got, "contents")
+	}
+	if err := ro.RestoreWith(v, dst, RestoreOptions{Marker: true}); !errors.Is(err, ErrReadOnly) {
+		t.Fatalf("RestoreWith a marker = %v, want ErrReadOnly", err)
+	}
+}
+
+func TestShared(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("permission bits are not supported on Windows")
+	}
+	fs, src := openTestStore(t, NewFilestore(filepath.Join(t.TempDir(), "store"), Shared))
+	path := filepath.Join(src, "a.txt")
+	addFile(t, fs, path, "a", "", "1")
+	info, err := os.Stat(fs.Root())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.Mode().Perm() != 0750 || info.Mode()&os.ModeSetgid == 0 {
+		t.Fatalf("root directory has mode %v, want group-readable with the setgid bit", info.Mode())
+	}
+	// a reader sees versions added while it is open
+	ro, _ := openTestStore(t, NewFilestore(fs.Dir, Shared|ReadOnly))
+	if err := ro.Add(path, "", "2"); !errors.Is(err, ErrReadOnly) {
+		t.Fatalf("Add to a read-only filestore = %v, want ErrReadOnly", err)
+	}
+	addFile(t, fs, path, "b", "", "2")
+	if versions, err := ro.Versions(path, -1); err != nil || len(versions) != 2 {
+		t.Fatalf("Versions = %v, %v from the reader, want 2 versions", versions, err)
+	}
+}
+
+func TestGetAt(t *testing.T) {
+	fs, src := newTestStore(t)
+	path := filepath.Join(src, "a.txt")
+	addFile(t, fs, path, "a", "", "1")
+	if _, err := fs.db.Exec("update Versions set date=?;", ToDBDate(time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC))); err != nil {
+		t.Fatal(err)
+	}
+	addFile(t, fs, path, "b", "", "2")
+	if v, err := fs.GetAt(path, time.Date(2021, 1, 1, 0, 0, 0, 0, time.UTC)); err != nil || v.Version != "1" {
+		t.Fatalf("GetAt in 2021 = %v, %v, want version 1", v, err)
+	}
+	if v, err := fs.GetAt(path, time.Now()); err != nil || v.Version != "2" {
+		t.Fatalf("GetAt now = %v, %v, want version 2", v, err)
+	}
+	if _, err := fs.GetAt(path, time.Date(2019, 1, 1, 0, 0, 0, 0, time.UTC)); !errors.Is(err, ErrNotFound) {
+		t.Fatalf("GetAt before the first version = %v, want ErrNotFound", err)
+	}
+}
+
+func TestInternInfo(t *testing.T) {
+	fs, src := newTestStore(t)
+	path := filepath.Join(src, "a.txt")
+	for i := 0; i < 3; i++ {
+		addFile(t, fs, path, "a", "same info", fmt.Sprint(i))
+	}
+	addFile(t, fs, path, "a", "other info", "3")
+	countInfos := func() int {
+		t.Helper()
+		var n int
+		if err := fs.db.QueryRow("select count(*) from Infos;").Scan(&n); err != nil {
+			t.Fatal(err)
+		}
+		return n
+	}
+	if n := countInfos(); n != 2 {
+		t.Fatalf("%d info strings stored, want 2", n)
+	}
+	versions, err := fs.Versions(path, -1)
+	if err != nil || len(versions) != 4 {
+		t.Fatalf("Versions = %v, %v, want 4 versions", versions, err)
+	}
+	if versions[0].Info != "other info" || versions[0].Fuzzy == "" || versions[3].Info != "same info" {
+		t.Fatalf("Versions = %+v, want their info strings and fuzzy hashes", versions)
+	}
+	// info strings no longer used are removed
+	if err := fs.DeleteVersion(versions[0]); err != nil {
+		t.Fatal(err)
+	}
+	if n := countInfos(); n != 1 {
+		t.Fatalf("%d info strings stored after deleting the only version with other info, want 1", n)
+	}
+}
+
+func TestRestoreLink(t *testing.T) {
+	fs, src := openTestStore(t, NewFilestore(filepath.Join(t.TempDir(), "store"), RestoreLink))
+	v := addFile(t, fs, filepath.Join(src, "a.txt"), "contents", "", "1")
+	dst := t.TempDir()
+	path := filepath.Join(dst, "a.txt")
+	writeFile(t, path, "old")
+	for i := 0; i < 2; i++ {
+		// restoring again keeps the link
+		if err := fs.Restore(v, dst); err != nil {
+			t.Fatal(err)
+		}
+		if got := readFile(t, path); got != "contents" {
+			t.Fatalf("restored %q, want %q", got, "contents")
+		}
+	}
+	blob, err := os.Stat(fs.blobFile(v.Name, v.Checksum, codecs[fs.compression()]))
+	if err != nil {
+		t.Fatal(err)
+	}
+	restored, err := os.Stat(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !os.SameFile(blob, restored) {
+		t.Fatal("restored file is not a hard link to the blob")
+	}
+	// the permissions of a link cannot differ from the blob, so it is copied
+	fs.RestoreMode = 0600
+	other := t.TempDir()
+	if err := fs.Restore(v, other); err != nil {
+		t.Fatal(err)
+	}
+	if restored, err = os.Stat(filepath.Join(other, "a.txt")); err != nil || os.SameFile(blob, restored) {
+		t.Fatalf("Stat = %v, %v, want a copy with RestoreMode", restored, err)
+	}
+}
+
+func TestOpenReadOnlyNeedsMigration(t *testing.T) {
+	fs, src := newTestStore(t)
+	path := filepath.Join(src, "a.txt")
+	addFile(t, fs, path, "a", "", "1")
+	if err := fs.Close(); err != nil {
+		t.Fatal(err)
+	}
+	// pretend that the last migration has not been applied yet
+	db, err := sql.Open(driverName, fs.dbPath())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	if _, err := db.Exec(fmt.Sprintf("pragma user_version=%d;", len(migrations)-1)); err != nil {
+		t.Fatal(err)
+	}
+	ro := NewFilestore(fs.Dir, ReadOnly)
+	if err := ro.Open(); !errors.Is(err, ErrNeedsMigration) {
+		ro.Close()
+		t.Fatalf("Open = %v, want ErrNeedsMigration", err)
+	}
+	// and that it has been applied since
+	if _, err := db.Exec(fmt.Sprintf("pragma user_version=%d;", len(migrations))); err != nil {
+		t.Fatal(err)
+	}
+	openTestStore(t, ro)
+	if v, err := ro.Get(path); err != nil || v.Version != "1" {
+		t.Fatalf("Get = %v, %v after migration", v, err)
+	}
+}
+
+func TestClosed(t *testing.T) {
+	fs, src := newTestStore(t)
+	path := filepath.Join(src, "a.txt")
+	addFile(t, fs, path, "a", "", "1")
+	if err := fs.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if err := fs.Add(path, "", "2"); !errors.Is(err, ErrNotOpen) {
+		t.Fatalf("Add = %v, want ErrNotOpen", err)
+	}
+	if _, err := fs.Get(path); !errors.Is(err, ErrNotOpen) {
+		t.Fatalf("Get = %v, want ErrNotOpen", err)
+	}
+	if fs.Has(path) {
+		t.Fatal("Has = true for a closed filestore")
+	}
+	if err := fs.Close(); !errors.Is(err, ErrNotOpen) {
+		t.Fatalf("Close = %v, want ErrNotOpen", err)
+	}
+}
+
+func TestSeq(t *testing.T) {
+	fs, src := newTestStore(t)
+	path := filepath.Join(src, "a.txt")
+	for i := 0; i < 4; i++ {
+		addFile(t, fs, path, fmt.Sprint(i), "", "")
+	}
+	if v := addFile(t, fs, filepath.Join(src, "b.txt"), "b", "", ""); v.Seq != 1 {
+		t.Fatalf("Seq = %d, want the versions of each path numbered separately", v.Seq)
+	}
+	versions, err := fs.Versions(path, -1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i, v := range versions {
+		if v.Seq != int64(4-i) {
+			t.Fatalf("version %d has Seq %d, want %d", i, v.Seq, 4-i)
+		}
+	}
+	if v, err := fs.GetSeq(path, 3); err != nil || v.ID != versions[1].ID {
+		t.Fatalf("GetSeq = %+v, %v, want %+v", v, err, versions[1])
+	}
+	// numbers of deleted versions are not reused
+	if err := fs.DeleteVersion(versions[0]); err != nil {
+		t.Fatal(err)
+	}
+	if v := addFile(t, fs, path, "new", "", ""); v.Seq != 5 {
+		t.Fatalf("Seq = %d after deleting the latest version, want 5", v.Seq)
+	}
+	if _, err := fs.GetSeq(path, 4); !errors.Is(err, ErrNotFound) {
+		t.Fatalf("GetSeq of a deleted version = %v, want ErrNotFound", err)
+	}
+}
@@ -0,0 +1,227 @@
+package filestore
+
+import (
+	"io"
+	iofs "io/fs"
+	"path"
+	"sort"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+// fsName is the SQL expression for the name of a stored path in the file system returned by FS,
+// which is the slash-separated path without its leading slash.
+const fsName = "(case when substr(path, 1, 1)='/' then substr(path, 2) else path end)"
+
+// FS returns a read-only file system of the latest versions of all files in the filestore, which
+// can be used with fs.WalkDir, http.FS, template.ParseFS and the like. Files are named by their
+// slash-separated source paths without the leading slash, so the latest version of
+// /home/user/notes.txt is opened as "home/user/notes.txt". Directories are derived from the
+// paths of the stored files. Files are opened as *VersionReader and support io.Seeker and
+// io.ReaderAt.
+func (fs *Filestore) FS() iofs.FS {
+	return &storeFS{fs: fs}
+}
+
+// FSAt returns a read-only file system like FS, which presents the filestore as it was at time
+// t. Each file is opened in the version that was current at t, and files added after t are not
+// part of it.
+func (fs *Filestore) FSAt(t time.Time) iofs.FS {
+	return &storeFS{fs: fs, at: ToDBDate(t.UTC())}
+}
+
+// storeFS implements fs.FS and fs.ReadDirFS for the filestore.
+type storeFS struct {
+	fs *Filestore
+	at string // the database date at which the filestore is presented, empty for the latest versions
+}
+
+// Open opens the named file or directory.
+func (s *storeFS) Open(name string) (iofs.File, error) {
+	if !iofs.ValidPath(name) {
+		return nil, &iofs.PathError{Op: "open", Path: name, Err: iofs.ErrInvalid}
+	}
+	if err := s.fs.ensureOpen(); err != nil {
+		return nil, &iofs.PathError{Op: "open", Path: name, Err: err}
+	}
+	if name != "." {
+		version, info, err := s.latest(name)
+		if err == nil {
+			r, err := s.fs.openSeekable(version)
+			if err != nil {
+				return nil, &iofs.PathError{Op: "open", Path: name, Err: err}
+			}
+			return &storeFile{VersionReader: r, info: info}, nil
+		}
+		if err != ErrNotFound {
+			return nil, &iofs.PathError{Op: "open", Path: name, Err: err}
+		}
+	}
+	entries, err := s.readDir(name)
+	if err != nil {
+		return nil, &iofs.PathError{Op: "open", Path: name, Err: err}
+	}
+	if len(entries) == 0 && name != "." {
+		return nil, &iofs.PathError{Op: "open", Path: name, Err: iofs.ErrNotExist}
+	}
+	return &storeDir{info: dirInfo(name), entries: entries}, nil
+}
+
+// ReadDir reads the named directory and returns its entries sorted by name.
+func (s *storeFS) ReadDir(name string) ([]iofs.DirEntry, error) {
+	if !iofs.ValidPath(name) {
+		return nil, &iofs.PathError{Op: "readdir", Path: name, Err: iofs.ErrInvalid}
+	}
+	if err := s.fs.ensureOpen(); err != nil {
+		return nil, &iofs.PathError{Op: "readdir", Path: name, Err: err}
+	}
+	entries, err := s.readDir(name)
+	if err != nil {
+		return nil, &iofs.PathError{Op: "readdir", Path: name, Err: err}
+	}
+	if len(entries) == 0 && name != "." {
+		return nil, &iofs.PathError{Op: "readdir", Path: name, Err: iofs.ErrNotExist}
+	}
+	return entries, nil
+}
+
+// latest returns the latest version of the file with the given name and its file info, or
+// ErrNotFound if there is no such file.
+func (s *storeFS) latest(name string) (FileVersion, iofs.FileInfo, error) {
+	rows, err := s.fs.db.Query(selectVersions+" where Versions.path in (?1, ?2) and (?3='' or Versions.date <= ?3) order by Versions.date desc, version_id desc limit 1;",
+		"/"+s.fs.storedPath(name), s.fs.storedPath(name), s.at)
+	if err != nil {
+		return FileVersion{}, nil, s.fs.dbError(err)
+	}
+	versions, err := s.fs.getVersions(rows)
+	if err != nil {
+		return FileVersion{}, nil, err
+	}
+	if len(versions) == 0 {
+		return FileVersion{}, nil, ErrNotFound
+	}
+	var size int64
+	if err := s.fs.db.QueryRow("select size from Files where checksum=?;", versions[0].Checksum).Scan(&size); err != nil {
+		return FileVersion{}, nil, s.fs.dbError(err)
+	}
+	info := &storeFileInfo{name: path.Base(name), size: size, mode: 0444, modTime: versions[0].From}
+	return versions[0], info, nil
+}
+
+// readDir returns the entries of the named directory sorted by name, which are empty if there
+// is no such directory.
+func (s *storeFS) readDir(name string) ([]iofs.DirEntry, error) {
+	prefix := ""
+	if name != "." {
+		prefix = s.fs.storedPath(name) + "/"
+	}
+	rows, err := s.fs.db.Query("select "+fsName+", date, size from Versions inner join Files on Versions.file=Files.file_id where substr("+fsName+", 1, ?1)=?2 and version_id=(select version_id from Versions as V where V.path=Versions.path and (?3='' or V.date <= ?3) order by date desc, version_id desc limit 1);",
+		utf8.RuneCountInString(prefix), prefix, s.at)
+	if err != nil {
+		return nil, s.fs.dbError(err)
+	}
+	defer rows.Close()
+	seen := make(map[string]bool)
+	entries := make([]iofs.DirEntry, 0)
+	for rows.Next() {
+		var file, date string
+		var size int64
+		if err := rows.Scan(&file, &date, &size); err != nil {
+			return nil, s.fs.dbError(err)
+		}
+		child := file[len(prefix):]
+		i := strings.IndexByte(child, '/')
+		if i >= 0 {
+			child = child[:i]
+		}
+		if child == "" || seen[child] {
+			continue
+		}
+		seen[child] = true
+		var info iofs.FileInfo = dirInfo(child)
+		if i < 0 {
+			modTime, err := ParseDBDate(date)
+			if err != nil {
+				return nil, ErrInvalidDate
+			}
+			info = &storeFileInfo{name: child, size: size, mode: 0444, modTime: modTime}
+		}
+		entries = append(entries, iofs.FileInfoToDirEntry(info))
+	}
+	if err := rows.Err(); err != nil {
+		return nil, s.fs.dbError(err)
+	}
+	sort.Slice(entries, func(i, j int) bool { return entries[i].Name() < entries[j].Name() })
+	return entries, nil
+}
+
+// storeFileInfo describes a file or directory of the file system returned by FS.
+type storeFileInfo struct {
+	name    string
+	size    int64
+	mode    iofs.FileMode
+	modTime time.Time
+}
+
+// dirInfo returns the file info of the directory with the given name.
+func dirInfo(name string) *storeFileInfo {
+	return &storeFileInfo{name: path.Base(name), mode: iofs.ModeDir | 0555}
+}
+
+func (i *storeFileInfo) Name() string        { return i.name }
+func (i *storeFileInfo) Size() int64         { return i.size }
+func (i *storeFileInfo) Mode() iofs.FileMode { return i.mode }
+func (i *storeFileInfo) ModTime() time.Time  { return i.modTime }
+func (i *storeFileInfo) IsDir() bool         { return i.mode.IsDir() }
+func (i *storeFileInfo) Sys() interface{}    { return nil }
+
+// storeFile is a file opened from the file system returned by FS.
+type storeFile struct {
+	*VersionReader
+	info iofs.FileInfo
+}
+
+// Stat returns the file info of the file.
+func (f *storeFile) Stat() (iofs.FileInfo, error) {
+	return f.info, nil
+}
+
+// storeDir is a directory opened from the file system returned by FS.
+type storeDir struct {
+	info    iofs.FileInfo
+	entries []iofs.DirEntry
+	offset  int
+}
+
+// Stat returns the file info of the directory.
+func (d *storeDir) Stat() (iofs.FileInfo, error) {
+	return d.info, nil
+}
+
+// Read fails because directories cannot be read.
+func (d *storeDir) Read([]byte) (int, error) {
+	return 0, &iofs.PathError{Op: "read", Path: d.info.Name(), Err: iofs.ErrInvalid}
+}
+
+// Close closes the directory.
+func (d *storeDir) Close() error {
+	return nil
+}
+
+// ReadDir returns the next n entries of the directory, or all remaining entries if n <= 0.
+func (d *storeDir) ReadDir(n int) ([]iofs.DirEntry, error) {
+	rest := d.entries[d.offset:]
+	if n <= 0 {
+		d.offset = len(d.entries)
+		return rest, nil
+	}
+	if len(rest) == 0 {
+		return nil, io.EOF
+	}
+	if n > len(rest) {
+		n = len(rest)
+	}
+	d.offset += n
+	return rest[:n], nil
+}
@@ -0,0 +1,73 @@
+package filestore
+
+import (
+	"errors"
+	"io"
+	iofs "io/fs"
+	"path/filepath"
+	"strings"
+	"testing"
+	"testing/fstest"
+	"time"
+)
+
+// viewName returns the name of the file at path in the file systems returned by FS and FSAt.
+func viewName(path string) string {
+	return strings.TrimPrefix(filepath.ToSlash(path), "/")
+}
+
+func TestFS(t *testing.T) {
+	fs, src := newTestStore(t)
+	a := filepath.Join(src, "a.txt")
+	b := filepath.Join(src, "sub", "deep", "b.txt")
+	addFile(t, fs, a, "old", "", "1")
+	addFile(t, fs, a, "newer", "", "2")
+	addFile(t, fs, b, "b", "", "1")
+	fsys := fs.FS()
+	if data, err := iofs.ReadFile(fsys, viewName(a)); err != nil || string(data) != "newer" {
+		t.Fatalf("ReadFile = %q, %v, want the latest version", data, err)
+	}
+	if err := fstest.TestFS(fsys, viewName(a), viewName(b)); err != nil {
+		t.Fatal(err)
+	}
+	f, err := fsys.Open(viewName(b))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := f.(io.Seeker); !ok {
+		t.Fatal("opened file is no io.Seeker")
+	}
+	f.Close()
+	if _, err := fsys.Open(viewName(a) + "x"); !errors.Is(err, iofs.ErrNotExist) {
+		t.Fatalf("Open of a missing file = %v, want fs.ErrNotExist", err)
+	}
+}
+
+func TestFSAt(t *testing.T) {
+	fs, src := newTestStore(t)
+	a, b := filepath.Join(src, "a.txt"), filepath.Join(src, "b.txt")
+	addFile(t, fs, a, "old", "", "1")
+	if _, err := fs.db.Exec("update Versions set date=?;", ToDBDate(time.Now().Add(-time.Hour))); err != nil {
+		t.Fatal(err)
+	}
+	addFile(t, fs, a, "newer", "", "2")
+	addFile(t, fs, b, "b", "", "1")
+	past := fs.FSAt(time.Now().Add(-30 * time.Minute))
+	if data, err := iofs.ReadFile(past, viewName(a)); err != nil || string(data) != "old" {
+		t.Fatalf("ReadFile = %q, %v, want the version current half an hour ago", data, err)
+	}
+	if _, err := past.Open(viewName(b)); !errors.Is(err, iofs.ErrNotExist) {
+		t.Fatalf("Open of a file added later = %v, want fs.ErrNotExist", err)
+	}
+	entries, err := iofs.ReadDir(past, viewName(src))
+	if err != nil || len(entries) != 1 || entries[0].Name() != "a.txt" {
+		t.Fatalf("ReadDir = %v, %v, want only a.txt", entries, err)
+	}
+	// before the first version, the file system is empty
+	if entries, err := iofs.ReadDir(fs.FSAt(time.Now().Add(-2*time.Hour)), "."); err != nil || len(entries) != 0 {
+		t.Fatalf("ReadDir = %v, %v, want no entries", entries, err)
+	}
+	if data, err := iofs.ReadFile(fs.FSAt(time.Now().Add(time.Minute)), viewName(a)); err != nil || string(data) != "newer" {
+		t.Fatalf("ReadFile = %q, %v, want the latest version", data, err)
+	}
+}
@@ -0,0 +1,232 @@
+package filestore
+
+import (
+	"fmt"
+	"math"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"sort"
+	"time"
+)
+
+// GenerateOptions are the options of Generate. Zero values select the defaults.
+type GenerateOptions struct {
+	// Dir is the directory in which the generated files are written, whose paths are the paths of
+	// the versions. A temporary directory that is removed afterwards is used if it is empty.
+	Dir      string
+	Paths    int   // the number of paths, 100 by default
+	Versions int   // the average number of versions of each path, 10 by default
+	MeanSize int64 // the mean size of files in bytes, 64 KiB by default; sizes are log-normally distributed
+	MaxSize  int64 // the maximum size of files in bytes, 64 times MeanSize by default
+	// Duplicates is the probability that the first version of a path has the same contents as
+	// the first version of another path, which is 0.1 by default. It is 0 if negative.
+	Duplicates float64
+	// Change is the fraction of the contents that changes between versions of a path, which is
+	// 0.05 by default, so that chunked filestores share most chunks between versions.
+	Change float64
+	// Since is the date of the oldest versions, one year ago by default. The dates of the versions
+	// are spread evenly between Since and now.
+	Since time.Time
+	Seed  int64 // the seed of the random numbers, so that the same options generate the same store
+}
+
+// GenerateReport summarizes the versions added by Generate.
+type GenerateReport struct {
+	Paths    int   // the number of paths
+	Versions int   // the number of versions added
+	Bytes    int64 // the total size of the versions
+}
+
+// Generate adds synthetic versions to the filestore as configured by opts, for load testing
+// applications using filestores and trying maintenance operations at scale. Paths have several
+// directory levels and common extensions, the sizes of files are log-normally distributed, some
+// paths share contents and successive versions of a path differ slightly. The versions are dated
+// between opts.Since and now, which retention policies take into account. They are added in
+// transactions of up to 100 versions.
+func (fs *Filestore) Generate(opts GenerateOptions) (_ GenerateReport, err error) {
+	op := newOp("Generate", opts.Dir)
+	defer op.done(&err)
+	if err := fs.ensureOpen(); err != nil {
+		return GenerateReport{}, err
+	}
+	opts = opts.withDefaults()
+	dir := opts.Dir
+	if dir == "" {
+		if dir, err = os.MkdirTemp("", "filestore-generate-"); err != nil {
+			return GenerateReport{}, err
+		}
+		defer os.RemoveAll(dir)
+	}
+	r := rand.New(rand.NewSource(opts.Seed))
+	// the number of versions of each path and the dates of all versions in order
+	counts := make([]int, opts.Paths)
+	total := 0
+	for i := range counts {
+		counts[i] = 1 + r.Intn(2*opts.Versions-1)
+		total += counts[i]
+	}
+	now := time.Now().UTC()
+	step := now.Sub(opts.Since) / time.Duration(total)
+	slots := r.Perm(total)
+	report := GenerateReport{Paths: opts.Paths}
+	var seeds []int64 // the seeds of the first contents of the paths generated so far
+	var tx *Tx
+	for i, count := range counts {
+		path := filepath.Join(dir, generatedPath(r, i))
+		if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+			return report, err
+		}
+		seed := r.Int63()
+		if len(seeds) > 0 && r.Float64() < opts.Duplicates {
+			seed = seeds[r.Intn(len(seeds))]
+		}
+		seeds = append(seeds, seed)
+		data := generatedData(rand.New(rand.NewSource(seed)), opts.MeanSize, opts.MaxSize)
+		// the versions of the path take the next slots of the timeline in date order
+		dates := make([]int, count)
+		copy(dates, slots[:count])
+		slots = slots[count:]
+		sort.Ints(dates)
+		for j, slot := range dates {
+			if j > 0 {
+				data = changeData(r, data, opts.Change)
+			}
+			if err := os.WriteFile(path, data, 0600); err != nil {
+				return report, err
+			}
+			if tx == nil {
+				if tx, err = fs.begin(); err != nil {
+					return report, err
+				}
+			}
+			if err := fs.addGenerated(tx, path, j, opts.Since.Add(time.Duration(slot)*step)); err != nil {
+				tx.rollback()
+				return report, err
+			}
+			report.Versions++
+			report.Bytes += int64(len(data))
+			if report.Versions%100 == 0 {
+				err := tx.commit()
+				tx = nil
+				if err != nil {
+					return report, err
+				}
+			}
+		}
+	}
+	if tx != nil {
+		return report, tx.commit()
+	}
+	return report, nil
+}
+
+// withDefaults returns the options with defaults for zero values.
+func (opts GenerateOptions) withDefaults() GenerateOptions {
+	if opts.Paths <= 0 {
+		opts.Paths = 100
+	}
+	if opts.Versions <= 0 {
+		opts.Versions = 10
+	}
+	if opts.MeanSize <= 0 {
+		opts.MeanSize = 64 << 10
+	}
+	if opts.MaxSize <= 0 {
+		opts.MaxSize = 64 * opts.MeanSize
+	}
+	if opts.Duplicates == 0 {
+		opts.Duplicates = 0.1
+	}
+	if opts.Change <= 0 {
+		opts.Change = 0.05
+	}
+	if opts.Since.IsZero() {
+		opts.Since = time.Now().AddDate(-1, 0, 0)
+	}
+	opts.Since = opts.Since.UTC()
+	return opts
+}
+
+// addGenerated adds the j-th version of the generated file at path within tx and dates it. The
+// version is signed again, since its signature covers the date.
+func (fs *Filestore) addGenerated(tx *Tx, path string, j int, date time.Time) error {
+	check, err := fs.checksum(path, nil)
+	if err != nil {
+		return err
+	}
+	id, err := tx.addVersionID(path, fmt.Sprintf("generated %s revision %d", filepath.Base(path), j+1), fmt.Sprintf("1.%d.0", j), check)
+	if err != nil {
+		return err
+	}
+	if _, err := tx.tx.Exec("update Versions set date=? where version_id=?;", ToDBDate(date), id); err != nil {
+		return fs.dbError(err)
+	}
+	return fs.signVersion(tx.tx, id)
+}
+
+// generatedExtensions are the extensions of generated files.
+var generatedExtensions = []string{".txt", ".md", ".go", ".json", ".csv", ".pdf", ".jpg", ".png", ".bin", ".docx"}
+
+// generatedPath returns a relative path of up to three directory levels for the i-th path.
+func generatedPath(r *rand.Rand, i int) string {
+	parts := []string{fmt.Sprintf("dir%d", r.Intn(10))}
+	for depth := r.Intn(3); depth > 0; depth-- {
+		parts = append(parts, fmt.Sprintf("sub%d", r.Intn(10)))
+	}
+	parts = append(parts, fmt.Sprintf("file%d%s", i, generatedExtensions[r.Intn(len(generatedExtensions))]))
+	return filepath.Join(parts...)
+}
+
+// generatedData returns contents with a log-normally distributed size of the given mean, at most
+// max, made of random and repetitive blocks so that they are partly compressible.
+func generatedData(r *rand.Rand, mean, max int64) []byte {
+	const sigma = 1.0
+	size := int64(math.Exp(math.Log(float64(mean)) - sigma*sigma/2 + sigma*r.NormFloat64()))
+	if size > max {
+		size = max
+	}
+	data := make([]byte, size)
+	text := []byte("lorem ipsum dolor sit amet, consectetur adipiscing elit ")
+	for i := 0; i < len(data); i += 4096 {
+		block := data[i:]
+		if len(block) > 4096 {
+			block = block[:4096]
+		}
+		if r.Intn(2) == 0 {
+			r.Read(block)
+		} else {
+			for j := range block {
+				block[j] = text[(i+j)%len(text)]
+			}
+		}
+	}
+	return data
+}
+
+// changeData returns a copy of data in which about the given fraction of the bytes is changed in
+// a few places, and a little is appended or truncated.
+func changeData(r *rand.Rand, data []byte, change float64) []byte {
+	changed := make([]byte, len(data), len(data)+1024)
+	copy(changed, data)
+	n := int(float64(len(data)) * change)
+	for n > 0 && len(changed) > 0 {
+		size := 1 + r.Intn(256)
+		if size > n {
+			size = n
+		}
+		start := r.Intn(len(changed))
+		end := start + size
+		if end > len(changed) {
+			end = len(changed)
+		}
+		r.Read(changed[start:end])
+		n -= size
+	}
+	if r.Intn(2) == 0 {
+		extra := make([]byte, r.Intn(1024))
+		r.Read(extra)
+		return append(changed, extra...)
+	}
+	return changed[:len(changed)-r.Intn(len(changed)/100+1)]
+}
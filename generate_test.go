@@ -0,0 +1,68 @@
+package filestore
+
+import (
+	"crypto/ed25519"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestGenerateSigned(t *testing.T) {
+	_, key, err := ed25519.GenerateKey(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	fs := NewFilestore(filepath.Join(t.TempDir(), "store"), 0)
+	fs.SigningKey = key
+	openTestStore(t, fs)
+	since := time.Now().AddDate(0, -1, 0)
+	report, err := fs.Generate(GenerateOptions{Paths: 3, Versions: 2, MeanSize: 1024, Since: since, Seed: 1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var versions []FileVersion
+	err = fs.Iterate(func(v FileVersion) bool {
+		versions = append(versions, v)
+		return true
+	})
+	if err != nil || len(versions) != report.Versions {
+		t.Fatalf("Iterate = %d versions, %v, want %d", len(versions), err, report.Versions)
+	}
+	for _, v := range versions {
+		if v.From.Before(since.Add(-time.Second)) || v.From.After(time.Now()) {
+			t.Fatalf("version %v dated %v, want a date since %v", v.Path, v.From, since)
+		}
+		if err := fs.VerifySignature(v); err != nil {
+			t.Fatalf("VerifySignature of %s: %v", v.Path, err)
+		}
+	}
+}
+
+func TestGenerate(t *testing.T) {
+	fs, _ := openTestStore(t, NewFilestore(filepath.Join(t.TempDir(), "store"), Chunked|Compress))
+	report, err := fs.Generate(GenerateOptions{Paths: 30, Versions: 5, MeanSize: 20000, Seed: 1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	s, err := fs.Stats()
+	if err != nil || s.Versions != int64(report.Versions) || s.Paths != 30 {
+		t.Fatalf("Stats = %+v, %v, want %d versions of 30 paths", s, err, report.Versions)
+	}
+	// versions are dated within the last year by default
+	var versions []FileVersion
+	err = fs.Iterate(func(v FileVersion) bool {
+		versions = append(versions, v)
+		return true
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, v := range versions {
+		if v.From.After(time.Now()) || v.From.Before(time.Now().AddDate(-1, 0, -1)) {
+			t.Fatalf("version %v dated %v, want a date within the last year", v.Path, v.From)
+		}
+	}
+	if verify, err := fs.Verify(VerifyOptions{}); err != nil || !verify.OK() {
+		t.Fatalf("Verify = %v, %v", verify.Problems, err)
+	}
+}
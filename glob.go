@@ -0,0 +1,111 @@
+package filestore
+
+import (
+	"fmt"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// PathsMatching returns the distinct source paths of the files in the filestore that match the
+// glob pattern, in ascending order and in the os-specific format. The pattern is slash-separated
+// and uses the syntax of path.Match for each element, where * does not match slashes, and in
+// addition ** as a whole element matches any number of path elements, including none. A pattern
+// starting with a slash is matched against the whole path, any other pattern against a trailing
+// part of the path following a slash, so that "projects/*/reports/*.pdf" finds the reports of all
+// projects wherever they are and "/home/**/*.pdf" all PDF files below /home. Patterns are
+// normalized like paths according to the NormalizePaths and FoldCase options.
+func (fs *Filestore) PathsMatching(pattern string) (_ []string, err error) {
+	op := newOp("PathsMatching", pattern)
+	defer op.done(&err)
+	if err := fs.ensureOpen(); err != nil {
+		return nil, err
+	}
+	pattern = fs.storedPath(pattern)
+	elems := strings.Split(pattern, "/")
+	for _, elem := range elems {
+		if _, err := path.Match(elem, ""); err != nil {
+			return nil, fmt.Errorf("filestore glob pattern %q is malformed: %w", pattern, err)
+		}
+	}
+	if !strings.HasPrefix(pattern, "/") {
+		elems = append([]string{"**"}, elems...)
+	}
+	query := "select distinct path from Versions"
+	var args []interface{}
+	if prefilter, ok := sqlGlob(pattern); ok {
+		query += " where path glob ?"
+		args = append(args, prefilter)
+	}
+	rows, err := fs.db.Query(query+";", args...)
+	if err != nil {
+		return nil, fs.dbError(err)
+	}
+	defer rows.Close()
+	paths := make([]string, 0)
+	for rows.Next() {
+		var p string
+		if err := rows.Scan(&p); err != nil {
+			return nil, fs.dbError(err)
+		}
+		if globMatches(elems, strings.Split(p, "/")) {
+			paths = append(paths, filepath.FromSlash(p))
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fs.dbError(err)
+	}
+	sort.Strings(paths)
+	return paths, nil
+}
+
+// globMatches returns true if the pattern elements match the path elements, where an element
+// ** matches any number of path elements.
+func globMatches(pattern, elems []string) bool {
+	for len(pattern) > 0 {
+		if pattern[0] == "**" {
+			for i := 0; i <= len(elems); i++ {
+				if globMatches(pattern[1:], elems[i:]) {
+					return true
+				}
+			}
+			return false
+		}
+		if len(elems) == 0 {
+			return false
+		}
+		if ok, _ := path.Match(pattern[0], elems[0]); !ok {
+			return false
+		}
+		pattern, elems = pattern[1:], elems[1:]
+	}
+	return len(elems) == 0
+}
+
+// sqlGlob translates a glob pattern into an SQLite GLOB pattern that matches at least the paths
+// matched by the pattern, so that the database can skip paths that cannot match. Since the wildcards
+// of GLOB also match slashes, ** becomes *, which absorbs the following slash, or the preceding one
+// at the end of the pattern, so that it still matches no elements at all. It returns false if the
+// pattern contains escapes, which GLOB does not support.
+func sqlGlob(pattern string) (string, bool) {
+	if strings.Contains(pattern, `\`) {
+		return "", false
+	}
+	elems := strings.Split(pattern, "/")
+	var b strings.Builder
+	for i, elem := range elems {
+		if i > 0 && elems[i-1] != "**" && (elem != "**" || i < len(elems)-1) {
+			b.WriteByte('/')
+		}
+		for strings.Contains(elem, "**") {
+			elem = strings.ReplaceAll(elem, "**", "*")
+		}
+		b.WriteString(elem)
+	}
+	pattern = b.String()
+	if !strings.HasPrefix(pattern, "/") {
+		pattern = "*" + pattern
+	}
+	return pattern, true
+}
@@ -0,0 +1,43 @@
+package filestore
+
+import (
+	"errors"
+	"fmt"
+	"path"
+	"path/filepath"
+	"testing"
+)
+
+func TestPathsMatching(t *testing.T) {
+	fs, src := newTestStore(t)
+	files := []string{"projects/a/reports/x.pdf", "projects/b/reports/y.pdf", "projects/b/reports/old/z.pdf", "projects/c/notes.txt", "top.pdf"}
+	for i, f := range files {
+		addFile(t, fs, filepath.Join(src, filepath.FromSlash(f)), fmt.Sprint(i), "", "")
+	}
+	for _, c := range []struct {
+		pattern string
+		want    []string
+	}{
+		{"projects/*/reports/*.pdf", []string{files[0], files[1]}},
+		{"projects/**/*.pdf", []string{files[0], files[2], files[1]}},
+		{"reports/**/*.pdf", []string{files[0], files[2], files[1]}},
+		{"**/c/notes.txt/**", []string{files[3]}},
+		{"*.pdf", []string{files[0], files[2], files[1], files[4]}},
+		{filepath.ToSlash(src) + "/*.pdf", []string{files[4]}},
+		{filepath.ToSlash(src) + "/**", []string{files[0], files[2], files[1], files[3], files[4]}},
+		{"nothing/**", nil},
+		{`projects/\c/notes.txt`, []string{files[3]}},
+	} {
+		var want []string
+		for _, f := range c.want {
+			want = append(want, filepath.Join(src, filepath.FromSlash(f)))
+		}
+		got, err := fs.PathsMatching(c.pattern)
+		if err != nil || fmt.Sprint(got) != fmt.Sprint(want) {
+			t.Fatalf("PathsMatching(%q) = %v, %v, want %v", c.pattern, got, err, want)
+		}
+	}
+	if _, err := fs.PathsMatching("projects/[a"); !errors.Is(err, path.ErrBadPattern) {
+		t.Fatalf("PathsMatching of an invalid pattern = %v, want path.ErrBadPattern", err)
+	}
+}
@@ -3,12 +3,39 @@ module github.com/rasteric/filestore
 go 1.18
 
 require (
-	github.com/bvinc/go-sqlite-lite v0.6.1 // indirect
 	github.com/dlclark/metaphone3 v0.0.0-20190903202417-5fe87fcdd547
+	github.com/fsnotify/fsnotify v1.5.1
 	github.com/golang/snappy v0.0.4
-	github.com/mattn/go-sqlite3 v1.14.8 // indirect
+	github.com/klauspost/compress v1.15.9
+	github.com/mattn/go-sqlite3 v1.14.12
+	github.com/pierrec/lz4/v4 v4.1.17
+	github.com/pkg/sftp v1.13.4
 	github.com/rasteric/flags v0.0.0-20191029113133-ef59ddff9f98
-	github.com/satori/go.uuid v1.2.0 // indirect
+	github.com/zeebo/blake3 v0.2.3
+	github.com/zeebo/xxh3 v1.0.2
 	golang.org/x/crypto v0.0.0-20210817164053-32db794688a5
-	golang.org/x/sys v0.0.0-20210819072135-bce67f096156 // indirect
+	golang.org/x/sys v0.0.0-20211007075335-d3039528d8ac
+	golang.org/x/text v0.3.7
+	modernc.org/sqlite v1.18.0
+)
+
+require (
+	github.com/google/uuid v1.3.0 // indirect
+	github.com/kballard/go-shellquote v0.0.0-20180428030007-95032a82bc51 // indirect
+	github.com/klauspost/cpuid/v2 v2.0.12 // indirect
+	github.com/kr/fs v0.1.0 // indirect
+	github.com/mattn/go-isatty v0.0.12 // indirect
+	github.com/remyoudompheng/bigfft v0.0.0-20200410134404-eec4a21b6bb0 // indirect
+	golang.org/x/mod v0.3.0 // indirect
+	golang.org/x/tools v0.0.0-20201124115921-2c860bdd6e78 // indirect
+	golang.org/x/xerrors v0.0.0-20200804184101-5ec99f83aff1 // indirect
+	lukechampine.com/uint128 v1.1.1 // indirect
+	modernc.org/cc/v3 v3.36.0 // indirect
+	modernc.org/ccgo/v3 v3.16.6 // indirect
+	modernc.org/libc v1.16.7 // indirect
+	modernc.org/mathutil v1.4.1 // indirect
+	modernc.org/memory v1.1.1 // indirect
+	modernc.org/opt v0.1.1 // indirect
+	modernc.org/strutil v1.1.1 // indirect
+	modernc.org/token v1.0.0 // indirect
 )
@@ -0,0 +1,64 @@
+package filestore
+
+import (
+	"crypto/sha256"
+	"errors"
+	"hash"
+
+	"github.com/zeebo/blake3"
+	"github.com/zeebo/xxh3"
+	"golang.org/x/crypto/blake2b"
+)
+
+var ErrUnknownHash = errors.New("filestore hash algorithm is unknown")
+
+// Names of the hash algorithms that can be used for the checksums of files by setting the Hash
+// field of a Filestore. The name of the algorithm is stored with the checksum of each file, so a
+// filestore may contain checksums computed with different algorithms.
+const (
+	HashBlake2b512 = "blake2b-512" // the default, cryptographic
+	HashBlake3     = "blake3"      // 256 bits, cryptographic and faster than Blake2b on most CPUs
+	HashSHA256     = "sha256"      // cryptographic and hardware-accelerated on many CPUs
+	// HashXXH3 is the 128 bit variant of XXH3, which is very fast but not cryptographic. It must
+	// only be used if the files added cannot be crafted to collide with other files.
+	HashXXH3 = "xxh3"
+)
+
+// hashName returns the name of the hash algorithm used for the checksums of added files.
+func (fs *Filestore) hashName() string {
+	if fs.Hash == "" {
+		return HashBlake2b512
+	}
+	return fs.Hash
+}
+
+// newHash returns a new hash of the algorithm with the given name.
+func newHash(name string) (hash.Hash, error) {
+	switch name {
+	case HashBlake2b512:
+		return blake2b.New512(nil)
+	case HashBlake3:
+		return blake3.New(), nil
+	case HashSHA256:
+		return sha256.New(), nil
+	case HashXXH3:
+		return &xxh3Hash128{xxh3.New()}, nil
+	}
+	return nil, ErrUnknownHash
+}
+
+// xxh3Hash128 computes the 128 bit variant of XXH3.
+type xxh3Hash128 struct {
+	*xxh3.Hasher
+}
+
+// Size returns the number of bytes returned by Sum.
+func (h *xxh3Hash128) Size() int {
+	return 16
+}
+
+// Sum appends the 128 bit hash of the data written so far to b.
+func (h *xxh3Hash128) Sum(b []byte) []byte {
+	sum := h.Sum128().Bytes()
+	return append(b, sum[:]...)
+}
@@ -0,0 +1,37 @@
+package filestore
+
+import (
+	"errors"
+	"path/filepath"
+	"testing"
+)
+
+func TestHashes(t *testing.T) {
+	fs, src := newTestStore(t)
+	digits := map[string]int{HashBlake2b512: 128, HashBlake3: 64, HashSHA256: 64, HashXXH3: 32}
+	var versions []FileVersion
+	for _, hash := range []string{"", HashBlake3, HashSHA256, HashXXH3} {
+		fs.Hash = hash
+		v := addFile(t, fs, filepath.Join(src, "a"+hash), "same", "", "1")
+		if v.Hash != fs.hashName() || len(v.Checksum) != digits[v.Hash] {
+			t.Fatalf("version has checksum %s of hash %s, want %d digits of hash %s", v.Checksum, v.Hash, digits[fs.hashName()], fs.hashName())
+		}
+		versions = append(versions, v)
+	}
+	// versions remain readable with the hashes they were added with
+	fs.Hash = ""
+	for _, v := range versions {
+		r, err := fs.OpenSeekable(v)
+		if err != nil {
+			t.Fatalf("OpenSeekable of a version with hash %s = %v", v.Hash, err)
+		}
+		r.Close()
+	}
+	if err := fs.Close(); err != nil {
+		t.Fatal(err)
+	}
+	fs.Hash = "md5"
+	if err := fs.Open(); !errors.Is(err, ErrUnknownHash) {
+		t.Fatalf("Open with an unknown hash = %v, want ErrUnknownHash", err)
+	}
+}
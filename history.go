@@ -0,0 +1,186 @@
+package filestore
+
+import (
+	"os"
+	"os/user"
+	"path/filepath"
+	"strings"
+)
+
+// history kinds recorded in the History table
+const (
+	historyDeleted  = "deleted"
+	historyRenamed  = "renamed"
+	historyRestored = "restored"
+)
+
+// MarkDeleted records in the history that the source file at path has been deleted. The
+// versions of the file remain in the filestore. ErrNotFound is returned if the filestore
+// has no versions of the file.
+func (fs *Filestore) MarkDeleted(path string) (err error) {
+	op := newOp("MarkDeleted", path)
+	defer op.done(&err)
+	if err := fs.ensureOpen(); err != nil {
+		return err
+	}
+	if !fs.Has(path) {
+		return ErrNotFound
+	}
+	return fs.addHistory(path, historyDeleted, "", 0, "", "")
+}
+
+// IsDeleted returns true if a deletion of the file at path has been recorded with MarkDeleted
+// and no new version of it has been added since then.
+func (fs *Filestore) IsDeleted(path string) (_ bool, err error) {
+	op := newOp("IsDeleted", path)
+	defer op.done(&err)
+	if err := fs.ensureOpen(); err != nil {
+		return false, err
+	}
+	var deleted bool
+	err = fs.db.QueryRow("select exists (select 1 from History where path=?1 and kind=?2 and date >= (select max(date) from Versions where path=?1));",
+		fs.storedPath(path), historyDeleted).Scan(&deleted)
+	if err != nil {
+		return false, fs.dbError(err)
+	}
+	return deleted, nil
+}
+
+// Orphaned returns the paths of all files in the filestore whose source files no longer exist
+// on disk. The paths are returned in the os-specific format. If paths are stored normalized
+// according to the NormalizePaths or FoldCase options, a source file exists if a file on disk
+// has a path normalized the same way.
+func (fs *Filestore) Orphaned() (_ []string, err error) {
+	op := newOp("Orphaned", "")
+	defer op.done(&err)
+	if err := fs.ensureOpen(); err != nil {
+		return nil, err
+	}
+	rows, err := fs.db.Query("select distinct path from Versions order by path;")
+	if err != nil {
+		return nil, fs.dbError(err)
+	}
+	defer rows.Close()
+	orphans := make([]string, 0)
+	for rows.Next() {
+		var path string
+		if err := rows.Scan(&path); err != nil {
+			return nil, fs.dbError(err)
+		}
+		if !fs.sourceExists(path) {
+			orphans = append(orphans, filepath.FromSlash(path))
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fs.dbError(err)
+	}
+	return orphans, nil
+}
+
+// sourceExists returns false if no source file with the stored path exists on disk. Since stored
+// paths may be normalized, the directories along the path are searched for names normalized the
+// same way unless the path exists as it is.
+func (fs *Filestore) sourceExists(path string) bool {
+	native := filepath.FromSlash(path)
+	if _, err := os.Lstat(native); !os.IsNotExist(err) || fs.pathForm() == "" {
+		return !os.IsNotExist(err)
+	}
+	vol := filepath.VolumeName(native)
+	dir, rest := ".", strings.TrimPrefix(path, filepath.ToSlash(vol))
+	if strings.HasPrefix(rest, "/") {
+		dir = vol + string(filepath.Separator)
+	}
+	return fs.findSource(dir, strings.FieldsFunc(rest, func(c rune) bool { return c == '/' }))
+}
+
+// findSource returns false if dir contains no file whose path relative to dir has the normalized
+// elements. It returns true if a directory cannot be read for other reasons than not existing.
+func (fs *Filestore) findSource(dir string, elems []string) bool {
+	if len(elems) == 0 {
+		return true
+	}
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return !os.IsNotExist(err)
+	}
+	for _, entry := range entries {
+		if fs.storedPath(entry.Name()) == elems[0] && fs.findSource(filepath.Join(dir, entry.Name()), elems[1:]) {
+			return true
+		}
+	}
+	return false
+}
+
+// MarkRenamed records in the history that the source file at path from has been renamed or
+// moved to path to. The versions remain stored under the old path, but both paths show the
+// rename in their timelines. ErrNotFound is returned if the filestore has no versions of from.
+func (fs *Filestore) MarkRenamed(from, to string) (err error) {
+	op := newOp("MarkRenamed", from)
+	defer op.done(&err)
+	if err := fs.ensureOpen(); err != nil {
+		return err
+	}
+	if !fs.Has(from) {
+		return ErrNotFound
+	}
+	return fs.addHistory(from, historyRenamed, fs.storedPath(to), 0, "", "")
+}
+
+// addHistory records an event of the given kind for path in the History table. The target
+// is the new path of a rename or the destination of a restore, version the ID of the
+// version concerned or 0. The reason and user of a restore may be given, empty otherwise.
+func (fs *Filestore) addHistory(path, kind, target string, version int64, reason, user string) error {
+	_, err := fs.db.Exec("insert into History(path, kind, target, version, date, reason, username) values(?, ?, ?, ?, ?, ?, ?);",
+		fs.storedPath(path), kind, target, version, dbNow(), reason, user)
+	if err != nil {
+		return fs.dbError(err)
+	}
+	return nil
+}
+
+// addMarker adds a version of the path of the restored version with its contents, whose
+// version string records the date of the restored version, within a transaction like a version
+// added by Tx.Add. The restored file is matched by the TagRules.
+func (fs *Filestore) addMarker(version FileVersion, restored string) error {
+	tx, err := fs.begin()
+	if err != nil {
+		return err
+	}
+	if err := tx.addMarker(version, restored); err != nil {
+		tx.rollback()
+		return err
+	}
+	return tx.commit()
+}
+
+// addMarker adds the marker of addMarker within the transaction.
+func (tx *Tx) addMarker(version FileVersion, restored string) error {
+	fs := tx.fs
+	var fileID int64
+	if err := txStmt(tx.tx, fs.queryIDStmt).QueryRow(version.Checksum).Scan(&fileID); err != nil {
+		return fs.dbError(err)
+	}
+	entry := versionEntry{path: version.Path, src: restored, info: version.Info, fileID: fileID,
+		version: "restored as of " + version.From.UTC().Format(legacyDBDateLayout)}
+	entry.mode, entry.mtime = fileAttributes(version.Mode, version.Modified)
+	var err error
+	if entry.xattrs, err = fs.xattrs(tx.tx, version.ID); err != nil {
+		return err
+	}
+	id, err := fs.insertVersion(tx.tx, entry)
+	if err != nil {
+		return err
+	}
+	tx.added = append(tx.added, id)
+	return nil
+}
+
+// currentUser returns the name of the user running the process, or an empty string if it
+// cannot be determined.
+func currentUser() string {
+	u, err := user.Current()
+	if err != nil {
+		return ""
+	}
+	return u.Username
+}
@@ -0,0 +1,88 @@
+package filestore
+
+import (
+	"crypto/ed25519"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestOrphanedMarkDeleted(t *testing.T) {
+	fs, src := newTestStore(t)
+	path := filepath.Join(src, "a.txt")
+	addFile(t, fs, path, "a", "", "1")
+	if orphaned, err := fs.Orphaned(); err != nil || len(orphaned) != 0 {
+		t.Fatalf("Orphaned = %v, %v, want none", orphaned, err)
+	}
+	if err := os.Remove(path); err != nil {
+		t.Fatal(err)
+	}
+	if orphaned, err := fs.Orphaned(); err != nil || len(orphaned) != 1 || orphaned[0] != path {
+		t.Fatalf("Orphaned = %v, %v, want %s", orphaned, err, path)
+	}
+	if deleted, err := fs.IsDeleted(path); deleted || err != nil {
+		t.Fatalf("IsDeleted = %v, %v before MarkDeleted", deleted, err)
+	}
+	if err := fs.MarkDeleted(path); err != nil {
+		t.Fatal(err)
+	}
+	if deleted, err := fs.IsDeleted(path); !deleted || err != nil {
+		t.Fatalf("IsDeleted = %v, %v after MarkDeleted", deleted, err)
+	}
+	if err := fs.MarkDeleted(filepath.Join(src, "b.txt")); !errors.Is(err, ErrNotFound) {
+		t.Fatalf("MarkDeleted of an unknown path = %v, want ErrNotFound", err)
+	}
+}
+
+func TestOrphanedFoldCase(t *testing.T) {
+	fs, src := openTestStore(t, NewFilestore(filepath.Join(t.TempDir(), "store"), FoldCase))
+	// the temporary directory has upper case letters, so the stored path does not exist as it is
+	path := filepath.Join(src, "README.md")
+	addFile(t, fs, path, "r", "", "1")
+	if orphaned, err := fs.Orphaned(); err != nil || len(orphaned) != 0 {
+		t.Fatalf("Orphaned = %v, %v, want none", orphaned, err)
+	}
+	if err := os.Remove(path); err != nil {
+		t.Fatal(err)
+	}
+	if orphaned, err := fs.Orphaned(); err != nil || len(orphaned) != 1 {
+		t.Fatalf("Orphaned = %v, %v, want 1 path", orphaned, err)
+	}
+}
+
+func TestRestoreMarker(t *testing.T) {
+	_, key, err := ed25519.GenerateKey(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	fs := NewFilestore(filepath.Join(t.TempDir(), "store"), 0)
+	fs.SigningKey = key
+	fs.TagRules = []TagRule{{Pattern: "*.txt", Tags: []string{"text"}}}
+	fs, src := openTestStore(t, fs)
+	path := filepath.Join(src, "a.txt")
+	first := addFile(t, fs, path, "first", "notes", "1")
+	addFile(t, fs, path, "second", "", "2")
+	var events []Event
+	fs.AddHook(func(e Event) { events = append(events, e) })
+	if err := fs.RestoreWith(first, t.TempDir(), RestoreOptions{Marker: true}); err != nil {
+		t.Fatal(err)
+	}
+	marker, err := fs.Get(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasPrefix(marker.Version, "restored as of ") || marker.Checksum != first.Checksum || marker.Info != "notes" {
+		t.Fatalf("latest version %+v, want the marker of %+v", marker, first)
+	}
+	if err := fs.VerifySignature(marker); err != nil {
+		t.Fatal(err)
+	}
+	if tags, err := fs.Tags(marker); err != nil || len(tags) != 1 || tags[0] != "text" {
+		t.Fatalf("Tags = %v, %v, want [text]", tags, err)
+	}
+	if len(events) != 1 || events[0].Kind != EventVersionAdded || events[0].Version.ID != marker.ID {
+		t.Fatalf("events %v, want the addition of the marker", events)
+	}
+}
@@ -0,0 +1,31 @@
+package filestore
+
+// Iterate calls fn for every version in the filestore in the order in which they were added,
+// streaming them from the database instead of loading them all into memory. Iteration stops
+// when fn returns false. The function fn must not modify the filestore, since the database
+// is read while it is called.
+func (fs *Filestore) Iterate(fn func(FileVersion) bool) (err error) {
+	op := newOp("Iterate", "")
+	defer op.done(&err)
+	if err := fs.ensureOpen(); err != nil {
+		return err
+	}
+	rows, err := fs.db.Query(selectVersions + " order by version_id;")
+	if err != nil {
+		return fs.dbError(err)
+	}
+	defer rows.Close()
+	for rows.Next() {
+		v, err := fs.scanVersion(rows)
+		if err != nil {
+			return err
+		}
+		if !fn(v) {
+			return nil
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return fs.dbError(err)
+	}
+	return nil
+}
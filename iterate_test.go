@@ -0,0 +1,34 @@
+package filestore
+
+import (
+	"fmt"
+	"path/filepath"
+	"testing"
+)
+
+func TestIterate(t *testing.T) {
+	fs, src := newTestStore(t)
+	for _, name := range []string{"c.txt", "a.txt", "b.txt"} {
+		addFile(t, fs, filepath.Join(src, name), name, "", "1")
+	}
+	var names []string
+	if err := fs.Iterate(func(v FileVersion) bool {
+		names = append(names, v.Name)
+		return true
+	}); err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{"c.txt", "a.txt", "b.txt"}; fmt.Sprint(names) != fmt.Sprint(want) {
+		t.Fatalf("Iterate visited %v, want %v in the order of adding", names, want)
+	}
+	names = nil
+	if err := fs.Iterate(func(v FileVersion) bool {
+		names = append(names, v.Name)
+		return len(names) < 2
+	}); err != nil {
+		t.Fatal(err)
+	}
+	if len(names) != 2 {
+		t.Fatalf("Iterate visited %v after fn returned false", names)
+	}
+}
@@ -0,0 +1,191 @@
+package filestore
+
+import (
+	"crypto/rand"
+	"database/sql"
+	"encoding/hex"
+	"errors"
+	"path/filepath"
+	"time"
+)
+
+var ErrNotExportable = errors.New("filestore contents are not stored unchanged in a single blob")
+var ErrUnknownLease = errors.New("filestore contains no such lease or it has expired")
+
+// Lease protects the blob of exported contents from being deleted until it expires, so that
+// external systems, such as a web server serving the blob, can refer to it by its path.
+type Lease struct {
+	ID       string    // the random token identifying the lease
+	Checksum string    // the checksum of the contents
+	Path     string    // the absolute path of the blob, which holds the contents unchanged
+	Expires  time.Time // the time at which the lease expires unless it is renewed
+}
+
+// Export leases the blob of the contents with the given checksum for the duration ttl and
+// returns the lease, whose Path may be used by external systems until it expires. As long as
+// the lease has not expired, the blob is not deleted, even if all versions referring to it are.
+// ErrUnknownChecksum is returned if there are no such contents and ErrNotExportable if they are
+// stored in chunks, compressed or encrypted. ErrNotLocal is returned if the filestore keeps its
+// contents in a BlobStore other than the root directory.
+func (fs *Filestore) Export(checksum string, ttl time.Duration) (_ Lease, err error) {
+	op := newOp("Export", "")
+	op.checksum = checksum
+	defer op.done(&err)
+	if err := fs.ensureOpen(); err != nil {
+		return Lease{}, err
+	}
+	if !fs.localBlobs() {
+		return Lease{}, ErrNotLocal
+	}
+	if err := fs.fetch(checksum); err != nil {
+		return Lease{}, err
+	}
+	// the contents are leased within the lock of the blobs, so that they are not deleted after
+	// they have been checked
+	tx, err := fs.begin()
+	if err != nil {
+		return Lease{}, err
+	}
+	c, err := fs.exportableCodec(tx.tx, checksum)
+	if err != nil {
+		tx.rollback()
+		return Lease{}, err
+	}
+	path, err := filepath.Abs(fs.blobFile("", checksum, c))
+	if err != nil {
+		tx.rollback()
+		return Lease{}, err
+	}
+	var token [16]byte
+	if _, err := rand.Read(token[:]); err != nil {
+		tx.rollback()
+		return Lease{}, err
+	}
+	lease := Lease{ID: hex.EncodeToString(token[:]), Checksum: checksum, Path: path, Expires: leaseExpiry(ttl)}
+	if _, err := tx.tx.Exec("insert into Leases(lease_id, checksum, expires) values(?, ?, ?);",
+		lease.ID, checksum, ToDBDate(lease.Expires)); err != nil {
+		tx.rollback()
+		return Lease{}, fs.dbError(err)
+	}
+	if err := tx.commit(); err != nil {
+		return Lease{}, err
+	}
+	return lease, nil
+}
+
+// exportableCodec returns the codec of the blob of the contents with the given checksum, as
+// queried with q. ErrUnknownChecksum is returned if there are no such contents and
+// ErrNotExportable if they are not stored unchanged in a single blob.
+func (fs *Filestore) exportableCodec(q querier, checksum string) (codec, error) {
+	var chunked bool
+	err := q.QueryRow("select chunked from Files where checksum=?;", checksum).Scan(&chunked)
+	if err == sql.ErrNoRows {
+		return codec{}, ErrUnknownChecksum
+	}
+	if err != nil {
+		return codec{}, fs.dbError(err)
+	}
+	if chunked {
+		return codec{}, ErrNotExportable
+	}
+	c, err := fs.blobCodec(q, checksum)
+	if err != nil {
+		return codec{}, err
+	}
+	if !c.plain() {
+		return codec{}, ErrNotExportable
+	}
+	return c, nil
+}
+
+// RenewLease extends a lease that has not expired yet to the duration ttl from now and returns
+// the renewed lease. ErrUnknownLease is returned if the lease has been released or has expired.
+func (fs *Filestore) RenewLease(lease Lease, ttl time.Duration) (_ Lease, err error) {
+	op := newOp("RenewLease", lease.Path)
+	op.checksum = lease.Checksum
+	defer op.done(&err)
+	if err := fs.ensureOpen(); err != nil {
+		return Lease{}, err
+	}
+	lease.Expires = leaseExpiry(ttl)
+	result, err := fs.db.Exec("update Leases set expires=? where lease_id=? and expires > ?;",
+		ToDBDate(lease.Expires), lease.ID, dbNow())
+	if err != nil {
+		return Lease{}, fs.dbError(err)
+	}
+	n, err := result.RowsAffected()
+	if err != nil {
+		return Lease{}, fs.dbError(err)
+	}
+	if n == 0 {
+		return Lease{}, ErrUnknownLease
+	}
+	return lease, nil
+}
+
+// ReleaseLease ends a lease before it expires. The blob is deleted if no version refers to it
+// and no other lease protects it. Releasing a lease that has expired already is not an error.
+func (fs *Filestore) ReleaseLease(lease Lease) (err error) {
+	op := newOp("ReleaseLease", lease.Path)
+	op.checksum = lease.Checksum
+	defer op.done(&err)
+	tx, err := fs.begin()
+	if err != nil {
+		return err
+	}
+	if _, err := tx.tx.Exec("delete from Leases where lease_id=?;", lease.ID); err != nil {
+		tx.rollback()
+		return fs.dbError(err)
+	}
+	if err := tx.collectGarbage(); err != nil {
+		tx.rollback()
+		return err
+	}
+	return tx.commit()
+}
+
+// leaseExpiry returns the time at which a lease for the duration ttl from now expires, in UTC
+// as stored in the database.
+func leaseExpiry(ttl time.Duration) time.Time {
+	return time.Now().UTC().Add(ttl)
+}
+
+// collectGarbage deletes the expired leases and the file entries of contents no longer used by
+// any version or lease within the transaction. Their blobs and chunks are removed on commit.
+func (tx *Tx) collectGarbage() error {
+	if tx.tx == nil {
+		return ErrTxDone
+	}
+	if _, err := tx.tx.Exec("delete from Leases where expires <= ?;", dbNow()); err != nil {
+		return tx.fs.dbError(err)
+	}
+	rows, err := tx.tx.Query("select file_id, checksum from Files where not exists (select 1 from Versions where file=file_id) and not exists (select 1 from Leases where Leases.checksum=Files.checksum);")
+	if err != nil {
+		return tx.fs.dbError(err)
+	}
+	type unusedFile struct {
+		id       int64
+		checksum string
+	}
+	var unused []unusedFile
+	for rows.Next() {
+		var f unusedFile
+		if err := rows.Scan(&f.id, &f.checksum); err != nil {
+			rows.Close()
+			return tx.fs.dbError(err)
+		}
+		unused = append(unused, f)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return tx.fs.dbError(err)
+	}
+	for _, f := range unused {
+		deleted, err := tx.fs.deleteFile(tx.tx, f.id, f.checksum)
+		if err != nil {
+			return err
+		}
+		tx.deleted = append(tx.deleted, deleted...)
+	}
+	return nil
+}
@@ -0,0 +1,63 @@
+package filestore
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestLeases(t *testing.T) {
+	fs, src := newTestStore(t)
+	path := filepath.Join(src, "a.txt")
+	v := addFile(t, fs, path, "served", "", "1")
+	lease, err := fs.Export(v.Checksum, time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := readFile(t, lease.Path); got != "served" {
+		t.Fatalf("leased blob contains %q, want %q", got, "served")
+	}
+	// the blob is kept while it is leased
+	if err := fs.DeleteVersion(v); err != nil {
+		t.Fatal(err)
+	}
+	if lease, err = fs.RenewLease(lease, 2*time.Hour); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := fs.Prune(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(lease.Path); err != nil {
+		t.Fatalf("leased blob of a deleted version: %v", err)
+	}
+	if err := fs.ReleaseLease(lease); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(lease.Path); !errors.Is(err, os.ErrNotExist) {
+		t.Fatalf("Stat of a released blob = %v, want os.ErrNotExist", err)
+	}
+	if _, err := fs.RenewLease(lease, time.Hour); !errors.Is(err, ErrUnknownLease) {
+		t.Fatalf("RenewLease of a released lease = %v, want ErrUnknownLease", err)
+	}
+	// expired leases do not protect blobs
+	v = addFile(t, fs, path, "again", "", "2")
+	if lease, err = fs.Export(v.Checksum, -time.Second); err != nil {
+		t.Fatal(err)
+	}
+	if err := fs.DeleteVersion(v); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(lease.Path); !errors.Is(err, os.ErrNotExist) {
+		t.Fatalf("Stat of a blob with an expired lease = %v, want os.ErrNotExist", err)
+	}
+	fs.Options |= Compress
+	v = addFile(t, fs, path, "compressed", "", "3")
+	if _, err := fs.Export(v.Checksum, time.Hour); !errors.Is(err, ErrNotExportable) {
+		t.Fatalf("Export of compressed contents = %v, want ErrNotExportable", err)
+	}
+	if _, err := fs.Export("0123", time.Hour); !errors.Is(err, ErrUnknownChecksum) {
+		t.Fatalf("Export of unknown contents = %v, want ErrUnknownChecksum", err)
+	}
+}
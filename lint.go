@@ -0,0 +1,94 @@
+package filestore
+
+import (
+	"fmt"
+	"path/filepath"
+	"sync/atomic"
+
+	"github.com/rasteric/flags"
+)
+
+// Thresholds of the findings of Lint.
+const (
+	lintCompressionBytes = 16 << 20 // compressed contents checked for their compression ratio at least
+	lintCompressionRatio = 0.95     // stored bytes per byte of contents above which compression is ineffective
+)
+
+// LintKind is the kind of a finding of Lint.
+type LintKind int
+
+const (
+	LintNoRetention            LintKind = iota + 1 // versions are added by a watcher but never pruned
+	LintIneffectiveCompression                     // compressed contents take almost as much space as uncompressed ones
+	LintStaleIndex                                 // the full text search index does not match the versions
+	LintNetworkFilesystem                          // the database is on a network file system
+)
+
+// String returns a lowercase name of the finding kind.
+func (k LintKind) String() string {
+	switch k {
+	case LintNoRetention:
+		return "no retention"
+	case LintIneffectiveCompression:
+		return "ineffective compression"
+	case LintStaleIndex:
+		return "stale index"
+	case LintNetworkFilesystem:
+		return "network file system"
+	}
+	return "unknown"
+}
+
+// LintFinding is a risky condition found by Lint.
+type LintFinding struct {
+	Kind    LintKind
+	Message string // what the risk is and how to avoid it
+}
+
+// Lint inspects the configuration and database of the filestore for conditions that are not
+// errors but risky or wasteful, such as a watcher adding versions without a retention policy,
+// compression of contents that do not compress, a stale full text search index and a database on
+// a network file system. It returns the findings with advice on what to do, which is empty if
+// nothing was found. The index is not checked if the filestore is read-only.
+func (fs *Filestore) Lint() (_ []LintFinding, err error) {
+	op := newOp("Lint", "")
+	defer op.done(&err)
+	if err := fs.ensureOpen(); err != nil {
+		return nil, err
+	}
+	findings := make([]LintFinding, 0)
+	if atomic.LoadInt32(&fs.watchers) > 0 && fs.Retention == (RetentionPolicy{}) && fs.Quota <= 0 {
+		findings = append(findings, LintFinding{Kind: LintNoRetention,
+			Message: "a watcher adds versions, but there is neither a retention policy nor a quota, so the filestore grows without bounds; set Retention and call Prune regularly, or set a Quota with the PruneOnQuota option"})
+	}
+	if fs.compression() != CompressionNone {
+		var size, stored int64
+		if err := fs.db.QueryRow("select coalesce(sum(size), 0), coalesce(sum(stored), 0) from (select size, stored from Files where codec!='none' and not chunked and origin is null union all select size, stored from Chunks where codec!='none');").Scan(&size, &stored); err != nil {
+			return nil, fs.dbError(err)
+		}
+		if size >= lintCompressionBytes && float64(stored) >= lintCompressionRatio*float64(size) {
+			findings = append(findings, LintFinding{Kind: LintIneffectiveCompression,
+				Message: fmt.Sprintf("compressed contents take %.0f%% of their size, so compression costs time without saving space, which is typical for media files; add their extensions to Incompressible or set Compression to %q",
+					100*float64(stored)/float64(size), CompressionNone)})
+		}
+	}
+	var fts bool
+	if err := fs.db.QueryRow("select exists (select 1 from sqlite_master where name='VersionsFts');").Scan(&fts); err != nil {
+		return nil, fs.dbError(err)
+	}
+	// the integrity check with rank 1 compares the index with the versions it indexes, but it is
+	// a write that read-only databases refuse
+	if fts && !flags.Has(fs.Options, ReadOnly) {
+		if _, err := fs.db.Exec("insert into VersionsFts(VersionsFts, rank) values('integrity-check', 1);"); err != nil {
+			findings = append(findings, LintFinding{Kind: LintStaleIndex,
+				Message: "the full text search index does not match the versions, so Search misses versions or finds deleted ones; call ReindexFTS or Repair to rebuild it"})
+		}
+	}
+	if fs.memory == "" {
+		if kind := networkFilesystem(filepath.Dir(fs.dbPath())); kind != "" {
+			msg := fmt.Sprintf("the database is on a %s file system, whose locking SQLite cannot rely on and whose processes on different machines cannot share the memory of the write-ahead log, so that concurrent access may corrupt it; keep the root directory on a local disk and back it up to the network with Backup", kind)
+			findings = append(findings, LintFinding{Kind: LintNetworkFilesystem, Message: msg})
+		}
+	}
+	return findings, nil
+}
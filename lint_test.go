@@ -0,0 +1,49 @@
+package filestore
+
+import (
+	"math/rand"
+	"path/filepath"
+	"testing"
+)
+
+// lintKinds returns the kinds of the findings.
+func lintKinds(findings []LintFinding) map[LintKind]bool {
+	kinds := make(map[LintKind]bool)
+	for _, f := range findings {
+		kinds[f.Kind] = true
+	}
+	return kinds
+}
+
+func TestLint(t *testing.T) {
+	fs, src := newTestStore(t)
+	if findings, err := fs.Lint(); err != nil || len(findings) != 0 {
+		t.Fatalf("Lint = %v, %v, want no findings", findings, err)
+	}
+	// random data does not compress
+	fs.Compression = CompressionSnappy
+	data := make([]byte, lintCompressionBytes+1<<20)
+	rand.New(rand.NewSource(1)).Read(data)
+	addFile(t, fs, filepath.Join(src, "random.dat"), string(data), "", "")
+	w, err := fs.Watch(src, WatchOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	findings, err := fs.Lint()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if kinds := lintKinds(findings); !kinds[LintNoRetention] || !kinds[LintIneffectiveCompression] || kinds[LintStaleIndex] {
+		t.Fatalf("Lint = %v, want no retention and ineffective compression", findings)
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	fs.Retention.MaxVersions = 3
+	if _, err := fs.Repair(RepairOptions{}); err != nil {
+		t.Fatal(err)
+	}
+	if findings, err = fs.Lint(); err != nil || len(findings) != 1 || findings[0].Kind != LintIneffectiveCompression {
+		t.Fatalf("Lint = %v, %v, want only ineffective compression", findings, err)
+	}
+}
@@ -0,0 +1,86 @@
+package filestore
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+
+	"github.com/rasteric/flags"
+)
+
+// blobLockName is the name of the lock file in the root directory, which processes lock while
+// they write or remove blobs and chunks.
+const blobLockName = "blobs.lock"
+
+// blobLock is the lock of the blobs of a root directory within this process, which is held by
+// one goroutine at a time. The holder also locks the lock file, which other processes wait for.
+type blobLock struct {
+	mutex sync.Mutex
+	file  *os.File // the locked lock file, nil for filestores in memory
+}
+
+// blobLocks are the locks of the blobs of root directories by the absolute paths of their lock
+// files, or by the names of the databases of filestores in memory.
+var blobLocks = struct {
+	sync.Mutex
+	locks map[string]*blobLock
+}{locks: make(map[string]*blobLock)}
+
+// lockBlobs waits until no other goroutine or process writes or removes blobs and chunks of the
+// filestore and keeps them from doing so until the returned function is called. Otherwise, one
+// could remove a blob that another has just written for new contents, or add a version referring
+// to contents that another is deleting, because the contents were unused or stored when it
+// looked. Blobs are written and removed within the lock together with the database changes
+// referring to them. The lock is not reentrant, so functions called while it is held must not
+// acquire it again. It does nothing if the filestore is read-only.
+func (fs *Filestore) lockBlobs() (func(), error) {
+	if flags.Has(fs.Options, ReadOnly) {
+		return func() {}, nil
+	}
+	key := fs.memory
+	if key == "" {
+		path, err := filepath.Abs(fs.Root() + blobLockName)
+		if err != nil {
+			return nil, err
+		}
+		key = path
+	}
+	blobLocks.Lock()
+	l, ok := blobLocks.locks[key]
+	if !ok {
+		l = &blobLock{}
+		blobLocks.locks[key] = l
+	}
+	blobLocks.Unlock()
+	l.mutex.Lock()
+	if fs.memory == "" {
+		mode := fs.fileMode()
+		if mode == 0 {
+			mode = 0666
+		}
+		// read access suffices for locking, which other users of shared filestores may only have
+		f, err := os.OpenFile(key, os.O_RDONLY|os.O_CREATE, mode)
+		if err != nil {
+			l.mutex.Unlock()
+			return nil, fmt.Errorf("filestore could not open lock file: %w", err)
+		}
+		if err := lockFile(f); err != nil {
+			f.Close()
+			l.mutex.Unlock()
+			return nil, fmt.Errorf("filestore could not lock %s: %w", key, err)
+		}
+		l.file = f
+	}
+	var once sync.Once
+	return func() {
+		once.Do(func() {
+			if l.file != nil {
+				unlockFile(l.file)
+				l.file.Close()
+				l.file = nil
+			}
+			l.mutex.Unlock()
+		})
+	}, nil
+}
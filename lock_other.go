@@ -0,0 +1,16 @@
+//go:build !(linux || darwin || freebsd || openbsd || netbsd || dragonfly || windows)
+
+package filestore
+
+import "os"
+
+// lockFile does nothing, since files cannot be locked on this platform, so that processes
+// sharing a filestore are not kept from removing each other's new blobs.
+func lockFile(f *os.File) error {
+	return nil
+}
+
+// unlockFile does nothing.
+func unlockFile(f *os.File) error {
+	return nil
+}
@@ -0,0 +1,56 @@
+package filestore
+
+import (
+	"path/filepath"
+	"sync"
+	"testing"
+)
+
+func TestBlobLockAddAndDelete(t *testing.T) {
+	fs, src := newTestStore(t)
+	a, b := filepath.Join(src, "a.txt"), filepath.Join(src, "b.txt")
+	writeFile(t, a, "shared")
+	writeFile(t, b, "shared")
+	// one goroutine adds and deletes contents that another adds for another file at the same time
+	var wg sync.WaitGroup
+	errs := make(chan error, 2)
+	wg.Add(2)
+	go func() {
+		defer wg.Done()
+		for i := 0; i < 300; i++ {
+			if err := fs.Add(a, "", ""); err != nil {
+				errs <- err
+				return
+			}
+			v, err := fs.Get(a)
+			if err != nil {
+				errs <- err
+				return
+			}
+			if err := fs.DeleteVersion(v); err != nil {
+				errs <- err
+				return
+			}
+		}
+	}()
+	go func() {
+		defer wg.Done()
+		for i := 0; i < 300; i++ {
+			if err := fs.Add(b, "", ""); err != nil {
+				errs <- err
+				return
+			}
+		}
+	}()
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		t.Fatal(err)
+	}
+	if versions, err := fs.Versions(b, -1); err != nil || len(versions) != 300 {
+		t.Fatalf("Versions = %d versions, %v, want 300", len(versions), err)
+	}
+	if report, err := fs.Verify(VerifyOptions{}); err != nil || !report.OK() {
+		t.Fatalf("Verify = %v, %v, want the contents of all versions", report.Problems, err)
+	}
+}
@@ -0,0 +1,23 @@
+//go:build linux || darwin || freebsd || openbsd || netbsd || dragonfly
+
+package filestore
+
+import (
+	"os"
+	"syscall"
+)
+
+// lockFile waits for an exclusive advisory lock of f.
+func lockFile(f *os.File) error {
+	for {
+		err := syscall.Flock(int(f.Fd()), syscall.LOCK_EX)
+		if err != syscall.EINTR {
+			return err
+		}
+	}
+}
+
+// unlockFile releases the lock of f.
+func unlockFile(f *os.File) error {
+	return syscall.Flock(int(f.Fd()), syscall.LOCK_UN)
+}
@@ -0,0 +1,58 @@
+//go:build linux || darwin || freebsd || openbsd || netbsd || dragonfly
+
+package filestore
+
+import (
+	"os"
+	"path/filepath"
+	"syscall"
+	"testing"
+	"time"
+)
+
+func TestBlobLock(t *testing.T) {
+	fs, src := newTestStore(t)
+	tx, err := fs.Begin()
+	if err != nil {
+		t.Fatal(err)
+	}
+	// a lock of another open file of the lock file stands for another process
+	f, err := os.Open(filepath.Join(fs.Root(), blobLockName))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	if err := syscall.Flock(int(f.Fd()), syscall.LOCK_EX|syscall.LOCK_NB); err == nil {
+		t.Fatal("blob lock not held by a transaction")
+	}
+	// adding within the transaction uses its lock
+	path := filepath.Join(src, "a.txt")
+	writeFile(t, path, "a")
+	if err := tx.Add(path, "", ""); err != nil {
+		t.Fatal(err)
+	}
+	if err := tx.Commit(); err != nil {
+		t.Fatal(err)
+	}
+	if err := syscall.Flock(int(f.Fd()), syscall.LOCK_EX|syscall.LOCK_NB); err != nil {
+		t.Fatalf("blob lock held after Commit: %v", err)
+	}
+	done := make(chan error)
+	go func() { done <- fs.Add(path, "", "") }()
+	select {
+	case err := <-done:
+		t.Fatalf("Add = %v while another process held the blob lock, want it to wait", err)
+	case <-time.After(100 * time.Millisecond):
+	}
+	if err := unlockFile(f); err != nil {
+		t.Fatal(err)
+	}
+	if err := <-done; err != nil {
+		t.Fatal(err)
+	}
+	// read-only filestores see the changes of others
+	ro, _ := openTestStore(t, NewFilestore(fs.Dir, ReadOnly))
+	if versions, err := ro.Versions(path, -1); err != nil || len(versions) != 2 {
+		t.Fatalf("Versions = %v, %v, want 2 versions", versions, err)
+	}
+}
@@ -0,0 +1,14 @@
+//go:build !windows
+
+package filestore
+
+// longPath returns path unchanged, since the length of paths is only limited by the file system
+// on this platform.
+func longPath(path string) string {
+	return path
+}
+
+// shortPath returns path unchanged.
+func shortPath(path string) string {
+	return path
+}
@@ -0,0 +1,29 @@
+package filestore
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestLongPaths(t *testing.T) {
+	fs, src := newTestStore(t)
+	// the blob path adds the root and the checksum to the name, exceeding MAX_PATH on Windows
+	dir := filepath.Join(src, strings.Repeat("d", 100), strings.Repeat("e", 100))
+	path := filepath.Join(dir, strings.Repeat("n", 120)+".txt")
+	v := addFile(t, fs, path, "long", "", "1")
+	dst := filepath.Join(t.TempDir(), strings.Repeat("r", 150))
+	if err := os.MkdirAll(dst, 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := fs.Restore(v, dst); err != nil {
+		t.Fatal(err)
+	}
+	if got := readFile(t, filepath.Join(dst, v.Name)); got != "long" {
+		t.Fatalf("restored %q, want %q", got, "long")
+	}
+	if report, err := fs.Verify(VerifyOptions{}); err != nil || !report.OK() {
+		t.Fatalf("Verify = %v, %v", report.Problems, err)
+	}
+}
@@ -0,0 +1,38 @@
+package filestore
+
+import (
+	"path/filepath"
+	"strings"
+)
+
+// maxPath is the length from which paths need the extended-length prefix on Windows, which is
+// MAX_PATH less the room for an 8.3 file name that paths of directories must leave.
+const maxPath = 248
+
+// longPath returns path in the extended-length form \\?\C:\dir\file, or \\?\UNC\server\share\file
+// for paths of shares, if it is too long for the Windows API otherwise. The names of blobs are
+// the names of the files first added with their contents below a directory named by their
+// checksum, so their paths easily exceed the limit. Shorter paths are returned unchanged.
+func longPath(path string) string {
+	if len(path) < maxPath || strings.HasPrefix(path, `\\?\`) {
+		return path
+	}
+	// extended-length paths are passed to the file system unchanged, so they must be absolute
+	// and clean, with backslashes as separators
+	abs, err := filepath.Abs(path)
+	if err != nil {
+		return path
+	}
+	if strings.HasPrefix(abs, `\\`) {
+		return `\\?\UNC\` + abs[2:]
+	}
+	return `\\?\` + abs
+}
+
+// shortPath returns path without the extended-length prefix added by longPath.
+func shortPath(path string) string {
+	if strings.HasPrefix(path, `\\?\UNC\`) {
+		return `\\` + path[len(`\\?\UNC\`):]
+	}
+	return strings.TrimPrefix(path, `\\?\`)
+}
@@ -0,0 +1,24 @@
+package filestore
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestLongPathForms(t *testing.T) {
+	long := strings.Repeat("d", maxPath)
+	for _, c := range []struct{ path, want string }{
+		{`C:\dir\file`, `C:\dir\file`},
+		{`C:\` + long, `\\?\C:\` + long},
+		{`\\server\share\` + long, `\\?\UNC\server\share\` + long},
+		{`\\?\C:\` + long, `\\?\C:\` + long},
+	} {
+		got := longPath(c.path)
+		if got != c.want {
+			t.Fatalf("longPath(%q) = %q, want %q", c.path, got, c.want)
+		}
+		if short := shortPath(got); short != c.path && !strings.HasPrefix(c.path, `\\?\`) {
+			t.Fatalf("shortPath(%q) = %q, want %q", got, short, c.path)
+		}
+	}
+}
@@ -0,0 +1,60 @@
+package filestore
+
+import (
+	"errors"
+	"strings"
+)
+
+var ErrInvalidChecksumPrefix = errors.New("filestore checksum prefix must consist of at least 4 hexadecimal digits")
+var ErrUnknownChecksum = errors.New("filestore contains no contents with the given checksum prefix")
+var ErrAmbiguousChecksum = errors.New("filestore checksum prefix matches the contents of more than one file")
+
+// minChecksumPrefix is the minimum length of a checksum prefix accepted by FindByChecksumPrefix.
+const minChecksumPrefix = 4
+
+// FindByChecksumPrefix returns all versions whose contents have the checksum starting with the
+// given hexadecimal prefix, in the order they were added. Like short commit hashes in git, the
+// first 8 to 12 digits usually suffice to identify stored contents. ErrUnknownChecksum is
+// returned if no checksum starts with prefix and ErrAmbiguousChecksum if more than one does.
+func (fs *Filestore) FindByChecksumPrefix(prefix string) (_ []FileVersion, err error) {
+	op := newOp("FindByChecksumPrefix", "")
+	op.checksum = prefix
+	defer op.done(&err)
+	if err := fs.ensureOpen(); err != nil {
+		return nil, err
+	}
+	prefix = strings.ToLower(prefix)
+	if len(prefix) < minChecksumPrefix || strings.Trim(prefix, "0123456789abcdef") != "" {
+		return nil, ErrInvalidChecksumPrefix
+	}
+	// hexadecimal checksums starting with prefix sort before prefix followed by 'g'
+	rows, err := fs.db.Query("select checksum from Files where checksum >= ? and checksum < ? limit 2;", prefix, prefix+"g")
+	if err != nil {
+		return nil, fs.dbError(err)
+	}
+	checksums := make([]string, 0, 2)
+	for rows.Next() {
+		var checksum string
+		if err := rows.Scan(&checksum); err != nil {
+			rows.Close()
+			return nil, fs.dbError(err)
+		}
+		checksums = append(checksums, checksum)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, fs.dbError(err)
+	}
+	switch len(checksums) {
+	case 0:
+		return nil, ErrUnknownChecksum
+	case 1:
+	default:
+		return nil, ErrAmbiguousChecksum
+	}
+	rows, err = fs.db.Query(selectVersions+" where checksum=? order by Versions.date, version_id;", checksums[0])
+	if err != nil {
+		return nil, fs.dbError(err)
+	}
+	return fs.getVersions(rows)
+}
@@ -0,0 +1,49 @@
+package filestore
+
+import (
+	"errors"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestFindByChecksumPrefix(t *testing.T) {
+	fs, src := newTestStore(t)
+	a, b := filepath.Join(src, "a.txt"), filepath.Join(src, "b.txt")
+	addFile(t, fs, a, "same", "", "1")
+	addFile(t, fs, b, "same", "", "1")
+	sum, err := fs.Checksum(a)
+	if err != nil {
+		t.Fatal(err)
+	}
+	versions, err := fs.FindByChecksumPrefix(strings.ToUpper(sum[:10]))
+	if err != nil || len(versions) != 2 || versions[0].Path != a || versions[1].Path != b {
+		t.Fatalf("FindByChecksumPrefix = %v, %v, want both versions in the order added", versions, err)
+	}
+	for _, prefix := range []string{"abc", "xyz1"} {
+		if _, err := fs.FindByChecksumPrefix(prefix); !errors.Is(err, ErrInvalidChecksumPrefix) {
+			t.Fatalf("FindByChecksumPrefix(%q) = %v, want ErrInvalidChecksumPrefix", prefix, err)
+		}
+	}
+	other := "0000"
+	if sum[0] == '0' {
+		other = "ffff"
+	}
+	if _, err := fs.FindByChecksumPrefix(other); !errors.Is(err, ErrUnknownChecksum) {
+		t.Fatalf("FindByChecksumPrefix of an unknown prefix = %v, want ErrUnknownChecksum", err)
+	}
+	// pretend that other contents have a checksum with the same prefix
+	next := "0"
+	if sum[10] == '0' {
+		next = "1"
+	}
+	if _, err := fs.db.Exec("insert into Files(checksum, size, stored) values(?, 0, 0);", sum[:10]+next); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := fs.FindByChecksumPrefix(sum[:10]); !errors.Is(err, ErrAmbiguousChecksum) {
+		t.Fatalf("FindByChecksumPrefix of a shared prefix = %v, want ErrAmbiguousChecksum", err)
+	}
+	if versions, err := fs.FindByChecksumPrefix(sum[:11]); err != nil || len(versions) != 2 {
+		t.Fatalf("FindByChecksumPrefix of a longer prefix = %v, %v, want both versions", versions, err)
+	}
+}
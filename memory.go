@@ -0,0 +1,100 @@
+package filestore
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+)
+
+// memoryDir is the Dir of filestores created with NewMemoryFilestore.
+const memoryDir = ":memory:"
+
+// memoryDBs is the number of in-memory databases created, which names them uniquely.
+var memoryDBs int64
+
+// NewMemoryFilestore returns a filestore that keeps its database and contents in memory, so that
+// tests of code using filestores run fast and leave nothing on disk. Its Dir is ":memory:" and its
+// Blobs are a MemoryBlobStore. Like other filestores, it must be opened before use, and all of its
+// versions are lost when it is closed. Operations that need temporary files, such as importing
+// contents, create them in the default directory for temporary files and remove them right away.
+func NewMemoryFilestore() *Filestore {
+	n := atomic.AddInt64(&memoryDBs, 1)
+	return &Filestore{Dir: memoryDir, Blobs: &MemoryBlobStore{}, memory: fmt.Sprintf("/filestore-%d", n)}
+}
+
+// tempDir returns the directory in which temporary files and directories are created, which is the
+// root directory unless the filestore is in memory.
+func (fs *Filestore) tempDir() string {
+	if fs.memory != "" {
+		return ""
+	}
+	return fs.Root()
+}
+
+// MemoryBlobStore is a BlobStore keeping data in memory, which is used by NewMemoryFilestore. The
+// zero MemoryBlobStore is empty and ready to use.
+type MemoryBlobStore struct {
+	mutex sync.Mutex
+	data  map[string][]byte
+}
+
+// Put stores the data read from r under key.
+func (s *MemoryBlobStore) Put(key string, r io.Reader) error {
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return err
+	}
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	if s.data == nil {
+		s.data = make(map[string][]byte)
+	}
+	s.data[key] = data
+	return nil
+}
+
+// Get returns a reader of the data stored under key.
+func (s *MemoryBlobStore) Get(key string) (io.ReadCloser, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	data, ok := s.data[key]
+	if !ok {
+		return nil, &os.PathError{Op: "get", Path: key, Err: os.ErrNotExist}
+	}
+	return io.NopCloser(bytes.NewReader(data)), nil
+}
+
+// Delete deletes the data stored under key.
+func (s *MemoryBlobStore) Delete(key string) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	delete(s.data, key)
+	return nil
+}
+
+// Exists returns true if data is stored under key.
+func (s *MemoryBlobStore) Exists(key string) (bool, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	_, ok := s.data[key]
+	return ok, nil
+}
+
+// List returns the keys starting with prefix in lexical order.
+func (s *MemoryBlobStore) List(prefix string) ([]string, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	var keys []string
+	for key := range s.data {
+		if strings.HasPrefix(key, prefix) {
+			keys = append(keys, key)
+		}
+	}
+	sort.Strings(keys)
+	return keys, nil
+}
@@ -0,0 +1,107 @@
+package filestore
+
+import (
+	"bytes"
+	"database/sql"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+)
+
+func TestMemoryFilestore(t *testing.T) {
+	wd, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	before, err := os.ReadDir(wd)
+	if err != nil {
+		t.Fatal(err)
+	}
+	fs := NewMemoryFilestore()
+	fs.Options |= Chunked
+	fs, _ = openTestStore(t, fs)
+	other, _ := openTestStore(t, NewMemoryFilestore())
+	src := t.TempDir()
+	// concurrent changes share the in-memory database
+	var wg sync.WaitGroup
+	errs := make(chan error, 48)
+	for i := 0; i < 8; i++ {
+		path := filepath.Join(src, fmt.Sprintf("%d.txt", i))
+		writeFile(t, path, strings.Repeat(fmt.Sprint(i), 100000+i))
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 3; j++ {
+				if err := fs.Add(path, "info", "1"); err != nil {
+					errs <- err
+				}
+				if _, err := fs.Versions(path, -1); err != nil {
+					errs <- err
+				}
+			}
+		}()
+	}
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		t.Fatal(err)
+	}
+	path := filepath.Join(src, "2.txt")
+	v, err := fs.Get(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var buf bytes.Buffer
+	if err := fs.RestoreTo(v, &buf); err != nil || buf.Len() != 100002 {
+		t.Fatalf("RestoreTo = %d bytes, %v, want 100002 bytes", buf.Len(), err)
+	}
+	r, err := fs.OpenSeekable(v)
+	if err != nil {
+		t.Fatal(err)
+	}
+	r.Close()
+	if results, err := fs.SimpleSearch([]string{"info"}, 100); err != nil || len(results) == 0 {
+		t.Fatalf("SimpleSearch = %v, %v, want results", results, err)
+	}
+	if report, err := fs.Verify(VerifyOptions{}); err != nil || !report.OK() {
+		t.Fatalf("Verify = %v, %v", report.Problems, err)
+	}
+	if _, err := fs.Repair(RepairOptions{}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := fs.Drill(filepath.Join(t.TempDir(), "drill")); err != nil {
+		t.Fatal(err)
+	}
+	// memory filestores are separate
+	if _, err := other.Get(path); !errors.Is(err, sql.ErrNoRows) {
+		t.Fatalf("Get from another memory filestore = %v, want sql.ErrNoRows", err)
+	}
+	var archive bytes.Buffer
+	if err := fs.ExportTar(&archive, ExportOptions{}); err != nil {
+		t.Fatal(err)
+	}
+	if err := other.ImportTar(&archive, ImportOptions{}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := other.Get(path); err != nil {
+		t.Fatal(err)
+	}
+	if err := fs.Close(); err != nil {
+		t.Fatal(err)
+	}
+	// nothing is left on disk
+	after, err := os.ReadDir(wd)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(after) != len(before) {
+		t.Fatalf("%d entries in the working directory, want %d", len(after), len(before))
+	}
+	if _, err := os.Stat(memoryDir); !errors.Is(err, os.ErrNotExist) {
+		t.Fatalf("Stat of %s = %v, want os.ErrNotExist", memoryDir, err)
+	}
+}
@@ -0,0 +1,263 @@
+package filestore
+
+import (
+	"bufio"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"io"
+	"time"
+)
+
+// Types of the records written by ExportMetadata.
+const (
+	metadataChunk   = "chunk"
+	metadataFile    = "file"
+	metadataVersion = "version"
+)
+
+// chunkRecord describes a chunk in the metadata written by ExportMetadata.
+type chunkRecord struct {
+	Type      string `json:"type"`
+	Checksum  string `json:"checksum"`
+	Codec     string `json:"codec"`
+	SealedKey []byte `json:"sealed_key,omitempty"`
+	Size      int64  `json:"size"`
+	Stored    int64  `json:"stored"`
+}
+
+// fileRecord describes stored contents in the metadata written by ExportMetadata.
+type fileRecord struct {
+	Type      string   `json:"type"`
+	Checksum  string   `json:"checksum"`
+	Hash      string   `json:"hash"`
+	Codec     string   `json:"codec"`
+	SealedKey []byte   `json:"sealed_key,omitempty"`
+	Size      int64    `json:"size"`
+	Stored    int64    `json:"stored"`
+	Chunks    []string `json:"chunks,omitempty"` // the checksums of the chunks in order if the contents are chunked
+	Origin    string   `json:"origin,omitempty"` // the filestore the contents were pulled from if they have not been fetched
+}
+
+// versionRecord describes a version in the metadata written by ExportMetadata.
+type versionRecord struct {
+	Type string `json:"type"`
+	manifestVersion
+}
+
+// ExportMetadata writes the database of the filestore without the blobs and chunks to w as JSON
+// lines, one JSON object per line. Each object has a "type", which is "chunk" for chunks,
+// "file" for stored contents, which refer to their chunks by checksum, and "version" for
+// versions, which refer to their contents by checksum and come last. The metadata can be
+// inspected and transformed with line-oriented tools and restored with ImportMetadata.
+func (fs *Filestore) ExportMetadata(w io.Writer) (err error) {
+	op := newOp("ExportMetadata", fs.Dir)
+	defer op.done(&err)
+	if err := fs.ensureOpen(); err != nil {
+		return err
+	}
+	// read within a transaction to export a consistent state
+	tx, err := fs.db.Begin()
+	if err != nil {
+		return fs.dbError(err)
+	}
+	defer tx.Rollback()
+	return fs.exportMetadata(tx, w, time.Time{})
+}
+
+// exportMetadata writes the metadata of the versions added after the given time, or of all
+// versions if it is zero, to w like ExportMetadata. Only the contents and chunks the versions use
+// are written then.
+func (fs *Filestore) exportMetadata(tx *sql.Tx, w io.Writer, after time.Time) error {
+	fileCond, args := "1", []interface{}(nil)
+	if !after.IsZero() {
+		fileCond, args = "file_id in (select file from Versions where date > ?)", []interface{}{ToDBDate(after.UTC())}
+	}
+	bw := bufio.NewWriter(w)
+	enc := json.NewEncoder(bw)
+	rows, err := tx.Query("select checksum, codec, sealed_key, size, stored from Chunks where chunk_id in (select chunk from FileChunks inner join Files on FileChunks.file=Files.file_id where "+
+		fileCond+") order by chunk_id;", args...)
+	if err != nil {
+		return fs.dbError(err)
+	}
+	for rows.Next() {
+		c := chunkRecord{Type: metadataChunk}
+		if err := rows.Scan(&c.Checksum, &c.Codec, &c.SealedKey, &c.Size, &c.Stored); err != nil {
+			rows.Close()
+			return fs.dbError(err)
+		}
+		if err := enc.Encode(c); err != nil {
+			rows.Close()
+			return err
+		}
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return fs.dbError(err)
+	}
+	if err := fs.exportFileRecords(tx, enc, fileCond, args); err != nil {
+		return err
+	}
+	manifest, err := fs.exportManifest(tx, ExportOptions{Filter: Filter{After: after}})
+	if err != nil {
+		return err
+	}
+	for _, v := range manifest.Versions {
+		if err := enc.Encode(versionRecord{Type: metadataVersion, manifestVersion: v}); err != nil {
+			return err
+		}
+	}
+	return bw.Flush()
+}
+
+// exportFileRecords writes a record of each file entry matching the condition cond with the
+// arguments args to enc.
+func (fs *Filestore) exportFileRecords(tx *sql.Tx, enc *json.Encoder, cond string, args []interface{}) error {
+	rows, err := tx.Query("select checksum, hash, codec, sealed_key, size, stored, chunked, coalesce(origin, '') from Files where "+
+		cond+" order by file_id;", args...)
+	if err != nil {
+		return fs.dbError(err)
+	}
+	var files []fileRecord
+	var chunked []bool
+	for rows.Next() {
+		f := fileRecord{Type: metadataFile}
+		var c bool
+		if err := rows.Scan(&f.Checksum, &f.Hash, &f.Codec, &f.SealedKey, &f.Size, &f.Stored, &c, &f.Origin); err != nil {
+			rows.Close()
+			return fs.dbError(err)
+		}
+		files = append(files, f)
+		chunked = append(chunked, c)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return fs.dbError(err)
+	}
+	for i, f := range files {
+		if chunked[i] {
+			refs, err := fs.chunkRefs(tx, f.Checksum, false)
+			if err != nil {
+				return err
+			}
+			f.Chunks = make([]string, len(refs))
+			for j, ref := range refs {
+				f.Chunks[j] = ref.checksum
+			}
+		}
+		if err := enc.Encode(f); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// ImportMetadata reads metadata written by ExportMetadata from r and adds the chunks, contents and
+// versions it describes to the database of the filestore, except those it contains already. The
+// blobs and chunks are not imported; they must be copied into the directory of the filestore
+// separately, for instance to rebuild a filestore whose database was lost, after which Verify
+// can check them. The metadata is imported within a single transaction, so nothing is imported
+// if it fails.
+func (fs *Filestore) ImportMetadata(r io.Reader) (err error) {
+	op := newOp("ImportMetadata", fs.Dir)
+	defer op.done(&err)
+	tx, err := fs.begin()
+	if err != nil {
+		return err
+	}
+	if err := fs.importMetadata(tx, r); err != nil {
+		tx.rollback()
+		return err
+	}
+	return tx.commit()
+}
+
+func (fs *Filestore) importMetadata(tx *Tx, r io.Reader) error {
+	dec := json.NewDecoder(r)
+	for line := 1; ; line++ {
+		var data json.RawMessage
+		if err := dec.Decode(&data); err == io.EOF {
+			return nil
+		} else if err != nil {
+			return fmt.Errorf("filestore could not read metadata record %d: %w", line, err)
+		}
+		var record struct {
+			Type string `json:"type"`
+		}
+		if err := json.Unmarshal(data, &record); err != nil {
+			return fmt.Errorf("filestore could not read metadata record %d: %w", line, err)
+		}
+		var err error
+		switch record.Type {
+		case metadataChunk:
+			var c chunkRecord
+			if err = json.Unmarshal(data, &c); err == nil {
+				err = fs.importChunkRecord(tx, c)
+			}
+		case metadataFile:
+			var f fileRecord
+			if err = json.Unmarshal(data, &f); err == nil {
+				err = fs.importFileRecord(tx, f)
+			}
+		case metadataVersion:
+			var v versionRecord
+			if err = json.Unmarshal(data, &v); err == nil {
+				err = fs.importVersion(tx, v.manifestVersion)
+			}
+		default:
+			err = fmt.Errorf("unknown type %q: %w", record.Type, ErrInvalidArchive)
+		}
+		if err != nil {
+			return fmt.Errorf("filestore could not import metadata record %d: %w", line, err)
+		}
+	}
+}
+
+// importChunkRecord adds the chunk of a record unless there is a chunk with its checksum.
+func (fs *Filestore) importChunkRecord(tx *Tx, c chunkRecord) error {
+	if !isHex(c.Checksum) {
+		return ErrInvalidArchive
+	}
+	if _, err := tx.tx.Exec("insert or ignore into Chunks(checksum, codec, sealed_key, size, stored) values(?, ?, ?, ?, ?);",
+		c.Checksum, c.Codec, c.SealedKey, c.Size, c.Stored); err != nil {
+		return fs.dbError(err)
+	}
+	return nil
+}
+
+// importFileRecord adds the file entry of a record unless there is one with its checksum. The
+// chunks of the record must have been imported before.
+func (fs *Filestore) importFileRecord(tx *Tx, f fileRecord) error {
+	if !isHex(f.Checksum) {
+		return ErrInvalidArchive
+	}
+	var exists bool
+	if err := tx.tx.QueryRow("select exists (select 1 from Files where checksum=?);", f.Checksum).Scan(&exists); err != nil {
+		return fs.dbError(err)
+	}
+	if exists {
+		return nil
+	}
+	var origin interface{}
+	if f.Origin != "" {
+		origin = f.Origin
+	}
+	result, err := tx.tx.Exec("insert into Files(checksum, hash, codec, sealed_key, size, stored, chunked, origin) values(?, ?, ?, ?, ?, ?, ?, ?);",
+		f.Checksum, f.Hash, f.Codec, f.SealedKey, f.Size, f.Stored, f.Chunks != nil, origin)
+	if err != nil {
+		return fs.dbError(err)
+	}
+	fileID, err := result.LastInsertId()
+	if err != nil {
+		return fs.dbError(err)
+	}
+	ids := make([]int64, len(f.Chunks))
+	for i, checksum := range f.Chunks {
+		if err := tx.tx.QueryRow("select chunk_id from Chunks where checksum=?;", checksum).Scan(&ids[i]); err == sql.ErrNoRows {
+			return fmt.Errorf("filestore metadata lacks chunk %s: %w", checksum, ErrInvalidArchive)
+		} else if err != nil {
+			return fs.dbError(err)
+		}
+	}
+	return fs.insertFileChunks(tx.tx, fileID, ids)
+}
@@ -0,0 +1,69 @@
+package filestore
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestMetadataRoundTrip(t *testing.T) {
+	fs, src := openTestStore(t, NewFilestore(filepath.Join(t.TempDir(), "store"), Compress|Chunked))
+	a, b := filepath.Join(src, "a.txt"), filepath.Join(src, "b.txt")
+	data := strings.Repeat("abcdefgh", 200000)
+	addFile(t, fs, a, data, "a", "1")
+	vb := addFile(t, fs, b, "bbb", "b", "1")
+	if err := fs.Tag(vb, "t"); err != nil {
+		t.Fatal(err)
+	}
+	if err := fs.Pin(vb); err != nil {
+		t.Fatal(err)
+	}
+	var metadata bytes.Buffer
+	if err := fs.ExportMetadata(&metadata); err != nil {
+		t.Fatal(err)
+	}
+	// the blobs and chunks remain, but the database is lost
+	if err := fs.Close(); err != nil {
+		t.Fatal(err)
+	}
+	for _, suffix := range []string{"", "-wal", "-shm"} {
+		if err := os.Remove(fs.dbPath() + suffix); err != nil && !os.IsNotExist(err) {
+			t.Fatal(err)
+		}
+	}
+	openTestStore(t, fs)
+	// importing the same metadata twice adds the versions once
+	for i := 0; i < 2; i++ {
+		if err := fs.ImportMetadata(bytes.NewReader(metadata.Bytes())); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if versions, err := fs.Versions(a, -1); err != nil || len(versions) != 1 {
+		t.Fatalf("Versions = %v, %v, want 1 version", versions, err)
+	}
+	v, err := fs.Get(a)
+	if err != nil {
+		t.Fatal(err)
+	}
+	dst := t.TempDir()
+	if err := fs.Restore(v, dst); err != nil {
+		t.Fatal(err)
+	}
+	if got := readFile(t, filepath.Join(dst, "a.txt")); got != data {
+		t.Fatalf("restored %d bytes, want %d bytes", len(got), len(data))
+	}
+	if v, err = fs.Get(b); err != nil {
+		t.Fatal(err)
+	}
+	if pinned, err := fs.IsPinned(v); err != nil || !pinned {
+		t.Fatalf("IsPinned = %v, %v, want true", pinned, err)
+	}
+	if tags, err := fs.Tags(v); err != nil || len(tags) != 1 || tags[0] != "t" {
+		t.Fatalf("Tags = %v, %v, want [t]", tags, err)
+	}
+	if err := fs.ImportMetadata(strings.NewReader(`{"type":"bogus"}`)); err == nil {
+		t.Fatal("ImportMetadata of an unknown record succeeded")
+	}
+}
@@ -0,0 +1,31 @@
+//go:build linux
+
+package filestore
+
+import "syscall"
+
+// networkFilesystems are the magic numbers of network file systems reported by statfs(2).
+var networkFilesystems = map[uint32]string{
+	0x6969:     "nfs",
+	0x517b:     "smb",
+	0xff534d42: "cifs",
+	0xfe534d42: "smb2",
+	0x564c:     "ncp",
+	0x65735546: "fuse",
+	0x5346414f: "afs",
+	0x73757245: "coda",
+	0x47504653: "gpfs",
+	0x0bd00bd0: "lustre",
+	0x00c36400: "ceph",
+}
+
+// networkFilesystem returns the type of the file system of path if it is a network file system,
+// or an empty string otherwise or if the type cannot be determined. FUSE file systems are
+// reported as well, since many of them, such as sshfs, are backed by the network.
+func networkFilesystem(path string) string {
+	var stat syscall.Statfs_t
+	if err := syscall.Statfs(path, &stat); err != nil {
+		return ""
+	}
+	return networkFilesystems[uint32(stat.Type)]
+}
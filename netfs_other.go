@@ -0,0 +1,9 @@
+//go:build !linux
+
+package filestore
+
+// networkFilesystem returns the type of the file system of path if it is a network file system,
+// which cannot be determined on this platform, so that it always returns an empty string.
+func networkFilesystem(path string) string {
+	return ""
+}
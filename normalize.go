@@ -0,0 +1,104 @@
+package filestore
+
+import (
+	"database/sql"
+	"errors"
+	"path/filepath"
+
+	"github.com/rasteric/flags"
+	"golang.org/x/text/cases"
+	"golang.org/x/text/unicode/norm"
+)
+
+var ErrPathsNotNormalized = errors.New("filestore has versions of paths not normalized as required by the NormalizePaths and FoldCase options")
+
+// pathFormKey is the key under which the normalization of the stored paths is recorded in the
+// Settings table once they have been checked.
+const pathFormKey = "path_form"
+
+// Normalizations of stored paths recorded under pathFormKey.
+const (
+	pathFormNFC  = "nfc"
+	pathFormFold = "fold" // case-folded and NFC
+)
+
+// storedPath returns path as it is stored in the database, with slashes as separators and
+// normalized according to the NormalizePaths and FoldCase options of the filestore. Paths given
+// to the methods of the filestore are converted with it, so that they find the stored versions
+// of differently normalized or cased paths.
+func (fs *Filestore) storedPath(path string) string {
+	path = filepath.ToSlash(path)
+	if flags.Has(fs.Options, FoldCase) {
+		// folding may produce decomposed characters, so the result is normalized in any case
+		path = cases.Fold().String(path)
+	}
+	if flags.Has(fs.Options, NormalizePaths) || flags.Has(fs.Options, FoldCase) {
+		path = norm.NFC.String(path)
+	}
+	return path
+}
+
+// pathForm returns the normalization of paths stored by the filestore, or the empty string if
+// paths are stored as they are.
+func (fs *Filestore) pathForm() string {
+	switch {
+	case flags.Has(fs.Options, FoldCase):
+		return pathFormFold
+	case flags.Has(fs.Options, NormalizePaths):
+		return pathFormNFC
+	}
+	return ""
+}
+
+// checkStoredPaths returns ErrPathsNotNormalized if the NormalizePaths or FoldCase option is set
+// but versions of paths that are not normalized accordingly have been added without it, since
+// they could no longer be found. Once all paths are found to be normalized, their normalization
+// is recorded unless readOnly is true, so that they are not checked again until the filestore is
+// opened without the options.
+func (fs *Filestore) checkStoredPaths(readOnly bool) error {
+	form := fs.pathForm()
+	if form == "" {
+		if readOnly {
+			return nil
+		}
+		if _, err := fs.db.Exec("delete from Settings where name=?;", pathFormKey); err != nil {
+			return fs.dbError(err)
+		}
+		return nil
+	}
+	var recorded string
+	err := fs.db.QueryRow("select value from Settings where name=?;", pathFormKey).Scan(&recorded)
+	if err != nil && err != sql.ErrNoRows {
+		return fs.dbError(err)
+	}
+	// folded paths are normalized as well
+	if recorded == form || recorded == pathFormFold {
+		return nil
+	}
+	rows, err := fs.db.Query("select distinct path from Versions;")
+	if err != nil {
+		return fs.dbError(err)
+	}
+	for rows.Next() {
+		var path string
+		if err := rows.Scan(&path); err != nil {
+			rows.Close()
+			return fs.dbError(err)
+		}
+		if fs.storedPath(path) != path {
+			rows.Close()
+			return ErrPathsNotNormalized
+		}
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return fs.dbError(err)
+	}
+	if readOnly {
+		return nil
+	}
+	if _, err := fs.db.Exec("insert or replace into Settings(name, value) values(?, ?);", pathFormKey, form); err != nil {
+		return fs.dbError(err)
+	}
+	return nil
+}
@@ -0,0 +1,77 @@
+package filestore
+
+import (
+	"bytes"
+	"errors"
+	"path/filepath"
+	"testing"
+)
+
+func TestFoldCaseExistingPaths(t *testing.T) {
+	dir := filepath.Join(t.TempDir(), "store")
+	fs, src := openTestStore(t, NewFilestore(dir, FoldCase))
+	addFile(t, fs, filepath.Join(src, "A.txt"), "a", "", "1")
+	if err := fs.Close(); err != nil {
+		t.Fatal(err)
+	}
+	// paths added with the option are found when it is set again
+	if err := fs.Open(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := fs.Get(filepath.Join(src, "a.TXT")); err != nil {
+		t.Fatal(err)
+	}
+	if err := fs.Close(); err != nil {
+		t.Fatal(err)
+	}
+	plain, _ := openTestStore(t, NewFilestore(dir, 0))
+	addFile(t, plain, filepath.Join(src, "B.txt"), "b", "", "1")
+	if err := plain.Close(); err != nil {
+		t.Fatal(err)
+	}
+	// B.txt would no longer be found
+	folded := NewFilestore(dir, FoldCase)
+	if err := folded.Open(); !errors.Is(err, ErrPathsNotNormalized) {
+		folded.Close()
+		t.Fatalf("Open = %v, want ErrPathsNotNormalized", err)
+	}
+	// plain ASCII paths are normalized already
+	openTestStore(t, NewFilestore(dir, NormalizePaths))
+}
+
+func TestNormalizePaths(t *testing.T) {
+	fs, src := openTestStore(t, NewFilestore(filepath.Join(t.TempDir(), "store"), NormalizePaths))
+	decomposed := filepath.Join(src, "Cafe\u0301.txt")
+	composed := filepath.Join(src, "Caf\u00e9.txt")
+	addFile(t, fs, decomposed, "one", "", "1")
+	addFile(t, fs, composed, "two", "", "2")
+	versions, err := fs.Versions(decomposed, -1)
+	if err != nil || len(versions) != 2 || versions[0].Path != composed {
+		t.Fatalf("Versions = %v, %v, want 2 versions of the composed path", versions, err)
+	}
+	if !fs.Has(decomposed) {
+		t.Fatal("Has of the decomposed path = false, want true")
+	}
+	// imported paths are normalized too
+	plain, _ := openTestStore(t, NewFilestore(filepath.Join(t.TempDir(), "plain"), 0))
+	addFile(t, plain, decomposed, "three", "", "3")
+	var archive bytes.Buffer
+	if err := plain.ExportTar(&archive, ExportOptions{}); err != nil {
+		t.Fatal(err)
+	}
+	if err := fs.ImportTar(&archive, ImportOptions{}); err != nil {
+		t.Fatal(err)
+	}
+	if versions, err := fs.Versions(composed, -1); err != nil || len(versions) != 3 {
+		t.Fatalf("Versions = %v, %v, want 3 versions after importing", versions, err)
+	}
+}
+
+func TestFoldCase(t *testing.T) {
+	fs, src := openTestStore(t, NewFilestore(filepath.Join(t.TempDir(), "store"), FoldCase))
+	addFile(t, fs, filepath.Join(src, "README.md"), "r", "", "")
+	v, err := fs.Get(filepath.Join(src, "readme.MD"))
+	if err != nil || v.Name != "readme.md" {
+		t.Fatalf("Get = %+v, %v, want the version of readme.md", v, err)
+	}
+}
@@ -0,0 +1,212 @@
+package filestore
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"io"
+	"path/filepath"
+	"time"
+
+	"github.com/rasteric/flags"
+)
+
+// policyKey is the key under which the policy of a filestore is stored in the Settings table.
+const policyKey = "policy"
+
+// Policy is the configuration of a filestore that is persisted in it with SetPolicy, so that it
+// applies whenever the filestore is opened, and that can be exported as JSON to configure other
+// filestores identically.
+type Policy struct {
+	Retention     RetentionPolicy // determines which versions are removed by Prune
+	Ignore        []string        // filepath.Match patterns of files and directories skipped by AddTree and Watch
+	Roots         []string        // the directories versions are expected to be added from, see OutsideRoots
+	TagRules      []TagRule       // rules tagging added versions
+	Quota         int64           // the maximum number of bytes taken by blobs and chunks, unlimited if zero
+	QuotaWarnings []float64       // fractions of Quota whose crossing emits EventQuotaWarning, DefaultQuotaWarnings if nil
+}
+
+// policyJSON is the JSON representation of a Policy, with durations as strings like "720h".
+type policyJSON struct {
+	Retention struct {
+		MaxVersions int    `json:"max_versions,omitempty"`
+		MaxAge      string `json:"max_age,omitempty"`
+		Notice      string `json:"notice,omitempty"`
+	} `json:"retention"`
+	Ignore        []string  `json:"ignore,omitempty"`
+	Roots         []string  `json:"roots,omitempty"`
+	TagRules      []TagRule `json:"tag_rules,omitempty"`
+	Quota         int64     `json:"quota,omitempty"`
+	QuotaWarnings []float64 `json:"quota_warnings"` // null for the DefaultQuotaWarnings, unlike an empty list
+}
+
+// MarshalJSON encodes the policy as JSON with durations in the format of time.Duration.String.
+func (p Policy) MarshalJSON() ([]byte, error) {
+	var j policyJSON
+	j.Retention.MaxVersions = p.Retention.MaxVersions
+	if p.Retention.MaxAge != 0 {
+		j.Retention.MaxAge = p.Retention.MaxAge.String()
+	}
+	if p.Retention.Notice != 0 {
+		j.Retention.Notice = p.Retention.Notice.String()
+	}
+	j.Ignore = p.Ignore
+	j.Roots = p.Roots
+	j.TagRules = p.TagRules
+	j.Quota = p.Quota
+	j.QuotaWarnings = p.QuotaWarnings
+	return json.Marshal(j)
+}
+
+// UnmarshalJSON decodes a policy encoded with MarshalJSON.
+func (p *Policy) UnmarshalJSON(data []byte) error {
+	var j policyJSON
+	if err := json.Unmarshal(data, &j); err != nil {
+		return err
+	}
+	policy := Policy{Ignore: j.Ignore, Roots: j.Roots, TagRules: j.TagRules, Quota: j.Quota, QuotaWarnings: j.QuotaWarnings}
+	policy.Retention.MaxVersions = j.Retention.MaxVersions
+	var err error
+	if j.Retention.MaxAge != "" {
+		if policy.Retention.MaxAge, err = time.ParseDuration(j.Retention.MaxAge); err != nil {
+			return fmt.Errorf("filestore policy has invalid max_age: %w", err)
+		}
+	}
+	if j.Retention.Notice != "" {
+		if policy.Retention.Notice, err = time.ParseDuration(j.Retention.Notice); err != nil {
+			return fmt.Errorf("filestore policy has invalid notice: %w", err)
+		}
+	}
+	if err := policy.check(); err != nil {
+		return err
+	}
+	*p = policy
+	return nil
+}
+
+// check returns an error if the policy has invalid patterns or tags, negative retention limits
+// or quota, or quota warnings that are no fractions of the quota.
+func (p Policy) check() error {
+	if p.Retention.MaxVersions < 0 {
+		return fmt.Errorf("filestore policy has negative max_versions %d", p.Retention.MaxVersions)
+	}
+	if p.Retention.MaxAge < 0 {
+		return fmt.Errorf("filestore policy has negative max_age %v", p.Retention.MaxAge)
+	}
+	if p.Retention.Notice < 0 {
+		return fmt.Errorf("filestore policy has negative notice %v", p.Retention.Notice)
+	}
+	for _, pattern := range p.Ignore {
+		if _, err := filepath.Match(pattern, ""); err != nil {
+			return fmt.Errorf("filestore policy has invalid ignore pattern %q: %w", pattern, err)
+		}
+	}
+	for _, rule := range p.TagRules {
+		if err := rule.check(); err != nil {
+			return err
+		}
+	}
+	if p.Quota < 0 {
+		return fmt.Errorf("filestore policy has negative quota %d", p.Quota)
+	}
+	for _, warning := range p.QuotaWarnings {
+		if warning <= 0 || warning > 1 {
+			return fmt.Errorf("filestore policy has quota warning %g, which is no fraction of the quota", warning)
+		}
+	}
+	return nil
+}
+
+// Policy returns the current policy of the filestore.
+func (fs *Filestore) Policy() Policy {
+	return Policy{Retention: fs.Retention, Ignore: fs.Ignore, Roots: fs.Roots, TagRules: fs.TagRules,
+		Quota: fs.Quota, QuotaWarnings: fs.QuotaWarnings}
+}
+
+// SetPolicy applies the policy to the filestore and stores it, so that it is applied again
+// whenever the filestore is opened, replacing the Retention, Ignore, Roots, TagRules, Quota and
+// QuotaWarnings fields set before. An error is returned and nothing is changed if the policy is
+// invalid, for instance if its quota or retention limits are negative.
+func (fs *Filestore) SetPolicy(policy Policy) (err error) {
+	op := newOp("SetPolicy", fs.Dir)
+	defer op.done(&err)
+	if err := fs.ensureOpen(); err != nil {
+		return err
+	}
+	if err := policy.check(); err != nil {
+		return err
+	}
+	data, err := json.Marshal(policy)
+	if err != nil {
+		return err
+	}
+	if _, err := fs.db.Exec("insert or replace into Settings(name, value) values(?, ?);", policyKey, string(data)); err != nil {
+		return fs.dbError(err)
+	}
+	fs.applyPolicy(policy)
+	return nil
+}
+
+// ExportPolicy writes the current policy of the filestore to w as JSON.
+func (fs *Filestore) ExportPolicy(w io.Writer) (err error) {
+	op := newOp("ExportPolicy", fs.Dir)
+	defer op.done(&err)
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(fs.Policy())
+}
+
+// ImportPolicy reads a policy written by ExportPolicy from r and sets it like SetPolicy.
+func (fs *Filestore) ImportPolicy(r io.Reader) (err error) {
+	op := newOp("ImportPolicy", fs.Dir)
+	defer op.done(&err)
+	var policy Policy
+	if err := json.NewDecoder(r).Decode(&policy); err != nil {
+		return fmt.Errorf("filestore could not read policy: %w", err)
+	}
+	return fs.SetPolicy(policy)
+}
+
+// applyPolicy sets the configuration fields of the filestore to those of the policy.
+func (fs *Filestore) applyPolicy(policy Policy) {
+	fs.Retention = policy.Retention
+	fs.Ignore = policy.Ignore
+	fs.Roots = policy.Roots
+	fs.TagRules = policy.TagRules
+	fs.Quota = policy.Quota
+	fs.QuotaWarnings = policy.QuotaWarnings
+}
+
+// loadPolicy applies the policy stored in the filestore, if there is one, overriding the
+// configuration fields set before opening it.
+func (fs *Filestore) loadPolicy() error {
+	var data string
+	err := fs.db.QueryRow("select value from Settings where name=?;", policyKey).Scan(&data)
+	if err == sql.ErrNoRows || err != nil && flags.Has(fs.Options, ReadOnly) {
+		// the Settings table may not even exist in a read-only filestore created earlier
+		return nil
+	}
+	if err != nil {
+		return fs.dbError(err)
+	}
+	var policy Policy
+	if err := json.Unmarshal([]byte(data), &policy); err != nil {
+		return fmt.Errorf("filestore contains invalid policy: %w", err)
+	}
+	fs.applyPolicy(policy)
+	return nil
+}
+
+// ignored returns true if the file or directory with the given name and slash-separated path
+// rel relative to the directory being walked or watched matches one of the patterns.
+func ignored(patterns []string, name, rel string) bool {
+	for _, pattern := range patterns {
+		if ok, _ := filepath.Match(pattern, name); ok {
+			return true
+		}
+		if ok, _ := filepath.Match(pattern, rel); ok {
+			return true
+		}
+	}
+	return false
+}
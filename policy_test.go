@@ -0,0 +1,106 @@
+package filestore
+
+import (
+	"bytes"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestPolicyQuota(t *testing.T) {
+	fs, _ := newTestStore(t)
+	policy := Policy{Retention: RetentionPolicy{MaxAge: 24 * time.Hour}, Quota: 1 << 20, QuotaWarnings: []float64{0.5}}
+	if err := fs.SetPolicy(policy); err != nil {
+		t.Fatal(err)
+	}
+	if err := fs.Close(); err != nil {
+		t.Fatal(err)
+	}
+	fs.Quota, fs.QuotaWarnings = 0, nil
+	openTestStore(t, fs)
+	if fs.Quota != 1<<20 || !reflect.DeepEqual(fs.QuotaWarnings, []float64{0.5}) {
+		t.Fatalf("Quota %d and QuotaWarnings %v after reopening, want those of %+v", fs.Quota, fs.QuotaWarnings, policy)
+	}
+	// no warnings at all are kept apart from the default warnings
+	fs.QuotaWarnings = []float64{}
+	var buf bytes.Buffer
+	if err := fs.ExportPolicy(&buf); err != nil {
+		t.Fatal(err)
+	}
+	other, _ := newTestStore(t)
+	if err := other.ImportPolicy(&buf); err != nil {
+		t.Fatal(err)
+	}
+	if other.Quota != 1<<20 || other.QuotaWarnings == nil || len(other.QuotaWarnings) != 0 {
+		t.Fatalf("imported Quota %d and QuotaWarnings %#v, want no warnings", other.Quota, other.QuotaWarnings)
+	}
+	if err := other.ImportPolicy(bytes.NewBufferString(`{"quota": -1}`)); err == nil {
+		t.Fatal("imported a negative quota")
+	}
+	if err := other.ImportPolicy(bytes.NewBufferString(`{"quota_warnings": [1.5]}`)); err == nil {
+		t.Fatal("imported a quota warning above the quota")
+	}
+	// invalid policies are rejected without changing the filestore
+	for _, invalid := range []Policy{
+		{Quota: -1},
+		{Retention: RetentionPolicy{MaxVersions: -1}},
+		{Retention: RetentionPolicy{MaxAge: -time.Hour}},
+		{Retention: RetentionPolicy{Notice: -time.Hour}},
+		{QuotaWarnings: []float64{0}},
+	} {
+		if err := other.SetPolicy(invalid); err == nil {
+			t.Fatalf("SetPolicy(%+v) succeeded", invalid)
+		}
+	}
+	if other.Quota != 1<<20 || other.Retention.MaxAge != 24*time.Hour {
+		t.Fatalf("Quota %d and Retention %+v after setting invalid policies, want those imported", other.Quota, other.Retention)
+	}
+}
+
+func TestPolicy(t *testing.T) {
+	fs, src := newTestStore(t)
+	policy := Policy{Retention: RetentionPolicy{MaxVersions: 3, MaxAge: 720 * time.Hour}, Ignore: []string{"*.tmp", "skip"}}
+	if err := fs.SetPolicy(policy); err != nil {
+		t.Fatal(err)
+	}
+	var buf bytes.Buffer
+	if err := fs.ExportPolicy(&buf); err != nil {
+		t.Fatal(err)
+	}
+	// durations are exported in the notation of time.Duration
+	if !strings.Contains(buf.String(), `"720h0m0s"`) {
+		t.Fatalf("exported policy %s, want the maximum age as a duration", buf.String())
+	}
+	if err := fs.Close(); err != nil {
+		t.Fatal(err)
+	}
+	fs.Retention, fs.Ignore = RetentionPolicy{}, nil
+	openTestStore(t, fs)
+	if fs.Retention.MaxVersions != 3 || fs.Retention.MaxAge != 720*time.Hour || len(fs.Ignore) != 2 {
+		t.Fatalf("policy %+v after reopening, want %+v", fs.Policy(), policy)
+	}
+	writeFile(t, filepath.Join(src, "a"), "a")
+	writeFile(t, filepath.Join(src, "b.tmp"), "b")
+	writeFile(t, filepath.Join(src, "skip", "c"), "c")
+	if _, err := fs.AddTree(src, "", "1"); err != nil {
+		t.Fatal(err)
+	}
+	if !fs.Has(filepath.Join(src, "a")) {
+		t.Fatal("file not matching the ignore patterns has not been added")
+	}
+	if fs.Has(filepath.Join(src, "b.tmp")) || fs.Has(filepath.Join(src, "skip", "c")) {
+		t.Fatal("ignored file has been added")
+	}
+	if err := fs.ImportPolicy(strings.NewReader(`{"retention":{"max_age":"bogus"}}`)); err == nil {
+		t.Fatal("ImportPolicy of a malformed duration succeeded")
+	}
+	// an imported policy replaces the whole policy
+	if err := fs.ImportPolicy(strings.NewReader(`{"retention":{"notice":"1h"}}`)); err != nil {
+		t.Fatal(err)
+	}
+	if fs.Retention.Notice != time.Hour || fs.Retention.MaxVersions != 0 || fs.Ignore != nil {
+		t.Fatalf("policy %+v after importing, want only a notice period", fs.Policy())
+	}
+}
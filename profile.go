@@ -0,0 +1,54 @@
+package filestore
+
+import (
+	"errors"
+	"time"
+)
+
+var ErrUnknownProfile = errors.New("filestore profile is unknown")
+
+// Names of the profiles that can be applied with InitProfile.
+const (
+	// ProfileDocumentArchive keeps every version of documents forever, compressed well with Zstd,
+	// and stores a summary of the changes of each version for searching.
+	ProfileDocumentArchive = "document archive"
+	// ProfileBuildCache stores build outputs quickly with LZ4 and XXH3 checksums in chunks, so
+	// that similar artifacts share storage, and keeps only a few recent versions of each.
+	ProfileBuildCache = "build cache"
+	// ProfileAutosaveHistory keeps the versions of the last month of frequently saved files in
+	// chunks compressed with Snappy, and ignores the temporary files of common editors.
+	ProfileAutosaveHistory = "autosave history"
+)
+
+// InitProfile configures the filestore with the preset of the profile with the given name,
+// which must be one of the Profile constants. It sets the options, codec, hash algorithm,
+// retention policy and ignore patterns of the profile and should be called before Open, after
+// which any of them may still be adjusted. Other options of the filestore are left unchanged.
+func (fs *Filestore) InitProfile(name string) error {
+	switch name {
+	case ProfileDocumentArchive:
+		fs.Options |= Summarize
+		fs.Options &^= Chunked
+		fs.Compression = CompressionZstd
+		fs.Hash = HashBlake2b512
+		fs.Retention = RetentionPolicy{}
+		fs.Ignore = nil
+	case ProfileBuildCache:
+		fs.Options |= Chunked
+		fs.Options &^= Summarize
+		fs.Compression = CompressionLZ4
+		fs.Hash = HashXXH3
+		fs.Retention = RetentionPolicy{MaxVersions: 3, MaxAge: 14 * 24 * time.Hour}
+		fs.Ignore = nil
+	case ProfileAutosaveHistory:
+		fs.Options |= Chunked
+		fs.Options &^= Summarize
+		fs.Compression = CompressionSnappy
+		fs.Hash = HashBlake3
+		fs.Retention = RetentionPolicy{MaxAge: 30 * 24 * time.Hour, Notice: 24 * time.Hour}
+		fs.Ignore = []string{"*~", "*.swp", "*.tmp", ".#*", "~$*"}
+	default:
+		return ErrUnknownProfile
+	}
+	return nil
+}
@@ -0,0 +1,27 @@
+package filestore
+
+import (
+	"errors"
+	"path/filepath"
+	"testing"
+)
+
+func TestProfiles(t *testing.T) {
+	for _, name := range []string{ProfileDocumentArchive, ProfileBuildCache, ProfileAutosaveHistory} {
+		fs := NewFilestore(filepath.Join(t.TempDir(), "store"), 0)
+		if err := fs.InitProfile(name); err != nil {
+			t.Fatal(err)
+		}
+		_, src := openTestStore(t, fs)
+		v := addFile(t, fs, filepath.Join(src, "a.txt"), "hello hello hello", "", "1")
+		if v.Hash != fs.Hash {
+			t.Fatalf("version of profile %s has hash %s, want %s", name, v.Hash, fs.Hash)
+		}
+		if c := storedCodec(t, fs, v); c != fs.Compression {
+			t.Fatalf("contents of profile %s stored with codec %s, want %s", name, c, fs.Compression)
+		}
+	}
+	if err := NewFilestore("store", 0).InitProfile("nope"); !errors.Is(err, ErrUnknownProfile) {
+		t.Fatalf("InitProfile of an unknown profile = %v, want ErrUnknownProfile", err)
+	}
+}
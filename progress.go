@@ -0,0 +1,131 @@
+package filestore
+
+import (
+	"io"
+	"os"
+	"time"
+)
+
+// progressInterval is the minimum time between two progress reports of an operation.
+const progressInterval = 200 * time.Millisecond
+
+// progressSmoothing is the weight of the latest throughput measurement in the exponentially
+// smoothed throughput reported to Progress.
+const progressSmoothing = 0.3
+
+// Progress receives reports about the progress of adding and restoring files. Set the Progress
+// field of a Filestore to receive them. Update is called from the goroutine performing the
+// operation, at most every 200 milliseconds and once more when the operation is complete, so it
+// should return quickly.
+type Progress interface {
+	Update(info ProgressInfo)
+}
+
+// ProgressInfo describes the progress of an operation. When a file is added, its contents are
+// read twice, once to compute the checksum and once to store them, so Total is twice the size of
+// the file. If the contents are already stored, the second pass is skipped. When a version is
+// restored, Total is the size of the stored contents.
+type ProgressInfo struct {
+	Op         string        // the operation, "Add" or "Restore"
+	Path       string        // the path of the file added or restored
+	Done       int64         // the number of bytes processed so far
+	Total      int64         // the total number of bytes to process
+	Elapsed    time.Duration // the time since the operation started
+	Throughput float64       // the smoothed throughput in bytes per second, 0 if not known yet
+	ETA        time.Duration // the estimated time until the operation is complete, 0 if not known
+}
+
+// progressTracker computes the progress of an operation and reports it. A nil tracker does
+// nothing, so operations can use it unconditionally.
+type progressTracker struct {
+	progress Progress
+	info     ProgressInfo
+	start    time.Time
+	last     time.Time // time of the last report
+	lastDone int64     // bytes processed at the last report
+}
+
+// newProgress returns a tracker for an operation on path that reads file the given number of
+// passes, or nil if the filestore has no Progress.
+func (fs *Filestore) newProgress(op, path, file string, passes int64) *progressTracker {
+	if fs.Progress == nil {
+		return nil
+	}
+	var total int64
+	if info, err := os.Stat(file); err == nil {
+		total = passes * info.Size()
+	}
+	now := time.Now()
+	return &progressTracker{progress: fs.Progress, info: ProgressInfo{Op: op, Path: path, Total: total},
+		start: now, last: now}
+}
+
+// add records that n more bytes have been processed and reports the progress if enough time
+// has passed since the last report.
+func (t *progressTracker) add(n int64) {
+	if t == nil || n <= 0 {
+		return
+	}
+	t.info.Done += n
+	if now := time.Now(); now.Sub(t.last) >= progressInterval {
+		t.report(now)
+	}
+}
+
+// setTotal sets the total number of bytes to process, if it was not known when the tracker was
+// created.
+func (t *progressTracker) setTotal(total int64) {
+	if t == nil {
+		return
+	}
+	t.info.Total = total
+}
+
+// finish records that the operation is complete and reports it.
+func (t *progressTracker) finish() {
+	if t == nil {
+		return
+	}
+	t.info.Done = t.info.Total
+	t.report(time.Now())
+}
+
+// report updates throughput and estimated time of arrival and passes them to Progress.
+func (t *progressTracker) report(now time.Time) {
+	if seconds := now.Sub(t.last).Seconds(); seconds > 0 {
+		rate := float64(t.info.Done-t.lastDone) / seconds
+		if t.info.Throughput == 0 {
+			t.info.Throughput = rate
+		} else {
+			t.info.Throughput = progressSmoothing*rate + (1-progressSmoothing)*t.info.Throughput
+		}
+	}
+	t.info.ETA = 0
+	if remaining := t.info.Total - t.info.Done; remaining > 0 && t.info.Throughput > 0 {
+		t.info.ETA = time.Duration(float64(remaining) / t.info.Throughput * float64(time.Second))
+	}
+	t.info.Elapsed = now.Sub(t.start)
+	t.last, t.lastDone = now, t.info.Done
+	t.progress.Update(t.info)
+}
+
+// reader returns a reader that records the bytes read from r, or r itself if t is nil.
+func (t *progressTracker) reader(r io.Reader) io.Reader {
+	if t == nil {
+		return r
+	}
+	return &progressReader{Reader: r, tracker: t}
+}
+
+// progressReader records the bytes read in its tracker.
+type progressReader struct {
+	io.Reader
+	tracker *progressTracker
+}
+
+// Read reads from the underlying reader and records the bytes read.
+func (r *progressReader) Read(p []byte) (int, error) {
+	n, err := r.Reader.Read(p)
+	r.tracker.add(int64(n))
+	return n, err
+}
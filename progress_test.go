@@ -0,0 +1,68 @@
+package filestore
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// recordedProgress records the progress reported to it.
+type recordedProgress struct{ infos []ProgressInfo }
+
+func (r *recordedProgress) Update(info ProgressInfo) { r.infos = append(r.infos, info) }
+
+// last returns the last progress reported.
+func (r *recordedProgress) last(t *testing.T) ProgressInfo {
+	t.Helper()
+	if len(r.infos) == 0 {
+		t.Fatal("no progress reported")
+	}
+	return r.infos[len(r.infos)-1]
+}
+
+func TestProgress(t *testing.T) {
+	fs, src := newTestStore(t)
+	progress := &recordedProgress{}
+	fs.Progress = progress
+	path := filepath.Join(src, "big")
+	const size = 8 << 20
+	if err := os.WriteFile(path, make([]byte, size), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := fs.Add(path, "", "1"); err != nil {
+		t.Fatal(err)
+	}
+	// the contents are read twice, to compute their checksum and to store them
+	if last := progress.last(t); last.Op != "Add" || last.Path != path || last.Done != 2*size || last.Total != 2*size || last.ETA != 0 {
+		t.Fatalf("last progress of Add = %+v, want %d bytes done", last, 2*size)
+	}
+	v, err := fs.Get(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := fs.Restore(v, t.TempDir()); err != nil {
+		t.Fatal(err)
+	}
+	if last := progress.last(t); last.Op != "Restore" || last.Done != last.Total || last.Total <= 0 {
+		t.Fatalf("last progress of Restore = %+v, want all bytes done", last)
+	}
+}
+
+func TestProgressThroughput(t *testing.T) {
+	progress := &recordedProgress{}
+	start := time.Now().Add(-time.Second)
+	tracker := &progressTracker{progress: progress, info: ProgressInfo{Total: 1000}, start: start, last: start}
+	tracker.add(100)
+	last := progress.last(t)
+	if last.Done != 100 || last.Throughput < 50 || last.Throughput > 150 {
+		t.Fatalf("progress = %+v, want a throughput of about 100 bytes per second", last)
+	}
+	if last.ETA < 6*time.Second || last.ETA > 18*time.Second {
+		t.Fatalf("ETA = %v, want about 9s", last.ETA)
+	}
+	// a nil tracker does nothing
+	var none *progressTracker
+	none.add(100)
+	none.finish()
+}
@@ -0,0 +1,350 @@
+package filestore
+
+import (
+	"database/sql"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+
+	"github.com/rasteric/flags"
+)
+
+var ErrNotFetched = errors.New("filestore contents have not been fetched from the filestore they were pulled from")
+
+// pulledKey is the prefix of the settings recording the ID of the last version pulled from the
+// filestore in the directory following the prefix.
+const pulledKey = "pulled:"
+
+// PullMetadata adds the versions added to remote since the last pull from it, or all of its
+// versions on the first pull, with their original dates, info strings, signatures and the
+// attributes of their source files but without their contents, and returns the number of
+// versions added. The versions can be found, listed and searched like other versions while
+// remote is unavailable, but are not Available. The contents of a version are fetched from the
+// filestore in the directory of remote the first time they are read or restored, or with Fetch,
+// which must be possible at that time and requires the same Key if they are encrypted. Versions
+// deleted from remote after they were pulled are kept.
+func (fs *Filestore) PullMetadata(remote *Filestore) (_ int, err error) {
+	op := newOp("PullMetadata", remote.Dir)
+	defer op.done(&err)
+	if err := fs.ensureOpen(); err != nil {
+		return 0, err
+	}
+	if err := remote.ensureOpen(); err != nil {
+		return 0, err
+	}
+	origin, err := filepath.Abs(remote.Root())
+	if err != nil {
+		return 0, err
+	}
+	var last int64
+	var value string
+	err = fs.db.QueryRow("select value from Settings where name=?;", pulledKey+origin).Scan(&value)
+	if err != nil && err != sql.ErrNoRows {
+		return 0, fs.dbError(err)
+	}
+	if value != "" {
+		if last, err = strconv.ParseInt(value, 10, 64); err != nil {
+			return 0, fmt.Errorf("filestore has an invalid record of pulls from %s: %w", origin, err)
+		}
+	}
+	rows, err := remote.db.Query("select version_id, path, info, Versions.version, date, checksum, hash, size, signature, coalesce(uuid, ''), mode, mtime from Versions inner join Infos on Versions.info_id=Infos.info_id inner join Files on Versions.file=Files.file_id left join Signatures on Signatures.version=version_id where version_id > ? order by version_id;",
+		last)
+	if err != nil {
+		return 0, remote.dbError(err)
+	}
+	var pulled []pulledVersion
+	for rows.Next() {
+		var v pulledVersion
+		if err := rows.Scan(&v.id, &v.path, &v.info, &v.version, &v.date, &v.checksum, &v.hashName, &v.size, &v.signature, &v.uuid, &v.mode, &v.mtime); err != nil {
+			rows.Close()
+			return 0, remote.dbError(err)
+		}
+		pulled = append(pulled, v)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return 0, remote.dbError(err)
+	}
+	if len(pulled) == 0 {
+		return 0, nil
+	}
+	for i := range pulled {
+		if pulled[i].xattrs, err = remote.xattrs(remote.db, pulled[i].id); err != nil {
+			return 0, err
+		}
+	}
+	tx, err := fs.db.Begin()
+	if err != nil {
+		return 0, fs.dbError(err)
+	}
+	n := 0
+	for _, v := range pulled {
+		added, err := fs.addPulledVersion(tx, origin, v)
+		if err != nil {
+			tx.Rollback()
+			return 0, err
+		}
+		if added {
+			n++
+		}
+	}
+	if _, err := tx.Exec("insert or replace into Settings(name, value) values(?, ?);",
+		pulledKey+origin, strconv.FormatInt(pulled[len(pulled)-1].id, 10)); err != nil {
+		tx.Rollback()
+		return 0, fs.dbError(err)
+	}
+	if err := tx.Commit(); err != nil {
+		return 0, fs.dbError(err)
+	}
+	return n, nil
+}
+
+// pulledVersion is a version read from another filestore by PullMetadata.
+type pulledVersion struct {
+	id                                            int64 // the ID in the other filestore
+	path, info, version, date, checksum, hashName string
+	uuid                                          string
+	size, mode, mtime                             int64
+	signature                                     []byte
+	xattrs                                        map[string][]byte
+}
+
+// addPulledVersion adds a version pulled from the filestore in the directory origin within tx,
+// with a file entry without a blob unless there are contents with the checksum already. It
+// returns false if there is a version of the path with the same date and contents already.
+func (fs *Filestore) addPulledVersion(tx *sql.Tx, origin string, v pulledVersion) (bool, error) {
+	// signatures cover the path, so they are dropped if it is stored differently
+	if stored := fs.storedPath(v.path); stored != v.path {
+		v.path, v.signature = stored, nil
+	}
+	// read-only filestores of earlier versions of this package have dates in seconds
+	if t, err := ParseDBDate(v.date); err == nil {
+		v.date = ToDBDate(t)
+	}
+	var fileID int64
+	err := txStmt(tx, fs.queryIDStmt).QueryRow(v.checksum).Scan(&fileID)
+	if err != nil && err != sql.ErrNoRows {
+		return false, fs.dbError(err)
+	}
+	if fileID == 0 {
+		result, err := tx.Exec("insert into Files(checksum, hash, codec, size, stored, chunked, origin) values(?, ?, ?, ?, 0, 0, ?);",
+			v.checksum, v.hashName, CompressionNone, v.size, origin)
+		if err != nil {
+			return false, fs.dbError(err)
+		}
+		if fileID, err = result.LastInsertId(); err != nil {
+			return false, fs.dbError(err)
+		}
+	} else {
+		var exists bool
+		if err := tx.QueryRow("select exists (select 1 from Versions where path=? and date=? and file=?);",
+			v.path, v.date, fileID).Scan(&exists); err != nil {
+			return false, fs.dbError(err)
+		}
+		if exists {
+			return false, nil
+		}
+	}
+	infoID, err := fs.internInfo(tx, v.info)
+	if err != nil {
+		return false, err
+	}
+	uuid, err := fs.importedUUID(tx, v.uuid)
+	if err != nil {
+		return false, err
+	}
+	result, err := tx.Exec("insert into Versions(path, info_id, version, date, file, uuid, mode, mtime) values(?, ?, ?, ?, ?, ?, ?, ?);",
+		v.path, infoID, v.version, v.date, fileID, uuid, v.mode, v.mtime)
+	if err != nil {
+		return false, fs.dbError(err)
+	}
+	versionID, err := result.LastInsertId()
+	if err != nil {
+		return false, fs.dbError(err)
+	}
+	// signatures cover the checksum, path and date, which are unchanged
+	if v.signature != nil {
+		if _, err := tx.Exec("insert into Signatures(version, signature) values(?, ?);", versionID, v.signature); err != nil {
+			return false, fs.dbError(err)
+		}
+	}
+	if err := fs.insertXattrs(tx, versionID, v.xattrs); err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+// Fetch stores the contents of a version pulled from another filestore with PullMetadata, so that
+// they are available when that filestore is not. Contents are fetched automatically when they are
+// first read or restored, so Fetch is only needed to make them available in advance. Nothing
+// is done if the contents are available already.
+func (fs *Filestore) Fetch(version FileVersion) (err error) {
+	op := newOp("Fetch", version.Path)
+	op.checksum = version.Checksum
+	defer op.done(&err)
+	if err := fs.ensureOpen(); err != nil {
+		return err
+	}
+	return fs.fetch(version.Checksum)
+}
+
+// FetchAll fetches the contents of all versions pulled from other filestores that have not been
+// fetched yet, like Fetch, and returns the number of contents fetched. If fetching fails, the
+// number fetched until then is returned with the error.
+func (fs *Filestore) FetchAll() (_ int, err error) {
+	op := newOp("FetchAll", fs.Dir)
+	defer op.done(&err)
+	if err := fs.ensureOpen(); err != nil {
+		return 0, err
+	}
+	rows, err := fs.db.Query("select checksum from Files where origin is not null order by file_id;")
+	if err != nil {
+		return 0, fs.dbError(err)
+	}
+	var checksums []string
+	for rows.Next() {
+		var checksum string
+		if err := rows.Scan(&checksum); err != nil {
+			rows.Close()
+			return 0, fs.dbError(err)
+		}
+		checksums = append(checksums, checksum)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return 0, fs.dbError(err)
+	}
+	for i, checksum := range checksums {
+		if err := fs.fetch(checksum); err != nil {
+			return i, err
+		}
+	}
+	return len(checksums), nil
+}
+
+// fetch stores the contents with the given checksum if they have been pulled with PullMetadata
+// and not been fetched from the filestore they were pulled from yet. Otherwise, it does nothing.
+// ErrNotFetched is returned if the filestore is read-only.
+func (fs *Filestore) fetch(checksum string) error {
+	var origin sql.NullString
+	if err := fs.db.QueryRow("select origin from Files where checksum=?;", checksum).Scan(&origin); err != nil || !origin.Valid {
+		// unknown contents are reported by the caller
+		return nil
+	}
+	fs.fetchMutex.Lock()
+	defer fs.fetchMutex.Unlock()
+	var fileID, size int64
+	var hashName, name string
+	err := fs.db.QueryRow("select file_id, hash, size, origin, coalesce(path, ?) from Files left join Versions on Versions.file=Files.file_id where checksum=? limit 1;",
+		encryptedBlobName, checksum).Scan(&fileID, &hashName, &size, &origin, &name)
+	if err != nil {
+		return fs.dbError(err)
+	}
+	if !origin.Valid {
+		// fetched while waiting for the lock
+		return nil
+	}
+	if flags.Has(fs.Options, ReadOnly) {
+		return ErrNotFetched
+	}
+	if err := fs.makeRoom(size); err != nil {
+		return err
+	}
+	unlock, err := fs.lockBlobs()
+	if err != nil {
+		return err
+	}
+	defer unlock()
+	tmp, err := os.MkdirTemp(fs.tempDir(), "fetch-")
+	if err != nil {
+		return err
+	}
+	defer os.RemoveAll(tmp)
+	path := filepath.Join(tmp, filepath.Base(filepath.FromSlash(name)))
+	if err := fs.fetchFile(origin.String, checksum, hashName, path); err != nil {
+		return fmt.Errorf("filestore failed to fetch contents from %s: %w", origin.String, err)
+	}
+	if err := fs.checkQuota(nil, path); err != nil {
+		return err
+	}
+	tx, err := fs.db.Begin()
+	if err != nil {
+		return fs.dbError(err)
+	}
+	tracker := fs.newProgress("Fetch", name, path, 1)
+	created, err := fs.localizeFile(tx, fileID, path, checksum, tracker)
+	if err != nil {
+		tx.Rollback()
+		fs.removeFiles(created)
+		return err
+	}
+	if err := tx.Commit(); err != nil {
+		fs.removeFiles(created)
+		return fs.dbError(err)
+	}
+	tracker.finish()
+	return nil
+}
+
+// fetchFile copies the contents with the given checksum from the filestore in the directory
+// origin to the file at path, checking them against the checksum with the hash algorithm of
+// the given name.
+func (fs *Filestore) fetchFile(origin, checksum, hashName, path string) error {
+	remote := &Filestore{Dir: origin, Options: ReadOnly, Key: fs.Key}
+	if err := remote.Open(); err != nil {
+		return err
+	}
+	defer remote.Close()
+	r, err := remote.openBlob(FileVersion{Checksum: checksum})
+	if err != nil {
+		return err
+	}
+	defer r.Close()
+	hasher, err := newHash(hashName)
+	if err != nil {
+		return err
+	}
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(io.MultiWriter(f, hasher), r); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+	if hex.EncodeToString(hasher.Sum(nil)) != checksum {
+		return ErrChecksumMismatch
+	}
+	return nil
+}
+
+// localizeFile stores the file at path with the given checksum as the contents of the file entry
+// with the given ID, which has been pulled from another filestore, within tx if it is not nil. It returns the
+// paths of the files created.
+func (fs *Filestore) localizeFile(tx *sql.Tx, fileID int64, path, checksum string, tracker *progressTracker) ([]string, error) {
+	sc, created, err := fs.storeContents(tx, path, checksum, tracker)
+	if err != nil {
+		return created, err
+	}
+	var q querier = fs.db
+	if tx != nil {
+		q = tx
+	}
+	if _, err := q.Exec("update Files set codec=?, sealed_key=?, size=?, stored=?, chunked=?, origin=null where file_id=?;",
+		sc.codec.name, sc.codec.sealedKey, sc.size, sc.stored, sc.chunks != nil, fileID); err != nil {
+		return created, fs.dbError(err)
+	}
+	if sc.chunks != nil {
+		if err := fs.insertFileChunks(tx, fileID, sc.chunks); err != nil {
+			return created, err
+		}
+	}
+	return created, nil
+}
@@ -0,0 +1,106 @@
+package filestore
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestPullMetadata(t *testing.T) {
+	remote, src := openTestStore(t, NewFilestore(filepath.Join(t.TempDir(), "remote"), Compress))
+	path := filepath.Join(src, "report.txt")
+	original := addFile(t, remote, path, "quarterly numbers", "finance report", "1")
+	fs, _ := openTestStore(t, NewFilestore(filepath.Join(t.TempDir(), "store"), Chunked))
+	if n, err := fs.PullMetadata(remote); err != nil || n != 1 {
+		t.Fatalf("PullMetadata = %d, %v, want 1 version", n, err)
+	}
+	// versions pulled before are skipped
+	if n, err := fs.PullMetadata(remote); err != nil || n != 0 {
+		t.Fatalf("PullMetadata again = %d, %v, want no versions", n, err)
+	}
+	v, err := fs.Get(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !v.From.Equal(original.From) || v.Checksum != original.Checksum || v.Info != original.Info {
+		t.Fatalf("pulled version %+v, want the metadata of %+v", v, original)
+	}
+	if report, err := fs.Verify(VerifyOptions{}); err != nil || !report.OK() {
+		t.Fatalf("Verify = %v, %v before fetching the contents", report.Problems, err)
+	}
+	// contents are fetched from the origin when they are first read
+	dst := t.TempDir()
+	if err := fs.Restore(v, dst); err != nil {
+		t.Fatal(err)
+	}
+	if got := readFile(t, filepath.Join(dst, "report.txt")); got != "quarterly numbers" {
+		t.Fatalf("restored %q, want the contents of the origin", got)
+	}
+	if report, err := fs.Verify(VerifyOptions{}); err != nil || !report.OK() || report.Contents != 1 {
+		t.Fatalf("Verify = %+v, %v, want the fetched contents", report, err)
+	}
+	entries, err := os.ReadDir(fs.Root())
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, e := range entries {
+		if strings.HasPrefix(e.Name(), "fetch-") {
+			t.Fatalf("temporary directory %s left after fetching", e.Name())
+		}
+	}
+	// adding pulled contents locally stores them, so they no longer depend on the origin
+	memo := filepath.Join(src, "memo.txt")
+	addFile(t, remote, memo, "memo", "memo", "1")
+	if n, err := fs.PullMetadata(remote); err != nil || n != 1 {
+		t.Fatalf("PullMetadata = %d, %v, want the new version", n, err)
+	}
+	if err := fs.Add(memo, "local memo", "2"); err != nil {
+		t.Fatal(err)
+	}
+	if err := remote.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.RemoveAll(remote.Dir); err != nil {
+		t.Fatal(err)
+	}
+	if v, err = fs.Get(memo); err != nil {
+		t.Fatal(err)
+	}
+	r, err := fs.OpenVersion(v)
+	if err != nil {
+		t.Fatal(err)
+	}
+	r.Close()
+}
+
+func TestFetch(t *testing.T) {
+	remote, src := newTestStore(t)
+	for _, name := range []string{"a", "b", "c"} {
+		addFile(t, remote, filepath.Join(src, name), name+name, name, "1")
+	}
+	fs := NewFilestore(filepath.Join(t.TempDir(), "store"), 0)
+	fs.CacheDir = filepath.Join(t.TempDir(), "cache")
+	fs.CacheSize = 1 << 20
+	openTestStore(t, fs)
+	if _, err := fs.PullMetadata(remote); err != nil {
+		t.Fatal(err)
+	}
+	path := filepath.Join(src, "a")
+	v, err := fs.Get(path)
+	if err != nil || v.Available {
+		t.Fatalf("Get = %+v, %v, want a version whose contents are not available yet", v, err)
+	}
+	if err := fs.Fetch(v); err != nil {
+		t.Fatal(err)
+	}
+	if v, err = fs.Get(path); err != nil || !v.Available {
+		t.Fatalf("Get = %+v, %v, want a version whose contents are available after fetching", v, err)
+	}
+	if n, err := fs.FetchAll(); err != nil || n != 2 {
+		t.Fatalf("FetchAll = %d, %v, want the contents of the other 2 versions", n, err)
+	}
+	if versions, err := fs.Versions(filepath.Join(src, "c"), -1); err != nil || len(versions) != 1 || !versions[0].Available {
+		t.Fatalf("Versions = %+v, %v, want an available version", versions, err)
+	}
+}
@@ -0,0 +1,196 @@
+package filestore
+
+import (
+	"strings"
+	"time"
+)
+
+// VersionQuery is a composable query for versions, which is built by chaining its methods to the
+// result of Query and run by Find. Each method returns a new query and leaves the one it is called
+// on unchanged, so that a common base query can be refined in different ways. For example,
+//
+//	Query().PathPrefix("/home/ann/docs/").After(t).InfoContains("invoice").VersionAtLeast("2.0").Limit(50)
+//
+// selects at most 50 versions of files below /home/ann/docs added after t whose info strings
+// contain "invoice" and whose version strings are at least 2.0.
+type VersionQuery struct {
+	filter     Filter
+	minVersion string
+	latest     bool
+	bySemver   bool
+	limit      int
+}
+
+// Query returns a query matching all versions, which is refined by the methods of VersionQuery.
+func Query() VersionQuery {
+	return VersionQuery{limit: -1}
+}
+
+// PathPrefix restricts the query to versions whose path starts with prefix. The prefix is
+// compared with the paths as they were added, so it must be absolute if files are added by
+// absolute paths.
+func (q VersionQuery) PathPrefix(prefix string) VersionQuery {
+	q.filter.PathPrefix = prefix
+	return q
+}
+
+// InfoContains restricts the query to versions whose info string contains s.
+func (q VersionQuery) InfoContains(s string) VersionQuery {
+	q.filter.Info = s
+	return q
+}
+
+// Version restricts the query to versions with exactly the version string v.
+func (q VersionQuery) Version(v string) VersionQuery {
+	q.filter.Version = v
+	return q
+}
+
+// VersionAtLeast restricts the query to versions whose version string is v or a later version
+// than v. Semantic versions are compared by their precedence, and other version strings by their
+// runs of digits as numbers and by the remaining characters as strings, so that "2.10" is later
+// than "2.9".
+func (q VersionQuery) VersionAtLeast(v string) VersionQuery {
+	q.minVersion = v
+	return q
+}
+
+// After restricts the query to versions added after t.
+func (q VersionQuery) After(t time.Time) VersionQuery {
+	q.filter.After = t
+	return q
+}
+
+// Before restricts the query to versions added before t.
+func (q VersionQuery) Before(t time.Time) VersionQuery {
+	q.filter.Before = t
+	return q
+}
+
+// Tagged restricts the query to versions that have all of the given tags, in addition to the
+// tags given before.
+func (q VersionQuery) Tagged(tags ...string) VersionQuery {
+	q.filter.Tags = append(append([]string(nil), q.filter.Tags...), tags...)
+	return q
+}
+
+// Latest restricts the query to the latest version of every file. The other restrictions apply
+// to the latest versions, so files whose latest version does not match are left out.
+func (q VersionQuery) Latest() VersionQuery {
+	q.latest = true
+	return q
+}
+
+// OrderBySemver returns the versions of the query from the highest to the lowest semantic
+// version instead of the latest first, followed by the versions whose version strings are no
+// semantic versions. Versions with equal version strings are returned latest first.
+func (q VersionQuery) OrderBySemver() VersionQuery {
+	q.bySemver = true
+	return q
+}
+
+// Limit returns at most n versions from the query, all of them if n is negative.
+func (q VersionQuery) Limit(n int) VersionQuery {
+	q.limit = n
+	return q
+}
+
+// Find returns the versions matching the query, latest first unless ordered by OrderBySemver.
+func (fs *Filestore) Find(query VersionQuery) (_ []FileVersion, err error) {
+	op := newOp("Find", query.filter.PathPrefix)
+	defer op.done(&err)
+	if err := fs.ensureOpen(); err != nil {
+		return nil, err
+	}
+	return fs.find(fs.db, query)
+}
+
+func (fs *Filestore) find(q querier, query VersionQuery) ([]FileVersion, error) {
+	cond, args := query.filter.where(fs)
+	if query.latest {
+		cond += " and version_id=(select version_id from Versions as V where V.path=VersionsText.path order by date desc, version_id desc limit 1)"
+	}
+	limit := query.limit
+	if query.minVersion != "" || query.bySemver {
+		// the versions are compared after the query, which must not limit the results then
+		limit = -1
+	}
+	rows, err := q.Query(selectVersions+" where version_id in (select version_id from VersionsText where "+cond+") order by Versions.date desc, version_id desc limit ?;",
+		append(args, limit)...)
+	if err != nil {
+		return nil, fs.dbError(err)
+	}
+	versions, err := fs.getVersions(rows)
+	if err != nil {
+		return nil, err
+	}
+	if query.minVersion != "" {
+		matching := make([]FileVersion, 0, len(versions))
+		for _, v := range versions {
+			if compareVersions(v.Version, query.minVersion) >= 0 {
+				matching = append(matching, v)
+			}
+		}
+		versions = matching
+	}
+	if query.bySemver {
+		sortBySemver(versions)
+	}
+	if query.limit >= 0 && len(versions) > query.limit {
+		versions = versions[:query.limit]
+	}
+	return versions, nil
+}
+
+// compareVersions compares the version strings a and b and returns -1 if a is an earlier version
+// than b, 1 if it is a later one and 0 if they are equal. Semantic versions are compared by their
+// precedence. Otherwise, runs of digits are compared as numbers and the other characters as
+// strings, so that "2.10" is later than "2.9".
+func compareVersions(a, b string) int {
+	if v, ok := parseSemver(a); ok {
+		if w, ok := parseSemver(b); ok {
+			return v.compare(w)
+		}
+	}
+	for a != "" && b != "" {
+		var x, y string
+		x, a = versionPart(a)
+		y, b = versionPart(b)
+		if isDigit(x[0]) && isDigit(y[0]) {
+			x, y = strings.TrimLeft(x, "0"), strings.TrimLeft(y, "0")
+			if len(x) != len(y) {
+				if len(x) < len(y) {
+					return -1
+				}
+				return 1
+			}
+		}
+		if c := strings.Compare(x, y); c != 0 {
+			return c
+		}
+	}
+	switch {
+	case a == b:
+		return 0
+	case a == "":
+		return -1
+	default:
+		return 1
+	}
+}
+
+// versionPart splits the leading run of digits or non-digits off the version string v, which
+// must not be empty.
+func versionPart(v string) (string, string) {
+	digits := isDigit(v[0])
+	i := 1
+	for i < len(v) && isDigit(v[i]) == digits {
+		i++
+	}
+	return v[:i], v[i:]
+}
+
+// isDigit returns true if c is an ASCII digit.
+func isDigit(c byte) bool {
+	return c >= '0' && c <= '9'
+}
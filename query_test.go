@@ -0,0 +1,64 @@
+package filestore
+
+import (
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestFind(t *testing.T) {
+	fs, src := newTestStore(t)
+	add := func(rel, info, version string) {
+		addFile(t, fs, filepath.Join(src, filepath.FromSlash(rel)), info+version, info, version)
+	}
+	start := time.Now().Add(-time.Minute)
+	add("docs/a.txt", "invoice march", "1.9")
+	add("docs/a.txt", "invoice april", "2.0")
+	add("docs/b.txt", "invoice may", "2.10")
+	add("docs/c.txt", "letter", "3.0")
+	add("other/d.txt", "invoice", "5")
+	if _, err := fs.TagWhere(Filter{Version: "3.0"}, "x", "y"); err != nil {
+		t.Fatal(err)
+	}
+	docs := Query().PathPrefix(filepath.Join(src, "docs") + string(filepath.Separator))
+	for _, c := range []struct {
+		name  string
+		query VersionQuery
+		want  int
+	}{
+		{"path prefix", docs, 4},
+		{"info", docs.InfoContains("invoice"), 3},
+		{"version at least 2.0", docs.InfoContains("invoice").VersionAtLeast("2.0"), 2},
+		{"version at least 2.9", docs.InfoContains("invoice").VersionAtLeast("2.9"), 1},
+		{"limit", docs.InfoContains("invoice").VersionAtLeast("2.0").Limit(1), 1},
+		{"after", docs.After(start), 4},
+		{"before", docs.Before(start), 0},
+		{"latest", docs.Latest(), 3},
+		{"all", Query(), 5},
+		{"version", Query().Version("5"), 1},
+		{"tags", Query().Tagged("x").Tagged("y"), 1},
+		{"tags of one call", Query().Tagged("x", "z"), 0},
+	} {
+		if versions, err := fs.Find(c.query); err != nil || len(versions) != c.want {
+			t.Fatalf("Find of %s = %v, %v, want %d versions", c.name, versions, err, c.want)
+		}
+	}
+}
+
+func TestCompareVersions(t *testing.T) {
+	for _, c := range []struct {
+		a, b string
+		want int
+	}{
+		{"2.10", "2.9", 1},
+		{"1.0", "1.0", 0},
+		{"1.0", "1.0.1", -1},
+		{"01", "1", 0},
+		{"1.0a", "1.0b", -1},
+		{"", "1", -1},
+	} {
+		if got := compareVersions(c.a, c.b); got != c.want {
+			t.Fatalf("compareVersions(%q, %q) = %d, want %d", c.a, c.b, got, c.want)
+		}
+	}
+}
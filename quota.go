@@ -0,0 +1,171 @@
+package filestore
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/rasteric/flags"
+)
+
+var ErrQuotaExceeded = errors.New("filestore quota exceeded")
+
+// DefaultQuotaWarnings are the fractions of the Quota at which EventQuotaWarning is emitted if
+// the QuotaWarnings of a filestore are nil.
+var DefaultQuotaWarnings = []float64{0.8, 0.9}
+
+// storedBytes returns the number of bytes taken on disk by blobs and chunks.
+func (fs *Filestore) storedBytes(q querier) (int64, error) {
+	var stored int64
+	// the stored sizes of chunked contents only count the chunks they added, which may be shared
+	err := q.QueryRow("select (select coalesce(sum(stored), 0) from Files where chunked=0 and origin is null) + (select coalesce(sum(stored), 0) from Chunks);").Scan(&stored)
+	if err != nil {
+		return 0, fs.dbError(err)
+	}
+	return stored, nil
+}
+
+// checkQuota returns an error wrapping ErrQuotaExceeded if storing the file at path would make
+// the filestore exceed its Quota, counting the full size of the file since the size after
+// compression and deduplication is not known in advance.
+func (fs *Filestore) checkQuota(tx *sql.Tx, path string) error {
+	if fs.Quota <= 0 {
+		return nil
+	}
+	info, err := os.Stat(path)
+	if err != nil {
+		return err
+	}
+	var q querier = fs.db
+	if tx != nil {
+		q = tx
+	}
+	used, err := fs.storedBytes(q)
+	if err != nil {
+		return err
+	}
+	if used+info.Size() <= fs.Quota {
+		return nil
+	}
+	return fmt.Errorf("filestore would take %d bytes with the quota of %d bytes: %w", used+info.Size(), fs.Quota, ErrQuotaExceeded)
+}
+
+// makeRoom prunes versions to make room for size more bytes if the filestore has the PruneOnQuota
+// option and would exceed its Quota otherwise. It is called before the lock of the blobs is
+// acquired, since pruning acquires it and emits events to hooks, which may use the filestore.
+func (fs *Filestore) makeRoom(size int64) error {
+	if fs.Quota <= 0 || !flags.Has(fs.Options, PruneOnQuota) {
+		return nil
+	}
+	used, err := fs.storedBytes(fs.db)
+	if err != nil || used+size <= fs.Quota {
+		return err
+	}
+	_, err = fs.pruneForQuota(fs.Quota - size)
+	return err
+}
+
+// makeRoomFor calls makeRoom for the file at path with the given checksum unless its contents
+// are stored already.
+func (fs *Filestore) makeRoomFor(path, check string) error {
+	if fs.Quota <= 0 || !flags.Has(fs.Options, PruneOnQuota) {
+		return nil
+	}
+	var stored bool
+	if err := fs.db.QueryRow("select exists (select 1 from Files where checksum=? and origin is null);", check).Scan(&stored); err != nil {
+		return fs.dbError(err)
+	}
+	if stored {
+		return nil
+	}
+	info, err := os.Stat(path)
+	if err != nil {
+		return err
+	}
+	return fs.makeRoom(info.Size())
+}
+
+// warnQuota emits an EventQuotaWarning if the filestore takes more than a warning threshold of
+// its Quota and did not the last time it was checked, so that users can be asked to prune before
+// adding files fails. A threshold is warned about again after usage has dropped below it.
+func (fs *Filestore) warnQuota() {
+	if fs.Quota <= 0 || !fs.hasHooks() {
+		return
+	}
+	used, err := fs.storedBytes(fs.db)
+	if err != nil {
+		return
+	}
+	thresholds := fs.QuotaWarnings
+	if thresholds == nil {
+		thresholds = DefaultQuotaWarnings
+	}
+	level := 0.0
+	for _, threshold := range thresholds {
+		if threshold > level && float64(used) >= threshold*float64(fs.Quota) {
+			level = threshold
+		}
+	}
+	fs.hooksMutex.Lock()
+	warned := fs.quotaWarned
+	fs.quotaWarned = level
+	fs.hooksMutex.Unlock()
+	if level > warned {
+		fs.emit(Event{Kind: EventQuotaWarning, Date: time.Now(), Used: used, Threshold: level})
+	}
+}
+
+// pruneForQuota prunes versions according to the retention policy and, if the filestore still
+// takes more than limit bytes, deletes the oldest versions that are neither pinned nor the latest
+// version of their file until it takes at most limit bytes or no such versions are left. It
+// returns the number of bytes taken afterwards.
+func (fs *Filestore) pruneForQuota(limit int64) (int64, error) {
+	if _, err := fs.prune(""); err != nil {
+		return 0, err
+	}
+	used, err := fs.storedBytes(fs.db)
+	if err != nil || used <= limit {
+		return used, err
+	}
+	tx, err := fs.begin()
+	if err != nil {
+		return 0, err
+	}
+	rows, err := tx.tx.Query(selectVersions + " where version_id not in (select version from Pins) order by date, version_id;")
+	if err != nil {
+		tx.rollback()
+		return 0, fs.dbError(err)
+	}
+	versions, err := fs.getVersions(rows)
+	if err != nil {
+		tx.rollback()
+		return 0, err
+	}
+	latest, err := fs.latestVersionIDs(tx.tx)
+	if err != nil {
+		tx.rollback()
+		return 0, err
+	}
+	for _, v := range versions {
+		if used <= limit {
+			break
+		}
+		if latest[v.ID] {
+			continue
+		}
+		if err := tx.deleteVersion(v); err != nil {
+			tx.rollback()
+			return 0, err
+		}
+		if used, err = fs.storedBytes(tx.tx); err != nil {
+			tx.rollback()
+			return 0, err
+		}
+	}
+	if err := tx.commit(); err != nil {
+		return 0, err
+	}
+	return used, nil
+}
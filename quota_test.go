@@ -0,0 +1,79 @@
+package filestore
+
+import (
+	"errors"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestQuota(t *testing.T) {
+	fs, src := newTestStore(t)
+	fs.Quota = 25
+	path := filepath.Join(src, "a.txt")
+	addFile(t, fs, path, "0123456789", "a", "1")
+	addFile(t, fs, path, "0123456789a", "a", "2")
+	writeFile(t, path, "0123456789ab")
+	if err := fs.Add(path, "a", "3"); !errors.Is(err, ErrQuotaExceeded) {
+		t.Fatalf("Add beyond the quota = %v, want ErrQuotaExceeded", err)
+	}
+	// with PruneOnQuota, the oldest versions make room for the new one
+	fs.Options |= PruneOnQuota
+	if err := fs.Add(path, "a", "3"); err != nil {
+		t.Fatal(err)
+	}
+	versions, err := fs.Versions(path, -1)
+	if err != nil || len(versions) != 2 || versions[0].Version != "3" || versions[1].Version != "2" {
+		t.Fatalf("Versions = %v, %v, want versions 3 and 2", versions, err)
+	}
+	if s, err := fs.Stats(); err != nil || s.StoredBytes != 23 {
+		t.Fatalf("Stats = %+v, %v, want 23 stored bytes", s, err)
+	}
+}
+
+func TestQuotaWarnings(t *testing.T) {
+	fs, src := newTestStore(t)
+	fs.Quota = 1000
+	var events []Event
+	fs.AddHook(func(e Event) {
+		if e.Kind == EventQuotaWarning {
+			events = append(events, e)
+		}
+	})
+	add := func(name string, n int) {
+		addFile(t, fs, filepath.Join(src, name), strings.Repeat(name, n), name, "1")
+	}
+	add("a", 500)
+	if len(events) != 0 {
+		t.Fatalf("events = %v below the thresholds, want none", events)
+	}
+	add("b", 320)
+	if len(events) != 1 || events[0].Threshold != 0.8 || events[0].Used != 820 {
+		t.Fatalf("events = %v, want a warning at 80%%", events)
+	}
+	// each threshold is only crossed once
+	add("c", 10)
+	if len(events) != 1 {
+		t.Fatalf("events = %v, want no second warning at 80%%", events)
+	}
+	add("d", 80)
+	if len(events) != 2 || events[1].Threshold != 0.9 || events[1].Kind.String() != "quota-warning" {
+		t.Fatalf("events = %v, want a warning at 90%%", events)
+	}
+	// until the usage has dropped below it
+	v, err := fs.Get(filepath.Join(src, "a"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := fs.DeleteVersion(v); err != nil {
+		t.Fatal(err)
+	}
+	add("e", 10)
+	if len(events) != 2 {
+		t.Fatalf("events = %v below the thresholds, want no new warning", events)
+	}
+	add("f", 500)
+	if len(events) != 3 || events[2].Threshold != 0.9 {
+		t.Fatalf("events = %v, want a single warning at 90%%", events)
+	}
+}
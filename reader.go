@@ -0,0 +1,305 @@
+package filestore
+
+import (
+	"errors"
+	"io"
+	"os"
+	"sync"
+)
+
+var ErrInvalidSeek = errors.New("filestore reader seek to negative position")
+
+// VersionReader provides sequential and random access to the contents of a version. Compressed
+// contents are decompressed on the fly in segments, which are kept in the segment cache of the
+// filestore so that repeated random access does not decompress the same data again.
+type VersionReader struct {
+	fs        *Filestore
+	checksum  string
+	file      *os.File      // the blob
+	temp      string        // the path of file if it is a temporary copy of the blob, removed on Close
+	codec     codec         // the codec of the blob
+	chunks    []chunkRef    // the chunks of the contents if they are stored in chunks, otherwise nil
+	offset    int64         // the offset for Read and Seek
+	dec       io.ReadCloser // decompresses the blob sequentially, nil if not started
+	decPos    int64         // the position of dec in the decompressed data
+	last      []byte        // the most recently decompressed segment
+	lastIndex int64         // the index of the segment in last, -1 if none
+	mutex     sync.Mutex
+}
+
+// RestoreTo writes the contents of the given version to w, decompressing them if necessary.
+func (fs *Filestore) RestoreTo(version FileVersion, w io.Writer) (err error) {
+	op := newOp("RestoreTo", version.Path)
+	op.checksum = version.Checksum
+	defer op.done(&err)
+	if err := fs.ensureOpen(); err != nil {
+		return err
+	}
+	r, err := fs.openBlob(version)
+	if err != nil {
+		return err
+	}
+	defer r.Close()
+	_, err = io.Copy(w, r)
+	return err
+}
+
+// OpenVersion returns a reader of the contents of the given version, which are decompressed if
+// necessary. The reader must be closed after use.
+func (fs *Filestore) OpenVersion(version FileVersion) (_ io.ReadCloser, err error) {
+	op := newOp("OpenVersion", version.Path)
+	op.checksum = version.Checksum
+	defer op.done(&err)
+	if err := fs.ensureOpen(); err != nil {
+		return nil, err
+	}
+	return fs.openBlob(version)
+}
+
+// openBlob returns a reader of the decompressed contents of the given version, preferring
+// a copy in the cache directory if there is one.
+func (fs *Filestore) openBlob(version FileVersion) (io.ReadCloser, error) {
+	if err := fs.fetch(version.Checksum); err != nil {
+		return nil, err
+	}
+	if fs.cache != nil {
+		if cached, ok := fs.cache.lookup(version.Checksum); ok {
+			if f, err := os.Open(cached); err == nil {
+				return f, nil
+			}
+		}
+	}
+	chunks, err := fs.chunkList(fs.db, version.Checksum)
+	if err != nil {
+		return nil, err
+	}
+	if chunks != nil {
+		return &chunkReader{fs: fs, chunks: chunks}, nil
+	}
+	c, err := fs.blobCodec(fs.db, version.Checksum)
+	if err != nil {
+		return nil, err
+	}
+	return fs.openBlobFile(version.Name, version.Checksum, c)
+}
+
+// openBlobFile returns a reader of the decompressed contents of the blob with the given name
+// and checksum stored with codec c, which must not be stored in chunks.
+func (fs *Filestore) openBlobFile(name, checksum string, c codec) (io.ReadCloser, error) {
+	f, err := fs.openStored(fs.blobFile(name, checksum, c))
+	if err != nil {
+		return nil, err
+	}
+	if c.plain() {
+		return f, nil
+	}
+	dec, err := c.reader(f)
+	if err != nil {
+		f.Close()
+		return nil, err
+	}
+	return &decompressingReader{ReadCloser: dec, file: f}, nil
+}
+
+// decompressingReader reads decompressed data from a compressed file and closes the file.
+type decompressingReader struct {
+	io.ReadCloser
+	file io.Closer
+}
+
+// Close closes the decompressor and the underlying file.
+func (r *decompressingReader) Close() error {
+	r.ReadCloser.Close()
+	return r.file.Close()
+}
+
+// OpenSeekable returns a reader with random access to the contents of the given version, which
+// must be closed after use.
+func (fs *Filestore) OpenSeekable(version FileVersion) (_ *VersionReader, err error) {
+	op := newOp("OpenSeekable", version.Path)
+	op.checksum = version.Checksum
+	defer op.done(&err)
+	if err := fs.ensureOpen(); err != nil {
+		return nil, err
+	}
+	return fs.openSeekable(version)
+}
+
+func (fs *Filestore) openSeekable(version FileVersion) (*VersionReader, error) {
+	if err := fs.fetch(version.Checksum); err != nil {
+		return nil, err
+	}
+	chunks, err := fs.chunkList(fs.db, version.Checksum)
+	if err != nil {
+		return nil, err
+	}
+	if chunks != nil {
+		return &VersionReader{fs: fs, checksum: version.Checksum, chunks: chunks, lastIndex: -1}, nil
+	}
+	c, err := fs.blobCodec(fs.db, version.Checksum)
+	if err != nil {
+		return nil, err
+	}
+	f, temp, err := fs.seekableStored(fs.blobFile(version.Name, version.Checksum, c))
+	if err != nil {
+		return nil, err
+	}
+	return &VersionReader{fs: fs, checksum: version.Checksum, file: f, temp: temp, codec: c, lastIndex: -1}, nil
+}
+
+// Read reads up to len(p) bytes from the current offset.
+func (r *VersionReader) Read(p []byte) (int, error) {
+	n, err := r.ReadAt(p, r.offset)
+	r.offset += int64(n)
+	if err == io.EOF && n > 0 {
+		err = nil
+	}
+	return n, err
+}
+
+// Seek sets the offset for the next Read, interpreted according to whence as in io.Seeker.
+func (r *VersionReader) Seek(offset int64, whence int) (int64, error) {
+	switch whence {
+	case io.SeekCurrent:
+		offset += r.offset
+	case io.SeekEnd:
+		size, err := r.Size()
+		if err != nil {
+			return r.offset, err
+		}
+		offset += size
+	}
+	if offset < 0 {
+		return r.offset, ErrInvalidSeek
+	}
+	r.offset = offset
+	return offset, nil
+}
+
+// ReadAt reads len(p) bytes starting at offset off of the contents, as in io.ReaderAt.
+func (r *VersionReader) ReadAt(p []byte, off int64) (int, error) {
+	if r.chunks != nil {
+		if off < 0 {
+			return 0, ErrInvalidSeek
+		}
+		return r.fs.readChunksAt(r.chunks, p, off)
+	}
+	if r.codec.plain() {
+		return r.file.ReadAt(p, off)
+	}
+	if off < 0 {
+		return 0, ErrInvalidSeek
+	}
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	n := 0
+	for n < len(p) {
+		segment, err := r.segment(off / segmentSize)
+		if err != nil {
+			return n, err
+		}
+		start := int(off % segmentSize)
+		if start >= len(segment) {
+			return n, io.EOF
+		}
+		m := copy(p[n:], segment[start:])
+		n += m
+		off += int64(m)
+	}
+	return n, nil
+}
+
+// Size returns the size of the decompressed contents.
+func (r *VersionReader) Size() (int64, error) {
+	if r.chunks != nil {
+		if len(r.chunks) == 0 {
+			return 0, nil
+		}
+		last := r.chunks[len(r.chunks)-1]
+		return last.offset + last.size, nil
+	}
+	if r.codec.plain() {
+		info, err := r.file.Stat()
+		if err != nil {
+			return 0, err
+		}
+		return info.Size(), nil
+	}
+	if size, ok := r.fs.segmentCache().blobSize(r.checksum); ok {
+		return size, nil
+	}
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	for index := r.decPos / segmentSize; ; index++ {
+		segment, err := r.segment(index)
+		if err != nil {
+			return 0, err
+		}
+		if len(segment) < segmentSize {
+			return index*segmentSize + int64(len(segment)), nil
+		}
+	}
+}
+
+// Close closes the reader.
+func (r *VersionReader) Close() error {
+	if r.file == nil {
+		return nil
+	}
+	if r.dec != nil {
+		r.dec.Close()
+	}
+	err := r.file.Close()
+	if r.temp != "" {
+		os.Remove(r.temp)
+	}
+	return err
+}
+
+// segment returns the decompressed segment with the given index, which is shorter than
+// segmentSize (possibly empty) at the end of the contents. The caller must hold the mutex.
+func (r *VersionReader) segment(index int64) ([]byte, error) {
+	if index == r.lastIndex {
+		return r.last, nil
+	}
+	cache := r.fs.segmentCache()
+	key := segmentKey{checksum: r.checksum, index: index}
+	if data, ok := cache.get(key); ok {
+		return data, nil
+	}
+	if r.dec == nil || r.decPos > index*segmentSize {
+		if _, err := r.file.Seek(0, io.SeekStart); err != nil {
+			return nil, err
+		}
+		if r.dec != nil {
+			r.dec.Close()
+		}
+		dec, err := r.codec.reader(r.file)
+		if err != nil {
+			r.dec = nil
+			return nil, err
+		}
+		r.dec, r.decPos = dec, 0
+	}
+	for {
+		data := make([]byte, segmentSize)
+		n, err := io.ReadFull(r.dec, data)
+		if err != nil && err != io.EOF && err != io.ErrUnexpectedEOF {
+			return nil, err
+		}
+		data = data[:n]
+		current := r.decPos / segmentSize
+		r.decPos += int64(n)
+		cache.put(segmentKey{checksum: r.checksum, index: current}, data)
+		r.last, r.lastIndex = data, current
+		if n < segmentSize {
+			cache.setBlobSize(r.checksum, r.decPos)
+			if current < index {
+				return nil, nil
+			}
+		}
+		if current == index {
+			return data, nil
+		}
+	}
+}
@@ -0,0 +1,115 @@
+package filestore
+
+import (
+	"bytes"
+	"io"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/rasteric/flags"
+)
+
+// testData returns n bytes that start with random bytes and continue with a repeating pattern,
+// so that they are partly compressible.
+func testData(n int) []byte {
+	data := make([]byte, n)
+	rand.New(rand.NewSource(1)).Read(data[:n/100])
+	for i := n / 100; i < n; i++ {
+		data[i] = byte(i % 251)
+	}
+	return data
+}
+
+func TestOpenSeekable(t *testing.T) {
+	for _, options := range []flags.Bits{0, Compress, Chunked} {
+		dir := t.TempDir()
+		fs := NewFilestore(filepath.Join(dir, "store"), options)
+		fs.SegmentCacheSize = 200 << 10
+		fs, src := openTestStore(t, fs)
+		data := testData(300000)
+		path := filepath.Join(src, "a.bin")
+		if err := os.WriteFile(path, data, 0644); err != nil {
+			t.Fatal(err)
+		}
+		if err := fs.Add(path, "", "1"); err != nil {
+			t.Fatal(err)
+		}
+		v, err := fs.Get(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		r, err := fs.OpenSeekable(v)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if all, err := io.ReadAll(r); err != nil || !bytes.Equal(all, data) {
+			t.Fatalf("read %d bytes, %v, want %d bytes", len(all), err, len(data))
+		}
+		for _, offset := range []int64{299990, 5, 65530, 131072, 200000} {
+			buf := make([]byte, 20)
+			n, err := r.ReadAt(buf, offset)
+			want := data[offset:]
+			if len(want) > len(buf) {
+				want = want[:len(buf)]
+			}
+			if !bytes.Equal(buf[:n], want) {
+				t.Fatalf("ReadAt(%d) = %d, %v with different data", offset, n, err)
+			}
+		}
+		if size, err := r.Size(); err != nil || size != int64(len(data)) {
+			t.Fatalf("Size = %d, %v, want %d", size, err, len(data))
+		}
+		offset, err := r.Seek(-10, io.SeekEnd)
+		if err != nil || offset != int64(len(data)-10) {
+			t.Fatalf("Seek = %d, %v, want %d", offset, err, len(data)-10)
+		}
+		if rest, err := io.ReadAll(r); err != nil || !bytes.Equal(rest, data[len(data)-10:]) {
+			t.Fatalf("read %v, %v after seeking", rest, err)
+		}
+		if err := r.Close(); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestRestoreTo(t *testing.T) {
+	for _, options := range []flags.Bits{0, Compress, Chunked} {
+		fs, src := openTestStore(t, NewFilestore(filepath.Join(t.TempDir(), "store"), options))
+		data := testData(100000)
+		path := filepath.Join(src, "a.bin")
+		if err := os.WriteFile(path, data, 0644); err != nil {
+			t.Fatal(err)
+		}
+		if err := fs.Add(path, "", "1"); err != nil {
+			t.Fatal(err)
+		}
+		v, err := fs.Get(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var buf bytes.Buffer
+		if err := fs.RestoreTo(v, &buf); err != nil || !bytes.Equal(buf.Bytes(), data) {
+			t.Fatalf("RestoreTo wrote %d bytes, %v, want %d bytes with options %v", buf.Len(), err, len(data), options)
+		}
+	}
+}
+
+func TestOpenVersion(t *testing.T) {
+	fs, src := openTestStore(t, NewFilestore(filepath.Join(t.TempDir(), "store"), Compress))
+	path := filepath.Join(src, "a.txt")
+	v := addFile(t, fs, path, "first", "", "1")
+	addFile(t, fs, path, "second", "", "2")
+	r, err := fs.OpenVersion(v)
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, err := io.ReadAll(r)
+	if err != nil || string(data) != "first" {
+		t.Fatalf("read %q, %v, want %q", data, err, "first")
+	}
+	if err := r.Close(); err != nil {
+		t.Fatal(err)
+	}
+}
@@ -0,0 +1,92 @@
+package filestore
+
+import (
+	"database/sql"
+	"fmt"
+	"path/filepath"
+	"strings"
+	"sync"
+)
+
+// registry holds the database handles of the filestores open in this process by the absolute path
+// of their database and the options it was opened with, so that filestores opened on the same
+// directory with the same options share them.
+var registry = struct {
+	sync.Mutex
+	dbs map[string]*sharedDB
+}{dbs: make(map[string]*sharedDB)}
+
+// sharedDB is a database handle shared by the filestores open on the same directory.
+type sharedDB struct {
+	db    *sql.DB
+	mutex *sync.RWMutex // synchronizes opening and closing the filestores
+	refs  int           // the number of open filestores using the database
+	holds int           // the number of running backups, during which deleted files are kept
+	held  []string      // the files of contents deleted while backups were running
+}
+
+// registryKey returns the key of the database of the filestore in the registry, which is its
+// data source name with the path made absolute and symbolic links resolved. The root directory
+// must exist unless the database is in memory.
+func (fs *Filestore) registryKey() (string, error) {
+	if fs.memory != "" {
+		return fs.dsn(), nil
+	}
+	root, err := filepath.Abs(fs.Root())
+	if err != nil {
+		return "", err
+	}
+	if root, err = filepath.EvalSymlinks(root); err != nil {
+		return "", err
+	}
+	return filepath.Join(root, filepath.Base(fs.dbPath())) + strings.TrimPrefix(fs.dsn(), fs.dbPath()), nil
+}
+
+// acquireDB sets the database handle and mutex of the filestore to those of another filestore open
+// on the same directory with the same options, or opens the database and calls init with it if
+// there is none. In both cases, the database must be released with releaseDB.
+func (fs *Filestore) acquireDB(init func() error) error {
+	key, err := fs.registryKey()
+	if err != nil {
+		return fmt.Errorf("filestore could not open root directory: %w", err)
+	}
+	registry.Lock()
+	defer registry.Unlock()
+	if shared, ok := registry.dbs[key]; ok {
+		shared.refs++
+		fs.db, fs.mutex, fs.dbKey = shared.db, shared.mutex, key
+		return nil
+	}
+	db, err := sql.Open(driverName, fs.dsn())
+	if err != nil {
+		return fmt.Errorf("filestore could not open the database: %w", err)
+	}
+	fs.db = db
+	if err := init(); err != nil {
+		db.Close()
+		fs.db = nil
+		return err
+	}
+	fs.mutex = &sync.RWMutex{}
+	registry.dbs[key] = &sharedDB{db: db, mutex: fs.mutex, refs: 1}
+	fs.dbKey = key
+	return nil
+}
+
+// releaseDB releases the database handle of the filestore and closes it unless other open
+// filestores still use it.
+func (fs *Filestore) releaseDB() error {
+	registry.Lock()
+	defer registry.Unlock()
+	key := fs.dbKey
+	shared, ok := registry.dbs[key]
+	if !ok || shared.db != fs.db {
+		return nil
+	}
+	fs.dbKey = ""
+	if shared.refs--; shared.refs > 0 {
+		return nil
+	}
+	delete(registry.dbs, key)
+	return shared.db.Close()
+}
@@ -0,0 +1,36 @@
+package filestore
+
+import (
+	"path/filepath"
+	"testing"
+)
+
+func TestRegistry(t *testing.T) {
+	fs, src := newTestStore(t)
+	key, err := fs.registryKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	other, _ := openTestStore(t, NewFilestore(fs.Dir, fs.Options))
+	if other.db != fs.db {
+		t.Fatal("filestores opened on the same directory do not share their database")
+	}
+	// filestores opened with other options have their own database
+	ro, _ := openTestStore(t, NewFilestore(fs.Dir, fs.Options|ReadOnly))
+	if ro.db == fs.db {
+		t.Fatal("read-only filestore shares the database of a writable one")
+	}
+	if err := other.Close(); err != nil {
+		t.Fatal(err)
+	}
+	addFile(t, fs, filepath.Join(src, "a.txt"), "a", "", "1")
+	if err := fs.Close(); err != nil {
+		t.Fatal(err)
+	}
+	registry.Lock()
+	_, ok := registry.dbs[key]
+	registry.Unlock()
+	if ok {
+		t.Fatal("database is still registered after closing all filestores using it")
+	}
+}
@@ -0,0 +1,256 @@
+package filestore
+
+import (
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// RepairOptions are the options of Repair.
+type RepairOptions struct {
+	Quick bool // only check that blobs and chunks exist instead of reading and hashing them
+	// DropMissing deletes the versions whose contents are missing, as well as versions referring
+	// to contents that are not in the database, which cannot be restored anyway. Otherwise, they
+	// are kept and reported as unresolved, so that the contents may still be recovered from a
+	// backup.
+	DropMissing bool
+}
+
+// RepairKind is the kind of an action taken by Repair.
+type RepairKind int
+
+const (
+	RepairRebuiltIndex   RepairKind = iota + 1 // a missing index was created or the full text index rebuilt
+	RepairRemovedFile                          // a blob, chunk or temporary file not used by any contents was removed
+	RepairRemovedEntry                         // a file entry not used by any version or lease was deleted
+	RepairDroppedVersion                       // a version whose contents are missing was deleted
+)
+
+// String returns a lowercase description of the repair kind.
+func (k RepairKind) String() string {
+	switch k {
+	case RepairRebuiltIndex:
+		return "rebuilt index"
+	case RepairRemovedFile:
+		return "removed file"
+	case RepairRemovedEntry:
+		return "removed entry"
+	case RepairDroppedVersion:
+		return "dropped version"
+	}
+	return "unknown"
+}
+
+// RepairAction is an action taken by Repair.
+type RepairAction struct {
+	Kind     RepairKind
+	Checksum string // the checksum of the contents or chunk concerned, empty if unknown
+	Path     string // the file removed or the name of the index rebuilt
+	Version  int64  // the ID of the version dropped, otherwise 0
+}
+
+// RepairReport is the result of Repair.
+type RepairReport struct {
+	Actions    []RepairAction  // the actions taken
+	Unresolved []VerifyProblem // the problems found by Verify that were not repaired
+}
+
+// Repair fixes the inconsistencies found by Verify that can be fixed without losing data, which
+// are typically left behind by failures while adding files: it creates missing indexes of the
+// database, rebuilds the full text index and recreates the triggers maintaining it, removes blobs
+// and chunks no contents use, such as those written before a failed commit, and deletes file
+// entries no version or lease uses. With opts.DropMissing, versions whose contents are missing
+// are deleted as well. Corrupt contents are never deleted. Other processes adding or deleting
+// contents wait for the repair, so that their new blobs are not removed before they are
+// committed. An error is only returned if the repair itself fails, in which case some of the
+// actions may have been taken.
+func (fs *Filestore) Repair(opts RepairOptions) (_ RepairReport, err error) {
+	op := newOp("Repair", fs.Dir)
+	defer op.done(&err)
+	if err := fs.ensureOpen(); err != nil {
+		return RepairReport{}, err
+	}
+	report := RepairReport{Actions: make([]RepairAction, 0), Unresolved: make([]VerifyProblem, 0)}
+	rebuilt, err := fs.rebuildIndexes()
+	if err != nil {
+		return report, err
+	}
+	report.Actions = append(report.Actions, rebuilt...)
+	// temporary directories of fetches, imports and links are only in use while they hold the locks
+	fs.fetchMutex.Lock()
+	defer fs.fetchMutex.Unlock()
+	unlock, err := fs.lockBlobs()
+	if err != nil {
+		return report, err
+	}
+	defer unlock()
+	removed, err := fs.removeTempDirs()
+	report.Actions = append(report.Actions, removed...)
+	if err != nil {
+		return report, err
+	}
+	verified, err := fs.verify(VerifyOptions{Quick: opts.Quick})
+	if err != nil {
+		return report, err
+	}
+	// the lock is held until the repair is done
+	tx, err := fs.beginLocked(func() {})
+	if err != nil {
+		return report, err
+	}
+	var actions []RepairAction
+	dropped := make(map[int64]bool)
+	for _, problem := range verified.Problems {
+		switch {
+		case problem.Kind == ProblemOrphan && problem.Path != "":
+			tx.deleted = append(tx.deleted, problem.Path)
+			actions = append(actions, RepairAction{Kind: RepairRemovedFile, Checksum: problem.Checksum, Path: problem.Path})
+		case problem.Kind == ProblemOrphan:
+			// removed by collecting garbage below
+			actions = append(actions, RepairAction{Kind: RepairRemovedEntry, Checksum: problem.Checksum})
+		case problem.Kind == ProblemDangling && opts.DropMissing:
+			if _, err := fs.deleteVersion(tx.tx, FileVersion{ID: problem.Version}); err != nil {
+				tx.rollback()
+				return report, err
+			}
+			dropped[problem.Version] = true
+			actions = append(actions, RepairAction{Kind: RepairDroppedVersion, Version: problem.Version})
+		case problem.Kind == ProblemMissing && opts.DropMissing:
+			versions, err := fs.versionsUsing(tx, problem.Checksum)
+			if err != nil {
+				tx.rollback()
+				return report, err
+			}
+			for _, version := range versions {
+				if dropped[version.ID] {
+					continue
+				}
+				if err := tx.deleteVersion(version); err != nil {
+					tx.rollback()
+					return report, err
+				}
+				dropped[version.ID] = true
+				actions = append(actions, RepairAction{Kind: RepairDroppedVersion, Checksum: version.Checksum, Version: version.ID})
+			}
+		default:
+			report.Unresolved = append(report.Unresolved, problem)
+		}
+	}
+	if err := tx.collectGarbage(); err != nil {
+		tx.rollback()
+		return report, err
+	}
+	if err := tx.commit(); err != nil {
+		return report, err
+	}
+	report.Actions = append(report.Actions, actions...)
+	return report, nil
+}
+
+// rebuildIndexes creates the indexes of the schema missing from the database and rebuilds the
+// full text index if there is one.
+func (fs *Filestore) rebuildIndexes() ([]RepairAction, error) {
+	indexes, err := fs.indexNames()
+	if err != nil {
+		return nil, err
+	}
+	for _, stmt := range schema {
+		if _, err := fs.db.Exec(stmt); err != nil {
+			return nil, fs.dbError(err)
+		}
+	}
+	created, err := fs.indexNames()
+	if err != nil {
+		return nil, err
+	}
+	var names []string
+	for name := range created {
+		if !indexes[name] {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	var actions []RepairAction
+	for _, name := range names {
+		actions = append(actions, RepairAction{Kind: RepairRebuiltIndex, Path: name})
+	}
+	if _, err := fs.db.Exec(ftsRebuild); err == nil {
+		if err := fs.createFtsTriggers(); err != nil {
+			return nil, err
+		}
+		actions = append(actions, RepairAction{Kind: RepairRebuiltIndex, Path: "VersionsFts"})
+	}
+	return actions, nil
+}
+
+// indexNames returns the names of the indexes of the database.
+func (fs *Filestore) indexNames() (map[string]bool, error) {
+	rows, err := fs.db.Query("select name from sqlite_master where type='index';")
+	if err != nil {
+		return nil, fs.dbError(err)
+	}
+	defer rows.Close()
+	names := make(map[string]bool)
+	for rows.Next() {
+		var name string
+		if err := rows.Scan(&name); err != nil {
+			return nil, fs.dbError(err)
+		}
+		names[name] = true
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fs.dbError(err)
+	}
+	return names, nil
+}
+
+// versionsUsing returns the versions of the contents with the given checksum within tx, or of
+// all contents with a chunk with the given checksum.
+func (fs *Filestore) versionsUsing(tx *Tx, checksum string) ([]FileVersion, error) {
+	rows, err := tx.tx.Query(selectVersions+" where Files.checksum=? or Files.file_id in (select file from FileChunks inner join Chunks on FileChunks.chunk=Chunks.chunk_id where Chunks.checksum=?) order by version_id;",
+		checksum, checksum)
+	if err != nil {
+		return nil, fs.dbError(err)
+	}
+	return fs.getVersions(rows)
+}
+
+// tempDirPrefixes are the prefixes of the names of the temporary directories created in the root
+// directory by fetches, imports and additions of symbolic links.
+var tempDirPrefixes = []string{"fetch-", "import-", "link-"}
+
+// removeTempDirs removes the temporary directories left in the root directory by interrupted
+// operations and returns the actions taken. Filestores in memory create temporary directories
+// elsewhere, which are removed by the operations themselves.
+func (fs *Filestore) removeTempDirs() ([]RepairAction, error) {
+	if fs.memory != "" {
+		return nil, nil
+	}
+	entries, err := os.ReadDir(fs.Root())
+	if err != nil {
+		return nil, err
+	}
+	var actions []RepairAction
+	for _, entry := range entries {
+		if !entry.IsDir() || !hasTempDirPrefix(entry.Name()) {
+			continue
+		}
+		path := filepath.Join(fs.Root(), entry.Name())
+		if err := os.RemoveAll(path); err != nil {
+			return actions, err
+		}
+		actions = append(actions, RepairAction{Kind: RepairRemovedFile, Path: path})
+	}
+	return actions, nil
+}
+
+// hasTempDirPrefix returns true if name starts with one of the tempDirPrefixes.
+func hasTempDirPrefix(name string) bool {
+	for _, prefix := range tempDirPrefixes {
+		if strings.HasPrefix(name, prefix) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,98 @@
+package filestore
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestRepairRemovesTempDirs(t *testing.T) {
+	fs, src := newTestStore(t)
+	fs.Symlinks = SymlinkStore
+	path := filepath.Join(src, "link")
+	if err := os.Symlink("target", path); err != nil {
+		t.Skip("symbolic links are not supported:", err)
+	}
+	if err := fs.Add(path, "", "1"); err != nil {
+		t.Fatal(err)
+	}
+	// directories left behind by interrupted operations
+	var left []string
+	for _, prefix := range []string{"fetch-", "import-", "link-"} {
+		dir, err := os.MkdirTemp(fs.Root(), prefix)
+		if err != nil {
+			t.Fatal(err)
+		}
+		left = append(left, dir)
+	}
+	report, err := fs.Repair(RepairOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, dir := range left {
+		if _, err := os.Stat(dir); !os.IsNotExist(err) {
+			t.Fatalf("%s has not been removed: %v", dir, err)
+		}
+	}
+	removed := 0
+	for _, action := range report.Actions {
+		if action.Kind == RepairRemovedFile {
+			removed++
+		}
+	}
+	if removed != len(left) {
+		t.Fatalf("Repair took actions %v, want removing %d directories", report.Actions, len(left))
+	}
+	if len(report.Unresolved) != 0 {
+		t.Fatalf("Repair left problems %v", report.Unresolved)
+	}
+}
+
+func TestRepair(t *testing.T) {
+	fs, src := newTestStore(t)
+	a, b := filepath.Join(src, "a.txt"), filepath.Join(src, "b.txt")
+	va := addFile(t, fs, a, "aaa", "a", "1")
+	addFile(t, fs, b, "bbb", "b", "1")
+	orphan := fs.Root() + "abcdef0123"
+	writeFile(t, filepath.Join(orphan, "x"), "x")
+	if err := os.RemoveAll(fs.Root() + va.Checksum); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := fs.db.Exec("drop index Tags_Tag;"); err != nil {
+		t.Fatal(err)
+	}
+	// missing contents are only dropped if requested
+	report, err := fs.Repair(RepairOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(report.Unresolved) != 1 || report.Unresolved[0].Kind != ProblemMissing {
+		t.Fatalf("Repair left problems %v, want the missing contents", report.Unresolved)
+	}
+	if _, err := os.Stat(orphan); !os.IsNotExist(err) {
+		t.Fatalf("orphaned blob directory has not been removed: %v", err)
+	}
+	var index bool
+	if err := fs.db.QueryRow("select exists (select 1 from sqlite_master where name='Tags_Tag');").Scan(&index); err != nil || !index {
+		t.Fatalf("index has not been recreated: %v", err)
+	}
+	if _, err := fs.Repair(RepairOptions{DropMissing: true}); err != nil {
+		t.Fatal(err)
+	}
+	if fs.Has(a) || !fs.Has(b) {
+		t.Fatal("Repair did not drop exactly the version with missing contents")
+	}
+	if verify, err := fs.Verify(VerifyOptions{}); err != nil || !verify.OK() {
+		t.Fatalf("Verify = %v, %v after repairing", verify.Problems, err)
+	}
+	// versions without contents are dropped as well
+	if _, err := fs.db.Exec("insert into Versions(path, info_id, version, date, file) values('zz', 1, '1', datetime('now'), 999);"); err != nil {
+		t.Fatal(err)
+	}
+	if report, err = fs.Repair(RepairOptions{DropMissing: true}); err != nil || len(report.Unresolved) != 0 {
+		t.Fatalf("Repair = %+v, %v, want no problems left", report, err)
+	}
+	if verify, err := fs.Verify(VerifyOptions{}); err != nil || !verify.OK() {
+		t.Fatalf("Verify = %v, %v after dropping the dangling version", verify.Problems, err)
+	}
+}
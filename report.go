@@ -0,0 +1,146 @@
+package filestore
+
+import (
+	"bytes"
+	htmltemplate "html/template"
+	"path/filepath"
+	"text/template"
+	"time"
+)
+
+// DayCount is the number of versions added on a day.
+type DayCount struct {
+	Day   time.Time // the day in UTC
+	Count int       // the number of versions added
+}
+
+// PathCount is the number of versions of a file added within a period.
+type PathCount struct {
+	Path  string // the path of the file (os path)
+	Count int    // the number of versions added
+}
+
+// ActivityReport summarizes the activity of a filestore within a period.
+type ActivityReport struct {
+	From, To     time.Time   // the period of the report
+	Adds         int         // the number of versions added
+	AddsPerDay   []DayCount  // the number of versions added per day, days without adds are omitted
+	TopPaths     []PathCount // the files with the most versions added, at most ten
+	AddedBytes   int64       // the total size of the contents of the versions added
+	NewBlobs     int         // the number of new contents stored
+	Growth       int64       // the number of bytes taken on disk by new contents
+	DedupSavings int64       // the number of bytes not stored because contents were already stored
+}
+
+// Report returns a summary of the activity within the given period before now.
+func (fs *Filestore) Report(period time.Duration) (_ ActivityReport, err error) {
+	op := newOp("Report", "")
+	defer op.done(&err)
+	if err := fs.ensureOpen(); err != nil {
+		return ActivityReport{}, err
+	}
+	r := ActivityReport{To: time.Now().UTC()}
+	r.From = r.To.Add(-period)
+	from, to := ToDBDate(r.From), ToDBDate(r.To)
+	rows, err := fs.db.Query("select date(date), count(*) from Versions where date between ? and ? group by date(date) order by date(date);", from, to)
+	if err != nil {
+		return ActivityReport{}, fs.dbError(err)
+	}
+	defer rows.Close()
+	r.AddsPerDay = make([]DayCount, 0)
+	for rows.Next() {
+		var day string
+		var count int
+		if err := rows.Scan(&day, &count); err != nil {
+			return ActivityReport{}, fs.dbError(err)
+		}
+		t, err := time.Parse("2006-01-02", day)
+		if err != nil {
+			return ActivityReport{}, ErrInvalidDate
+		}
+		r.AddsPerDay = append(r.AddsPerDay, DayCount{Day: t, Count: count})
+		r.Adds += count
+	}
+	if err := rows.Err(); err != nil {
+		return ActivityReport{}, fs.dbError(err)
+	}
+	rows.Close()
+	rows, err = fs.db.Query("select path, count(*) as n from Versions where date between ? and ? group by path order by n desc, path limit 10;", from, to)
+	if err != nil {
+		return ActivityReport{}, fs.dbError(err)
+	}
+	r.TopPaths = make([]PathCount, 0)
+	for rows.Next() {
+		var p PathCount
+		if err := rows.Scan(&p.Path, &p.Count); err != nil {
+			return ActivityReport{}, fs.dbError(err)
+		}
+		p.Path = filepath.FromSlash(p.Path)
+		r.TopPaths = append(r.TopPaths, p)
+	}
+	if err := rows.Err(); err != nil {
+		return ActivityReport{}, fs.dbError(err)
+	}
+	err = fs.db.QueryRow("select coalesce(sum(size), 0) from Versions inner join Files on Versions.file=Files.file_id where date between ? and ?;", from, to).Scan(&r.AddedBytes)
+	if err != nil {
+		return ActivityReport{}, fs.dbError(err)
+	}
+	var newBytes int64
+	err = fs.db.QueryRow("select count(*), coalesce(sum(size), 0), coalesce(sum(stored), 0) from Files where (select min(date) from Versions where file=file_id) between ? and ?;", from, to).Scan(&r.NewBlobs, &newBytes, &r.Growth)
+	if err != nil {
+		return ActivityReport{}, fs.dbError(err)
+	}
+	r.DedupSavings = r.AddedBytes - newBytes
+	return r, nil
+}
+
+var markdownReport = template.Must(template.New("report").Parse(`# Filestore activity {{.From.Format "2006-01-02"}} to {{.To.Format "2006-01-02"}}
+
+- Versions added: {{.Adds}} ({{.AddedBytes}} bytes)
+- New contents stored: {{.NewBlobs}} ({{.Growth}} bytes on disk)
+- Saved by deduplication: {{.DedupSavings}} bytes
+{{if .AddsPerDay}}
+## Versions added per day
+
+| Day | Versions |
+|-----|----------|
+{{range .AddsPerDay}}| {{.Day.Format "2006-01-02"}} | {{.Count}} |
+{{end}}{{end}}{{if .TopPaths}}
+## Most changed files
+
+| File | Versions |
+|------|----------|
+{{range .TopPaths}}| {{.Path}} | {{.Count}} |
+{{end}}{{end}}`))
+
+var htmlReport = htmltemplate.Must(htmltemplate.New("report").Parse(`<h1>Filestore activity {{.From.Format "2006-01-02"}} to {{.To.Format "2006-01-02"}}</h1>
+<ul>
+<li>Versions added: {{.Adds}} ({{.AddedBytes}} bytes)</li>
+<li>New contents stored: {{.NewBlobs}} ({{.Growth}} bytes on disk)</li>
+<li>Saved by deduplication: {{.DedupSavings}} bytes</li>
+</ul>
+{{if .AddsPerDay}}<h2>Versions added per day</h2>
+<table>
+<tr><th>Day</th><th>Versions</th></tr>
+{{range .AddsPerDay}}<tr><td>{{.Day.Format "2006-01-02"}}</td><td>{{.Count}}</td></tr>
+{{end}}</table>
+{{end}}{{if .TopPaths}}<h2>Most changed files</h2>
+<table>
+<tr><th>File</th><th>Versions</th></tr>
+{{range .TopPaths}}<tr><td>{{.Path}}</td><td>{{.Count}}</td></tr>
+{{end}}</table>
+{{end}}`))
+
+// Markdown renders the report as a Markdown document.
+func (r ActivityReport) Markdown() string {
+	var buf bytes.Buffer
+	markdownReport.Execute(&buf, r)
+	return buf.String()
+}
+
+// HTML renders the report as an HTML fragment.
+func (r ActivityReport) HTML() string {
+	var buf bytes.Buffer
+	htmlReport.Execute(&buf, r)
+	return buf.String()
+}
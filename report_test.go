@@ -0,0 +1,36 @@
+package filestore
+
+import (
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestReport(t *testing.T) {
+	fs, src := newTestStore(t)
+	a, b := filepath.Join(src, "a.txt"), filepath.Join(src, "b.txt")
+	addFile(t, fs, a, "0123456789", "", "1")
+	addFile(t, fs, a, "0123456789", "", "2")
+	addFile(t, fs, b, "0123456789", "", "1")
+	r, err := fs.Report(24 * time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// the contents are stored once and shared by the three versions
+	if r.Adds != 3 || r.AddedBytes != 30 || r.NewBlobs != 1 || r.Growth != 10 || r.DedupSavings != 20 {
+		t.Fatalf("Report = %+v, want 3 adds of 30 bytes with one new blob of 10 bytes", r)
+	}
+	if len(r.TopPaths) != 2 || r.TopPaths[0].Path != a || r.TopPaths[0].Count != 2 {
+		t.Fatalf("TopPaths = %v, want %s with 2 versions first", r.TopPaths, a)
+	}
+	if len(r.AddsPerDay) != 1 || r.AddsPerDay[0].Count != 3 {
+		t.Fatalf("AddsPerDay = %v, want 3 adds on one day", r.AddsPerDay)
+	}
+	if md := r.Markdown(); !strings.Contains(md, "| "+a+" | 2 |") {
+		t.Fatalf("Markdown lacks the top path:\n%s", md)
+	}
+	if html := r.HTML(); !strings.Contains(html, "<td>2</td>") {
+		t.Fatalf("HTML lacks the top path:\n%s", html)
+	}
+}
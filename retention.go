@@ -0,0 +1,210 @@
+package filestore
+
+import (
+	"time"
+)
+
+// RetentionPolicy determines which versions are removed by Prune. The latest version of a file
+// and pinned versions are never removed. They count towards MaxVersions, so that each pinned
+// version of a file leaves room for one other version less, and a file only keeps more than
+// MaxVersions versions if more of them are pinned.
+type RetentionPolicy struct {
+	MaxVersions int           // maximum number of versions kept per file, unlimited if zero
+	MaxAge      time.Duration // versions older than this are removed, kept forever if zero
+	// Notice is how long before a version expires an EventVersionExpiring is emitted by Prune.
+	// Versions that will be removed because of MaxVersions when the next version of a file is
+	// added are announced as well. No events are emitted if Notice is zero.
+	Notice time.Duration
+}
+
+// Pin protects the given version from being removed by Prune.
+func (fs *Filestore) Pin(version FileVersion) (err error) {
+	op := newOp("Pin", version.Path)
+	defer op.done(&err)
+	if err := fs.ensureOpen(); err != nil {
+		return err
+	}
+	if _, err := fs.versionByID(fs.db, version.ID); err != nil {
+		return err
+	}
+	if _, err := fs.db.Exec("insert or ignore into Pins(version) values(?);", version.ID); err != nil {
+		return fs.dbError(err)
+	}
+	return nil
+}
+
+// Unpin removes the protection of the given version from being removed by Prune.
+func (fs *Filestore) Unpin(version FileVersion) (err error) {
+	op := newOp("Unpin", version.Path)
+	defer op.done(&err)
+	if err := fs.ensureOpen(); err != nil {
+		return err
+	}
+	if _, err := fs.db.Exec("delete from Pins where version=?;", version.ID); err != nil {
+		return fs.dbError(err)
+	}
+	return nil
+}
+
+// IsPinned returns true if the given version is pinned.
+func (fs *Filestore) IsPinned(version FileVersion) (_ bool, err error) {
+	op := newOp("IsPinned", version.Path)
+	defer op.done(&err)
+	if err := fs.ensureOpen(); err != nil {
+		return false, err
+	}
+	var pinned bool
+	if err := fs.db.QueryRow("select exists (select 1 from Pins where version=?);", version.ID).Scan(&pinned); err != nil {
+		return false, fs.dbError(err)
+	}
+	return pinned, nil
+}
+
+// Prune removes all versions that have expired according to the retention policy of the filestore
+// and returns the number of versions removed. Before that, an EventVersionExpiring is emitted for
+// each version that will expire within the notice period of the policy, giving hooks a chance to pin
+// or export it. Since these events are emitted on every call, hooks may receive them repeatedly.
+// Contents kept only by leases that have expired since are deleted as well.
+func (fs *Filestore) Prune() (_ int, err error) {
+	op := newOp("Prune", "")
+	defer op.done(&err)
+	if err := fs.ensureOpen(); err != nil {
+		return 0, err
+	}
+	return fs.prune("")
+}
+
+// PruneUnder is like Prune, but only removes versions of files under the directory prefix and
+// only emits the events announcing their expiry, so that the retention policy can be applied to
+// a project subtree on its own.
+func (fs *Filestore) PruneUnder(prefix string) (_ int, err error) {
+	op := newOp("PruneUnder", prefix)
+	defer op.done(&err)
+	if err := fs.ensureOpen(); err != nil {
+		return 0, err
+	}
+	return fs.prune(fs.dirPrefix(prefix))
+}
+
+// prune removes the expired versions of files whose stored paths start with dir, which is empty to
+// prune all files. The expired versions are selected again within the transaction deleting them
+// after the events announcing expiring versions have been emitted, so that versions pinned in the
+// meantime are kept.
+func (fs *Filestore) prune(dir string) (int, error) {
+	_, expiring, err := fs.expiredVersions(fs.db, fs.Retention, dir, time.Now())
+	if err != nil {
+		return 0, err
+	}
+	for _, e := range expiring {
+		fs.emit(e)
+	}
+	tx, err := fs.begin()
+	if err != nil {
+		return 0, err
+	}
+	expired, _, err := fs.expiredVersions(tx.tx, fs.Retention, dir, time.Now())
+	if err != nil {
+		tx.rollback()
+		return 0, err
+	}
+	for _, v := range expired {
+		if err := tx.deleteVersion(v); err != nil {
+			tx.rollback()
+			return 0, err
+		}
+	}
+	if err := tx.collectGarbage(); err != nil {
+		tx.rollback()
+		return 0, err
+	}
+	if err := tx.commit(); err != nil {
+		return 0, err
+	}
+	return len(expired), nil
+}
+
+// expiredVersions returns the versions of files whose stored paths start with dir that have
+// expired according to the policy at time now, and the events announcing versions that will expire
+// within the notice period, as queried with q.
+func (fs *Filestore) expiredVersions(q querier, policy RetentionPolicy, dir string, now time.Time) ([]FileVersion, []Event, error) {
+	expired := make([]FileVersion, 0)
+	expiring := make([]Event, 0)
+	if policy.MaxVersions <= 0 && policy.MaxAge <= 0 {
+		return expired, expiring, nil
+	}
+	rows, err := q.Query(selectVersions+" where substr(path, 1, length(?1))=?1 order by path, date desc, version_id desc;", dir)
+	if err != nil {
+		return nil, nil, fs.dbError(err)
+	}
+	versions, err := fs.getVersions(rows)
+	if err != nil {
+		return nil, nil, err
+	}
+	latest, err := fs.latestVersionIDs(q)
+	if err != nil {
+		return nil, nil, err
+	}
+	pinned, err := fs.versionIDs(q, "select version from Pins;")
+	if err != nil {
+		return nil, nil, err
+	}
+	// kept counts the versions of the current file that are kept, starting with its latest and
+	// pinned versions, which are kept in any case
+	kept := 0
+	for i, v := range versions {
+		if i == 0 || versions[i-1].Path != v.Path {
+			kept = 0
+			for _, w := range versions[i:] {
+				if w.Path != v.Path {
+					break
+				}
+				if latest[w.ID] || pinned[w.ID] {
+					kept++
+				}
+			}
+		}
+		if latest[v.ID] || pinned[v.ID] {
+			continue
+		}
+		expires := v.From.Add(policy.MaxAge)
+		if policy.MaxVersions > 0 && kept >= policy.MaxVersions || policy.MaxAge > 0 && !now.Before(expires) {
+			expired = append(expired, v)
+			continue
+		}
+		kept++
+		switch {
+		case policy.Notice <= 0:
+		case policy.MaxAge > 0 && now.Add(policy.Notice).After(expires):
+			expiring = append(expiring, Event{Kind: EventVersionExpiring, Version: v, Date: expires})
+		case policy.MaxVersions > 0 && kept == policy.MaxVersions:
+			expiring = append(expiring, Event{Kind: EventVersionExpiring, Version: v})
+		}
+	}
+	return expired, expiring, nil
+}
+
+// latestVersionIDs returns the set of IDs of the latest version of every file.
+func (fs *Filestore) latestVersionIDs(q querier) (map[int64]bool, error) {
+	return fs.versionIDs(q, "select version_id from Versions as V where version_id = (select version_id from Versions where path=V.path order by date desc, version_id desc limit 1);")
+}
+
+// versionIDs returns the set of version IDs selected by the query with q.
+func (fs *Filestore) versionIDs(q querier, query string) (map[int64]bool, error) {
+	rows, err := q.Query(query)
+	if err != nil {
+		return nil, fs.dbError(err)
+	}
+	defer rows.Close()
+	ids := make(map[int64]bool)
+	for rows.Next() {
+		var id int64
+		if err := rows.Scan(&id); err != nil {
+			return nil, fs.dbError(err)
+		}
+		ids[id] = true
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fs.dbError(err)
+	}
+	return ids, nil
+}
@@ -0,0 +1,98 @@
+package filestore
+
+import (
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// addVersions adds n versions of the file at path and returns them, latest first.
+func addVersions(t *testing.T, fs *Filestore, path string, n int) []FileVersion {
+	t.Helper()
+	for i := 0; i < n; i++ {
+		addFile(t, fs, path, string(rune('a'+i)), "", "")
+	}
+	versions, err := fs.Versions(path, -1)
+	if err != nil || len(versions) != n {
+		t.Fatalf("Versions = %v, %v, want %d versions", versions, err, n)
+	}
+	return versions
+}
+
+func TestPruneMaxVersions(t *testing.T) {
+	fs, src := newTestStore(t)
+	path := filepath.Join(src, "a.txt")
+	versions := addVersions(t, fs, path, 5)
+	fs.Retention = RetentionPolicy{MaxVersions: 2}
+	if n, err := fs.Prune(); err != nil || n != 3 {
+		t.Fatalf("Prune = %d, %v, want 3", n, err)
+	}
+	kept, _ := fs.Versions(path, -1)
+	if len(kept) != 2 || kept[0].ID != versions[0].ID || kept[1].ID != versions[1].ID {
+		t.Fatalf("kept %v, want the 2 latest versions", kept)
+	}
+}
+
+func TestPrunePinsCountTowardsMaxVersions(t *testing.T) {
+	fs, src := newTestStore(t)
+	path := filepath.Join(src, "a.txt")
+	versions := addVersions(t, fs, path, 5)
+	oldest := versions[4]
+	if err := fs.Pin(oldest); err != nil {
+		t.Fatal(err)
+	}
+	fs.Retention = RetentionPolicy{MaxVersions: 3}
+	if n, err := fs.Prune(); err != nil || n != 2 {
+		t.Fatalf("Prune = %d, %v, want 2", n, err)
+	}
+	kept, _ := fs.Versions(path, -1)
+	if len(kept) != 3 || kept[0].ID != versions[0].ID || kept[1].ID != versions[1].ID || kept[2].ID != oldest.ID {
+		t.Fatalf("kept %v, want the 2 latest and the pinned version", kept)
+	}
+	// with more pinned versions than allowed, only the latest and pinned versions remain
+	for _, v := range kept[1:] {
+		if err := fs.Pin(v); err != nil {
+			t.Fatal(err)
+		}
+	}
+	fs.Retention = RetentionPolicy{MaxVersions: 1}
+	if n, err := fs.Prune(); err != nil || n != 0 {
+		t.Fatalf("Prune = %d, %v, want 0", n, err)
+	}
+	if err := fs.Unpin(kept[1]); err != nil {
+		t.Fatal(err)
+	}
+	if pinned, _ := fs.IsPinned(kept[1]); pinned {
+		t.Fatal("version still pinned")
+	}
+	if n, err := fs.Prune(); err != nil || n != 1 {
+		t.Fatalf("Prune = %d, %v, want 1", n, err)
+	}
+}
+
+func TestPruneNotice(t *testing.T) {
+	fs, src := newTestStore(t)
+	path := filepath.Join(src, "a.txt")
+	versions := addVersions(t, fs, path, 3)
+	var events []Event
+	fs.AddHook(func(e Event) {
+		if e.Kind == EventVersionExpiring {
+			events = append(events, e)
+		}
+	})
+	fs.Retention = RetentionPolicy{MaxVersions: 3, Notice: time.Hour}
+	if n, err := fs.Prune(); err != nil || n != 0 {
+		t.Fatalf("Prune = %d, %v, want 0", n, err)
+	}
+	if len(events) != 1 || events[0].Version.ID != versions[2].ID {
+		t.Fatalf("expiring events %v, want one for the oldest version", events)
+	}
+	events = nil
+	fs.Retention = RetentionPolicy{MaxAge: 30 * time.Minute, Notice: time.Hour}
+	if _, err := fs.Prune(); err != nil {
+		t.Fatal(err)
+	}
+	if len(events) != 2 || events[0].Date.IsZero() {
+		t.Fatalf("expiring events %v, want two with expiry dates", events)
+	}
+}
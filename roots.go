@@ -0,0 +1,100 @@
+package filestore
+
+import (
+	"path/filepath"
+	"strings"
+)
+
+// OutsideRoots returns the paths with versions that are not inside any of the Roots of the
+// filestore in alphabetical order, such as files in temporary directories added by accident.
+// Roots are compared with paths as they were added, so they must be absolute if files are added
+// by absolute paths. No paths are returned if the filestore has no Roots.
+func (fs *Filestore) OutsideRoots() (_ []string, err error) {
+	op := newOp("OutsideRoots", fs.Dir)
+	defer op.done(&err)
+	if err := fs.ensureOpen(); err != nil {
+		return nil, err
+	}
+	return fs.outsideRoots()
+}
+
+func (fs *Filestore) outsideRoots() ([]string, error) {
+	paths := make([]string, 0)
+	if len(fs.Roots) == 0 {
+		return paths, nil
+	}
+	rows, err := fs.db.Query("select distinct path from Versions order by path;")
+	if err != nil {
+		return nil, fs.dbError(err)
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var path string
+		if err := rows.Scan(&path); err != nil {
+			return nil, fs.dbError(err)
+		}
+		path = filepath.FromSlash(path)
+		if !insideRoots(fs.Roots, path) {
+			paths = append(paths, path)
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fs.dbError(err)
+	}
+	return paths, nil
+}
+
+// DeleteOutsideRoots deletes all versions of the paths returned by OutsideRoots, except pinned
+// versions, and returns the number of versions deleted. Their contents are deleted unless other
+// versions or leases use them.
+func (fs *Filestore) DeleteOutsideRoots() (_ int, err error) {
+	op := newOp("DeleteOutsideRoots", fs.Dir)
+	defer op.done(&err)
+	if err := fs.ensureOpen(); err != nil {
+		return 0, err
+	}
+	paths, err := fs.outsideRoots()
+	if err != nil {
+		return 0, err
+	}
+	tx, err := fs.begin()
+	if err != nil {
+		return 0, err
+	}
+	n := 0
+	for _, path := range paths {
+		rows, err := tx.tx.Query(selectVersions+" where Versions.path=? and version_id not in (select version from Pins);", filepath.ToSlash(path))
+		if err != nil {
+			tx.rollback()
+			return 0, fs.dbError(err)
+		}
+		versions, err := fs.getVersions(rows)
+		if err != nil {
+			tx.rollback()
+			return 0, err
+		}
+		for _, version := range versions {
+			if err := tx.deleteVersion(version); err != nil {
+				tx.rollback()
+				return 0, err
+			}
+			n++
+		}
+	}
+	if err := tx.commit(); err != nil {
+		return 0, err
+	}
+	return n, nil
+}
+
+// insideRoots returns true if path is one of the roots or inside one of them.
+func insideRoots(roots []string, path string) bool {
+	path = filepath.Clean(path)
+	for _, root := range roots {
+		rel, err := filepath.Rel(filepath.Clean(root), path)
+		if err == nil && rel != ".." && !strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,37 @@
+package filestore
+
+import (
+	"bytes"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestRoots(t *testing.T) {
+	fs, src := newTestStore(t)
+	docs := filepath.Join(src, "docs")
+	// a directory whose name starts with the root is outside of it
+	a, b := filepath.Join(docs, "a"), filepath.Join(src, "docsx", "b")
+	addFile(t, fs, a, "a", "", "1")
+	addFile(t, fs, b, "b", "", "1")
+	addFile(t, fs, b, "bb", "", "2")
+	if paths, err := fs.OutsideRoots(); err != nil || len(paths) != 0 {
+		t.Fatalf("OutsideRoots = %v, %v without roots, want none", paths, err)
+	}
+	if err := fs.SetPolicy(Policy{Roots: []string{docs}}); err != nil {
+		t.Fatal(err)
+	}
+	var buf bytes.Buffer
+	if err := fs.ExportPolicy(&buf); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(buf.String(), `"roots"`) {
+		t.Fatalf("exported policy %s, want the roots", buf.String())
+	}
+	if paths, err := fs.OutsideRoots(); err != nil || len(paths) != 1 || paths[0] != b {
+		t.Fatalf("OutsideRoots = %v, %v, want %s", paths, err, b)
+	}
+	if n, err := fs.DeleteOutsideRoots(); err != nil || n != 2 || fs.Has(b) || !fs.Has(a) {
+		t.Fatalf("DeleteOutsideRoots = %d, %v, want the 2 versions of b deleted", n, err)
+	}
+}
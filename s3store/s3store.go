@@ -0,0 +1,553 @@
+// Package s3store provides a filestore.BlobStore keeping the blobs and chunks of a filestore in a
+// bucket of Amazon S3 or a compatible object storage such as MinIO, while the database with the
+// metadata stays in the root directory of the filestore. Several filestores may share a bucket
+// under different prefixes.
+//
+// For example, the following opens a filestore whose contents are kept in a MinIO bucket:
+//
+//	blobs, err := s3store.New(s3store.Config{Endpoint: "http://localhost:9000", Bucket: "archive",
+//		AccessKey: "minio", SecretKey: "minio123", PathStyle: true})
+//	if err != nil {
+//		return err
+//	}
+//	fs := filestore.NewFilestore("/var/lib/archive", 0)
+//	fs.Blobs = blobs
+//	err = fs.Open()
+//
+// Requests are signed with AWS Signature Version 4 including the SHA-256 hashes of their
+// payloads, so that the service rejects data damaged on the way. Objects larger than the PartSize
+// are uploaded in parts with a multipart upload, which is aborted if a part cannot be uploaded.
+// Requests failing with network or server errors are retried, each part on its own.
+package s3store
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var ErrNoBucket = errors.New("s3store bucket is not set")
+var ErrRequestFailed = errors.New("s3store request failed")
+var ErrPartSize = errors.New("s3store part size must be between 5 MiB and 5 GiB")
+
+const (
+	minPartSize     = 5 << 20  // the minimum size of parts but the last one of multipart uploads
+	maxPartSize     = 5 << 30  // the maximum size of parts and of objects uploaded at once
+	defaultPartSize = 64 << 20 // the size of parts if Config.PartSize is zero
+	maxParts        = 10000    // the maximum number of parts of multipart uploads
+	defaultRetries  = 3        // the number of retries if Config.Retries is zero
+)
+
+// retryDelay is the delay before the first retry of a request, which doubles with every retry.
+var retryDelay = 500 * time.Millisecond
+
+// Config configures the access to a bucket.
+type Config struct {
+	Endpoint     string // the URL of the service, https://s3.<Region>.amazonaws.com if empty
+	Region       string // the region of the bucket, us-east-1 if empty
+	Bucket       string // the name of the bucket
+	Prefix       string // prepended to the keys of the filestore, such as "archive/"
+	AccessKey    string // the access key ID
+	SecretKey    string // the secret access key
+	SessionToken string // the token of temporary credentials, if any
+	// PathStyle addresses the bucket in the path of URLs instead of the host name, as required by
+	// MinIO and other services without virtual-hosted buckets.
+	PathStyle bool
+	Client    *http.Client // the client making requests, http.DefaultClient if nil
+	// PartSize is the size of the parts in which larger objects are uploaded, 64 MiB by default,
+	// at least 5 MiB and at most 5 GiB. It is increased for files that would have more than 10000 parts. Data
+	// that cannot be read at offsets, such as chunks, is read into memory one part at a time.
+	PartSize int64
+	// Retries is how often requests failing with network errors or server errors are retried,
+	// 3 times if zero and never if negative.
+	Retries int
+}
+
+// Store is a filestore.BlobStore keeping data in objects of a bucket.
+type Store struct {
+	config   Config
+	endpoint *url.URL
+}
+
+// New returns a store of the bucket configured by config. No request is made.
+func New(config Config) (*Store, error) {
+	if config.Bucket == "" {
+		return nil, ErrNoBucket
+	}
+	if config.Region == "" {
+		config.Region = "us-east-1"
+	}
+	if config.Endpoint == "" {
+		config.Endpoint = "https://s3." + config.Region + ".amazonaws.com"
+	}
+	if config.Client == nil {
+		config.Client = http.DefaultClient
+	}
+	if config.PartSize == 0 {
+		config.PartSize = defaultPartSize
+	}
+	if config.PartSize < minPartSize || config.PartSize > maxPartSize {
+		return nil, ErrPartSize
+	}
+	if config.Retries == 0 {
+		config.Retries = defaultRetries
+	}
+	endpoint, err := url.Parse(config.Endpoint)
+	if err != nil {
+		return nil, fmt.Errorf("s3store invalid endpoint %s: %w", config.Endpoint, err)
+	}
+	return &Store{config: config, endpoint: endpoint}, nil
+}
+
+// Put uploads the data read from r to the object of key, in parts with a multipart upload if it
+// is larger than the PartSize.
+func (s *Store) Put(key string, r io.Reader) error {
+	parts, err := newPartReader(r, s.config.PartSize)
+	if err != nil {
+		return err
+	}
+	first, err := parts.next()
+	if err != nil {
+		return err
+	}
+	second, err := parts.next()
+	if err != nil {
+		return err
+	}
+	if second == nil {
+		if first == nil {
+			first = bytes.NewReader(nil)
+		}
+		resp, err := s.do(http.MethodPut, key, nil, first)
+		if err != nil {
+			return err
+		}
+		resp.Body.Close()
+		return nil
+	}
+	return s.putMultipart(key, parts, first, second)
+}
+
+// multipartPart is a part of a CompleteMultipartUpload request.
+type multipartPart struct {
+	PartNumber int
+	ETag       string
+}
+
+// putMultipart uploads the data of parts to the object of key with a multipart upload, starting
+// with the parts first and second read already. The upload is aborted if it fails, so that the
+// uploaded parts do not take up space.
+func (s *Store) putMultipart(key string, parts *partReader, first, second io.ReadSeeker) (err error) {
+	resp, err := s.do(http.MethodPost, key, url.Values{"uploads": {""}}, nil)
+	if err != nil {
+		return err
+	}
+	var initiated struct {
+		UploadID string `xml:"UploadId"`
+	}
+	err = xml.NewDecoder(resp.Body).Decode(&initiated)
+	resp.Body.Close()
+	if err != nil || initiated.UploadID == "" {
+		return fmt.Errorf("s3store invalid response initiating the upload of %s: %w", key, ErrRequestFailed)
+	}
+	uploadID := url.Values{"uploadId": {initiated.UploadID}}
+	defer func() {
+		if err != nil {
+			if resp, abortErr := s.do(http.MethodDelete, key, uploadID, nil); abortErr == nil {
+				resp.Body.Close()
+			}
+		}
+	}()
+	var complete struct {
+		XMLName xml.Name        `xml:"CompleteMultipartUpload"`
+		Parts   []multipartPart `xml:"Part"`
+	}
+	for part := first; part != nil; {
+		number := len(complete.Parts) + 1
+		if number > maxParts {
+			return fmt.Errorf("s3store cannot upload %s in more than %d parts: %w", key, maxParts, ErrPartSize)
+		}
+		resp, err := s.do(http.MethodPut, key, url.Values{"partNumber": {strconv.Itoa(number)}, "uploadId": {initiated.UploadID}}, part)
+		if err != nil {
+			return err
+		}
+		resp.Body.Close()
+		complete.Parts = append(complete.Parts, multipartPart{PartNumber: number, ETag: resp.Header.Get("ETag")})
+		if part, second = second, nil; part == nil {
+			if part, err = parts.next(); err != nil {
+				return err
+			}
+		}
+	}
+	body, err := xml.Marshal(complete)
+	if err != nil {
+		return err
+	}
+	resp, err = s.do(http.MethodPost, key, uploadID, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	// the service may report errors after responding with 200 OK
+	var result struct {
+		XMLName xml.Name
+		Code    string
+		Message string
+	}
+	if err := xml.NewDecoder(resp.Body).Decode(&result); err != nil {
+		return fmt.Errorf("s3store invalid response completing the upload of %s: %w", key, ErrRequestFailed)
+	}
+	if result.XMLName.Local == "Error" {
+		return fmt.Errorf("%w: completing the upload of %s: %s %s", ErrRequestFailed, s.config.Prefix+key, result.Code, result.Message)
+	}
+	return nil
+}
+
+// partReader splits data into parts of multipart uploads. Data that can be read at offsets is
+// split into sections, and other data is read into memory one part at a time.
+type partReader struct {
+	r        io.Reader
+	at       io.ReaderAt // r if it can be read at offsets
+	offset   int64       // the offset of the next part in at
+	end      int64       // the end of the data of at
+	partSize int64
+}
+
+// newPartReader returns a partReader of the remaining data of r in parts of partSize bytes, or
+// larger parts if there were too many.
+func newPartReader(r io.Reader, partSize int64) (*partReader, error) {
+	p := &partReader{r: r, partSize: partSize}
+	at, ok := r.(io.ReaderAt)
+	seeker, seekable := r.(io.Seeker)
+	if !ok || !seekable {
+		return p, nil
+	}
+	offset, err := seeker.Seek(0, io.SeekCurrent)
+	if err != nil {
+		return nil, err
+	}
+	end, err := seeker.Seek(0, io.SeekEnd)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := seeker.Seek(offset, io.SeekStart); err != nil {
+		return nil, err
+	}
+	p.at, p.offset, p.end = at, offset, end
+	if size := (end - offset + maxParts - 1) / maxParts; size > p.partSize {
+		p.partSize = size
+	}
+	return p, nil
+}
+
+// next returns the next part, or nil if there is no data left.
+func (p *partReader) next() (io.ReadSeeker, error) {
+	if p.at != nil {
+		if p.offset >= p.end {
+			return nil, nil
+		}
+		size := p.partSize
+		if size > p.end-p.offset {
+			size = p.end - p.offset
+		}
+		part := io.NewSectionReader(p.at, p.offset, size)
+		p.offset += size
+		return part, nil
+	}
+	var buf bytes.Buffer
+	n, err := io.CopyN(&buf, p.r, p.partSize)
+	if err != nil && err != io.EOF {
+		return nil, err
+	}
+	if n == 0 {
+		return nil, nil
+	}
+	return bytes.NewReader(buf.Bytes()), nil
+}
+
+// Get downloads the object of key. The error satisfies errors.Is(err, os.ErrNotExist) if there
+// is no such object.
+func (s *Store) Get(key string) (io.ReadCloser, error) {
+	resp, err := s.do(http.MethodGet, key, nil, nil)
+	if err != nil {
+		return nil, err
+	}
+	return resp.Body, nil
+}
+
+// Delete deletes the object of key.
+func (s *Store) Delete(key string) error {
+	resp, err := s.do(http.MethodDelete, key, nil, nil)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	return nil
+}
+
+// Exists returns true if there is an object for key.
+func (s *Store) Exists(key string) (bool, error) {
+	resp, err := s.do(http.MethodHead, key, nil, nil)
+	if errors.Is(err, os.ErrNotExist) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	resp.Body.Close()
+	return true, nil
+}
+
+// listResult is the part of a ListObjectsV2 response used by List.
+type listResult struct {
+	Contents []struct {
+		Key string
+	}
+	IsTruncated           bool
+	NextContinuationToken string
+}
+
+// List returns the keys of the objects whose keys start with prefix, in the lexical order in which
+// the service lists them.
+func (s *Store) List(prefix string) ([]string, error) {
+	var keys []string
+	token := ""
+	for {
+		query := url.Values{"list-type": {"2"}, "prefix": {s.config.Prefix + prefix}}
+		if token != "" {
+			query.Set("continuation-token", token)
+		}
+		resp, err := s.do(http.MethodGet, "", query, nil)
+		if err != nil {
+			return keys, err
+		}
+		var result listResult
+		err = xml.NewDecoder(resp.Body).Decode(&result)
+		resp.Body.Close()
+		if err != nil {
+			return keys, fmt.Errorf("s3store invalid listing of %s: %w", s.config.Bucket, err)
+		}
+		for _, object := range result.Contents {
+			keys = append(keys, strings.TrimPrefix(object.Key, s.config.Prefix))
+		}
+		if !result.IsTruncated || result.NextContinuationToken == "" {
+			return keys, nil
+		}
+		token = result.NextContinuationToken
+	}
+}
+
+// objectURL returns the URL of the object of key, or of the bucket if key is empty.
+func (s *Store) objectURL(key string, query url.Values) *url.URL {
+	u := *s.endpoint
+	path := strings.TrimSuffix(u.Path, "/")
+	if s.config.PathStyle {
+		path += "/" + s.config.Bucket
+	} else {
+		u.Host = s.config.Bucket + "." + u.Host
+	}
+	path += "/"
+	if key != "" {
+		path += s.config.Prefix + key
+	}
+	u.Path, u.RawPath = path, escapePath(path)
+	u.RawQuery = canonicalQuery(query)
+	return &u
+}
+
+// statusError is the error of a response with a status other than 2xx and 404.
+type statusError struct {
+	method, object string
+	status         int
+	text           string // the status text followed by the code and message of the error
+}
+
+// Error returns a message with the request and the error of the response.
+func (e *statusError) Error() string {
+	return fmt.Sprintf("%v: %s %s: %s", ErrRequestFailed, e.method, e.object, e.text)
+}
+
+// Unwrap returns ErrRequestFailed.
+func (e *statusError) Unwrap() error {
+	return ErrRequestFailed
+}
+
+// do makes a signed request for the object of key, or for the bucket if key is empty, and returns
+// the response if it succeeded. Its body must be closed. Other responses are turned into errors,
+// which satisfy errors.Is(err, os.ErrNotExist) for missing objects. Requests failing with network
+// or server errors are retried as configured, with the body read again from its start.
+func (s *Store) do(method, key string, query url.Values, body io.ReadSeeker) (*http.Response, error) {
+	var size int64
+	payloadHash := sha256.New()
+	if body != nil {
+		var err error
+		if size, err = io.Copy(payloadHash, body); err != nil {
+			return nil, err
+		}
+	}
+	hash := hex.EncodeToString(payloadHash.Sum(nil))
+	delay := retryDelay
+	for retry := 0; ; retry++ {
+		resp, err := s.try(method, key, query, body, size, hash)
+		if err == nil || retry >= s.config.Retries || !retryable(err) {
+			return resp, err
+		}
+		time.Sleep(delay)
+		delay *= 2
+	}
+}
+
+// retryable returns true if a request failing with err may succeed when it is retried, which is
+// the case for network errors, server errors and throttling.
+func retryable(err error) bool {
+	var se *statusError
+	if errors.As(err, &se) {
+		return se.status >= 500 || se.status == http.StatusTooManyRequests
+	}
+	return !errors.Is(err, os.ErrNotExist)
+}
+
+// try makes a request like do once, sending the body of the given size and SHA-256 hash from its
+// start.
+func (s *Store) try(method, key string, query url.Values, body io.ReadSeeker, size int64, hash string) (*http.Response, error) {
+	var reader io.Reader
+	if body != nil {
+		if _, err := body.Seek(0, io.SeekStart); err != nil {
+			return nil, err
+		}
+		reader = body
+	}
+	req, err := http.NewRequest(method, s.objectURL(key, query).String(), reader)
+	if err != nil {
+		return nil, err
+	}
+	if body != nil {
+		req.ContentLength = size
+		if size == 0 {
+			req.Body = http.NoBody
+		}
+	}
+	req.Header.Set("X-Amz-Content-Sha256", hash)
+	s.sign(req, time.Now())
+	resp, err := s.config.Client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode >= 200 && resp.StatusCode < 300 {
+		return resp, nil
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode == http.StatusNotFound && query.Get("uploadId") == "" {
+		return nil, fmt.Errorf("s3store %s has no object %s: %w", s.config.Bucket, key, os.ErrNotExist)
+	}
+	var msg struct {
+		Code    string
+		Message string
+	}
+	xml.NewDecoder(io.LimitReader(resp.Body, 1<<16)).Decode(&msg)
+	return nil, &statusError{method: method, object: s.config.Prefix + key, status: resp.StatusCode,
+		text: strings.TrimSpace(resp.Status + " " + msg.Code + " " + msg.Message)}
+}
+
+// sign signs req at time t with AWS Signature Version 4, covering the host and all headers set.
+func (s *Store) sign(req *http.Request, t time.Time) {
+	t = t.UTC()
+	date := t.Format("20060102")
+	req.Header.Set("X-Amz-Date", t.Format("20060102T150405Z"))
+	if req.Header.Get("X-Amz-Content-Sha256") == "" {
+		hash := sha256.Sum256(nil)
+		req.Header.Set("X-Amz-Content-Sha256", hex.EncodeToString(hash[:]))
+	}
+	if s.config.SessionToken != "" {
+		req.Header.Set("X-Amz-Security-Token", s.config.SessionToken)
+	}
+	headers := map[string]string{"host": req.URL.Host}
+	for name, values := range req.Header {
+		headers[strings.ToLower(name)] = strings.Join(values, ",")
+	}
+	names := make([]string, 0, len(headers))
+	for name := range headers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	var canonical strings.Builder
+	canonical.WriteString(req.Method + "\n" + req.URL.EscapedPath() + "\n" + req.URL.RawQuery + "\n")
+	for _, name := range names {
+		canonical.WriteString(name + ":" + strings.TrimSpace(headers[name]) + "\n")
+	}
+	signed := strings.Join(names, ";")
+	canonical.WriteString("\n" + signed + "\n" + req.Header.Get("X-Amz-Content-Sha256"))
+	scope := date + "/" + s.config.Region + "/s3/aws4_request"
+	hash := sha256.Sum256([]byte(canonical.String()))
+	toSign := "AWS4-HMAC-SHA256\n" + req.Header.Get("X-Amz-Date") + "\n" + scope + "\n" + hex.EncodeToString(hash[:])
+	key := []byte("AWS4" + s.config.SecretKey)
+	for _, part := range []string{date, s.config.Region, "s3", "aws4_request"} {
+		key = hmacSHA256(key, part)
+	}
+	req.Header.Set("Authorization", fmt.Sprintf("AWS4-HMAC-SHA256 Credential=%s/%s, SignedHeaders=%s, Signature=%s",
+		s.config.AccessKey, scope, signed, hex.EncodeToString(hmacSHA256(key, toSign))))
+}
+
+// hmacSHA256 returns the HMAC-SHA256 of data with key.
+func hmacSHA256(key []byte, data string) []byte {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(data))
+	return mac.Sum(nil)
+}
+
+// escapePath escapes path as in the canonical requests of Signature Version 4, which escape all
+// bytes but unreserved characters and slashes.
+func escapePath(path string) string {
+	var b strings.Builder
+	for i := 0; i < len(path); i++ {
+		c := path[i]
+		if c == '/' || unreserved(c) {
+			b.WriteByte(c)
+		} else {
+			fmt.Fprintf(&b, "%%%02X", c)
+		}
+	}
+	return b.String()
+}
+
+// canonicalQuery returns the query sorted by name with names and values escaped as in canonical
+// requests of Signature Version 4.
+func canonicalQuery(query url.Values) string {
+	names := make([]string, 0, len(query))
+	for name := range query {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	var parts []string
+	for _, name := range names {
+		for _, value := range query[name] {
+			parts = append(parts, escapeQuery(name)+"="+escapeQuery(value))
+		}
+	}
+	return strings.Join(parts, "&")
+}
+
+// escapeQuery escapes all bytes of s but unreserved characters.
+func escapeQuery(s string) string {
+	return strings.ReplaceAll(escapePath(s), "/", "%2F")
+}
+
+// unreserved returns true if c is an unreserved character of RFC 3986.
+func unreserved(c byte) bool {
+	return 'A' <= c && c <= 'Z' || 'a' <= c && c <= 'z' || '0' <= c && c <= '9' || c == '-' || c == '.' || c == '_' || c == '~'
+}
@@ -0,0 +1,433 @@
+package filestore
+
+import (
+	"database/sql"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/rasteric/flags"
+)
+
+// schema contains the statements creating the tables and indexes of the database.
+var schema = []string{
+	"create table if not exists Files (file_id integer primary key, checksum text not null, size integer not null default 0, stored integer not null default 0, chunked integer not null default 0, hash text not null default 'blake2b-512', codec text not null default 'none', sealed_key blob, origin text);",
+	"create unique index if not exists Files_Index on Files(checksum);",
+	"create table if not exists Chunks (chunk_id integer primary key, checksum text not null, codec text not null default 'none', sealed_key blob, size integer not null, stored integer not null);",
+	"create unique index if not exists Chunks_Index on Chunks(checksum);",
+	"create table if not exists FileChunks (file integer not null, seq integer not null, chunk integer not null, primary key(file, seq), foreign key(file) references Files(file_id), foreign key(chunk) references Chunks(chunk_id));",
+	"create index if not exists FileChunks_Chunk on FileChunks(chunk);",
+	"create table if not exists Infos (info_id integer primary key, info text not null, fuzzy text not null);",
+	"create unique index if not exists Infos_Index on Infos(info);",
+	"create table if not exists Versions (version_id integer primary key, path text not null, info_id integer not null, version text not null, date text not null, file integer, uuid text, mode integer not null default 0, mtime integer not null default 0, seq integer not null default 0, foreign key(info_id) references Infos(info_id), foreign key(file) references Files(file_id));",
+	"create unique index if not exists Versions_UUID on Versions(uuid);",
+	"create index if not exists Versions_PathSeq on Versions(path, seq);",
+	"create table if not exists PathSeqs (path text primary key, seq integer not null);",
+	// numbers the versions of each path in the order they are added, without reusing the numbers
+	// of deleted versions
+	"create trigger if not exists Versions_Seq after insert on Versions when new.seq=0 begin insert into PathSeqs(path, seq) values(new.path, 1) on conflict(path) do update set seq=seq+1; update Versions set seq=(select seq from PathSeqs where path=new.path) where version_id=new.version_id; end;",
+	"create view if not exists VersionsText as select version_id, path, info, fuzzy, version, date, file from Versions inner join Infos on Versions.info_id=Infos.info_id;",
+	"create table if not exists History (history_id integer primary key, path text not null, kind text not null, target text not null, version integer not null, date text not null, reason text not null default '', username text not null default '');",
+	"create index if not exists History_Path on History(path);",
+	"create table if not exists Snapshots (snapshot_id integer primary key, name text not null, root text not null, date text not null);",
+	"create table if not exists SnapshotEntries (snapshot integer not null, rel text not null, version integer, foreign key(snapshot) references Snapshots(snapshot_id), foreign key(version) references Versions(version_id));",
+	"create index if not exists SnapshotEntries_Snapshot on SnapshotEntries(snapshot);",
+	"create table if not exists Summaries (summary_of integer primary key, bytes_added integer not null, bytes_removed integer not null, lines_added integer not null, lines_removed integer not null, is_text integer not null, foreign key(summary_of) references Versions(version_id));",
+	"create table if not exists Tags (version integer not null, tag text not null, primary key(version, tag), foreign key(version) references Versions(version_id));",
+	"create index if not exists Tags_Tag on Tags(tag);",
+	"create table if not exists Settings (name text primary key, value text not null);",
+	"create table if not exists Pins (version integer primary key, foreign key(version) references Versions(version_id));",
+	"create table if not exists Signatures (version integer primary key, signature blob not null, foreign key(version) references Versions(version_id));",
+	"create table if not exists Xattrs (version integer not null, name text not null, value blob not null, primary key(version, name), foreign key(version) references Versions(version_id));",
+	"create table if not exists Leases (lease_id text primary key, checksum text not null, expires text not null);",
+	"create index if not exists Leases_Checksum on Leases(checksum);",
+}
+
+// ftsSchema returns the statement creating the full text search index with the given FTS5
+// tokenizer, which is not available if SQLite has been compiled without FTS5.
+func ftsSchema(tokenizer string) string {
+	return "create virtual table if not exists VersionsFts using FTS5 (content='VersionsText',content_rowid='version_id',prefix='2 3 4',tokenize='" +
+		strings.ReplaceAll(tokenizer, "'", "''") + "',version_id,path,info,fuzzy,version,date,file);"
+}
+
+// ftsTriggers keep the full text search index up to date with the versions, whose infos must
+// still exist when they are deleted. They are only created together with the index.
+var ftsTriggers = []string{
+	"create trigger if not exists VersionsFts_Insert after insert on Versions begin " + ftsInsertNew + " end;",
+	"create trigger if not exists VersionsFts_Delete after delete on Versions begin " + ftsDeleteOld + " end;",
+	"create trigger if not exists VersionsFts_Update after update of path, info_id, version, date, file on Versions begin " + ftsDeleteOld + " " + ftsInsertNew + " end;",
+}
+
+// ftsInsertNew adds the new row of a trigger on Versions to the full text search index.
+const ftsInsertNew = "insert into VersionsFts(rowid, version_id, path, info, fuzzy, version, date, file) select version_id, version_id, path, info, fuzzy, version, date, file from VersionsText where version_id=new.version_id;"
+
+// ftsDeleteOld removes the old row of a trigger on Versions from the full text search index,
+// which needs the values that were indexed.
+const ftsDeleteOld = "insert into VersionsFts(VersionsFts, rowid, version_id, path, info, fuzzy, version, date, file) select 'delete', old.version_id, old.version_id, old.path, info, fuzzy, old.version, old.date, old.file from Infos where info_id=old.info_id;"
+
+// ftsVocabSchema creates the table listing the terms of the full text search index by column,
+// which is used for search suggestions.
+const ftsVocabSchema = "create virtual table if not exists VersionsFtsVocab using fts5vocab(VersionsFts, col);"
+
+// migrations update the database of a filestore created by an earlier version of this package
+// to the current schema. The user_version of the database is the number of migrations applied
+// to it. New databases are created with the current schema and need no migrations.
+var migrations = []func(fs *Filestore, tx *sql.Tx) error{
+	migrateFileSizes,
+	migrateInfos,
+	migrateChunked,
+	migrateHash,
+	migrateCodecs,
+	migrateKeys,
+	migrateOrigins,
+	migrateUUIDs,
+	migrateAttributes,
+	migrateSeqs,
+	migrateDates,
+}
+
+// createTables creates the tables and indexes of the database unless they exist, and migrates
+// existing databases to the current schema.
+func (fs *Filestore) createTables() error {
+	var exists bool
+	if err := fs.db.QueryRow("select exists (select 1 from sqlite_master where type='table' and name='Files');").Scan(&exists); err != nil {
+		return fs.dbError(err)
+	}
+	if exists {
+		if err := fs.migrate(); err != nil {
+			return err
+		}
+	}
+	for _, stmt := range schema {
+		if _, err := fs.db.Exec(stmt); err != nil {
+			return fs.dbError(err)
+		}
+	}
+	tokenizer, err := fs.ftsTokenizer(exists)
+	if err != nil {
+		return err
+	}
+	if _, err := fs.db.Exec(ftsSchema(tokenizer)); err == nil {
+		fs.db.Exec(ftsVocabSchema)
+		if err := fs.createFtsTriggers(); err != nil {
+			return err
+		}
+	} else if !exists && tokenizer != TokenizerUnicode61 {
+		// without FTS5, new filestores silently do without the index unless a tokenizer was chosen
+		return fmt.Errorf("filestore could not create the full text index with tokenizer %q: %w", tokenizer, err)
+	}
+	if !exists {
+		if _, err := fs.db.Exec(fmt.Sprintf("pragma user_version=%d;", len(migrations))); err != nil {
+			return fs.dbError(err)
+		}
+	}
+	return nil
+}
+
+// createFtsTriggers creates the triggers maintaining the full text search index unless they exist.
+// The index of filestores created without them is rebuilt, since it misses the versions added
+// before.
+func (fs *Filestore) createFtsTriggers() error {
+	var exists bool
+	if err := fs.db.QueryRow("select exists (select 1 from sqlite_master where type='trigger' and name='VersionsFts_Insert');").Scan(&exists); err != nil {
+		return fs.dbError(err)
+	}
+	if exists {
+		return nil
+	}
+	tx, err := fs.db.Begin()
+	if err != nil {
+		return fs.dbError(err)
+	}
+	for _, stmt := range append(ftsTriggers, ftsRebuild) {
+		if _, err := tx.Exec(stmt); err != nil {
+			tx.Rollback()
+			return fs.dbError(err)
+		}
+	}
+	if err := tx.Commit(); err != nil {
+		return fs.dbError(err)
+	}
+	return nil
+}
+
+// migrate applies the migrations that have not been applied to the database yet, each within
+// its own transaction.
+func (fs *Filestore) migrate() error {
+	var version int
+	if err := fs.db.QueryRow("pragma user_version;").Scan(&version); err != nil {
+		return fs.dbError(err)
+	}
+	for ; version < len(migrations); version++ {
+		tx, err := fs.db.Begin()
+		if err != nil {
+			return fs.dbError(err)
+		}
+		if err := migrations[version](fs, tx); err != nil {
+			tx.Rollback()
+			return fmt.Errorf("filestore failed to migrate database to version %d: %w", version+1, err)
+		}
+		if _, err := tx.Exec(fmt.Sprintf("pragma user_version=%d;", version+1)); err != nil {
+			tx.Rollback()
+			return fs.dbError(err)
+		}
+		if err := tx.Commit(); err != nil {
+			return fs.dbError(err)
+		}
+	}
+	return nil
+}
+
+// checkMigrated returns ErrNeedsMigration unless all migrations have been applied to the
+// database, which read-only filestores cannot do.
+func (fs *Filestore) checkMigrated() error {
+	var version int
+	if err := fs.db.QueryRow("pragma user_version;").Scan(&version); err != nil {
+		return fs.dbError(err)
+	}
+	if version < len(migrations) {
+		return ErrNeedsMigration
+	}
+	return nil
+}
+
+// migrateFileSizes adds the decompressed and stored sizes of blobs to the Files table.
+func migrateFileSizes(fs *Filestore, tx *sql.Tx) error {
+	if _, err := tx.Exec("alter table Files add column size integer not null default 0;"); err != nil {
+		return err
+	}
+	if _, err := tx.Exec("alter table Files add column stored integer not null default 0;"); err != nil {
+		return err
+	}
+	rows, err := tx.Query("select file_id, checksum from Files;")
+	if err != nil {
+		return err
+	}
+	checksums := make(map[int64]string)
+	for rows.Next() {
+		var id int64
+		var checksum string
+		if err := rows.Scan(&id, &checksum); err != nil {
+			rows.Close()
+			return err
+		}
+		checksums[id] = checksum
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return err
+	}
+	for id, checksum := range checksums {
+		// blobs were compressed with Snappy if the filestore had the Compress option
+		c := codecs[CompressionNone]
+		if flags.Has(fs.Options, Compress) {
+			c = codecs[CompressionSnappy]
+		}
+		blob := fs.blobFile("", checksum, c)
+		info, err := os.Stat(blob)
+		if os.IsNotExist(err) {
+			continue
+		}
+		if err != nil {
+			return err
+		}
+		size := info.Size()
+		if r, err := fs.openBlobFile("", checksum, c); err == nil {
+			size, err = io.Copy(io.Discard, r)
+			r.Close()
+			if err != nil {
+				return err
+			}
+		}
+		if _, err := tx.Exec("update Files set size=?, stored=? where file_id=?;", size, info.Size(), id); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// migrateInfos moves the info strings of versions into the Infos table, so that each distinct
+// info string is stored only once. The Versions table is copied rather than altered, since
+// SQLite can only drop columns since version 3.35. The full text search index had the Versions
+// table as its content and is recreated for the VersionsText view and rebuilt, unless SQLite has
+// been compiled without FTS5.
+func migrateInfos(fs *Filestore, tx *sql.Tx) error {
+	stmts := []string{
+		"drop table if exists VersionsFts;",
+		"create table if not exists Infos (info_id integer primary key, info text not null, fuzzy text not null);",
+		"create unique index if not exists Infos_Index on Infos(info);",
+		"insert or ignore into Infos(info, fuzzy) select info, fuzzy from Versions;",
+		"create table VersionsNew (version_id integer primary key, path text not null, info_id integer not null, version text not null, date text not null, file integer, foreign key(info_id) references Infos(info_id), foreign key(file) references Files(file_id));",
+		"insert into VersionsNew(version_id, path, info_id, version, date, file) select version_id, path, (select info_id from Infos where Infos.info=Versions.info), version, date, file from Versions;",
+		"drop table Versions;",
+		"alter table VersionsNew rename to Versions;",
+		"create view if not exists VersionsText as select version_id, path, info, fuzzy, version, date, file from Versions inner join Infos on Versions.info_id=Infos.info_id;",
+	}
+	for _, stmt := range stmts {
+		if _, err := tx.Exec(stmt); err != nil {
+			return err
+		}
+	}
+	if _, err := tx.Exec(ftsSchema(TokenizerUnicode61)); err != nil {
+		// without FTS5, the filestore does without the index
+		return nil
+	}
+	for _, stmt := range append(ftsTriggers, ftsRebuild) {
+		if _, err := tx.Exec(stmt); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// migrateChunked adds the column recording whether the contents of a file are stored in chunks.
+func migrateChunked(fs *Filestore, tx *sql.Tx) error {
+	_, err := tx.Exec("alter table Files add column chunked integer not null default 0;")
+	return err
+}
+
+// migrateHash adds the column recording the hash algorithm of the checksum of a file. Earlier
+// versions of this package only used Blake2b-512.
+func migrateHash(fs *Filestore, tx *sql.Tx) error {
+	_, err := tx.Exec("alter table Files add column hash text not null default 'blake2b-512';")
+	return err
+}
+
+// migrateCodecs adds the columns recording the codecs of blobs and chunks. Earlier versions of
+// this package compressed all of them with Snappy if the filestore had the Compress option.
+// Databases created before chunks were supported get the Chunks table with the current schema.
+func migrateCodecs(fs *Filestore, tx *sql.Tx) error {
+	chunks, err := hasTable(tx, "Chunks")
+	if err != nil {
+		return err
+	}
+	stmts := []string{"alter table Files add column codec text not null default 'none';"}
+	if chunks {
+		stmts = append(stmts, "alter table Chunks add column codec text not null default 'none';")
+	}
+	if flags.Has(fs.Options, Compress) {
+		stmts = append(stmts, "update Files set codec='snappy';")
+		if chunks {
+			stmts = append(stmts, "update Chunks set codec='snappy';")
+		}
+	}
+	for _, stmt := range stmts {
+		if _, err := tx.Exec(stmt); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// migrateKeys adds the columns holding the sealed data keys of encrypted blobs and chunks.
+func migrateKeys(fs *Filestore, tx *sql.Tx) error {
+	chunks, err := hasTable(tx, "Chunks")
+	if err != nil {
+		return err
+	}
+	if _, err := tx.Exec("alter table Files add column sealed_key blob;"); err != nil {
+		return err
+	}
+	if chunks {
+		if _, err := tx.Exec("alter table Chunks add column sealed_key blob;"); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// migrateOrigins adds the column recording the filestore from which the blob of contents pulled
+// with PullMetadata has yet to be fetched.
+func migrateOrigins(fs *Filestore, tx *sql.Tx) error {
+	_, err := tx.Exec("alter table Files add column origin text;")
+	return err
+}
+
+// migrateUUIDs adds the column holding the UUIDs of versions and gives existing versions UUIDs.
+func migrateUUIDs(fs *Filestore, tx *sql.Tx) error {
+	if _, err := tx.Exec("alter table Versions add column uuid text;"); err != nil {
+		return err
+	}
+	rows, err := tx.Query("select version_id from Versions;")
+	if err != nil {
+		return err
+	}
+	var ids []int64
+	for rows.Next() {
+		var id int64
+		if err := rows.Scan(&id); err != nil {
+			rows.Close()
+			return err
+		}
+		ids = append(ids, id)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return err
+	}
+	for _, id := range ids {
+		uuid, err := fs.newUUID()
+		if err != nil {
+			return err
+		}
+		if _, err := tx.Exec("update Versions set uuid=? where version_id=?;", uuid, id); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// migrateAttributes adds the columns recording the permission bits and modification times of the
+// source files of versions, which are unknown for existing versions.
+func migrateAttributes(fs *Filestore, tx *sql.Tx) error {
+	if _, err := tx.Exec("alter table Versions add column mode integer not null default 0;"); err != nil {
+		return err
+	}
+	_, err := tx.Exec("alter table Versions add column mtime integer not null default 0;")
+	return err
+}
+
+// migrateSeqs adds the sequence numbers of versions among the versions of their paths, which
+// are assigned to the existing versions in the order they were added.
+func migrateSeqs(fs *Filestore, tx *sql.Tx) error {
+	stmts := []string{
+		"alter table Versions add column seq integer not null default 0;",
+		"update Versions set seq=(select count(*) from Versions as V where V.path=Versions.path and (V.date < Versions.date or V.date=Versions.date and V.version_id <= Versions.version_id));",
+		"create table if not exists PathSeqs (path text primary key, seq integer not null);",
+		"insert into PathSeqs(path, seq) select path, max(seq) from Versions group by path;",
+	}
+	for _, stmt := range stmts {
+		if _, err := tx.Exec(stmt); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// migrateDates converts the dates of versions, history entries, snapshots and leases from
+// seconds to RFC 3339 with nanoseconds, which sort as strings with the new dates.
+func migrateDates(fs *Filestore, tx *sql.Tx) error {
+	columns := []struct{ table, column string }{{"Versions", "date"}, {"History", "date"}, {"Snapshots", "date"}, {"Leases", "expires"}}
+	for _, c := range columns {
+		exists, err := hasTable(tx, c.table)
+		if err != nil {
+			return err
+		}
+		if !exists {
+			continue
+		}
+		if _, err := tx.Exec(fmt.Sprintf("update %[1]s set %[2]s=replace(%[2]s, ' ', 'T') || '.000000000Z' where %[2]s glob '[0-9][0-9][0-9][0-9]-[0-9][0-9]-[0-9][0-9] [0-9][0-9]:[0-9][0-9]:[0-9][0-9]';",
+			c.table, c.column)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// hasTable returns true if the database has a table with the given name.
+func hasTable(tx *sql.Tx, name string) (bool, error) {
+	var exists bool
+	err := tx.QueryRow("select exists (select 1 from sqlite_master where type='table' and name=?);", name).Scan(&exists)
+	return exists, err
+}
@@ -0,0 +1,194 @@
+package filestore
+
+import (
+	"crypto/ed25519"
+	"database/sql"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/golang/snappy"
+)
+
+func TestMigrateInfos(t *testing.T) {
+	fs := NewFilestore(filepath.Join(t.TempDir(), "store"), 0)
+	if err := os.MkdirAll(fs.Root(), 0755); err != nil {
+		t.Fatal(err)
+	}
+	// create the database as it was before the info strings were moved into the Infos table
+	db, err := sql.Open(driverName, fs.dbPath())
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, stmt := range []string{
+		"create table Files (file_id integer primary key, checksum text not null);",
+		"create unique index Files_Index on Files(checksum);",
+		"create table Versions (version_id integer primary key, path text not null, info text not null, fuzzy text not null, version text not null, date text not null, file integer, foreign key(file) references Files(file_id));",
+		"insert into Files(checksum) values('0123');",
+		"insert into Versions(path, info, fuzzy, version, date, file) values('/a.txt', 'invoice', 'invoice', '1', '2020-01-02 03:04:05', 1), ('/b.txt', 'receipt', 'receipt', '1', '2020-01-02 03:04:05', 1), ('/a.txt', 'invoice', 'invoice', '2', '2020-01-03 03:04:05', 1);",
+	} {
+		if _, err := db.Exec(stmt); err != nil {
+			t.Fatal(err)
+		}
+	}
+	_, ftsErr := db.Exec("create virtual table VersionsFts using FTS5 (content='Versions',prefix='2 3 4',version_id,path,info,fuzzy,version,date,file);")
+	db.Close()
+	openTestStore(t, fs)
+	versions, err := fs.Versions("/a.txt", -1)
+	if err != nil || len(versions) != 2 || versions[0].Info != "invoice" || versions[0].Version != "2" {
+		t.Fatalf("Versions = %v, %v, want 2 versions with their infos", versions, err)
+	}
+	var infos int
+	if err := fs.db.QueryRow("select count(*) from Infos;").Scan(&infos); err != nil || infos != 2 {
+		t.Fatalf("%d infos, %v, want 2", infos, err)
+	}
+	if ftsErr != nil {
+		return
+	}
+	found, err := fs.Search("invoice", -1)
+	if err != nil || len(found) != 2 {
+		t.Fatalf("Search = %v, %v, want the 2 versions of /a.txt", found, err)
+	}
+}
+
+func TestMigrateFileSizes(t *testing.T) {
+	fs := NewFilestore(filepath.Join(t.TempDir(), "store"), Compress)
+	// write a blob compressed with Snappy and a database as they were before sizes were recorded
+	if err := os.MkdirAll(fs.Root()+"0123", 0755); err != nil {
+		t.Fatal(err)
+	}
+	f, err := os.Create(fs.localPath("a.txt", "0123") + ".snappy")
+	if err != nil {
+		t.Fatal(err)
+	}
+	w := snappy.NewBufferedWriter(f)
+	if _, err := w.Write([]byte("hello world")); err != nil {
+		t.Fatal(err)
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if err := f.Close(); err != nil {
+		t.Fatal(err)
+	}
+	db, err := sql.Open(driverName, fs.dbPath())
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, stmt := range []string{
+		"create table Files (file_id integer primary key, checksum text not null);",
+		"create table Versions (version_id integer primary key, path text not null, info text not null, fuzzy text not null, version text not null, date text not null, file integer, foreign key(file) references Files(file_id));",
+		"insert into Files(checksum) values('0123');",
+	} {
+		if _, err := db.Exec(stmt); err != nil {
+			t.Fatal(err)
+		}
+	}
+	db.Close()
+	openTestStore(t, fs)
+	var size, stored int64
+	if err := fs.db.QueryRow("select size, stored from Files;").Scan(&size, &stored); err != nil {
+		t.Fatal(err)
+	}
+	if size != 11 || stored == 0 {
+		t.Fatalf("size %d and stored size %d, want 11 and the size of the blob", size, stored)
+	}
+	var version int
+	if err := fs.db.QueryRow("pragma user_version;").Scan(&version); err != nil || version != len(migrations) {
+		t.Fatalf("user_version = %d, %v, want %d", version, err, len(migrations))
+	}
+}
+
+func TestMigrateSeqs(t *testing.T) {
+	fs, src := newTestStore(t)
+	path := filepath.Join(src, "a.txt")
+	for i := 0; i < 4; i++ {
+		addFile(t, fs, path, fmt.Sprint(i), "", "")
+	}
+	// remove the numbers as they were before they were introduced
+	tx, err := fs.db.Begin()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer tx.Rollback()
+	for _, stmt := range []string{
+		"drop table PathSeqs;",
+		"drop index Versions_PathSeq;",
+		"drop trigger Versions_Seq;",
+		"alter table Versions drop column seq;",
+	} {
+		if _, err := tx.Exec(stmt); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := migrateSeqs(fs, tx); err != nil {
+		t.Fatal(err)
+	}
+	if err := tx.Commit(); err != nil {
+		t.Fatal(err)
+	}
+	// the trigger numbering new versions is created when the filestore is opened
+	if err := fs.Close(); err != nil {
+		t.Fatal(err)
+	}
+	openTestStore(t, fs)
+	// existing versions are numbered by date
+	versions, err := fs.Versions(path, -1)
+	if err != nil || len(versions) != 4 || versions[0].Seq != 4 || versions[3].Seq != 1 {
+		t.Fatalf("Versions = %v, %v, want versions numbered from 1 to 4", versions, err)
+	}
+	if v := addFile(t, fs, path, "new", "", ""); v.Seq != 5 {
+		t.Fatalf("Seq = %d after migrating, want 5", v.Seq)
+	}
+}
+
+func TestMigrateDates(t *testing.T) {
+	fs := NewFilestore(filepath.Join(t.TempDir(), "store"), 0)
+	_, fs.SigningKey, _ = ed25519.GenerateKey(nil)
+	fs, src := openTestStore(t, fs)
+	path := filepath.Join(src, "a.txt")
+	v := addFile(t, fs, path, "a", "", "1")
+	latest := addFile(t, fs, path, "b", "", "2")
+	// date and sign the first version as earlier versions of the package did
+	legacy := "2021-05-06 07:08:09"
+	if _, err := fs.db.Exec("update Versions set date=? where version_id=?;", legacy, v.ID); err != nil {
+		t.Fatal(err)
+	}
+	if err := fs.signVersion(nil, v.ID); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := fs.db.Exec("insert into History(path, kind, target, version, date) values('x', 'deleted', '', 0, ?);", legacy); err != nil {
+		t.Fatal(err)
+	}
+	tx, err := fs.db.Begin()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer tx.Rollback()
+	if err := migrateDates(fs, tx); err != nil {
+		t.Fatal(err)
+	}
+	if err := tx.Commit(); err != nil {
+		t.Fatal(err)
+	}
+	var date string
+	if err := fs.db.QueryRow("select date from Versions where version_id=?;", v.ID).Scan(&date); err != nil || date != "2021-05-06T07:08:09.000000000Z" {
+		t.Fatalf("migrated date %q, %v, want %q", date, err, "2021-05-06T07:08:09.000000000Z")
+	}
+	old, err := fs.versionByID(fs.db, v.ID)
+	if err != nil || !old.From.Equal(time.Date(2021, 5, 6, 7, 8, 9, 0, time.UTC)) {
+		t.Fatalf("migrated version dated %v, %v, want 2021-05-06 07:08:09 UTC", old.From, err)
+	}
+	// signatures made with the old dates remain valid
+	for _, w := range []FileVersion{old, latest} {
+		if err := fs.VerifySignature(w); err != nil {
+			t.Fatalf("VerifySignature of version %s = %v", w.Version, err)
+		}
+	}
+	versions, err := fs.Versions(path, -1)
+	if err != nil || len(versions) != 2 || versions[1].ID != v.ID {
+		t.Fatalf("Versions = %v, %v, want the migrated version last", versions, err)
+	}
+}
@@ -0,0 +1,149 @@
+package filestore
+
+import (
+	"database/sql"
+	"errors"
+	"strings"
+	"time"
+)
+
+// ErrNoFTS is returned by ReindexFTS if the database has no full text search index, which is the
+// case if SQLite has been compiled without FTS5. Searches fail with an error of SQLite then.
+var ErrNoFTS = errors.New("filestore has no full text search index, since SQLite has been compiled without FTS5")
+
+// ftsRebuild rebuilds the full text search index from the versions.
+const ftsRebuild = "insert into VersionsFts(VersionsFts) values('rebuild');"
+
+// ReindexFTS rebuilds the full text search index from the versions. The index is kept up to date
+// as versions are added, changed and deleted, and the index of a filestore created by an earlier
+// version of this package is rebuilt when it is first opened, so this is only needed if the index
+// has been damaged. ErrNoFTS is returned if there is no index.
+func (fs *Filestore) ReindexFTS() (err error) {
+	op := newOp("ReindexFTS", fs.Dir)
+	defer op.done(&err)
+	if err := fs.ensureOpen(); err != nil {
+		return err
+	}
+	var fts bool
+	if err := fs.db.QueryRow("select exists (select 1 from sqlite_master where name='VersionsFts');").Scan(&fts); err != nil {
+		return fs.dbError(err)
+	}
+	if !fts {
+		return ErrNoFTS
+	}
+	if _, err := fs.db.Exec(ftsRebuild); err != nil {
+		return fs.dbError(err)
+	}
+	return nil
+}
+
+// SearchMode determines how the words given to SearchWords are combined.
+type SearchMode int
+
+const (
+	SearchAll    SearchMode = iota // versions must match all words
+	SearchAny                      // versions must match at least one of the words
+	SearchPhrase                   // versions must contain the words in order as a phrase
+)
+
+// SearchOptions are the options of SearchWordsWith.
+type SearchOptions struct {
+	Mode SearchMode // how the words are combined, all of them must match by default
+}
+
+// SearchWords performs a full text search for versions matching all of the given words, like
+// Search but with every word escaped by FTS5Escape, so that it is safe to pass words entered by
+// users. Words are matched as the Tokenizer of the index splits them, in full unless it is
+// TokenizerTrigram, without column filters or operators. Empty words are ignored and no versions
+// are returned if no words remain.
+func (fs *Filestore) SearchWords(words []string, limit int) (_ []FileVersion, err error) {
+	op := newOp("SearchWords", "")
+	defer op.done(&err)
+	if err := fs.ensureOpen(); err != nil {
+		return nil, err
+	}
+	return fs.searchWords(fs.db, words, limit, SearchOptions{})
+}
+
+// SearchWordsWith performs a search like SearchWords, but combines the words according to opts.
+func (fs *Filestore) SearchWordsWith(words []string, limit int, opts SearchOptions) (_ []FileVersion, err error) {
+	op := newOp("SearchWordsWith", "")
+	defer op.done(&err)
+	if err := fs.ensureOpen(); err != nil {
+		return nil, err
+	}
+	return fs.searchWords(fs.db, words, limit, opts)
+}
+
+func (fs *Filestore) searchWords(q querier, words []string, limit int, opts SearchOptions) ([]FileVersion, error) {
+	term := wordsTerm(words, opts.Mode)
+	if term == "" {
+		return make([]FileVersion, 0), nil
+	}
+	return fs.search(q, term, time.Time{}, time.Time{}, limit)
+}
+
+// SearchBetween performs a search like Search, but only returns versions added at or after from
+// and before to. A zero from or to leaves the range open on that side.
+func (fs *Filestore) SearchBetween(term string, from, to time.Time, limit int) (_ []FileVersion, err error) {
+	op := newOp("SearchBetween", "")
+	defer op.done(&err)
+	if err := fs.ensureOpen(); err != nil {
+		return nil, err
+	}
+	return fs.search(fs.db, term, from, to, limit)
+}
+
+// wordsTerm returns an FTS5 query term matching the non-empty words escaped and combined
+// according to mode, or the empty string if there are no such words.
+func wordsTerm(words []string, mode SearchMode) string {
+	escaped := make([]string, 0, len(words))
+	for _, word := range words {
+		if strings.TrimSpace(word) != "" {
+			escaped = append(escaped, FTS5Escape(word))
+		}
+	}
+	switch mode {
+	case SearchAny:
+		return strings.Join(escaped, " OR ")
+	case SearchPhrase:
+		// adjacent strings of a phrase are matched as one phrase
+		return strings.Join(escaped, " + ")
+	default:
+		return strings.Join(escaped, " AND ")
+	}
+}
+
+// Names of the FTS5 tokenizers that can be chosen for the full text search index by setting the
+// Tokenizer field of a Filestore before it is first opened.
+const (
+	TokenizerUnicode61    = "unicode61"                     // the default, which matches whole words ignoring case and single diacritics, so that "cafe" matches "Café"
+	TokenizerNoDiacritics = "unicode61 remove_diacritics 2" // matches whole words ignoring case and all diacritics, so that "viet" matches "Việt" as well
+	TokenizerTrigram      = "trigram"                       // matches any substring of at least three characters ignoring case
+)
+
+// tokenizerKey is the key under which the tokenizer of the full text search index is stored in
+// the Settings table.
+const tokenizerKey = "fts_tokenizer"
+
+// ftsTokenizer returns the tokenizer of the full text search index. The Tokenizer of the filestore
+// is recorded when the database is created, unless it exists already, in which case the index
+// has been created with TokenizerUnicode61 if no tokenizer is recorded.
+func (fs *Filestore) ftsTokenizer(exists bool) (string, error) {
+	var tokenizer string
+	err := fs.db.QueryRow("select value from Settings where name=?;", tokenizerKey).Scan(&tokenizer)
+	if err == nil {
+		return tokenizer, nil
+	}
+	if err != sql.ErrNoRows {
+		return "", fs.dbError(err)
+	}
+	tokenizer = TokenizerUnicode61
+	if !exists && fs.Tokenizer != "" {
+		tokenizer = fs.Tokenizer
+	}
+	if _, err := fs.db.Exec("insert into Settings(name, value) values(?, ?);", tokenizerKey, tokenizer); err != nil {
+		return "", fs.dbError(err)
+	}
+	return tokenizer, nil
+}
@@ -0,0 +1,212 @@
+package filestore
+
+import (
+	"fmt"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestSearchMalformedTerm(t *testing.T) {
+	fs, src := newTestStore(t)
+	requireFTS(t, fs)
+	addFile(t, fs, filepath.Join(src, "a.txt"), "a", "invoice", "1")
+	if versions, err := fs.Search("invoice", 10); err != nil || len(versions) != 1 {
+		t.Fatalf("Search = %v, %v, want one version", versions, err)
+	}
+	// FTS5 reports syntax errors while stepping through the results
+	if versions, err := fs.Search(`"invoice`, 10); err == nil {
+		t.Fatalf("Search of a malformed term = %v without error", versions)
+	}
+}
+
+func TestSuggest(t *testing.T) {
+	fs, src := newTestStore(t)
+	requireFTS(t, fs)
+	addFile(t, fs, filepath.Join(src, "report.txt"), "a", "Reporting quarterly", "1")
+	addFile(t, fs, filepath.Join(src, "b.txt"), "b", "report repository", "1")
+	// report occurs in both versions, so it is suggested first
+	terms, err := fs.Suggest("Rep", 10)
+	if err != nil || len(terms) < 3 || terms[0] != "report" {
+		t.Fatalf("Suggest = %v, %v, want report first", terms, err)
+	}
+	if terms, err := fs.Suggest("rep", 1); err != nil || len(terms) != 1 {
+		t.Fatalf("Suggest with limit 1 = %v, %v, want one term", terms, err)
+	}
+}
+
+func TestSearchWords(t *testing.T) {
+	fs, src := newTestStore(t)
+	requireFTS(t, fs)
+	for i, info := range []string{"quarterly sales report", "sales figures", `report on "quotes" AND stuff`} {
+		addFile(t, fs, filepath.Join(src, fmt.Sprintf("%d.txt", i)), info, info, "")
+	}
+	for _, c := range []struct {
+		words []string
+		mode  SearchMode
+		want  int
+	}{
+		{[]string{"sales", "report"}, SearchAll, 1},
+		{[]string{"sales", "report"}, SearchAny, 3},
+		{[]string{"sales", "report"}, SearchPhrase, 1},
+		{[]string{"report", "sales"}, SearchPhrase, 0},
+		// FTS5 syntax is matched literally
+		{[]string{`"quotes"`, "AND", "NOT", "(", "*"}, SearchAny, 1},
+		{[]string{"", " "}, SearchAny, 0},
+	} {
+		versions, err := fs.SearchWordsWith(c.words, 10, SearchOptions{Mode: c.mode})
+		if err != nil || len(versions) != c.want {
+			t.Fatalf("SearchWordsWith(%q, mode %v) = %v, %v, want %d versions", c.words, c.mode, versions, err, c.want)
+		}
+	}
+	if versions, err := fs.SearchWords([]string{"figures"}, 10); err != nil || len(versions) != 1 {
+		t.Fatalf("SearchWords = %v, %v, want 1 version", versions, err)
+	}
+}
+
+func TestSearchRanked(t *testing.T) {
+	fs, src := newTestStore(t)
+	requireFTS(t, fs)
+	infos := []string{"apple banana cherry dates elderberry figs grapes", "apple apple apple", "banana only"}
+	for i, info := range infos {
+		addFile(t, fs, filepath.Join(src, fmt.Sprintf("%d.txt", i)), info, info, "")
+	}
+	versions, err := fs.Search("apple", 10)
+	if err != nil || len(versions) != 2 {
+		t.Fatalf("Search = %v, %v, want 2 versions", versions, err)
+	}
+	if versions[0].Info != infos[1] || versions[0].Score <= versions[1].Score || versions[1].Score <= 0 {
+		t.Fatalf("Search ranked %q with score %v before %q with score %v, want the most relevant first", versions[0].Info, versions[0].Score, versions[1].Info, versions[1].Score)
+	}
+	if versions, err = fs.SearchWords([]string{"banana"}, 10); err != nil || len(versions) != 2 || versions[0].Info != infos[2] {
+		t.Fatalf("SearchWords = %v, %v, want %q first", versions, err, infos[2])
+	}
+	// only search results have scores
+	if v, err := fs.Get(filepath.Join(src, "0.txt")); err != nil || v.Score != 0 {
+		t.Fatalf("Get = score %v, %v, want no score", v.Score, err)
+	}
+}
+
+func TestFTSTriggers(t *testing.T) {
+	fs, src := newTestStore(t)
+	requireFTS(t, fs)
+	path := filepath.Join(src, "a.txt")
+	addFile(t, fs, path, "a", "zebra crossing", "1")
+	addFile(t, fs, path, "b", "zebra stripes", "2")
+	search := func(want int) []FileVersion {
+		t.Helper()
+		versions, err := fs.SearchWords([]string{"zebra"}, 10)
+		if err != nil || len(versions) != want {
+			t.Fatalf("SearchWords = %v, %v, want %d versions", versions, err, want)
+		}
+		return versions
+	}
+	// the index follows added and deleted versions
+	if err := fs.DeleteVersion(search(2)[0]); err != nil {
+		t.Fatal(err)
+	}
+	search(1)
+	if _, err := fs.db.Exec("insert into VersionsFts(VersionsFts, rank) values('integrity-check', 1);"); err != nil {
+		t.Fatalf("integrity check of the index: %v", err)
+	}
+	// filestores created before the triggers are reindexed when they are opened
+	for _, name := range []string{"VersionsFts_Insert", "VersionsFts_Delete", "VersionsFts_Update"} {
+		if _, err := fs.db.Exec("drop trigger " + name + ";"); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if _, err := fs.db.Exec("insert into VersionsFts(VersionsFts) values('delete-all');"); err != nil {
+		t.Fatal(err)
+	}
+	search(0)
+	if err := fs.Close(); err != nil {
+		t.Fatal(err)
+	}
+	openTestStore(t, fs)
+	search(1)
+	if _, err := fs.db.Exec("insert into VersionsFts(VersionsFts) values('delete-all');"); err != nil {
+		t.Fatal(err)
+	}
+	if err := fs.ReindexFTS(); err != nil {
+		t.Fatal(err)
+	}
+	search(1)
+}
+
+func TestTokenizer(t *testing.T) {
+	for _, c := range []struct {
+		tokenizer, word string
+		want            int
+	}{
+		{"", "cafe", 1},
+		{"", "viet", 0},
+		{TokenizerNoDiacritics, "viet", 1},
+		{TokenizerTrigram, "AF\u00c9", 1},
+		{TokenizerTrigram, "rapp", 1},
+		{TokenizerUnicode61, "rapp", 0},
+	} {
+		fs := NewFilestore(filepath.Join(t.TempDir(), "store"), 0)
+		fs.Tokenizer = c.tokenizer
+		fs, src := openTestStore(t, fs)
+		requireFTS(t, fs)
+		addFile(t, fs, filepath.Join(src, "a.txt"), "a", "Caf\u00e9 Vi\u1ec7t Bericht Stadtrapport", "1")
+		if err := fs.Close(); err != nil {
+			t.Fatal(err)
+		}
+		// the tokenizer the index was created with is kept
+		fs.Tokenizer = "porter"
+		openTestStore(t, fs)
+		if _, err := fs.Repair(RepairOptions{}); err != nil {
+			t.Fatal(err)
+		}
+		if versions, err := fs.SearchWords([]string{c.word}, 10); err != nil || len(versions) != c.want {
+			t.Fatalf("SearchWords(%q) with tokenizer %q = %v, %v, want %d versions", c.word, c.tokenizer, versions, err, c.want)
+		}
+		if err := fs.Close(); err != nil {
+			t.Fatal(err)
+		}
+	}
+	fs := NewFilestore(filepath.Join(t.TempDir(), "store"), 0)
+	fs.Tokenizer = "nonsense"
+	if err := fs.Open(); err == nil {
+		fs.Close()
+		t.Fatal("Open with an unknown tokenizer succeeded")
+	}
+}
+
+func TestBetween(t *testing.T) {
+	fs, src := newTestStore(t)
+	requireFTS(t, fs)
+	path := filepath.Join(src, "a.txt")
+	for i := 0; i < 5; i++ {
+		addFile(t, fs, path, fmt.Sprint(i), "monthly report", "")
+	}
+	// date the versions a month apart
+	base := time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+	versions, err := fs.Versions(path, -1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i, v := range versions {
+		if _, err := fs.db.Exec("update Versions set date=? where version_id=?;", ToDBDate(base.AddDate(0, i, 0)), v.ID); err != nil {
+			t.Fatal(err)
+		}
+	}
+	from, to := base.AddDate(0, 1, 0), base.AddDate(0, 3, 0)
+	if versions, err = fs.VersionsBetween(path, from, to, -1); err != nil || len(versions) != 2 || !versions[0].From.Equal(base.AddDate(0, 2, 0)) {
+		t.Fatalf("VersionsBetween = %v, %v, want the 2 versions from %v to %v", versions, err, from, to)
+	}
+	if versions, err = fs.VersionsBetween(path, time.Time{}, to, -1); err != nil || len(versions) != 3 {
+		t.Fatalf("VersionsBetween = %v, %v, want the 3 versions before %v", versions, err, to)
+	}
+	// the time zone of the bounds does not matter
+	if versions, err = fs.VersionsBetween(path, from.In(time.FixedZone("UTC+1", 3600)), time.Time{}, 2); err != nil || len(versions) != 2 {
+		t.Fatalf("VersionsBetween = %v, %v, want 2 versions", versions, err)
+	}
+	if versions, err = fs.SearchBetween("report", from, to, 10); err != nil || len(versions) != 2 {
+		t.Fatalf("SearchBetween = %v, %v, want 2 versions", versions, err)
+	}
+	if versions, err = fs.SearchBetween("report", time.Time{}, time.Time{}, 10); err != nil || len(versions) != 5 {
+		t.Fatalf("SearchBetween = %v, %v without bounds, want all 5 versions", versions, err)
+	}
+}
@@ -0,0 +1,96 @@
+package filestore
+
+import (
+	"container/list"
+	"sync"
+)
+
+// segmentSize is the size of the decompressed segments of compressed blobs held in a segmentCache.
+const segmentSize = 64 << 10
+
+// segmentKey identifies a decompressed segment of a blob.
+type segmentKey struct {
+	checksum string // the checksum of the blob
+	index    int64  // the segment covers bytes index*segmentSize up to (index+1)*segmentSize
+}
+
+// segmentCache keeps decompressed segments of compressed blobs in memory, evicting the least
+// recently used segments when the total size exceeds a budget. It also remembers the decompressed
+// size of blobs once it is known, as long as segments of them are cached.
+type segmentCache struct {
+	size    int64                        // maximum total size in bytes
+	used    int64                        // current total size in bytes
+	lru     *list.List                   // segments, most recently used first
+	entries map[segmentKey]*list.Element // segments by key
+	sizes   map[string]int64             // decompressed sizes of blobs by checksum
+	counts  map[string]int               // numbers of cached segments of blobs by checksum
+	mutex   sync.Mutex
+}
+
+// segmentEntry is an element of the LRU list of a segmentCache.
+type segmentEntry struct {
+	key  segmentKey
+	data []byte
+}
+
+// newSegmentCache returns a new segment cache with a budget of size bytes.
+func newSegmentCache(size int64) *segmentCache {
+	return &segmentCache{size: size, lru: list.New(), entries: make(map[segmentKey]*list.Element),
+		sizes: make(map[string]int64), counts: make(map[string]int)}
+}
+
+// get returns the cached segment with the given key and true, or false if it is not cached.
+func (c *segmentCache) get(key segmentKey) ([]byte, bool) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	elem, ok := c.entries[key]
+	if !ok {
+		return nil, false
+	}
+	c.lru.MoveToFront(elem)
+	return elem.Value.(*segmentEntry).data, true
+}
+
+// put adds a segment to the cache, evicting least recently used segments if necessary. Segments
+// larger than the budget are not cached. The data must not be modified afterwards.
+func (c *segmentCache) put(key segmentKey, data []byte) {
+	n := int64(len(data))
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	if _, ok := c.entries[key]; ok || n > c.size {
+		return
+	}
+	for c.used+n > c.size && c.lru.Len() > 0 {
+		elem := c.lru.Back()
+		entry := elem.Value.(*segmentEntry)
+		c.lru.Remove(elem)
+		delete(c.entries, entry.key)
+		c.used -= int64(len(entry.data))
+		if c.counts[entry.key.checksum]--; c.counts[entry.key.checksum] == 0 {
+			delete(c.counts, entry.key.checksum)
+			delete(c.sizes, entry.key.checksum)
+		}
+	}
+	c.entries[key] = c.lru.PushFront(&segmentEntry{key: key, data: data})
+	c.used += n
+	c.counts[key.checksum]++
+}
+
+// blobSize returns the decompressed size of the blob with the given checksum and true if it
+// is known, false otherwise.
+func (c *segmentCache) blobSize(checksum string) (int64, bool) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	size, ok := c.sizes[checksum]
+	return size, ok
+}
+
+// setBlobSize remembers the decompressed size of the blob with the given checksum until its last
+// segment is evicted. Sizes of blobs without cached segments are not remembered.
+func (c *segmentCache) setBlobSize(checksum string, size int64) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	if c.counts[checksum] > 0 {
+		c.sizes[checksum] = size
+	}
+}
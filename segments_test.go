@@ -0,0 +1,29 @@
+package filestore
+
+import (
+	"fmt"
+	"testing"
+)
+
+func TestSegmentCacheEvictsBlobSizes(t *testing.T) {
+	c := newSegmentCache(2 * segmentSize)
+	segment := make([]byte, segmentSize)
+	for i := 0; i < 100; i++ {
+		checksum := fmt.Sprint(i)
+		c.put(segmentKey{checksum: checksum}, segment)
+		c.setBlobSize(checksum, segmentSize)
+		if size, ok := c.blobSize(checksum); !ok || size != segmentSize {
+			t.Fatalf("blobSize(%q) = %d, %v, want %d", checksum, size, ok, segmentSize)
+		}
+	}
+	if len(c.sizes) != 2 || len(c.counts) != 2 {
+		t.Fatalf("cache remembers %d sizes of %d blobs, want those of the 2 cached blobs", len(c.sizes), len(c.counts))
+	}
+	if _, ok := c.blobSize("0"); ok {
+		t.Fatal("size of an evicted blob is still known")
+	}
+	c.setBlobSize("uncached", 1)
+	if _, ok := c.blobSize("uncached"); ok {
+		t.Fatal("size of a blob without cached segments is remembered")
+	}
+}
@@ -0,0 +1,274 @@
+package filestore
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+var ErrInvalidConstraint = errors.New("filestore version constraint is malformed")
+
+// semver is a version string parsed as a semantic version. Build metadata is dropped, since it
+// does not take part in comparisons.
+type semver struct {
+	major, minor, patch uint64
+	pre                 []string // the dot-separated identifiers of the pre-release, nil for releases
+}
+
+// parseSemver parses a semantic version like "1.2.3", "v1.2.3-rc.1" or "1.2.3+build.5". Missing
+// minor and patch numbers are taken as zero, so that "1.2" is the same as "1.2.0". It returns
+// false if s is not a semantic version.
+func parseSemver(s string) (semver, bool) {
+	var v semver
+	s = strings.TrimPrefix(s, "v")
+	if i := strings.IndexByte(s, '+'); i >= 0 {
+		s = s[:i]
+	}
+	if i := strings.IndexByte(s, '-'); i >= 0 {
+		v.pre = strings.Split(s[i+1:], ".")
+		for _, id := range v.pre {
+			if id == "" {
+				return semver{}, false
+			}
+		}
+		s = s[:i]
+	}
+	parts := strings.Split(s, ".")
+	if len(parts) > 3 {
+		return semver{}, false
+	}
+	nums := []*uint64{&v.major, &v.minor, &v.patch}
+	for i, part := range parts {
+		if part == "" || !isNumeric(part) {
+			return semver{}, false
+		}
+		n, err := strconv.ParseUint(part, 10, 64)
+		if err != nil {
+			return semver{}, false
+		}
+		*nums[i] = n
+	}
+	return v, true
+}
+
+// isNumeric returns true if s consists of ASCII digits only.
+func isNumeric(s string) bool {
+	for i := 0; i < len(s); i++ {
+		if !isDigit(s[i]) {
+			return false
+		}
+	}
+	return true
+}
+
+// compare returns -1, 0 or 1 if v has a lower, the same or a higher precedence than w. A
+// pre-release has a lower precedence than the release, and its identifiers are compared
+// numerically if they are numbers and as strings otherwise.
+func (v semver) compare(w semver) int {
+	for _, d := range [][2]uint64{{v.major, w.major}, {v.minor, w.minor}, {v.patch, w.patch}} {
+		if d[0] != d[1] {
+			if d[0] < d[1] {
+				return -1
+			}
+			return 1
+		}
+	}
+	switch {
+	case v.pre == nil && w.pre == nil:
+		return 0
+	case v.pre == nil:
+		return 1
+	case w.pre == nil:
+		return -1
+	}
+	for i := 0; i < len(v.pre) && i < len(w.pre); i++ {
+		if c := compareIdentifiers(v.pre[i], w.pre[i]); c != 0 {
+			return c
+		}
+	}
+	switch {
+	case len(v.pre) < len(w.pre):
+		return -1
+	case len(v.pre) > len(w.pre):
+		return 1
+	}
+	return 0
+}
+
+// compareIdentifiers compares two identifiers of pre-releases, where numbers have a lower
+// precedence than other identifiers.
+func compareIdentifiers(a, b string) int {
+	an, bn := isNumeric(a), isNumeric(b)
+	switch {
+	case an && bn:
+		a, b = strings.TrimLeft(a, "0"), strings.TrimLeft(b, "0")
+		if len(a) != len(b) {
+			if len(a) < len(b) {
+				return -1
+			}
+			return 1
+		}
+	case an:
+		return -1
+	case bn:
+		return 1
+	}
+	return strings.Compare(a, b)
+}
+
+// versionConstraint is a parsed version constraint, which is satisfied if all comparisons of any
+// of its alternatives are.
+type versionConstraint [][]versionComparison
+
+// versionComparison compares versions with a version by an operator.
+type versionComparison struct {
+	op      string
+	version semver
+}
+
+// constraintOperators are the operators of version comparisons, longer operators first so that
+// they are not taken for their prefixes.
+var constraintOperators = []string{"!=", ">=", "<=", ">", "<", "=", "~", "^"}
+
+// parseConstraint parses a constraint of comparisons separated by spaces, all of which must hold,
+// and alternatives of such comparisons separated by "||". A comparison is a semantic version
+// preceded by one of the operators =, !=, >, >=, <, <=, ~ and ^, or by none for =. The tilde
+// allows later patch releases of the version, and the caret later minor and patch releases, or
+// only later patch releases for versions below 1.0.0.
+func parseConstraint(constraint string) (versionConstraint, error) {
+	var c versionConstraint
+	for _, alternative := range strings.Split(constraint, "||") {
+		fields := strings.Fields(alternative)
+		if len(fields) == 0 {
+			return nil, fmt.Errorf("%w: %q has an empty alternative", ErrInvalidConstraint, constraint)
+		}
+		var comparisons []versionComparison
+		for i := 0; i < len(fields); i++ {
+			field := fields[i]
+			op := ""
+			for _, o := range constraintOperators {
+				if strings.HasPrefix(field, o) {
+					op = o
+					break
+				}
+			}
+			rest := field[len(op):]
+			if rest == "" && i+1 < len(fields) {
+				// the operator is separated from its version by a space
+				i++
+				rest = fields[i]
+			}
+			v, ok := parseSemver(rest)
+			if !ok {
+				return nil, fmt.Errorf("%w: %q is not a semantic version", ErrInvalidConstraint, rest)
+			}
+			if op == "" {
+				op = "="
+			}
+			comparisons = append(comparisons, versionComparison{op: op, version: v})
+		}
+		c = append(c, comparisons)
+	}
+	return c, nil
+}
+
+// matches returns true if version v satisfies the constraint. Like in npm, pre-releases only
+// satisfy alternatives with a comparison of a pre-release of the same version, so that
+// "<2.0.0" does not select "2.0.0-rc.1".
+func (c versionConstraint) matches(v semver) bool {
+	for _, comparisons := range c {
+		ok, pre := true, v.pre == nil
+		for _, comparison := range comparisons {
+			if !comparison.matches(v) {
+				ok = false
+				break
+			}
+			w := comparison.version
+			pre = pre || w.pre != nil && w.major == v.major && w.minor == v.minor && w.patch == v.patch
+		}
+		if ok && pre {
+			return true
+		}
+	}
+	return false
+}
+
+// matches returns true if version v satisfies the comparison.
+func (c versionComparison) matches(v semver) bool {
+	d := v.compare(c.version)
+	switch c.op {
+	case "=":
+		return d == 0
+	case "!=":
+		return d != 0
+	case ">":
+		return d > 0
+	case ">=":
+		return d >= 0
+	case "<":
+		return d < 0
+	case "<=":
+		return d <= 0
+	case "~":
+		return d >= 0 && v.major == c.version.major && v.minor == c.version.minor
+	case "^":
+		if d < 0 || v.major != c.version.major {
+			return false
+		}
+		return c.version.major > 0 || v.minor == c.version.minor
+	}
+	return false
+}
+
+// VersionsMatching returns the versions of a file whose version strings are semantic versions
+// satisfying the constraint, ordered from the highest to the lowest version, and versions with
+// equal version strings latest first. A constraint consists of comparisons separated by spaces,
+// all of which must hold, such as ">=1.2.0 <2.0.0". Its alternatives are separated by "||". The
+// operators are =, !=, >, >=, <, <=, ~ for later patch releases and ^ for compatible releases,
+// where a version without operator must be equal. Version strings may start with "v" and omit
+// the minor and patch numbers. Pre-releases such as "2.0.0-rc.1" are only selected by
+// alternatives comparing with a pre-release of the same version, such as ">=2.0.0-rc.0".
+// ErrInvalidConstraint is returned if the constraint is malformed.
+func (fs *Filestore) VersionsMatching(path, constraint string) (_ []FileVersion, err error) {
+	op := newOp("VersionsMatching", path)
+	defer op.done(&err)
+	if err := fs.ensureOpen(); err != nil {
+		return nil, err
+	}
+	c, err := parseConstraint(constraint)
+	if err != nil {
+		return nil, err
+	}
+	rows, err := fs.getVersionsStmt.Query(fs.storedPath(path), -1)
+	if err != nil {
+		return nil, fs.dbError(err)
+	}
+	versions, err := fs.getVersions(rows)
+	if err != nil {
+		return nil, err
+	}
+	matching := make([]FileVersion, 0)
+	for _, v := range versions {
+		if sv, ok := parseSemver(v.Version); ok && c.matches(sv) {
+			matching = append(matching, v)
+		}
+	}
+	sortBySemver(matching)
+	return matching, nil
+}
+
+// sortBySemver sorts versions from the highest to the lowest semantic version, followed by the
+// versions whose version strings are no semantic versions, keeping the order of versions with
+// equal version strings.
+func sortBySemver(versions []FileVersion) {
+	sort.SliceStable(versions, func(i, j int) bool {
+		v, vok := parseSemver(versions[i].Version)
+		w, wok := parseSemver(versions[j].Version)
+		if !vok || !wok {
+			return vok && !wok
+		}
+		return v.compare(w) > 0
+	})
+}
@@ -0,0 +1,65 @@
+package filestore
+
+import (
+	"errors"
+	"fmt"
+	"path/filepath"
+	"testing"
+)
+
+func TestVersionsMatching(t *testing.T) {
+	fs, src := newTestStore(t)
+	path := filepath.Join(src, "lib.txt")
+	for i, version := range []string{"1.0.0", "v1.2.0", "1.10.1", "2.0.0-rc.1", "2.0.0", "nightly", "1.2.5", "0.3.1"} {
+		addFile(t, fs, path, fmt.Sprint(i), "", version)
+	}
+	for _, c := range []struct {
+		constraint string
+		want       []string
+	}{
+		{">=1.2.0 <2.0.0", []string{"1.10.1", "1.2.5", "v1.2.0"}},
+		{">= 1.2 < 2", []string{"1.10.1", "1.2.5", "v1.2.0"}},
+		{"^1.2.0", []string{"1.10.1", "1.2.5", "v1.2.0"}},
+		{"~1.2.0", []string{"1.2.5", "v1.2.0"}},
+		{"^0.3.0", []string{"0.3.1"}},
+		{">=2.0.0-alpha", []string{"2.0.0", "2.0.0-rc.1"}},
+		{"1.0.0 || >2.0.0-rc.1", []string{"2.0.0", "1.0.0"}},
+		{"!=1.0.0 <1.2", []string{"0.3.1"}},
+	} {
+		versions, err := fs.VersionsMatching(path, c.constraint)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var got []string
+		for _, v := range versions {
+			got = append(got, v.Version)
+		}
+		if fmt.Sprint(got) != fmt.Sprint(c.want) {
+			t.Fatalf("VersionsMatching(%q) = %v, want %v", c.constraint, got, c.want)
+		}
+	}
+	for _, constraint := range []string{"", ">=x", "1.0 ||", ">>1.0"} {
+		if _, err := fs.VersionsMatching(path, constraint); !errors.Is(err, ErrInvalidConstraint) {
+			t.Fatalf("VersionsMatching(%q) = %v, want ErrInvalidConstraint", constraint, err)
+		}
+	}
+	versions, err := fs.Find(Query().OrderBySemver().Limit(3))
+	if err != nil || len(versions) != 3 || versions[0].Version != "2.0.0" || versions[1].Version != "2.0.0-rc.1" || versions[2].Version != "1.10.1" {
+		t.Fatalf("Find ordered by semantic version = %v, %v, want 2.0.0, 2.0.0-rc.1 and 1.10.1", versions, err)
+	}
+}
+
+func TestSemverPrecedence(t *testing.T) {
+	for _, c := range []struct {
+		a, b string
+		want int
+	}{
+		{"1.0.0-alpha", "1.0.0", -1},
+		{"1.0.0-alpha.2", "1.0.0-alpha.10", -1},
+		{"1.0.0-alpha.beta", "1.0.0-alpha.1", 1},
+	} {
+		if got := compareVersions(c.a, c.b); got != c.want {
+			t.Fatalf("compareVersions(%q, %q) = %d, want %d", c.a, c.b, got, c.want)
+		}
+	}
+}
@@ -0,0 +1,244 @@
+// Package sftpstore provides a filestore.BlobStore keeping the blobs and chunks of a filestore in
+// a directory of a remote server reached over SFTP, while the database with the metadata stays in
+// the root directory of the filestore. This lets small devices keep only metadata locally and push
+// contents to a server, which needs nothing but an SSH daemon with the SFTP subsystem.
+//
+// For example, the following opens a filestore whose contents are kept on a server:
+//
+//	config := &ssh.ClientConfig{User: "backup", Auth: []ssh.AuthMethod{ssh.PublicKeys(signer)},
+//		HostKeyCallback: ssh.FixedHostKey(hostKey)}
+//	blobs, err := sftpstore.Dial("backup.example.com:22", config, "/srv/blobs/laptop")
+//	if err != nil {
+//		return err
+//	}
+//	defer blobs.Close()
+//	fs := filestore.NewFilestore("/var/lib/archive", 0)
+//	fs.Blobs = blobs
+//	err = fs.Open()
+//
+// The store uses the SFTP client of github.com/pkg/sftp, which speaks version 3 of the protocol
+// that all common servers support. The store is safe for concurrent use.
+package sftpstore
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/pkg/sftp"
+	"golang.org/x/crypto/ssh"
+)
+
+var ErrRequestFailed = errors.New("sftpstore request failed")
+
+const (
+	posixRename    = "posix-rename@openssh.com"
+	tempNamePrefix = ".put-"
+)
+
+// Store is a filestore.BlobStore keeping data in files below a directory of an SFTP server, whose
+// paths relative to the directory are the keys.
+type Store struct {
+	dir         string
+	client      *sftp.Client
+	closers     []io.Closer
+	posixRename bool // whether the server replaces files when renaming with the posix-rename extension
+	mutex       sync.Mutex
+	dirs        map[string]bool // directories known to exist
+}
+
+// Dial connects to the SSH server at addr with config, starts the SFTP subsystem and returns a
+// store of the directory dir on the server. The store must be closed after use.
+func Dial(addr string, config *ssh.ClientConfig, dir string) (*Store, error) {
+	conn, err := ssh.Dial("tcp", addr, config)
+	if err != nil {
+		return nil, err
+	}
+	client, err := sftp.NewClient(conn)
+	if err != nil {
+		conn.Close()
+		return nil, err
+	}
+	s := newStore(client, dir)
+	s.closers = append(s.closers, conn)
+	return s, nil
+}
+
+// New returns a store of the directory dir on the SFTP server to which requests are written with w
+// and from whose responses are read with r, for instance the pipes of an ssh command started with
+// the -s sftp flags.
+func New(r io.Reader, w io.WriteCloser, dir string) (*Store, error) {
+	client, err := sftp.NewClientPipe(r, w)
+	if err != nil {
+		return nil, err
+	}
+	return newStore(client, dir), nil
+}
+
+// newStore returns a store of the directory dir on the server of client.
+func newStore(client *sftp.Client, dir string) *Store {
+	s := &Store{dir: strings.TrimSuffix(dir, "/"), client: client, dirs: make(map[string]bool)}
+	if s.dir == "" {
+		s.dir = "."
+	}
+	_, s.posixRename = client.HasExtension(posixRename)
+	return s
+}
+
+// Close closes the connection to the server.
+func (s *Store) Close() error {
+	err := s.client.Close()
+	for _, c := range s.closers {
+		c.Close()
+	}
+	return err
+}
+
+// Put writes the data read from r to the file of key, creating its directories. The data is
+// written to a temporary file that is renamed when complete, so that readers never see partial
+// data.
+func (s *Store) Put(key string, r io.Reader) error {
+	target := s.path(key)
+	if err := s.mkdirAll(path.Dir(target)); err != nil {
+		return err
+	}
+	var random [8]byte
+	if _, err := rand.Read(random[:]); err != nil {
+		return err
+	}
+	tmp := path.Join(path.Dir(target), tempNamePrefix+hex.EncodeToString(random[:]))
+	// some servers cannot open files for reading and writing at once
+	f, err := s.client.OpenFile(tmp, os.O_WRONLY|os.O_CREATE|os.O_TRUNC)
+	if err != nil {
+		return s.error(tmp, err)
+	}
+	if _, err := io.Copy(f, r); err != nil {
+		f.Close()
+		s.client.Remove(tmp)
+		return s.error(tmp, err)
+	}
+	if err := f.Close(); err != nil {
+		s.client.Remove(tmp)
+		return s.error(tmp, err)
+	}
+	if err := s.rename(tmp, target); err != nil {
+		s.client.Remove(tmp)
+		return s.error(target, err)
+	}
+	return nil
+}
+
+// rename renames the file old to new, replacing new if it exists.
+func (s *Store) rename(old, new string) error {
+	if s.posixRename {
+		return s.client.PosixRename(old, new)
+	}
+	// plain renames fail if new exists, which only happens if the same data is stored twice
+	if err := s.client.Remove(new); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return err
+	}
+	return s.client.Rename(old, new)
+}
+
+// mkdirAll creates the directory dir and its parents unless they are known to exist.
+func (s *Store) mkdirAll(dir string) error {
+	s.mutex.Lock()
+	known := s.dirs[dir]
+	s.mutex.Unlock()
+	if known || dir == "." || dir == "/" {
+		return nil
+	}
+	if err := s.client.MkdirAll(dir); err != nil {
+		return s.error(dir, err)
+	}
+	s.mutex.Lock()
+	s.dirs[dir] = true
+	s.mutex.Unlock()
+	return nil
+}
+
+// Get opens the file of key for reading. The error satisfies errors.Is(err, os.ErrNotExist) if
+// there is no such file.
+func (s *Store) Get(key string) (io.ReadCloser, error) {
+	p := s.path(key)
+	f, err := s.client.Open(p)
+	if err != nil {
+		return nil, s.error(p, err)
+	}
+	return f, nil
+}
+
+// Delete removes the file of key.
+func (s *Store) Delete(key string) error {
+	p := s.path(key)
+	if err := s.client.Remove(p); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return s.error(p, err)
+	}
+	return nil
+}
+
+// Exists returns true if there is a regular file for key.
+func (s *Store) Exists(key string) (bool, error) {
+	p := s.path(key)
+	info, err := s.client.Stat(p)
+	if errors.Is(err, os.ErrNotExist) {
+		return false, nil
+	}
+	if err != nil {
+		return false, s.error(p, err)
+	}
+	return info.Mode().IsRegular(), nil
+}
+
+// List returns the keys of the files whose keys start with prefix in lexical order. Only the
+// directory containing the prefix is walked.
+func (s *Store) List(prefix string) ([]string, error) {
+	root := s.dir
+	if base := strings.TrimSuffix(prefix[:strings.LastIndex(prefix, "/")+1], "/"); base != "" {
+		root = s.path(base)
+	}
+	var keys []string
+	walker := s.client.Walk(root)
+	for walker.Step() {
+		if err := walker.Err(); err != nil {
+			if errors.Is(err, os.ErrNotExist) && walker.Path() == root {
+				return nil, nil
+			}
+			return nil, s.error(walker.Path(), err)
+		}
+		if !walker.Stat().Mode().IsRegular() || strings.HasPrefix(path.Base(walker.Path()), tempNamePrefix) {
+			continue
+		}
+		key := strings.TrimPrefix(walker.Path(), s.dir+"/")
+		if strings.HasPrefix(key, prefix) {
+			keys = append(keys, key)
+		}
+	}
+	sort.Strings(keys)
+	return keys, nil
+}
+
+// path returns the remote path of key.
+func (s *Store) path(key string) string {
+	return s.dir + "/" + key
+}
+
+// error returns err of a request concerning the remote path p with the path, wrapping
+// ErrRequestFailed if the server reported a failure.
+func (s *Store) error(p string, err error) error {
+	var status *sftp.StatusError
+	switch {
+	case errors.Is(err, os.ErrNotExist):
+		return fmt.Errorf("sftpstore %s does not exist: %w", p, os.ErrNotExist)
+	case errors.As(err, &status):
+		return fmt.Errorf("%w: %s: %v", ErrRequestFailed, p, err)
+	}
+	return err
+}
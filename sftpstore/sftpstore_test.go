@@ -0,0 +1,145 @@
+package sftpstore
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/pkg/sftp"
+	"github.com/rasteric/filestore"
+)
+
+// pipes joins the ends of two pipes from which a server reads requests and to which it writes
+// responses.
+type pipes struct {
+	io.Reader
+	io.WriteCloser
+}
+
+// newTestStore returns a store of the directory blobs below a local directory, which is served by
+// the SFTP server of github.com/pkg/sftp until the end of the test, together with the local
+// directory. Files are renamed with the posix-rename extension only if posix is true.
+func newTestStore(t *testing.T, posix bool) (*Store, string) {
+	t.Helper()
+	root := t.TempDir()
+	clientReader, serverWriter := io.Pipe()
+	serverReader, clientWriter := io.Pipe()
+	server, err := sftp.NewServer(pipes{serverReader, serverWriter})
+	if err != nil {
+		t.Fatal(err)
+	}
+	go func() {
+		// the server stops serving when the client closes its end, then its own end is closed
+		server.Serve()
+		server.Close()
+	}()
+	s, err := New(clientReader, clientWriter, filepath.ToSlash(filepath.Join(root, "blobs")))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !s.posixRename {
+		t.Fatal("the server does not support the posix-rename extension")
+	}
+	s.posixRename = posix
+	t.Cleanup(func() { s.Close() })
+	return s, root
+}
+
+func testStore(t *testing.T, posix bool) {
+	s, root := newTestStore(t, posix)
+	data := bytes.Repeat([]byte("0123456789"), 10000)
+	for i := 0; i < 2; i++ {
+		// the second put replaces the file
+		if err := s.Put("ab/cd/x.bin", bytes.NewReader(data)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := s.Put("ab/y", strings.NewReader("")); err != nil {
+		t.Fatal(err)
+	}
+	if got, err := os.ReadFile(filepath.Join(root, "blobs", "ab", "cd", "x.bin")); err != nil || !bytes.Equal(got, data) {
+		t.Fatalf("stored %d bytes, %v, want %d bytes", len(got), err, len(data))
+	}
+	r, err := s.Get("ab/cd/x.bin")
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, err := io.ReadAll(r)
+	r.Close()
+	if err != nil || !bytes.Equal(got, data) {
+		t.Fatalf("Get returned %d bytes, %v, want %d bytes", len(got), err, len(data))
+	}
+	if _, err := s.Get("missing"); !errors.Is(err, os.ErrNotExist) {
+		t.Fatalf("Get of a missing key = %v, want os.ErrNotExist", err)
+	}
+	if ok, err := s.Exists("ab/y"); !ok || err != nil {
+		t.Fatalf("Exists = %v, %v, want true", ok, err)
+	}
+	if ok, err := s.Exists("ab/z"); ok || err != nil {
+		t.Fatalf("Exists of a missing key = %v, %v, want false", ok, err)
+	}
+	for _, key := range []string{"c/a", "c/b", "c/c", "c/d", "c/e"} {
+		if err := s.Put(key, strings.NewReader(key)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for prefix, want := range map[string]int{"": 7, "c/": 5, "zz/": 0} {
+		keys, err := s.List(prefix)
+		if err != nil || len(keys) != want {
+			t.Fatalf("List(%q) = %v, %v, want %d keys", prefix, keys, err, want)
+		}
+	}
+	for i := 0; i < 2; i++ {
+		// deleting a missing key is no error
+		if err := s.Delete("ab/y"); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if ok, err := s.Exists("ab/y"); ok || err != nil {
+		t.Fatalf("Exists of a deleted key = %v, %v, want false", ok, err)
+	}
+}
+
+func TestStorePosixRename(t *testing.T) { testStore(t, true) }
+func TestStoreRename(t *testing.T)      { testStore(t, false) }
+
+func TestFilestoreOnSFTP(t *testing.T) {
+	s, _ := newTestStore(t, true)
+	dir := t.TempDir()
+	fs := filestore.NewFilestore(filepath.Join(dir, "store"), 0)
+	fs.Blobs = s
+	fs.Compression = filestore.CompressionZstd
+	if err := fs.Open(); err != nil {
+		t.Fatal(err)
+	}
+	defer fs.Close()
+	path := filepath.Join(dir, "a.txt")
+	data := bytes.Repeat([]byte("some data "), 100000)
+	if err := os.WriteFile(path, data, 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := fs.Add(path, "", "1"); err != nil {
+		t.Fatal(err)
+	}
+	v, err := fs.Get(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var buf bytes.Buffer
+	if err := fs.RestoreTo(v, &buf); err != nil || !bytes.Equal(buf.Bytes(), data) {
+		t.Fatalf("restored %d bytes, %v, want %d bytes", buf.Len(), err, len(data))
+	}
+	if report, err := fs.Verify(filestore.VerifyOptions{}); err != nil || !report.OK() {
+		t.Fatalf("Verify = %v, %v", report.Problems, err)
+	}
+	if err := fs.DeleteVersion(v); err != nil {
+		t.Fatal(err)
+	}
+	if keys, err := s.List(""); err != nil || len(keys) != 0 {
+		t.Fatalf("List after deleting the version = %v, %v, want none", keys, err)
+	}
+}
@@ -0,0 +1,99 @@
+package filestore
+
+import (
+	"crypto/rand"
+	"database/sql"
+	"encoding/base32"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+var ErrInvalidShortID = errors.New("filestore short ID is malformed")
+
+// shortIDEncoding encodes short IDs with lowercase letters and digits, without padding.
+var shortIDEncoding = base32.NewEncoding("abcdefghijklmnopqrstuvwxyz234567").WithPadding(base32.NoPadding)
+
+// minShortIDBytes is the minimum number of bytes encoded in a short ID, which yields IDs of 8
+// characters for the first few hundred billion versions.
+const minShortIDBytes = 5
+
+// shortIDSaltKey is the key under which the salt of short IDs is stored in the Settings table.
+const shortIDSaltKey = "shortid_salt"
+
+// loadShortIDSalt reads the salt added to version IDs in short IDs, generating and storing a
+// random one if the filestore has none yet. A read-only filestore without salt uses zero.
+func (fs *Filestore) loadShortIDSalt(readOnly bool) error {
+	fs.shortIDSalt = 0
+	var value string
+	err := fs.db.QueryRow("select value from Settings where name=?;", shortIDSaltKey).Scan(&value)
+	if err == nil {
+		if fs.shortIDSalt, err = strconv.ParseUint(value, 10, 32); err != nil {
+			return fmt.Errorf("filestore contains invalid short ID salt: %w", err)
+		}
+		return nil
+	}
+	if readOnly {
+		// the Settings table may not even exist in a read-only filestore created earlier
+		return nil
+	}
+	if err != sql.ErrNoRows {
+		return fs.dbError(err)
+	}
+	var buf [4]byte
+	if _, err := rand.Read(buf[:]); err != nil {
+		return err
+	}
+	fs.shortIDSalt = uint64(binary.BigEndian.Uint32(buf[:]))
+	if _, err := fs.db.Exec("insert into Settings(name, value) values(?, ?);", shortIDSaltKey,
+		strconv.FormatUint(fs.shortIDSalt, 10)); err != nil {
+		return fs.dbError(err)
+	}
+	return nil
+}
+
+// shortID returns the short ID of the version with the given ID, which is the base32 encoding of
+// the ID plus the salt of the filestore.
+func (fs *Filestore) shortID(id int64) string {
+	var buf [8]byte
+	binary.BigEndian.PutUint64(buf[:], uint64(id)+fs.shortIDSalt)
+	b := buf[:]
+	for len(b) > minShortIDBytes && b[0] == 0 {
+		b = b[1:]
+	}
+	return shortIDEncoding.EncodeToString(b)
+}
+
+// parseShortID returns the version ID encoded in a short ID of the filestore.
+func (fs *Filestore) parseShortID(shortID string) (int64, error) {
+	b, err := shortIDEncoding.DecodeString(strings.ToLower(shortID))
+	if err != nil || len(b) < minShortIDBytes || len(b) > 8 {
+		return 0, ErrInvalidShortID
+	}
+	var buf [8]byte
+	copy(buf[8-len(b):], b)
+	value := binary.BigEndian.Uint64(buf[:])
+	if value < fs.shortIDSalt || fs.shortID(int64(value-fs.shortIDSalt)) != strings.ToLower(shortID) {
+		return 0, ErrInvalidShortID
+	}
+	return int64(value - fs.shortIDSalt), nil
+}
+
+// GetByShortID returns the version with the given short ID, as found in the ShortID field of a
+// FileVersion. Short IDs are case-insensitive and only valid within the filestore that created
+// them. ErrInvalidShortID is returned if shortID is malformed and ErrUnknownVersion if there is
+// no such version.
+func (fs *Filestore) GetByShortID(shortID string) (_ FileVersion, err error) {
+	op := newOp("GetByShortID", "")
+	defer op.done(&err)
+	if err := fs.ensureOpen(); err != nil {
+		return FileVersion{}, err
+	}
+	id, err := fs.parseShortID(shortID)
+	if err != nil {
+		return FileVersion{}, err
+	}
+	return fs.versionByID(fs.db, id)
+}
@@ -0,0 +1,33 @@
+package filestore
+
+import (
+	"errors"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestShortID(t *testing.T) {
+	fs, src := newTestStore(t)
+	v := addFile(t, fs, filepath.Join(src, "a.txt"), "a", "", "1")
+	if len(v.ShortID) != 8 {
+		t.Fatalf("ShortID = %q, want 8 characters", v.ShortID)
+	}
+	if w, err := fs.GetByShortID(strings.ToUpper(v.ShortID)); err != nil || w.ID != v.ID || w.ShortID != v.ShortID {
+		t.Fatalf("GetByShortID = %v, %v, want %v", w, err, v)
+	}
+	if _, err := fs.GetByShortID("x!"); !errors.Is(err, ErrInvalidShortID) {
+		t.Fatalf("GetByShortID of an invalid id = %v, want ErrInvalidShortID", err)
+	}
+	// short ids remain the same when the filestore is opened again
+	if err := fs.Close(); err != nil {
+		t.Fatal(err)
+	}
+	openTestStore(t, fs)
+	if w, err := fs.GetByShortID(v.ShortID); err != nil || w.ID != v.ID {
+		t.Fatalf("GetByShortID after opening again = %v, %v, want %v", w, err, v)
+	}
+	if _, err := fs.GetByShortID(fs.shortID(v.ID + 5)); !errors.Is(err, ErrUnknownVersion) {
+		t.Fatalf("GetByShortID of an unknown version = %v, want ErrUnknownVersion", err)
+	}
+}
@@ -0,0 +1,81 @@
+package filestore
+
+import (
+	"crypto/ed25519"
+	"database/sql"
+	"errors"
+)
+
+var ErrNoSignature = errors.New("filestore version has no signature")
+var ErrNoVerifyKey = errors.New("filestore has no key to verify signatures with")
+var ErrInvalidSignature = errors.New("filestore version signature is invalid")
+
+// signatureMessage returns the message signed for a version with the given checksum, slash-separated
+// path and date as stored in the database.
+func signatureMessage(checksum, path, date string) []byte {
+	return []byte("filestore version\x00" + checksum + "\x00" + path + "\x00" + date)
+}
+
+// signVersion records a signature of the version with the given ID if the filestore has a
+// SigningKey, within tx if it is not nil.
+func (fs *Filestore) signVersion(tx *sql.Tx, id int64) error {
+	if fs.SigningKey == nil {
+		return nil
+	}
+	var q querier = fs.db
+	if tx != nil {
+		q = tx
+	}
+	var checksum, path, date string
+	if err := q.QueryRow("select checksum, path, date from Versions inner join Files on Versions.file=Files.file_id where version_id=?;",
+		id).Scan(&checksum, &path, &date); err != nil {
+		return fs.dbError(err)
+	}
+	signature := ed25519.Sign(fs.SigningKey, signatureMessage(checksum, path, date))
+	if _, err := q.Exec("insert or replace into Signatures(version, signature) values(?, ?);", id, signature); err != nil {
+		return fs.dbError(err)
+	}
+	return nil
+}
+
+// VerifySignature checks the signature recorded when the version was added against its checksum,
+// path and date in the filestore, using the VerifyKey of the filestore or else the public key of
+// its SigningKey. ErrNoSignature is returned if the version was added without a SigningKey and
+// ErrInvalidSignature if the signature does not match, so that the version has been tampered
+// with or was signed with another key.
+func (fs *Filestore) VerifySignature(version FileVersion) (err error) {
+	op := newOp("VerifySignature", version.Path)
+	op.checksum = version.Checksum
+	defer op.done(&err)
+	if err := fs.ensureOpen(); err != nil {
+		return err
+	}
+	key := fs.VerifyKey
+	if key == nil && fs.SigningKey != nil {
+		key = fs.SigningKey.Public().(ed25519.PublicKey)
+	}
+	if len(key) != ed25519.PublicKeySize {
+		return ErrNoVerifyKey
+	}
+	var checksum, path, date string
+	var signature []byte
+	err = fs.db.QueryRow("select checksum, path, date, signature from Versions inner join Files on Versions.file=Files.file_id left join Signatures on Signatures.version=version_id where version_id=?;",
+		version.ID).Scan(&checksum, &path, &date, &signature)
+	if err == sql.ErrNoRows {
+		return ErrUnknownVersion
+	}
+	if err != nil {
+		return fs.dbError(err)
+	}
+	if signature == nil {
+		return ErrNoSignature
+	}
+	if ed25519.Verify(key, signatureMessage(checksum, path, date), signature) {
+		return nil
+	}
+	// versions signed before dates were recorded with nanoseconds were signed with their old dates
+	if legacy, ok := legacyDBDate(date); ok && ed25519.Verify(key, signatureMessage(checksum, path, legacy), signature) {
+		return nil
+	}
+	return ErrInvalidSignature
+}
@@ -0,0 +1,35 @@
+package filestore
+
+import (
+	"crypto/ed25519"
+	"errors"
+	"path/filepath"
+	"testing"
+)
+
+func TestSignatures(t *testing.T) {
+	fs, src := newTestStore(t)
+	unsigned := addFile(t, fs, filepath.Join(src, "a.txt"), "doc", "", "1")
+	if err := fs.VerifySignature(unsigned); !errors.Is(err, ErrNoVerifyKey) {
+		t.Fatalf("VerifySignature without key = %v, want ErrNoVerifyKey", err)
+	}
+	_, key, err := ed25519.GenerateKey(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	fs.SigningKey = key
+	if err := fs.VerifySignature(unsigned); !errors.Is(err, ErrNoSignature) {
+		t.Fatalf("VerifySignature of a version added without key = %v, want ErrNoSignature", err)
+	}
+	v := addFile(t, fs, filepath.Join(src, "b.txt"), "doc2", "", "1")
+	if err := fs.VerifySignature(v); err != nil {
+		t.Fatal(err)
+	}
+	// signatures cover the metadata of versions
+	if _, err := fs.db.Exec("update Versions set path='other' where version_id=?;", v.ID); err != nil {
+		t.Fatal(err)
+	}
+	if err := fs.VerifySignature(v); !errors.Is(err, ErrInvalidSignature) {
+		t.Fatalf("VerifySignature of a changed version = %v, want ErrInvalidSignature", err)
+	}
+}
@@ -0,0 +1,325 @@
+package filestore
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+var ErrUnknownSnapshot = errors.New("filestore contains no such snapshot")
+
+// SnapshotID identifies a snapshot of a directory tree.
+type SnapshotID int64
+
+// Snapshot describes a snapshot of a directory tree created by AddTree.
+type Snapshot struct {
+	ID   SnapshotID // the ID of the snapshot
+	Name string     // the name of the snapshot
+	Root string     // the directory from which the snapshot was taken (os path)
+	Date time.Time  // the datetime on which the snapshot was taken
+}
+
+// TreeOption is an option for AddTree.
+type TreeOption func(*treeOptions)
+
+type treeOptions struct {
+	name     string                                   // the name of the snapshot
+	filter   func(path string, info os.FileInfo) bool // returns false for files and directories to skip
+	failFast bool                                     // abort on the first unreadable file
+}
+
+// TreeFileError is an error reading a file or directory of a tree added with AddTree, or the
+// rejection of a symbolic link.
+type TreeFileError struct {
+	Path string // the file or directory that was skipped (os path)
+	Err  error  // the error reading it, or ErrSymlink
+}
+
+// TreeErrors is the error returned by AddTree if files or directories of the tree could not be
+// read, for example because permission was denied or they vanished during the walk, or are
+// symbolic links rejected by the filestore. The other files have been added nevertheless. Use
+// errors.As to obtain it.
+type TreeErrors struct {
+	Errors []TreeFileError // the errors in the order in which they occurred
+}
+
+// Error returns a message with the number of errors and the first of them.
+func (e *TreeErrors) Error() string {
+	if len(e.Errors) == 0 {
+		return "filestore could not read the tree"
+	}
+	return fmt.Sprintf("filestore skipped %d files and directories of the tree, the first being %s: %v",
+		len(e.Errors), e.Errors[0].Path, e.Errors[0].Err)
+}
+
+// SnapshotName sets the name of the snapshot created by AddTree. The default name is the
+// directory of the tree.
+func SnapshotName(name string) TreeOption {
+	return func(o *treeOptions) {
+		o.name = name
+	}
+}
+
+// TreeFilter sets a function that is called by AddTree for each file and subdirectory of the
+// tree and returns false if it is to be skipped. Skipped directories are not walked.
+func TreeFilter(filter func(path string, info os.FileInfo) bool) TreeOption {
+	return func(o *treeOptions) {
+		o.filter = filter
+	}
+}
+
+// TreeFailFast makes AddTree abort and add nothing if a file or directory of the tree cannot be
+// read, instead of skipping it and returning TreeErrors after adding the other files.
+func TreeFailFast() TreeOption {
+	return func(o *treeOptions) {
+		o.failFast = true
+	}
+}
+
+// AddTree walks the directory dir and adds a version of every regular file in it with the given
+// info and version strings. The files and directories are recorded as one snapshot, whose ID
+// is returned. Files and directories matching an Ignore pattern of the filestore are skipped like
+// those rejected by a TreeFilter. Files and directories that cannot be read are skipped as well,
+// so that a long import is not aborted by a single one, and reported by a TreeErrors returned
+// together with the ID of the snapshot of the remaining files, unless the TreeFailFast option is
+// given. Symbolic links are handled according to the Symlinks policy of the filestore: the files
+// they point to are added, the links themselves are added, or they are reported like unreadable
+// files with ErrSymlink. Links to directories are not followed. Other errors, as well as files
+// vanishing while they are stored, abort AddTree, in which case none of the files are added.
+func (fs *Filestore) AddTree(dir string, info, version string, opts ...TreeOption) (_ SnapshotID, err error) {
+	op := newOp("AddTree", dir)
+	defer op.done(&err)
+	if err := fs.ensureOpen(); err != nil {
+		return 0, err
+	}
+	options := treeOptions{name: dir}
+	for _, opt := range opts {
+		opt(&options)
+	}
+	var files, dirs []string
+	var skipped []TreeFileError
+	// skip records an unreadable file or directory, returning the error if the walk is to stop
+	skip := func(path string, info os.FileInfo, err error) error {
+		if options.failFast {
+			return err
+		}
+		skipped = append(skipped, TreeFileError{Path: path, Err: err})
+		if info != nil && info.IsDir() {
+			return filepath.SkipDir
+		}
+		return nil
+	}
+	err = filepath.Walk(dir, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			if path == dir {
+				return err
+			}
+			return skip(path, info, err)
+		}
+		if path == dir {
+			return nil
+		}
+		rel, err := filepath.Rel(dir, path)
+		if err != nil {
+			return err
+		}
+		if ignored(fs.Ignore, info.Name(), filepath.ToSlash(rel)) || options.filter != nil && !options.filter(path, info) {
+			if info.IsDir() {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if info.IsDir() {
+			dirs = append(dirs, path)
+			return nil
+		}
+		if info.Mode()&os.ModeSymlink != 0 {
+			switch fs.Symlinks {
+			case SymlinkStore:
+				files = append(files, path)
+				return nil
+			case SymlinkReject:
+				return skip(path, nil, ErrSymlink)
+			}
+			target, err := os.Stat(path)
+			if err != nil {
+				return skip(path, nil, err)
+			}
+			info = target
+		}
+		if info.Mode().IsRegular() {
+			files = append(files, path)
+		}
+		return nil
+	})
+	if err != nil {
+		return 0, fmt.Errorf("filestore failed to walk directory %s: %w", dir, err)
+	}
+	readable := files[:0]
+	checksums := make([]string, 0, len(files))
+	for _, path := range files {
+		checksum, err := fs.checksum(path, nil)
+		if err != nil {
+			if options.failFast {
+				return 0, fmt.Errorf("filestore checksum failed for %s: %w", path, err)
+			}
+			skipped = append(skipped, TreeFileError{Path: path, Err: err})
+			continue
+		}
+		readable = append(readable, path)
+		checksums = append(checksums, checksum)
+	}
+	tx, err := fs.begin()
+	if err != nil {
+		return 0, err
+	}
+	id, err := tx.addTree(dir, options.name, readable, dirs, checksums, info, version)
+	if err != nil {
+		tx.rollback()
+		return 0, err
+	}
+	if err := tx.commit(); err != nil {
+		return 0, err
+	}
+	if len(skipped) > 0 {
+		return id, &TreeErrors{Errors: skipped}
+	}
+	return id, nil
+}
+
+// addTree records a snapshot of the given files and directories under dir within the transaction.
+func (tx *Tx) addTree(dir, name string, files, dirs, checksums []string, info, version string) (SnapshotID, error) {
+	result, err := tx.tx.Exec("insert into Snapshots(name, root, date) values(?, ?, ?);",
+		name, filepath.ToSlash(dir), dbNow())
+	if err != nil {
+		return 0, tx.fs.dbError(err)
+	}
+	id, err := result.LastInsertId()
+	if err != nil {
+		return 0, tx.fs.dbError(err)
+	}
+	stmt, err := tx.tx.Prepare("insert into SnapshotEntries(snapshot, rel, version) values(?, ?, ?);")
+	if err != nil {
+		return 0, tx.fs.dbError(err)
+	}
+	defer stmt.Close()
+	for _, path := range dirs {
+		rel, err := filepath.Rel(dir, path)
+		if err != nil {
+			return 0, err
+		}
+		if _, err := stmt.Exec(id, filepath.ToSlash(rel), nil); err != nil {
+			return 0, tx.fs.dbError(err)
+		}
+	}
+	for i, path := range files {
+		versionID, err := tx.addVersionID(path, info, version, checksums[i])
+		if err != nil {
+			return 0, err
+		}
+		rel, err := filepath.Rel(dir, path)
+		if err != nil {
+			return 0, err
+		}
+		if _, err := stmt.Exec(id, filepath.ToSlash(rel), versionID); err != nil {
+			return 0, tx.fs.dbError(err)
+		}
+	}
+	return SnapshotID(id), nil
+}
+
+// RestoreTree recreates the directory tree of the snapshot with the given ID under the directory
+// dst, including empty directories, and restores the versions of all files in the snapshot.
+// Existing files are overwritten.
+func (fs *Filestore) RestoreTree(id SnapshotID, dst string) (err error) {
+	op := newOp("RestoreTree", dst)
+	defer op.done(&err)
+	if err := fs.ensureOpen(); err != nil {
+		return err
+	}
+	var exists bool
+	if err := fs.db.QueryRow("select exists (select 1 from Snapshots where snapshot_id=?);", id).Scan(&exists); err != nil {
+		return fs.dbError(err)
+	}
+	if !exists {
+		return ErrUnknownSnapshot
+	}
+	rows, err := fs.db.Query("select rel, version from SnapshotEntries where snapshot=? order by rel;", id)
+	if err != nil {
+		return fs.dbError(err)
+	}
+	type entry struct {
+		rel     string
+		version sql.NullInt64
+	}
+	entries := make([]entry, 0)
+	for rows.Next() {
+		var e entry
+		if err := rows.Scan(&e.rel, &e.version); err != nil {
+			rows.Close()
+			return fs.dbError(err)
+		}
+		entries = append(entries, e)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return fs.dbError(err)
+	}
+	if err := os.MkdirAll(dst, 0777); err != nil {
+		return fmt.Errorf("filestore could not create directory %s: %w", dst, err)
+	}
+	for _, e := range entries {
+		path := filepath.Join(dst, filepath.FromSlash(e.rel))
+		if !e.version.Valid {
+			if err := os.MkdirAll(path, 0777); err != nil {
+				return fmt.Errorf("filestore could not create directory %s: %w", path, err)
+			}
+			continue
+		}
+		v, err := fs.versionByID(fs.db, e.version.Int64)
+		if err != nil {
+			return err
+		}
+		if err := os.MkdirAll(filepath.Dir(path), 0777); err != nil {
+			return fmt.Errorf("filestore could not create directory %s: %w", filepath.Dir(path), err)
+		}
+		if err := fs.restore(v, filepath.Dir(path), RestoreOptions{}); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Snapshots returns all snapshots taken with AddTree, from oldest to newest.
+func (fs *Filestore) Snapshots() (_ []Snapshot, err error) {
+	op := newOp("Snapshots", "")
+	defer op.done(&err)
+	if err := fs.ensureOpen(); err != nil {
+		return nil, err
+	}
+	rows, err := fs.db.Query("select snapshot_id, name, root, date from Snapshots order by snapshot_id;")
+	if err != nil {
+		return nil, fs.dbError(err)
+	}
+	defer rows.Close()
+	snapshots := make([]Snapshot, 0)
+	for rows.Next() {
+		var s Snapshot
+		var timeStr string
+		if err := rows.Scan(&s.ID, &s.Name, &s.Root, &timeStr); err != nil {
+			return nil, fs.dbError(err)
+		}
+		s.Root = filepath.FromSlash(s.Root)
+		if s.Date, err = ParseDBDate(timeStr); err != nil {
+			return nil, ErrInvalidDate
+		}
+		snapshots = append(snapshots, s)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fs.dbError(err)
+	}
+	return snapshots, nil
+}
@@ -0,0 +1,96 @@
+package filestore
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// writeTree writes a tree of files to dir, with an empty subdirectory and two files of the same
+// contents.
+func writeTree(t *testing.T, dir string) {
+	t.Helper()
+	writeFile(t, filepath.Join(dir, "a.txt"), "a")
+	writeFile(t, filepath.Join(dir, "sub", "b.txt"), "b")
+	writeFile(t, filepath.Join(dir, "sub", "c.txt"), "a")
+	if err := os.MkdirAll(filepath.Join(dir, "sub", "empty"), 0755); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestAddTree(t *testing.T) {
+	fs, src := newTestStore(t)
+	writeTree(t, src)
+	id, err := fs.AddTree(src, "", "1", SnapshotName("first"), TreeFilter(func(path string, info os.FileInfo) bool {
+		return filepath.Base(path) != "c.txt"
+	}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	paths, err := fs.Paths(10, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(paths) != 2 || paths[0] != filepath.Join(src, "a.txt") || paths[1] != filepath.Join(src, "sub", "b.txt") {
+		t.Fatalf("Paths = %v, want a.txt and sub/b.txt", paths)
+	}
+	snapshots, err := fs.Snapshots()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(snapshots) != 1 || snapshots[0].ID != id || snapshots[0].Name != "first" || snapshots[0].Root != src {
+		t.Fatalf("Snapshots = %v, want the snapshot %d named first", snapshots, id)
+	}
+}
+
+func TestRestoreTree(t *testing.T) {
+	fs, src := newTestStore(t)
+	writeTree(t, src)
+	id, err := fs.AddTree(src, "", "1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	dst := filepath.Join(t.TempDir(), "restored")
+	if err := fs.RestoreTree(id, dst); err != nil {
+		t.Fatal(err)
+	}
+	for path, want := range map[string]string{"a.txt": "a", "sub/b.txt": "b", "sub/c.txt": "a"} {
+		if got := readFile(t, filepath.Join(dst, filepath.FromSlash(path))); got != want {
+			t.Fatalf("restored %s with %q, want %q", path, got, want)
+		}
+	}
+	if info, err := os.Stat(filepath.Join(dst, "sub", "empty")); err != nil || !info.IsDir() {
+		t.Fatalf("empty directory not restored: %v", err)
+	}
+	if err := fs.RestoreTree(id+1, dst); !errors.Is(err, ErrUnknownSnapshot) {
+		t.Fatalf("RestoreTree of an unknown snapshot = %v, want ErrUnknownSnapshot", err)
+	}
+}
+
+func TestAddTreeErrors(t *testing.T) {
+	fs, src := newTestStore(t)
+	writeTree(t, src)
+	dangling := filepath.Join(src, "dangling")
+	if err := os.Symlink(filepath.Join(src, "missing"), dangling); err != nil {
+		t.Skip("symbolic links are not supported:", err)
+	}
+	if _, err := fs.AddTree(src, "", "1", TreeFailFast()); err == nil {
+		t.Fatal("AddTree of a tree with an unreadable file succeeded with TreeFailFast")
+	}
+	if versions, err := fs.Versions(filepath.Join(src, "a.txt"), -1); err != nil || len(versions) != 0 {
+		t.Fatalf("Versions = %v, %v after a failed AddTree, want none", versions, err)
+	}
+	// unreadable files are skipped and reported otherwise
+	id, err := fs.AddTree(src, "", "1")
+	var treeErrors *TreeErrors
+	if !errors.As(err, &treeErrors) || len(treeErrors.Errors) != 1 || treeErrors.Errors[0].Path != dangling {
+		t.Fatalf("AddTree = %v, want a TreeErrors of %s", err, dangling)
+	}
+	if id == 0 {
+		t.Fatal("no snapshot taken of the readable files")
+	}
+	if versions, err := fs.Versions(filepath.Join(src, "sub", "b.txt"), -1); err != nil || len(versions) != 1 {
+		t.Fatalf("Versions = %v, %v, want the version added", versions, err)
+	}
+}
@@ -0,0 +1,63 @@
+//go:build linux
+
+package filestore
+
+import (
+	"errors"
+	"io"
+	"os"
+	"syscall"
+)
+
+// whence values of lseek for finding the next data or hole in a file, see lseek(2)
+const (
+	seekData = 3
+	seekHole = 4
+)
+
+// copySparse copies the contents of src to dst, which must both be regular files positioned at
+// their beginning. Only the data regions reported by SEEK_DATA and SEEK_HOLE are written, so the
+// holes of a sparse src remain holes in dst. If the file system of src does not support finding
+// holes, all contents are copied. The bytes copied or skipped are recorded in tracker.
+func copySparse(dst, src *os.File, tracker *progressTracker) error {
+	info, err := src.Stat()
+	if err != nil {
+		return err
+	}
+	size := info.Size()
+	var offset int64
+	for offset < size {
+		data, err := src.Seek(offset, seekData)
+		if errors.Is(err, syscall.ENXIO) {
+			// no more data, the rest of the file is a hole
+			tracker.add(size - offset)
+			break
+		}
+		if errors.Is(err, syscall.EINVAL) && offset == 0 {
+			if _, err := src.Seek(0, io.SeekStart); err != nil {
+				return err
+			}
+			_, err = io.Copy(dst, tracker.reader(src))
+			return err
+		}
+		if err != nil {
+			return err
+		}
+		tracker.add(data - offset)
+		hole, err := src.Seek(data, seekHole)
+		if err != nil {
+			return err
+		}
+		if _, err := src.Seek(data, io.SeekStart); err != nil {
+			return err
+		}
+		if _, err := dst.Seek(data, io.SeekStart); err != nil {
+			return err
+		}
+		if _, err := io.CopyN(dst, tracker.reader(src), hole-data); err != nil {
+			return err
+		}
+		offset = hole
+	}
+	return dst.Truncate(size)
+}
@@ -0,0 +1,65 @@
+//go:build linux
+
+package filestore
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"syscall"
+	"testing"
+)
+
+// allocated returns the number of bytes allocated on disk for the file at path.
+func allocated(t *testing.T, path string) int64 {
+	t.Helper()
+	var st syscall.Stat_t
+	if err := syscall.Stat(path, &st); err != nil {
+		t.Fatal(err)
+	}
+	return st.Blocks * 512
+}
+
+func TestSparse(t *testing.T) {
+	fs, src := newTestStore(t)
+	path := filepath.Join(src, "disk.img")
+	const size, offset = 64 << 20, 32 << 20
+	f, err := os.Create(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := f.Truncate(size); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := f.WriteAt([]byte("hello"), offset); err != nil {
+		t.Fatal(err)
+	}
+	f.Close()
+	if allocated(t, path) > 1<<20 {
+		t.Skip("the file system does not support sparse files")
+	}
+	if err := fs.Add(path, "", "1"); err != nil {
+		t.Fatal(err)
+	}
+	v, err := fs.Get(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	blob := fs.blobFile(v.Name, v.Checksum, codecs[fs.compression()])
+	if info, err := os.Stat(blob); err != nil || info.Size() != size || allocated(t, blob) > 1<<20 {
+		t.Fatalf("blob = %v, %v with %d bytes allocated, want a sparse file of %d bytes", info, err, allocated(t, blob), size)
+	}
+	if err := os.Remove(path); err != nil {
+		t.Fatal(err)
+	}
+	if err := fs.RestoreAtSource(v); err != nil {
+		t.Fatal(err)
+	}
+	data, err := os.ReadFile(path)
+	if err != nil || len(data) != size || !bytes.Equal(data[offset:offset+5], []byte("hello")) {
+		t.Fatalf("restored %d bytes, %v, want the contents of the sparse file", len(data), err)
+	}
+	if n := allocated(t, path); n > 1<<20 {
+		t.Fatalf("restored file has %d bytes allocated, want a sparse file", n)
+	}
+}
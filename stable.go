@@ -0,0 +1,106 @@
+package filestore
+
+import (
+	"net/url"
+	"os"
+	"path/filepath"
+)
+
+// stableDir is the name of the directory in the root directory containing the stable paths of
+// blobs, which are links to the blobs.
+const stableDir = "stable"
+
+// stablePath returns the stable path of the contents with the given checksum, which depends on
+// nothing but the checksum.
+func (fs *Filestore) stablePath(checksum string) string {
+	return filepath.Join(fs.Root()+stableDir, checksum[:2], checksum)
+}
+
+// StablePath returns a content-addressed path at which the contents of version can be read
+// unchanged by other systems as long as the version, or another version with the same contents,
+// is in the filestore. The path depends only on the checksum and the directory of the filestore,
+// so it remains valid when the layout of blobs changes in later versions of this package, for
+// which it is a link to the blob maintained by the filestore. ErrNotExportable is returned if the
+// contents are stored in chunks, compressed or encrypted, and ErrNotLocal if they are kept in a
+// BlobStore other than the root directory. Use Export to keep the contents from being deleted
+// while the path is in use.
+func (fs *Filestore) StablePath(version FileVersion) (_ string, err error) {
+	op := newOp("StablePath", version.Path)
+	op.checksum = version.Checksum
+	defer op.done(&err)
+	if err := fs.ensureOpen(); err != nil {
+		return "", err
+	}
+	return fs.linkStable(version.Checksum)
+}
+
+// StableURL returns the path returned by StablePath as a file URL.
+func (fs *Filestore) StableURL(version FileVersion) (_ string, err error) {
+	op := newOp("StableURL", version.Path)
+	op.checksum = version.Checksum
+	defer op.done(&err)
+	if err := fs.ensureOpen(); err != nil {
+		return "", err
+	}
+	path, err := fs.linkStable(version.Checksum)
+	if err != nil {
+		return "", err
+	}
+	u := url.URL{Scheme: "file", Path: filepath.ToSlash(path)}
+	if u.Path[0] != '/' {
+		// paths with drive letters on Windows
+		u.Path = "/" + u.Path
+	}
+	return u.String(), nil
+}
+
+// linkStable returns the absolute stable path of the contents with the given checksum, linking
+// it to the blob unless it exists already.
+func (fs *Filestore) linkStable(checksum string) (string, error) {
+	if !fs.localBlobs() {
+		return "", ErrNotLocal
+	}
+	if err := fs.fetch(checksum); err != nil {
+		return "", err
+	}
+	// the contents are linked within the lock of the blobs, so that they are not deleted after
+	// they have been checked
+	unlock, err := fs.lockBlobs()
+	if err != nil {
+		return "", err
+	}
+	defer unlock()
+	c, err := fs.exportableCodec(fs.db, checksum)
+	if err != nil {
+		return "", err
+	}
+	path, err := filepath.Abs(fs.stablePath(checksum))
+	if err != nil {
+		return "", err
+	}
+	blob, err := filepath.Abs(fs.blobFile("", checksum, c))
+	if err != nil {
+		return "", err
+	}
+	if target, err := os.Stat(path); err == nil {
+		if info, err := os.Stat(blob); err == nil && os.SameFile(info, target) {
+			return path, nil
+		}
+	}
+	if err := ensureDirectory(filepath.Dir(path), fs.dirMode()); err != nil {
+		return "", err
+	}
+	// replace a link to a blob that has moved since, for instance because the layout changed
+	os.Remove(path)
+	target, err := filepath.Rel(filepath.Dir(path), blob)
+	if err != nil {
+		target = blob
+	}
+	if err := os.Symlink(target, path); err != nil {
+		// symbolic links may require privileges on Windows, in which case a hard link is used
+		if err := os.Link(blob, path); err != nil {
+			return "", err
+		}
+	}
+	return path, nil
+}
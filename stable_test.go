@@ -0,0 +1,53 @@
+package filestore
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestStablePath(t *testing.T) {
+	fs, src := newTestStore(t)
+	path := filepath.Join(src, "a.txt")
+	v := addFile(t, fs, path, "stable", "", "1")
+	stable, err := fs.StablePath(v)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := readFile(t, stable); got != "stable" {
+		t.Fatalf("stable path has contents %q, want %q", got, "stable")
+	}
+	if again, err := fs.StablePath(v); err != nil || again != stable {
+		t.Fatalf("StablePath = %s, %v, want %s again", again, err, stable)
+	}
+	if u, err := fs.StableURL(v); err != nil || !strings.HasPrefix(u, "file:///") {
+		t.Fatalf("StableURL = %s, %v, want a file URL", u, err)
+	}
+	// the link is repaired if the blob has moved
+	blob := fs.blobFile(v.Name, v.Checksum, codecs[CompressionNone])
+	if err := os.Rename(blob, filepath.Join(filepath.Dir(blob), "renamed")); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.ReadFile(stable); err == nil {
+		t.Fatal("stable path can be read although the blob has moved")
+	}
+	if _, err := fs.StablePath(v); err != nil {
+		t.Fatal(err)
+	}
+	if got := readFile(t, stable); got != "stable" {
+		t.Fatalf("stable path has contents %q after relinking, want %q", got, "stable")
+	}
+	if err := fs.DeleteVersion(v); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Lstat(stable); !errors.Is(err, os.ErrNotExist) {
+		t.Fatalf("Lstat of the stable path of deleted contents = %v, want os.ErrNotExist", err)
+	}
+	fs.Options |= Compress
+	v = addFile(t, fs, path, "compressed", "", "2")
+	if _, err := fs.StablePath(v); !errors.Is(err, ErrNotExportable) {
+		t.Fatalf("StablePath of compressed contents = %v, want ErrNotExportable", err)
+	}
+}
@@ -0,0 +1,54 @@
+package filestore
+
+import "os"
+
+// StoreStats describes the size of a filestore.
+type StoreStats struct {
+	Paths       int64 // the number of distinct paths with versions
+	Versions    int64 // the number of versions
+	Blobs       int64 // the number of distinct contents stored
+	Unfetched   int64 // the number of distinct contents pulled from another filestore and not fetched yet
+	RawBytes    int64 // the total size of the stored contents of all versions, as if each was stored separately
+	UniqueBytes int64 // the total size of the distinct contents stored
+	StoredBytes int64 // the number of bytes taken on disk by blobs and chunks, after compression
+	DBBytes     int64 // the size of the database, including its write-ahead log
+	// DedupRatio is RawBytes divided by UniqueBytes, i.e. how many times larger the filestore
+	// would be if contents were stored once per version. It is 1 for an empty filestore.
+	DedupRatio float64
+}
+
+// Stats returns the number of paths, versions and contents of the filestore and the number of
+// bytes they take before and after deduplication and compression.
+func (fs *Filestore) Stats() (_ StoreStats, err error) {
+	op := newOp("Stats", fs.Dir)
+	defer op.done(&err)
+	if err := fs.ensureOpen(); err != nil {
+		return StoreStats{}, err
+	}
+	var s StoreStats
+	err = fs.db.QueryRow("select count(distinct path), count(*), coalesce(sum(case when origin is null then size end), 0) from Versions inner join Files on Versions.file=Files.file_id;").Scan(&s.Paths, &s.Versions, &s.RawBytes)
+	if err != nil {
+		return StoreStats{}, fs.dbError(err)
+	}
+	err = fs.db.QueryRow("select count(*), coalesce(sum(size), 0) from Files where origin is null;").Scan(&s.Blobs, &s.UniqueBytes)
+	if err != nil {
+		return StoreStats{}, fs.dbError(err)
+	}
+	err = fs.db.QueryRow("select count(*) from Files where origin is not null;").Scan(&s.Unfetched)
+	if err != nil {
+		return StoreStats{}, fs.dbError(err)
+	}
+	if s.StoredBytes, err = fs.storedBytes(fs.db); err != nil {
+		return StoreStats{}, err
+	}
+	for _, suffix := range []string{"", "-wal"} {
+		if info, err := os.Stat(fs.dbPath() + suffix); err == nil {
+			s.DBBytes += info.Size()
+		}
+	}
+	s.DedupRatio = 1
+	if s.UniqueBytes > 0 {
+		s.DedupRatio = float64(s.RawBytes) / float64(s.UniqueBytes)
+	}
+	return s, nil
+}
@@ -0,0 +1,20 @@
+package filestore
+
+import (
+	"path/filepath"
+	"testing"
+)
+
+func TestStats(t *testing.T) {
+	fs, src := newTestStore(t)
+	addFile(t, fs, filepath.Join(src, "a.txt"), "aaaa", "a", "1")
+	addFile(t, fs, filepath.Join(src, "b.txt"), "aaaa", "b", "1")
+	s, err := fs.Stats()
+	if err != nil {
+		t.Fatal(err)
+	}
+	// both versions share their contents
+	if s.Paths != 2 || s.Versions != 2 || s.Blobs != 1 || s.RawBytes != 8 || s.UniqueBytes != 4 || s.StoredBytes != 4 || s.DedupRatio != 2 || s.DBBytes == 0 {
+		t.Fatalf("Stats = %+v, want 2 versions sharing 4 bytes", s)
+	}
+}
@@ -0,0 +1,69 @@
+package filestore
+
+import (
+	"strings"
+)
+
+// dirPrefix returns the stored form of the directory path prefix with a trailing slash, so that
+// it matches the stored paths of the files under the directory but not those of its siblings
+// with the same name prefix. The empty prefix is returned unchanged and matches all paths.
+func (fs *Filestore) dirPrefix(prefix string) string {
+	prefix = fs.storedPath(prefix)
+	if prefix != "" && !strings.HasSuffix(prefix, "/") {
+		prefix += "/"
+	}
+	return prefix
+}
+
+// VersionsUnder returns the latest version of every file under the directory prefix, including
+// files in its subdirectories, ordered by path. At most limit versions are returned, all of them
+// if limit is negative. The prefix is compared with the paths as they were added, so it must be
+// absolute if files are added by absolute paths. The empty prefix selects all files.
+func (fs *Filestore) VersionsUnder(prefix string, limit int) (_ []FileVersion, err error) {
+	op := newOp("VersionsUnder", prefix)
+	defer op.done(&err)
+	if err := fs.ensureOpen(); err != nil {
+		return nil, err
+	}
+	rows, err := fs.db.Query(selectVersions+" where substr(Versions.path, 1, length(?1))=?1 and version_id = (select version_id from Versions as L where L.path=Versions.path order by L.date desc, L.version_id desc limit 1) order by Versions.path limit ?2;",
+		fs.dirPrefix(prefix), limit)
+	if err != nil {
+		return nil, fs.dbError(err)
+	}
+	return fs.getVersions(rows)
+}
+
+// DeleteUnder deletes all versions of the files under the directory prefix, except pinned
+// versions, and returns the number of versions deleted. Their contents are deleted unless other
+// versions or leases use them. The empty prefix selects all files like in VersionsUnder.
+func (fs *Filestore) DeleteUnder(prefix string) (_ int, err error) {
+	op := newOp("DeleteUnder", prefix)
+	defer op.done(&err)
+	if err := fs.ensureOpen(); err != nil {
+		return 0, err
+	}
+	tx, err := fs.begin()
+	if err != nil {
+		return 0, err
+	}
+	rows, err := tx.tx.Query(selectVersions+" where substr(Versions.path, 1, length(?1))=?1 and version_id not in (select version from Pins);", fs.dirPrefix(prefix))
+	if err != nil {
+		tx.rollback()
+		return 0, fs.dbError(err)
+	}
+	versions, err := fs.getVersions(rows)
+	if err != nil {
+		tx.rollback()
+		return 0, err
+	}
+	for _, version := range versions {
+		if err := tx.deleteVersion(version); err != nil {
+			tx.rollback()
+			return 0, err
+		}
+	}
+	if err := tx.commit(); err != nil {
+		return 0, err
+	}
+	return len(versions), nil
+}
@@ -0,0 +1,54 @@
+package filestore
+
+import (
+	"path/filepath"
+	"testing"
+)
+
+func TestSubtree(t *testing.T) {
+	fs, src := newTestStore(t)
+	add := func(rel, data string) {
+		addFile(t, fs, filepath.Join(src, filepath.FromSlash(rel)), data, "", data)
+	}
+	add("proj/a.txt", "a1")
+	add("proj/a.txt", "a2")
+	add("proj/sub/b.txt", "b1")
+	add("project2/c.txt", "c1")
+	proj := filepath.Join(src, "proj")
+	versions, err := fs.VersionsUnder(proj, -1)
+	if err != nil || len(versions) != 2 || versions[0].Name != "a.txt" || versions[1].Name != "b.txt" {
+		t.Fatalf("VersionsUnder = %v, %v, want the latest versions of a.txt and b.txt", versions, err)
+	}
+	if versions, err := fs.VersionsUnder(proj+string(filepath.Separator), 1); err != nil || len(versions) != 1 {
+		t.Fatalf("VersionsUnder = %v, %v, want 1 version", versions, err)
+	}
+	if versions, err := fs.VersionsUnder("", -1); err != nil || len(versions) != 3 {
+		t.Fatalf("VersionsUnder the root = %v, %v, want 3 versions", versions, err)
+	}
+	fs.Retention = RetentionPolicy{MaxVersions: 1}
+	if n, err := fs.PruneUnder(filepath.Join(src, "project2")); err != nil || n != 0 {
+		t.Fatalf("PruneUnder = %d, %v, want nothing pruned", n, err)
+	}
+	if n, err := fs.PruneUnder(proj); err != nil || n != 1 {
+		t.Fatalf("PruneUnder = %d, %v, want the old version of a.txt pruned", n, err)
+	}
+	// pinned versions are kept, and paths sharing the prefix are not in the subtree
+	add("project2/c.txt", "c2")
+	b := filepath.Join(proj, "sub", "b.txt")
+	v, err := fs.Get(b)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := fs.Pin(v); err != nil {
+		t.Fatal(err)
+	}
+	if n, err := fs.DeleteUnder(proj); err != nil || n != 1 {
+		t.Fatalf("DeleteUnder = %d, %v, want 1 version deleted", n, err)
+	}
+	if fs.Has(filepath.Join(proj, "a.txt")) || !fs.Has(b) {
+		t.Fatal("DeleteUnder deleted the pinned version or kept the other")
+	}
+	if versions, err := fs.Versions(filepath.Join(src, "project2", "c.txt"), -1); err != nil || len(versions) != 2 {
+		t.Fatalf("Versions = %v, %v, want both versions of c.txt", versions, err)
+	}
+}
@@ -0,0 +1,126 @@
+package filestore
+
+import (
+	"bytes"
+	"database/sql"
+	"io"
+	"os"
+)
+
+// summaryColumns are the columns of the Summaries table read by scanVersion.
+const summaryColumns = "bytes_added, bytes_removed, lines_added, lines_removed, is_text"
+
+// ChangeSummary summarizes the changes of a version compared to the previous version of the same
+// file. It is stored when a version is added to a filestore with the Summarize option. The first
+// version of a file is compared to empty contents. Lines are compared like in Diff if both
+// versions are text, otherwise the bytes at the same offsets are compared, and a changed byte
+// counts as both removed and added.
+type ChangeSummary struct {
+	BytesAdded   int64 `json:"bytes_added"`   // the number of bytes in added lines, or of changed and appended bytes
+	BytesRemoved int64 `json:"bytes_removed"` // the number of bytes in removed lines, or of changed and truncated bytes
+	LinesAdded   int   `json:"lines_added"`   // the number of added lines, 0 if not compared as text
+	LinesRemoved int   `json:"lines_removed"` // the number of removed lines, 0 if not compared as text
+	Text         bool  `json:"text"`          // true if the lines were compared
+}
+
+// nullSummary holds the summary columns of a version, which are null if it has no summary.
+type nullSummary struct {
+	bytesAdded, bytesRemoved, linesAdded, linesRemoved sql.NullInt64
+	text                                               sql.NullBool
+}
+
+// get returns the summary, or nil if the columns are null.
+func (s *nullSummary) get() *ChangeSummary {
+	if !s.bytesAdded.Valid {
+		return nil
+	}
+	return &ChangeSummary{BytesAdded: s.bytesAdded.Int64, BytesRemoved: s.bytesRemoved.Int64,
+		LinesAdded: int(s.linesAdded.Int64), LinesRemoved: int(s.linesRemoved.Int64), Text: s.text.Bool}
+}
+
+// summarize compares the file at path to the latest version of it in the filestore. If tx is not
+// nil, the latest version is looked up within the transaction.
+func (fs *Filestore) summarize(tx *sql.Tx, path string) (*ChangeSummary, error) {
+	var q querier = fs.db
+	if tx != nil {
+		q = tx
+	}
+	rows, err := q.Query(selectVersions+" where Versions.path=? order by Versions.date desc, version_id desc limit 1;",
+		fs.storedPath(path))
+	if err != nil {
+		return nil, fs.dbError(err)
+	}
+	versions, err := fs.getVersions(rows)
+	if err != nil {
+		return nil, err
+	}
+	var old io.Reader = bytes.NewReader(nil)
+	if len(versions) > 0 {
+		r, err := fs.openBlob(versions[0])
+		if err != nil {
+			return nil, err
+		}
+		defer r.Close()
+		old = r
+	}
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	return changeSummary(old, f)
+}
+
+// changeSummary returns the summary of the changes from the contents of a to those of b.
+func changeSummary(a, b io.Reader) (*ChangeSummary, error) {
+	textA, isTextA, err := readText(a)
+	if err != nil {
+		return nil, err
+	}
+	textB, isTextB, err := readText(b)
+	if err != nil {
+		return nil, err
+	}
+	if isTextA && isTextB {
+		summary := &ChangeSummary{Text: true}
+		for _, e := range diffLines(splitLines(string(textA)), splitLines(string(textB))) {
+			switch e.kind {
+			case '+':
+				summary.LinesAdded++
+				summary.BytesAdded += int64(len(e.line))
+			case '-':
+				summary.LinesRemoved++
+				summary.BytesRemoved += int64(len(e.line))
+			}
+		}
+		return summary, nil
+	}
+	_, different, sizeA, sizeB, err := compareBytes(io.MultiReader(bytes.NewReader(textA), a),
+		io.MultiReader(bytes.NewReader(textB), b))
+	if err != nil {
+		return nil, err
+	}
+	summary := &ChangeSummary{}
+	if sizeB > sizeA {
+		summary.BytesRemoved = different - (sizeB - sizeA)
+		summary.BytesAdded = different
+	} else {
+		summary.BytesAdded = different - (sizeA - sizeB)
+		summary.BytesRemoved = different
+	}
+	return summary, nil
+}
+
+// insertSummary stores the summary of the version with the given ID, within tx if it is not nil.
+func (fs *Filestore) insertSummary(tx *sql.Tx, versionID int64, summary *ChangeSummary) error {
+	var q querier = fs.db
+	if tx != nil {
+		q = tx
+	}
+	_, err := q.Exec("insert into Summaries(summary_of, "+summaryColumns+") values(?, ?, ?, ?, ?, ?);", versionID,
+		summary.BytesAdded, summary.BytesRemoved, summary.LinesAdded, summary.LinesRemoved, summary.Text)
+	if err != nil {
+		return fs.dbError(err)
+	}
+	return nil
+}
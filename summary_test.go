@@ -0,0 +1,57 @@
+package filestore
+
+import (
+	"path/filepath"
+	"testing"
+)
+
+func TestSummaries(t *testing.T) {
+	fs, src := openTestStore(t, NewFilestore(filepath.Join(t.TempDir(), "store"), Summarize))
+	path := filepath.Join(src, "a.txt")
+	addFile(t, fs, path, "one\ntwo\nthree\n", "", "1")
+	addFile(t, fs, path, "one\n2\nthree\nfour\n", "", "2")
+	versions, err := fs.Versions(path, -1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if s := versions[1].Summary; s == nil || *s != (ChangeSummary{BytesAdded: 14, LinesAdded: 3, Text: true}) {
+		t.Fatalf("summary of the first version = %+v", s)
+	}
+	if s := versions[0].Summary; s == nil || *s != (ChangeSummary{BytesAdded: 7, BytesRemoved: 4, LinesAdded: 2, LinesRemoved: 1, Text: true}) {
+		t.Fatalf("summary of the second version = %+v", s)
+	}
+	// versions added in a transaction are summarized against the ones added before them
+	bin := filepath.Join(src, "b.bin")
+	tx, err := fs.Begin()
+	if err != nil {
+		t.Fatal(err)
+	}
+	writeFile(t, bin, "\x00\x01\x02\x03")
+	if err := tx.Add(bin, "", "1"); err != nil {
+		t.Fatal(err)
+	}
+	writeFile(t, bin, "\x00\x09\x02")
+	if err := tx.Add(bin, "", "2"); err != nil {
+		t.Fatal(err)
+	}
+	if err := tx.Commit(); err != nil {
+		t.Fatal(err)
+	}
+	if versions, err = fs.Versions(bin, -1); err != nil {
+		t.Fatal(err)
+	}
+	if s := versions[0].Summary; s == nil || *s != (ChangeSummary{BytesAdded: 1, BytesRemoved: 2}) {
+		t.Fatalf("summary of the binary version = %+v", s)
+	}
+	// summaries are deleted with their versions
+	if err := fs.DeleteVersion(versions[1]); err != nil {
+		t.Fatal(err)
+	}
+	var n int
+	if err := fs.db.QueryRow("select count(*) from Summaries;").Scan(&n); err != nil {
+		t.Fatal(err)
+	}
+	if n != 3 {
+		t.Fatalf("%d summaries stored, want 3", n)
+	}
+}
@@ -0,0 +1,61 @@
+package filestore
+
+// Suspend closes the database of the filestore and releases the prepared statements, so that
+// other processes such as sync clients see a consistent state of the filestore directory and no
+// locks are held while the filestore is idle. The filestore remains usable: Resume reopens it,
+// and so does any operation called while it is suspended. If other filestores in this process
+// are open on the same directory, the database is only closed when they are closed or suspended
+// as well. Suspend must not be called while operations or transactions are in progress.
+func (fs *Filestore) Suspend() (err error) {
+	op := newOp("Suspend", fs.Dir)
+	defer op.done(&err)
+	fs.stateMutex.Lock()
+	defer fs.stateMutex.Unlock()
+	if fs.suspended {
+		return nil
+	}
+	if fs.db == nil {
+		return ErrNotOpen
+	}
+	if err := fs.close(); err != nil {
+		return err
+	}
+	fs.suspended = true
+	return nil
+}
+
+// Resume reopens a filestore suspended with Suspend. It does nothing if the filestore is not
+// suspended.
+func (fs *Filestore) Resume() (err error) {
+	op := newOp("Resume", fs.Dir)
+	defer op.done(&err)
+	fs.stateMutex.Lock()
+	defer fs.stateMutex.Unlock()
+	return fs.resume()
+}
+
+// resume reopens the filestore if it is suspended. The caller must hold the state mutex.
+func (fs *Filestore) resume() error {
+	if !fs.suspended {
+		return nil
+	}
+	if err := fs.open(); err != nil {
+		return err
+	}
+	fs.suspended = false
+	return nil
+}
+
+// ensureOpen resumes the filestore if it is suspended and returns ErrNotOpen if it has not been
+// opened.
+func (fs *Filestore) ensureOpen() error {
+	fs.stateMutex.Lock()
+	defer fs.stateMutex.Unlock()
+	if err := fs.resume(); err != nil {
+		return err
+	}
+	if fs.db == nil {
+		return ErrNotOpen
+	}
+	return nil
+}
@@ -0,0 +1,55 @@
+package filestore
+
+import (
+	"errors"
+	"path/filepath"
+	"testing"
+)
+
+func TestSuspend(t *testing.T) {
+	fs, src := newTestStore(t)
+	key, err := fs.registryKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	path := filepath.Join(src, "a.txt")
+	addFile(t, fs, path, "a", "", "1")
+	if err := fs.Suspend(); err != nil {
+		t.Fatal(err)
+	}
+	registry.Lock()
+	_, ok := registry.dbs[key]
+	registry.Unlock()
+	if fs.db != nil || ok {
+		t.Fatal("database is still open after suspending the filestore")
+	}
+	// operations reopen a suspended filestore
+	v, err := fs.Get(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := fs.Suspend(); err != nil {
+		t.Fatal(err)
+	}
+	r, err := fs.OpenVersion(v)
+	if err != nil {
+		t.Fatal(err)
+	}
+	r.Close()
+	if err := fs.Suspend(); err != nil {
+		t.Fatal(err)
+	}
+	if err := fs.Resume(); err != nil || fs.db == nil {
+		t.Fatalf("Resume = %v, want the database open", err)
+	}
+	// a suspended filestore can be closed and is not reopened afterwards
+	if err := fs.Suspend(); err != nil {
+		t.Fatal(err)
+	}
+	if err := fs.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := fs.Get(path); !errors.Is(err, ErrNotOpen) {
+		t.Fatalf("Get after closing = %v, want ErrNotOpen", err)
+	}
+}
@@ -0,0 +1,75 @@
+package filestore
+
+import (
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+)
+
+var ErrSymlink = errors.New("filestore rejects symbolic links")
+
+// SymlinkPolicy determines how symbolic links are added to the filestore.
+type SymlinkPolicy int
+
+const (
+	SymlinkFollow SymlinkPolicy = iota // the file a link points to is added under the path of the link
+	SymlinkStore                       // the link itself is added with its target as contents and recreated on restore
+	SymlinkReject                      // adding a link fails with ErrSymlink
+)
+
+// symlinkTarget returns the target of the file at path and true if it is a symbolic link that is
+// stored as such, or ErrSymlink if it is a symbolic link and the filestore rejects them.
+func (fs *Filestore) symlinkTarget(path string) (string, bool, error) {
+	if fs.Symlinks == SymlinkFollow {
+		return "", false, nil
+	}
+	info, err := os.Lstat(path)
+	if err != nil || info.Mode()&os.ModeSymlink == 0 {
+		// errors are reported when the file is read
+		return "", false, nil
+	}
+	if fs.Symlinks == SymlinkReject {
+		return "", false, ErrSymlink
+	}
+	target, err := os.Readlink(path)
+	return target, err == nil, err
+}
+
+// contentsFile returns the file holding the contents of a version of the file at path, which is
+// path itself unless it is a symbolic link stored as such. In that case, the contents are the
+// target of the link, which is written to a temporary file of the same name whose directory is
+// to be removed once the contents are stored, and true is returned.
+func (fs *Filestore) contentsFile(path string) (string, bool, error) {
+	target, link, err := fs.symlinkTarget(path)
+	if err != nil || !link {
+		return path, false, err
+	}
+	dir, err := os.MkdirTemp(fs.tempDir(), "link-")
+	if err != nil {
+		return "", false, err
+	}
+	src := filepath.Join(dir, filepath.Base(path))
+	if err := os.WriteFile(src, []byte(target), 0600); err != nil {
+		os.RemoveAll(dir)
+		return "", false, err
+	}
+	return src, true, nil
+}
+
+// restoreSymlink recreates the symbolic link of version at dst, replacing an existing file.
+func (fs *Filestore) restoreSymlink(version FileVersion, dst string) error {
+	r, err := fs.openBlob(version)
+	if err != nil {
+		return err
+	}
+	target, err := io.ReadAll(r)
+	r.Close()
+	if err != nil {
+		return err
+	}
+	if err := os.Remove(dst); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	return os.Symlink(string(target), dst)
+}
@@ -0,0 +1,80 @@
+package filestore
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestSymlinks(t *testing.T) {
+	fs, src := newTestStore(t)
+	writeFile(t, filepath.Join(src, "target.txt"), "contents")
+	link := filepath.Join(src, "link")
+	if err := os.Symlink("target.txt", link); err != nil {
+		t.Skip("symbolic links are not supported:", err)
+	}
+	if err := os.Symlink("missing", filepath.Join(src, "dangling")); err != nil {
+		t.Fatal(err)
+	}
+	// links are followed by default
+	if err := fs.Add(link, "", "1"); err != nil {
+		t.Fatal(err)
+	}
+	v, err := fs.Get(link)
+	if err != nil || v.Mode&os.ModeSymlink != 0 {
+		t.Fatalf("Get = mode %v, %v, want the mode of the target", v.Mode, err)
+	}
+	fs.Symlinks = SymlinkStore
+	if err := fs.Add(link, "", "2"); err != nil {
+		t.Fatal(err)
+	}
+	versions, err := fs.Versions(link, -1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, w := range versions {
+		if w.Version == "2" {
+			v = w
+		}
+	}
+	if v.Mode&os.ModeSymlink == 0 {
+		t.Fatalf("stored link has mode %v, want a symbolic link", v.Mode)
+	}
+	// restoring a link replaces the file at its place
+	dst := t.TempDir()
+	writeFile(t, filepath.Join(dst, "link"), "old")
+	if err := fs.Restore(v, dst); err != nil {
+		t.Fatal(err)
+	}
+	if target, err := os.Readlink(filepath.Join(dst, "link")); err != nil || target != "target.txt" {
+		t.Fatalf("Readlink = %q, %v, want %q", target, err, "target.txt")
+	}
+	if report, err := fs.Verify(VerifyOptions{}); err != nil || !report.OK() {
+		t.Fatalf("Verify = %v, %v", report.Problems, err)
+	}
+	// dangling links are stored in trees as well
+	id, err := fs.AddTree(src, "", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	out := t.TempDir()
+	if err := fs.RestoreTree(id, out); err != nil {
+		t.Fatal(err)
+	}
+	if target, err := os.Readlink(filepath.Join(out, "dangling")); err != nil || target != "missing" {
+		t.Fatalf("Readlink = %q, %v, want %q", target, err, "missing")
+	}
+	fs.Symlinks = SymlinkReject
+	if err := fs.Add(link, "", "3"); !errors.Is(err, ErrSymlink) {
+		t.Fatalf("Add of a link = %v, want ErrSymlink", err)
+	}
+	_, err = fs.AddTree(src, "", "")
+	var treeErrors *TreeErrors
+	if !errors.As(err, &treeErrors) || len(treeErrors.Errors) != 2 || !errors.Is(treeErrors.Errors[0].Err, ErrSymlink) {
+		t.Fatalf("AddTree = %v, want a TreeErrors of the 2 links", err)
+	}
+	if _, err := fs.AddTree(src, "", "", TreeFailFast()); !errors.Is(err, ErrSymlink) {
+		t.Fatalf("AddTree = %v with TreeFailFast, want ErrSymlink", err)
+	}
+}
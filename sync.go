@@ -0,0 +1,96 @@
+package filestore
+
+import (
+	"os"
+	"path/filepath"
+	"runtime"
+
+	"github.com/rasteric/flags"
+)
+
+// Flush makes all changes committed so far visible to processes reading the database file
+// directly, such as backup tools copying it. Committed changes are first written to the
+// write-ahead log, which Flush checkpoints into the database file. New connections of SQLite see
+// committed changes in any case. Flush does nothing if the filestore is read-only or in memory.
+func (fs *Filestore) Flush() (err error) {
+	op := newOp("Flush", fs.Dir)
+	defer op.done(&err)
+	if err := fs.ensureOpen(); err != nil {
+		return err
+	}
+	return fs.flush()
+}
+
+func (fs *Filestore) flush() error {
+	if flags.Has(fs.Options, ReadOnly) || fs.memory != "" {
+		return nil
+	}
+	if _, err := fs.db.Exec("pragma wal_checkpoint(TRUNCATE);"); err != nil {
+		return fs.dbError(err)
+	}
+	return nil
+}
+
+// Sync guarantees that all changes committed before it was called survive a crash of the
+// operating system or a power failure, so that external processes may be notified of them. It
+// flushes the database like Flush and writes the blobs and chunks stored since the last Sync,
+// their directories and the database to disk. Without Sync, the operating system writes them
+// to disk at a time of its choosing.
+func (fs *Filestore) Sync() (err error) {
+	op := newOp("Sync", fs.Dir)
+	defer op.done(&err)
+	if err := fs.ensureOpen(); err != nil {
+		return err
+	}
+	if err := fs.flush(); err != nil {
+		return err
+	}
+	fs.syncMutex.Lock()
+	unsynced := fs.unsynced
+	fs.unsynced = nil
+	fs.syncMutex.Unlock()
+	dirs := make(map[string]bool)
+	for i, path := range unsynced {
+		if err := syncFile(path); err != nil {
+			fs.wrote(unsynced[i:]...)
+			return err
+		}
+		dirs[filepath.Dir(path)] = true
+	}
+	dirs[filepath.Clean(fs.Root())] = true
+	for dir := range dirs {
+		if runtime.GOOS == "windows" {
+			// directories cannot be synced on Windows, where their entries are durable anyway
+			break
+		}
+		if err := syncFile(dir); err != nil {
+			return err
+		}
+	}
+	if flags.Has(fs.Options, ReadOnly) {
+		return nil
+	}
+	return syncFile(fs.dbPath())
+}
+
+// wrote records that the files at the given paths have been written, so that Sync writes them
+// to disk.
+func (fs *Filestore) wrote(paths ...string) {
+	fs.syncMutex.Lock()
+	defer fs.syncMutex.Unlock()
+	fs.unsynced = append(fs.unsynced, paths...)
+}
+
+// syncFile writes the file or directory at path to disk. Files that no longer exist, such as
+// blobs removed by a rollback, are ignored.
+func syncFile(path string) error {
+	f, err := os.Open(path)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	return f.Sync()
+}
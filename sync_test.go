@@ -0,0 +1,28 @@
+package filestore
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestSync(t *testing.T) {
+	fs, src := openTestStore(t, NewFilestore(filepath.Join(t.TempDir(), "store"), Shared|Chunked))
+	addFile(t, fs, filepath.Join(src, "a.txt"), "hello", "a", "1")
+	if len(fs.unsynced) == 0 {
+		t.Fatal("no files to synchronize after adding a version")
+	}
+	if err := fs.Sync(); err != nil {
+		t.Fatal(err)
+	}
+	if len(fs.unsynced) != 0 {
+		t.Fatalf("%d files left to synchronize after Sync", len(fs.unsynced))
+	}
+	// the write-ahead log is checkpointed into the database
+	if info, err := os.Stat(fs.dbPath() + "-wal"); err == nil && info.Size() != 0 {
+		t.Fatalf("write-ahead log has %d bytes after Sync", info.Size())
+	}
+	if err := fs.Flush(); err != nil {
+		t.Fatal(err)
+	}
+}
@@ -0,0 +1,100 @@
+package filestore
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+)
+
+// SyncOptions are the options of SyncTo.
+type SyncOptions struct {
+	Filter Filter // only versions matching the filter are pushed, all if it is the zero Filter
+	DryRun bool   // if true, the report is computed but the other filestore is not changed
+}
+
+// SyncReport summarizes what SyncTo pushed to the other filestore.
+type SyncReport struct {
+	Versions int   // the number of versions pushed
+	Present  int   // the number of versions the other filestore already had
+	Contents int   // the number of contents copied
+	Bytes    int64 // the size of the contents copied
+}
+
+// SyncTo pushes the versions of the filestore that the other filestore lacks to it with their
+// dates, info strings, tags, pins and signatures, so that the other filestore mirrors this one,
+// for instance a filestore on a laptop to one on a network drive. A version is present in the
+// other filestore if it has a version of the same path with the same date and checksum. Contents
+// are only copied if the other filestore has no contents with the same checksum, and are
+// stored with its codec and keys. Versions deleted from this filestore are not deleted from the
+// other. Both filestores must be open. The changes to the other filestore are made in a single
+// transaction, so nothing is pushed if SyncTo fails.
+func (fs *Filestore) SyncTo(other *Filestore, opts SyncOptions) (_ SyncReport, err error) {
+	op := newOp("SyncTo", other.Dir)
+	defer op.done(&err)
+	if err := fs.ensureOpen(); err != nil {
+		return SyncReport{}, err
+	}
+	manifest, err := fs.exportManifest(fs.db, ExportOptions{Filter: opts.Filter})
+	if err != nil {
+		return SyncReport{}, err
+	}
+	tx, err := other.begin()
+	if err != nil {
+		return SyncReport{}, err
+	}
+	tmp, err := os.MkdirTemp(other.tempDir(), "import-")
+	if err != nil {
+		tx.rollback()
+		return SyncReport{}, err
+	}
+	defer os.RemoveAll(tmp)
+	var report SyncReport
+	copied := make(map[string]bool) // the checksums of the contents copied
+	for _, v := range manifest.Versions {
+		v = other.importedPath(v, v.Path)
+		var present, stored bool
+		if err := tx.tx.QueryRow("select exists (select 1 from Versions inner join Files on Versions.file=Files.file_id where path=? and date=? and checksum=?), exists (select 1 from Files where checksum=? and origin is null);",
+			v.Path, v.Date, v.Checksum, v.Checksum).Scan(&present, &stored); err != nil {
+			tx.rollback()
+			return report, other.dbError(err)
+		}
+		if present {
+			report.Present++
+			continue
+		}
+		report.Versions++
+		if !stored && !copied[v.Checksum] {
+			copied[v.Checksum] = true
+			report.Contents++
+			report.Bytes += v.Size
+			if !opts.DryRun {
+				if err := fs.syncContents(tx, v, filepath.Join(tmp, filepath.Base(filepath.FromSlash(v.Path)))); err != nil {
+					tx.rollback()
+					return report, fmt.Errorf("filestore could not push the contents of %s: %w", v.Path, err)
+				}
+			}
+		}
+		if opts.DryRun {
+			continue
+		}
+		if err := other.importVersion(tx, v); err != nil {
+			tx.rollback()
+			return report, err
+		}
+	}
+	if opts.DryRun {
+		return report, tx.rollback()
+	}
+	return report, tx.commit()
+}
+
+// syncContents stores the contents of the version v of this filestore in the filestore of tx,
+// using the file at tmp as a temporary copy.
+func (fs *Filestore) syncContents(tx *Tx, v manifestVersion, tmp string) error {
+	r, err := fs.openBlob(FileVersion{Name: filepath.Base(v.Path), Checksum: v.Checksum})
+	if err != nil {
+		return err
+	}
+	defer r.Close()
+	return tx.fs.importBlob(tx, r, tmp, v.Checksum, v.Hash)
+}
@@ -0,0 +1,58 @@
+package filestore
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestSyncTo(t *testing.T) {
+	fs, src := newTestStore(t)
+	other, _ := openTestStore(t, NewFilestore(filepath.Join(t.TempDir(), "other"), Compress|Chunked))
+	f, g := filepath.Join(src, "f.txt"), filepath.Join(src, "g.txt")
+	addFile(t, fs, f, "one", "f", "1")
+	vg := addFile(t, fs, g, "one", "g", "1")
+	if err := fs.Tag(vg, "x"); err != nil {
+		t.Fatal(err)
+	}
+	report, err := fs.SyncTo(other, SyncOptions{DryRun: true})
+	if err != nil || report.Versions != 2 || report.Contents != 1 {
+		t.Fatalf("dry SyncTo = %+v, %v, want 2 versions with 1 contents", report, err)
+	}
+	if versions, err := other.Versions(f, -1); err != nil || len(versions) != 0 {
+		t.Fatalf("Versions = %v, %v after a dry run, want none", versions, err)
+	}
+	report, err = fs.SyncTo(other, SyncOptions{})
+	if err != nil || report.Versions != 2 || report.Contents != 1 || report.Bytes != 3 {
+		t.Fatalf("SyncTo = %+v, %v, want 2 versions with 3 bytes of contents", report, err)
+	}
+	// only the new version is pushed
+	addFile(t, fs, f, "two", "f", "2")
+	report, err = fs.SyncTo(other, SyncOptions{})
+	if err != nil || report.Versions != 1 || report.Present != 2 {
+		t.Fatalf("SyncTo = %+v, %v, want 1 version pushed and 2 present", report, err)
+	}
+	if versions, err := other.Versions(f, -1); err != nil || len(versions) != 2 {
+		t.Fatalf("Versions = %v, %v, want 2 versions", versions, err)
+	}
+	v, err := other.Get(g)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if tags, err := other.Tags(v); err != nil || len(tags) != 1 {
+		t.Fatalf("Tags = %v, %v, want the pushed tag", tags, err)
+	}
+	if report, err := other.Verify(VerifyOptions{}); err != nil || !report.OK() {
+		t.Fatalf("Verify = %v, %v", report.Problems, err)
+	}
+	entries, err := os.ReadDir(other.Root())
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, e := range entries {
+		if strings.HasPrefix(e.Name(), "import-") {
+			t.Fatalf("temporary directory %s left after SyncTo", e.Name())
+		}
+	}
+}
@@ -0,0 +1,110 @@
+package filestore
+
+import (
+	"database/sql"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// TagRule tags added versions whose files match all of its criteria that are set, so that
+// versions are tagged consistently whoever adds them. The rules of the TagRules field of the
+// filestore are evaluated whenever a version is added.
+type TagRule struct {
+	Pattern string   `json:"pattern,omitempty"`  // filepath.Match pattern of the name or slash-separated path of the file
+	MIME    string   `json:"mime,omitempty"`     // MIME type of the file, or its prefix ending in a slash such as "image/"
+	MinSize int64    `json:"min_size,omitempty"` // minimum size of the file in bytes
+	MaxSize int64    `json:"max_size,omitempty"` // maximum size of the file in bytes, unlimited if zero
+	Tags    []string `json:"tags"`               // the tags added to matching versions
+}
+
+// check returns an error if the pattern or tags of the rule are invalid.
+func (r TagRule) check() error {
+	if _, err := filepath.Match(r.Pattern, ""); err != nil {
+		return fmt.Errorf("filestore tag rule has invalid pattern %q: %w", r.Pattern, err)
+	}
+	return checkTags(r.Tags)
+}
+
+// matches returns true if the file with the given slash-separated path, size and MIME type
+// matches the rule.
+func (r TagRule) matches(path string, size int64, mimeType string) bool {
+	if r.Pattern != "" && !ignored([]string{r.Pattern}, filepath.Base(path), path) {
+		return false
+	}
+	if size < r.MinSize || r.MaxSize > 0 && size > r.MaxSize {
+		return false
+	}
+	if r.MIME != "" {
+		if strings.HasSuffix(r.MIME, "/") {
+			return strings.HasPrefix(mimeType, r.MIME)
+		}
+		return mimeType == r.MIME
+	}
+	return true
+}
+
+// applyTagRules adds the tags of the TagRules matching the file at path to the version with the
+// given ID, within tx if it is not nil. The size and MIME type are those of the file src, which
+// has the contents of the version and is path unless the file has been restored elsewhere.
+func (fs *Filestore) applyTagRules(tx *sql.Tx, id int64, path, src string) error {
+	if len(fs.TagRules) == 0 {
+		return nil
+	}
+	// a symbolic link stored as such is matched by its own size rather than that of its target
+	info, err := os.Lstat(src)
+	if err == nil && info.Mode()&os.ModeSymlink != 0 && fs.Symlinks == SymlinkFollow {
+		info, err = os.Stat(src)
+	}
+	if err != nil {
+		return err
+	}
+	link := info.Mode()&os.ModeSymlink != 0
+	var mimeType string
+	for _, rule := range fs.TagRules {
+		if rule.MIME != "" && !link {
+			mimeType = detectMIME(src)
+			break
+		}
+	}
+	var q querier = fs.db
+	if tx != nil {
+		q = tx
+	}
+	slashPath := filepath.ToSlash(path)
+	for _, rule := range fs.TagRules {
+		if !rule.matches(slashPath, info.Size(), mimeType) {
+			continue
+		}
+		for _, tag := range rule.Tags {
+			if _, err := q.Exec("insert or ignore into Tags(tag, version) values(?, ?);", tag, id); err != nil {
+				return fs.dbError(err)
+			}
+		}
+	}
+	return nil
+}
+
+// detectMIME returns the MIME type of the file at path without parameters, determined by its
+// extension or else by its first bytes.
+func detectMIME(path string) string {
+	mimeType := mime.TypeByExtension(filepath.Ext(path))
+	if mimeType == "" {
+		f, err := os.Open(path)
+		if err != nil {
+			return ""
+		}
+		defer f.Close()
+		head := make([]byte, 512)
+		n, _ := io.ReadFull(f, head)
+		mimeType = http.DetectContentType(head[:n])
+	}
+	if media, _, err := mime.ParseMediaType(mimeType); err == nil {
+		return media
+	}
+	return mimeType
+}
@@ -0,0 +1,78 @@
+package filestore
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestTagRules(t *testing.T) {
+	fs, src := newTestStore(t)
+	fs.TagRules = []TagRule{
+		{Pattern: "*.pdf", Tags: []string{"document"}},
+		{MIME: "image/", Tags: []string{"image"}},
+		{MinSize: 10, Tags: []string{"big"}},
+		{MIME: "text/plain", Tags: []string{"text"}},
+	}
+	files := map[string]struct{ data, tags string }{
+		"a.pdf": {"%PDF-1.4 lots of stuff", "[big document]"},
+		"b.png": {"\x89PNG\r\n\x1a\n", "[image]"},
+		"c":     {"hello", "[text]"},
+	}
+	for name, file := range files {
+		v := addFile(t, fs, filepath.Join(src, name), file.data, "", "1")
+		if tags, err := fs.Tags(v); err != nil || fmt.Sprint(tags) != file.tags {
+			t.Fatalf("Tags of %s = %v, %v, want %s", name, tags, err, file.tags)
+		}
+	}
+	// tag rules are part of the policy, whose patterns are checked on import
+	if err := fs.SetPolicy(fs.Policy()); err != nil {
+		t.Fatal(err)
+	}
+	if err := fs.ImportPolicy(strings.NewReader(`{"tag_rules":[{"pattern":"[","tags":["x"]}]}`)); err == nil {
+		t.Fatal("ImportPolicy of a malformed pattern succeeded")
+	}
+	if len(fs.TagRules) != 4 {
+		t.Fatalf("%d tag rules after failing to import a policy, want the 4 rules set before", len(fs.TagRules))
+	}
+}
+
+func TestTagRulesSymlinks(t *testing.T) {
+	fs, src := newTestStore(t)
+	fs.TagRules = []TagRule{{MinSize: 16, Tags: []string{"big"}}}
+	fs.Symlinks = SymlinkStore
+	writeFile(t, filepath.Join(src, "target.txt"), "a rather big target")
+	link := filepath.Join(src, "link")
+	if err := os.Symlink("target.txt", link); err != nil {
+		t.Skip("symbolic links are not supported:", err)
+	}
+	dangling := filepath.Join(src, "dangling")
+	if err := os.Symlink("missing", dangling); err != nil {
+		t.Fatal(err)
+	}
+	// stored links are matched by their own size, even if their target is missing
+	for _, path := range []string{link, dangling} {
+		if err := fs.Add(path, "", "1"); err != nil {
+			t.Fatal(err)
+		}
+		v, err := fs.Get(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if tags, err := fs.Tags(v); err != nil || len(tags) != 0 {
+			t.Fatalf("Tags of %s = %v, %v, want none", path, tags, err)
+		}
+	}
+	// followed links are matched by the size of their target
+	fs.Symlinks = SymlinkFollow
+	if err := fs.Add(link, "", "2"); err != nil {
+		t.Fatal(err)
+	}
+	if v, err := fs.Get(link); err != nil {
+		t.Fatal(err)
+	} else if tags, err := fs.Tags(v); err != nil || fmt.Sprint(tags) != "[big]" {
+		t.Fatalf("Tags of a followed link = %v, %v, want [big]", tags, err)
+	}
+}
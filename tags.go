@@ -0,0 +1,179 @@
+package filestore
+
+import (
+	"errors"
+	"strings"
+	"time"
+)
+
+var ErrInvalidTag = errors.New("filestore tags must not be empty")
+
+// Filter selects versions by their properties. A version matches if it satisfies all criteria
+// that are set, so the zero Filter matches all versions.
+type Filter struct {
+	PathPrefix string    // only versions whose path starts with this prefix
+	Info       string    // only versions whose info string contains this string
+	Version    string    // only versions with exactly this version string
+	After      time.Time // only versions added after this time
+	Before     time.Time // only versions added before this time
+	Tags       []string  // only versions that have all of these tags
+}
+
+// where returns the condition of a query of VersionsText selecting the versions matching the
+// filter in the filestore fs, and its arguments.
+func (f Filter) where(fs *Filestore) (string, []interface{}) {
+	conds := []string{"1"}
+	var args []interface{}
+	if f.PathPrefix != "" {
+		conds = append(conds, "substr(path, 1, length(?))=?")
+		prefix := fs.storedPath(f.PathPrefix)
+		args = append(args, prefix, prefix)
+	}
+	if f.Info != "" {
+		conds = append(conds, "instr(info, ?) > 0")
+		args = append(args, f.Info)
+	}
+	if f.Version != "" {
+		conds = append(conds, "version=?")
+		args = append(args, f.Version)
+	}
+	if !f.After.IsZero() {
+		conds = append(conds, "date > ?")
+		args = append(args, ToDBDate(f.After.UTC()))
+	}
+	if !f.Before.IsZero() {
+		conds = append(conds, "date < ?")
+		args = append(args, ToDBDate(f.Before.UTC()))
+	}
+	for _, tag := range f.Tags {
+		conds = append(conds, "version_id in (select version from Tags where tag=?)")
+		args = append(args, tag)
+	}
+	return strings.Join(conds, " and "), args
+}
+
+// checkTags returns ErrInvalidTag if any of the tags is empty.
+func checkTags(tags []string) error {
+	for _, tag := range tags {
+		if tag == "" {
+			return ErrInvalidTag
+		}
+	}
+	return nil
+}
+
+// Tag adds the given tags to a version. Tags the version already has are ignored.
+func (fs *Filestore) Tag(version FileVersion, tags ...string) (err error) {
+	op := newOp("Tag", version.Path)
+	defer op.done(&err)
+	if err := fs.ensureOpen(); err != nil {
+		return err
+	}
+	if err := checkTags(tags); err != nil {
+		return err
+	}
+	if _, err := fs.versionByID(fs.db, version.ID); err != nil {
+		return err
+	}
+	_, err = fs.tagWhere("insert or ignore into Tags(tag, version) values(?, ?);", tags, version.ID)
+	return err
+}
+
+// Untag removes the given tags from a version. Tags the version does not have are ignored.
+func (fs *Filestore) Untag(version FileVersion, tags ...string) (err error) {
+	op := newOp("Untag", version.Path)
+	defer op.done(&err)
+	if err := fs.ensureOpen(); err != nil {
+		return err
+	}
+	_, err = fs.tagWhere("delete from Tags where tag=? and version=?;", tags, version.ID)
+	return err
+}
+
+// Tags returns the tags of a version in alphabetical order.
+func (fs *Filestore) Tags(version FileVersion) (_ []string, err error) {
+	op := newOp("Tags", version.Path)
+	defer op.done(&err)
+	if err := fs.ensureOpen(); err != nil {
+		return nil, err
+	}
+	return fs.tags(fs.db, version.ID)
+}
+
+// tags returns the tags of the version with the given ID in alphabetical order.
+func (fs *Filestore) tags(q querier, id int64) ([]string, error) {
+	rows, err := q.Query("select tag from Tags where version=? order by tag;", id)
+	if err != nil {
+		return nil, fs.dbError(err)
+	}
+	defer rows.Close()
+	tags := make([]string, 0)
+	for rows.Next() {
+		var tag string
+		if err := rows.Scan(&tag); err != nil {
+			return nil, fs.dbError(err)
+		}
+		tags = append(tags, tag)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fs.dbError(err)
+	}
+	return tags, nil
+}
+
+// TagWhere adds the given tags to all versions matching filter and returns the number of tags
+// added, not counting tags the versions already had. For example, a filter with the PathPrefix
+// "invoices/2023/" and the tag "fy2023" tags all versions of files in that directory.
+func (fs *Filestore) TagWhere(filter Filter, tags ...string) (_ int64, err error) {
+	op := newOp("TagWhere", filter.PathPrefix)
+	defer op.done(&err)
+	if err := fs.ensureOpen(); err != nil {
+		return 0, err
+	}
+	if err := checkTags(tags); err != nil {
+		return 0, err
+	}
+	cond, args := filter.where(fs)
+	return fs.tagWhere("insert or ignore into Tags(version, tag) select version_id, ? from VersionsText where "+cond+";",
+		tags, args...)
+}
+
+// UntagWhere removes the given tags from all versions matching filter and returns the number of
+// tags removed.
+func (fs *Filestore) UntagWhere(filter Filter, tags ...string) (_ int64, err error) {
+	op := newOp("UntagWhere", filter.PathPrefix)
+	defer op.done(&err)
+	if err := fs.ensureOpen(); err != nil {
+		return 0, err
+	}
+	cond, args := filter.where(fs)
+	return fs.tagWhere("delete from Tags where tag=? and version in (select version_id from VersionsText where "+cond+");",
+		tags, args...)
+}
+
+// tagWhere executes stmt, whose first argument is a tag, for each of the tags within a single
+// transaction and returns the total number of rows affected.
+func (fs *Filestore) tagWhere(stmt string, tags []string, args ...interface{}) (int64, error) {
+	tx, err := fs.db.Begin()
+	if err != nil {
+		return 0, fs.dbError(err)
+	}
+	var total int64
+	for _, tag := range tags {
+		result, err := tx.Exec(stmt, append([]interface{}{tag}, args...)...)
+		if err != nil {
+			tx.Rollback()
+			return 0, fs.dbError(err)
+		}
+		n, err := result.RowsAffected()
+		if err != nil {
+			tx.Rollback()
+			return 0, fs.dbError(err)
+		}
+		total += n
+	}
+	if err := tx.Commit(); err != nil {
+		return 0, fs.dbError(err)
+	}
+	return total, nil
+}
@@ -0,0 +1,54 @@
+package filestore
+
+import (
+	"errors"
+	"path/filepath"
+	"testing"
+)
+
+func TestTagWhere(t *testing.T) {
+	fs, src := newTestStore(t)
+	dir := filepath.Join(src, "invoices", "2023")
+	a, b, c := filepath.Join(dir, "a"), filepath.Join(dir, "b"), filepath.Join(src, "c")
+	for _, path := range []string{a, b, c} {
+		addFile(t, fs, path, path, "invoice "+filepath.Base(path), "1")
+	}
+	if n, err := fs.TagWhere(Filter{PathPrefix: dir}, "fy2023", "money"); err != nil || n != 4 {
+		t.Fatalf("TagWhere = %d, %v, want 4 tags added", n, err)
+	}
+	// tags the versions already have are not counted
+	if n, err := fs.TagWhere(Filter{PathPrefix: filepath.Join(src, "invoices")}, "fy2023"); err != nil || n != 0 {
+		t.Fatalf("TagWhere of existing tags = %d, %v, want 0", n, err)
+	}
+	va, err := fs.Get(a)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if tags, err := fs.Tags(va); err != nil || len(tags) != 2 || tags[0] != "fy2023" || tags[1] != "money" {
+		t.Fatalf("Tags = %v, %v, want fy2023 and money", tags, err)
+	}
+	vc, err := fs.Get(c)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := fs.Tag(vc, "money"); err != nil {
+		t.Fatal(err)
+	}
+	if n, err := fs.UntagWhere(Filter{Tags: []string{"fy2023"}, Info: "invoice a"}, "money"); err != nil || n != 1 {
+		t.Fatalf("UntagWhere = %d, %v, want 1 tag removed", n, err)
+	}
+	if _, err := fs.TagWhere(Filter{}, ""); !errors.Is(err, ErrInvalidTag) {
+		t.Fatalf("TagWhere of an empty tag = %v, want ErrInvalidTag", err)
+	}
+	// tags are deleted with their versions
+	if err := fs.DeleteVersion(vc); err != nil {
+		t.Fatal(err)
+	}
+	var n int
+	if err := fs.db.QueryRow("select count(*) from Tags;").Scan(&n); err != nil {
+		t.Fatal(err)
+	}
+	if n != 3 {
+		t.Fatalf("%d tags stored, want 3", n)
+	}
+}
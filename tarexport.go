@@ -0,0 +1,157 @@
+package filestore
+
+import (
+	"archive/tar"
+	"encoding/json"
+	"fmt"
+	"io"
+	"path/filepath"
+)
+
+// Names of the entries of archives written by ExportTar.
+const (
+	tarManifestName = "manifest.json" // the manifest listing the versions, which comes first
+	tarBlobDir      = "blobs/"        // the directory of the contents, named by their checksums
+	tarFormat       = 1               // the version of the format of archives
+)
+
+// ExportOptions are the options of ExportTar.
+type ExportOptions struct {
+	Filter     Filter // only versions matching the filter are exported, all if it is the zero Filter
+	LatestOnly bool   // only the latest version of each path is exported, if it matches the filter
+}
+
+// tarManifest is the manifest of an archive written by ExportTar.
+type tarManifest struct {
+	Format   int               `json:"format"`
+	Versions []manifestVersion `json:"versions"`
+}
+
+// manifestVersion describes a version in the manifest of an archive.
+type manifestVersion struct {
+	UUID      string            `json:"uuid,omitempty"`
+	Path      string            `json:"path"` // slash-separated
+	Info      string            `json:"info"`
+	Version   string            `json:"version"`
+	Date      string            `json:"date"` // as stored in the database
+	Checksum  string            `json:"checksum"`
+	Hash      string            `json:"hash"`
+	Size      int64             `json:"size"`
+	Mode      int64             `json:"mode,omitempty"`     // permission bits of the source file, and os.ModeSymlink for links
+	Modified  int64             `json:"modified,omitempty"` // modification time of the source file in Unix nanoseconds
+	Tags      []string          `json:"tags,omitempty"`
+	Xattrs    map[string][]byte `json:"xattrs,omitempty"` // extended attributes of the source file by name
+	Pinned    bool              `json:"pinned,omitempty"`
+	Signature []byte            `json:"signature,omitempty"`
+}
+
+// ExportTar writes the versions selected by opts to w as a tar archive, so that they can be
+// moved to another machine or archived. The archive starts with a manifest.json listing the
+// versions with their info strings, dates, tags, signatures and the permissions, extended
+// attributes and modification times of their source files, followed by the contents of each
+// version under blobs/ named by their checksums, decompressed and decrypted. Contents shared by
+// several versions are written once. Contents pulled from another filestore are fetched first.
+// The writer is not closed.
+//
+// The archive does not depend on the order in which the versions were added or on the machine,
+// so that exporting the same versions yields byte-identical archives which can be checksummed and
+// compared: versions are listed by date, path, version string, info string, checksum and UUID,
+// blobs follow in the order of their first use with the date of that use as modification time,
+// and no owners or other metadata of the system are recorded.
+func (fs *Filestore) ExportTar(w io.Writer, opts ExportOptions) (err error) {
+	op := newOp("ExportTar", opts.Filter.PathPrefix)
+	defer op.done(&err)
+	if err := fs.ensureOpen(); err != nil {
+		return err
+	}
+	manifest, err := fs.exportManifest(fs.db, opts)
+	if err != nil {
+		return err
+	}
+	data, err := json.MarshalIndent(manifest, "", "  ")
+	if err != nil {
+		return err
+	}
+	tw := tar.NewWriter(w)
+	if err := tw.WriteHeader(&tar.Header{Name: tarManifestName, Mode: 0644, Size: int64(len(data))}); err != nil {
+		return err
+	}
+	if _, err := tw.Write(data); err != nil {
+		return err
+	}
+	written := make(map[string]bool)
+	for _, v := range manifest.Versions {
+		if written[v.Checksum] {
+			continue
+		}
+		written[v.Checksum] = true
+		if err := fs.exportBlob(tw, v); err != nil {
+			return fmt.Errorf("filestore failed to export contents of %s: %w", v.Path, err)
+		}
+	}
+	return tw.Close()
+}
+
+// exportManifest returns the manifest listing the versions selected by opts, queried with q.
+func (fs *Filestore) exportManifest(q querier, opts ExportOptions) (tarManifest, error) {
+	cond, args := opts.Filter.where(fs)
+	if opts.LatestOnly {
+		cond += " and version_id=(select version_id from Versions as V where V.path=VersionsText.path order by date desc, version_id desc limit 1)"
+	}
+	manifest := tarManifest{Format: tarFormat, Versions: make([]manifestVersion, 0)}
+	rows, err := q.Query("select version_id, (select coalesce(uuid, '') from Versions as U where U.version_id=VersionsText.version_id) as version_uuid, (select mode from Versions as U where U.version_id=VersionsText.version_id), (select mtime from Versions as U where U.version_id=VersionsText.version_id), path, info, version, date, checksum, hash, size, exists (select 1 from Pins where Pins.version=version_id), (select signature from Signatures where Signatures.version=version_id) from VersionsText inner join Files on VersionsText.file=Files.file_id where "+
+		cond+" order by date, path, version, info, checksum, version_uuid;", args...)
+	if err != nil {
+		return manifest, fs.dbError(err)
+	}
+	var ids []int64
+	for rows.Next() {
+		var id int64
+		var v manifestVersion
+		if err := rows.Scan(&id, &v.UUID, &v.Mode, &v.Modified, &v.Path, &v.Info, &v.Version, &v.Date, &v.Checksum, &v.Hash, &v.Size, &v.Pinned, &v.Signature); err != nil {
+			rows.Close()
+			return manifest, fs.dbError(err)
+		}
+		ids = append(ids, id)
+		manifest.Versions = append(manifest.Versions, v)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return manifest, fs.dbError(err)
+	}
+	for i, id := range ids {
+		tags, err := fs.tags(q, id)
+		if err != nil {
+			return manifest, err
+		}
+		if len(tags) > 0 {
+			manifest.Versions[i].Tags = tags
+		}
+		attrs, err := fs.xattrs(q, id)
+		if err != nil {
+			return manifest, err
+		}
+		if len(attrs) > 0 {
+			manifest.Versions[i].Xattrs = attrs
+		}
+	}
+	return manifest, nil
+}
+
+// exportBlob writes the contents of the version v of a manifest to tw.
+func (fs *Filestore) exportBlob(tw *tar.Writer, v manifestVersion) error {
+	r, err := fs.openBlob(FileVersion{Name: filepath.Base(v.Path), Checksum: v.Checksum})
+	if err != nil {
+		return err
+	}
+	defer r.Close()
+	date, err := ParseDBDate(v.Date)
+	if err != nil {
+		return ErrInvalidDate
+	}
+	if err := tw.WriteHeader(&tar.Header{Name: tarBlobDir + v.Checksum, Mode: 0644, Size: v.Size, ModTime: date}); err != nil {
+		return err
+	}
+	_, err = io.Copy(tw, r)
+	return err
+}
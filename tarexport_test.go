@@ -0,0 +1,143 @@
+package filestore
+
+import (
+	"archive/tar"
+	"bytes"
+	"encoding/json"
+	"io"
+	"path/filepath"
+	"testing"
+)
+
+// rewriteArchive returns the archive with the data of each entry replaced by the result of
+// rewrite, which is passed the name and data of the entry.
+func rewriteArchive(t *testing.T, archive []byte, rewrite func(name string, data []byte) []byte) []byte {
+	t.Helper()
+	tr := tar.NewReader(bytes.NewReader(archive))
+	var buf bytes.Buffer
+	tw := tar.NewWriter(&buf)
+	for {
+		header, err := tr.Next()
+		if err == io.EOF {
+			break
+		} else if err != nil {
+			t.Fatal(err)
+		}
+		data, err := io.ReadAll(tr)
+		if err != nil {
+			t.Fatal(err)
+		}
+		data = rewrite(header.Name, data)
+		header.Size = int64(len(data))
+		if err := tw.WriteHeader(header); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := tw.Write(data); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := tw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+// reverseManifest returns the archive with the versions of its manifest in reverse order.
+func reverseManifest(t *testing.T, archive []byte) []byte {
+	t.Helper()
+	return rewriteArchive(t, archive, func(name string, data []byte) []byte {
+		if name != tarManifestName {
+			return data
+		}
+		var manifest tarManifest
+		if err := json.Unmarshal(data, &manifest); err != nil {
+			t.Fatal(err)
+		}
+		for i, j := 0, len(manifest.Versions)-1; i < j; i, j = i+1, j-1 {
+			manifest.Versions[i], manifest.Versions[j] = manifest.Versions[j], manifest.Versions[i]
+		}
+		data, err := json.Marshal(manifest)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return data
+	})
+}
+
+func TestExportTarIdentical(t *testing.T) {
+	fs, src := newTestStore(t)
+	path := filepath.Join(src, "a.txt")
+	addFile(t, fs, path, "first", "", "1")
+	addFile(t, fs, path, "second", "", "2")
+	addFile(t, fs, filepath.Join(src, "b.txt"), "third", "", "1")
+	// versions of a path with the same date are ordered by their version strings, not as added
+	if _, err := fs.db.Exec("update Versions set date=(select min(date) from Versions);"); err != nil {
+		t.Fatal(err)
+	}
+	var archive bytes.Buffer
+	if err := fs.ExportTar(&archive, ExportOptions{}); err != nil {
+		t.Fatal(err)
+	}
+	other, _ := newTestStore(t)
+	if err := other.ImportTar(bytes.NewReader(reverseManifest(t, archive.Bytes())), ImportOptions{}); err != nil {
+		t.Fatal(err)
+	}
+	var exported bytes.Buffer
+	if err := other.ExportTar(&exported, ExportOptions{}); err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(exported.Bytes(), archive.Bytes()) {
+		t.Fatal("exports of the same versions added in another order differ")
+	}
+}
+
+// readManifest returns the manifest of the archive and the number of other entries in it.
+func readManifest(t *testing.T, archive []byte) (tarManifest, int) {
+	t.Helper()
+	tr := tar.NewReader(bytes.NewReader(archive))
+	header, err := tr.Next()
+	if err != nil || header.Name != tarManifestName {
+		t.Fatalf("first entry = %v, %v, want the manifest", header, err)
+	}
+	var manifest tarManifest
+	if err := json.NewDecoder(tr).Decode(&manifest); err != nil {
+		t.Fatal(err)
+	}
+	entries := 0
+	for {
+		if _, err := tr.Next(); err == io.EOF {
+			break
+		} else if err != nil {
+			t.Fatal(err)
+		}
+		entries++
+	}
+	return manifest, entries
+}
+
+func TestExportTar(t *testing.T) {
+	fs, src := openTestStore(t, NewFilestore(filepath.Join(t.TempDir(), "store"), Compress))
+	a, b := filepath.Join(src, "a.txt"), filepath.Join(src, "b.txt")
+	addFile(t, fs, a, "aaa", "a", "1")
+	addFile(t, fs, a, "aaaa", "a", "2")
+	v := addFile(t, fs, b, "aaa", "b", "1")
+	if err := fs.Tag(v, "x", "y"); err != nil {
+		t.Fatal(err)
+	}
+	var archive bytes.Buffer
+	if err := fs.ExportTar(&archive, ExportOptions{}); err != nil {
+		t.Fatal(err)
+	}
+	// contents shared by versions are exported once
+	manifest, entries := readManifest(t, archive.Bytes())
+	if len(manifest.Versions) != 3 || len(manifest.Versions[2].Tags) != 2 || entries != 2 {
+		t.Fatalf("exported manifest %+v with %d contents, want 3 versions with 2 contents", manifest, entries)
+	}
+	archive.Reset()
+	if err := fs.ExportTar(&archive, ExportOptions{LatestOnly: true, Filter: Filter{PathPrefix: a}}); err != nil {
+		t.Fatal(err)
+	}
+	if manifest, entries = readManifest(t, archive.Bytes()); len(manifest.Versions) != 1 || manifest.Versions[0].Version != "2" || entries != 1 {
+		t.Fatalf("exported manifest %+v with %d contents, want only the latest version of a", manifest, entries)
+	}
+}
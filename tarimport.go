@@ -0,0 +1,313 @@
+package filestore
+
+import (
+	"archive/tar"
+	"database/sql"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+)
+
+var ErrInvalidArchive = errors.New("filestore archive is invalid")
+var ErrPathExists = errors.New("filestore already contains versions of an imported path")
+
+// CollisionPolicy determines how ImportTar handles imported paths that already have versions.
+type CollisionPolicy int
+
+const (
+	CollisionMerge   CollisionPolicy = iota // imported versions are added to the existing versions, except identical ones
+	CollisionSkip                           // imported versions of existing paths are skipped
+	CollisionReplace                        // existing versions of imported paths are deleted, except pinned versions
+	CollisionFail                           // nothing is imported and ErrPathExists is returned
+)
+
+// ImportOptions are the options of ImportTar.
+type ImportOptions struct {
+	// Prefix is joined with the paths of the imported versions by a slash, so that they can be
+	// kept apart from existing versions. For example, the prefix "/backup" imports versions of
+	// "/home/ann/a.txt" as "/backup/home/ann/a.txt". Signatures are not imported if it is set,
+	// since they cover the path.
+	Prefix     string
+	Collisions CollisionPolicy // how to handle imported paths that already have versions
+}
+
+// ImportTar adds the versions of an archive written by ExportTar to the filestore with their
+// original dates, info strings, tags, pins and signatures, and stores their contents unless
+// there are contents with the same checksum already. Contents are checked against their
+// checksums. Paths that already have versions are handled according to opts.Collisions. The
+// archive is imported within a single transaction, so nothing is imported if it fails.
+func (fs *Filestore) ImportTar(r io.Reader, opts ImportOptions) (err error) {
+	op := newOp("ImportTar", opts.Prefix)
+	defer op.done(&err)
+	tr := tar.NewReader(r)
+	header, err := tr.Next()
+	if err != nil {
+		return fmt.Errorf("filestore could not read archive: %w", err)
+	}
+	if header.Name != tarManifestName {
+		return fmt.Errorf("filestore archive does not start with %s: %w", tarManifestName, ErrInvalidArchive)
+	}
+	var manifest tarManifest
+	if err := json.NewDecoder(tr).Decode(&manifest); err != nil {
+		return fmt.Errorf("filestore could not read manifest: %w", ErrInvalidArchive)
+	}
+	if manifest.Format != tarFormat {
+		return fmt.Errorf("filestore archive has unsupported format %d: %w", manifest.Format, ErrInvalidArchive)
+	}
+	for i, v := range manifest.Versions {
+		if !isHex(v.Checksum) {
+			return fmt.Errorf("filestore archive has invalid checksum %q: %w", v.Checksum, ErrInvalidArchive)
+		}
+		p := v.Path
+		if opts.Prefix != "" {
+			p = path.Join(filepath.ToSlash(opts.Prefix), p)
+		}
+		manifest.Versions[i] = fs.importedPath(v, p)
+	}
+	tx, err := fs.begin()
+	if err != nil {
+		return err
+	}
+	replaced, err := fs.importCollisions(tx, manifest.Versions, opts.Collisions)
+	if err != nil {
+		tx.rollback()
+		return err
+	}
+	// the contents of the versions to import, stored under the name of the first version
+	contents := make(map[string]manifestVersion)
+	for _, v := range manifest.Versions {
+		if _, ok := contents[v.Checksum]; !ok && v.Path != "" {
+			contents[v.Checksum] = v
+		}
+	}
+	tmp, err := os.MkdirTemp(fs.tempDir(), "import-")
+	if err != nil {
+		tx.rollback()
+		return err
+	}
+	defer os.RemoveAll(tmp)
+	for {
+		header, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			tx.rollback()
+			return fmt.Errorf("filestore could not read archive: %w", err)
+		}
+		checksum := strings.TrimPrefix(header.Name, tarBlobDir)
+		v, ok := contents[checksum]
+		if !ok || !strings.HasPrefix(header.Name, tarBlobDir) {
+			// not the contents of an imported version
+			continue
+		}
+		name := filepath.Join(tmp, filepath.Base(filepath.FromSlash(v.Path)))
+		if err := fs.importBlob(tx, tr, name, checksum, v.Hash); err != nil {
+			tx.rollback()
+			return fmt.Errorf("filestore could not import %s: %w", header.Name, err)
+		}
+	}
+	for _, v := range manifest.Versions {
+		if err := fs.importVersion(tx, v); err != nil {
+			tx.rollback()
+			return err
+		}
+	}
+	for _, version := range replaced {
+		if err := tx.deleteVersion(version); err != nil {
+			tx.rollback()
+			return err
+		}
+	}
+	return tx.commit()
+}
+
+// importCollisions handles the imported versions of paths that already have versions according
+// to policy. It clears the paths of skipped versions and returns the versions to delete after the
+// import, which leave out the versions identical to imported ones, since these are not imported
+// again.
+func (fs *Filestore) importCollisions(tx *Tx, versions []manifestVersion, policy CollisionPolicy) ([]FileVersion, error) {
+	if policy == CollisionMerge {
+		return nil, nil
+	}
+	var replaced []FileVersion
+	// the dates and checksums of the imported versions of each path
+	imported := make(map[string]map[string]bool)
+	for _, v := range versions {
+		if date, err := ParseDBDate(v.Date); err == nil {
+			if imported[v.Path] == nil {
+				imported[v.Path] = make(map[string]bool)
+			}
+			imported[v.Path][ToDBDate(date)+" "+v.Checksum] = true
+		}
+	}
+	exists := make(map[string]bool)
+	for _, v := range versions {
+		if _, ok := exists[v.Path]; ok {
+			continue
+		}
+		rows, err := tx.tx.Query(selectVersions+" where Versions.path=? and version_id not in (select version from Pins);", v.Path)
+		if err != nil {
+			return nil, fs.dbError(err)
+		}
+		existing, err := fs.getVersions(rows)
+		if err != nil {
+			return nil, err
+		}
+		var found bool
+		if err := tx.tx.QueryRow("select exists (select 1 from Versions where path=?);", v.Path).Scan(&found); err != nil {
+			return nil, fs.dbError(err)
+		}
+		exists[v.Path] = found
+		if found && policy == CollisionFail {
+			return nil, fmt.Errorf("filestore cannot import %s: %w", v.Path, ErrPathExists)
+		}
+		if policy == CollisionReplace {
+			for _, e := range existing {
+				if !imported[v.Path][ToDBDate(e.From)+" "+e.Checksum] {
+					replaced = append(replaced, e)
+				}
+			}
+		}
+	}
+	if policy == CollisionSkip {
+		for i, v := range versions {
+			if exists[v.Path] {
+				versions[i].Path = ""
+			}
+		}
+	}
+	return replaced, nil
+}
+
+// importBlob stores the contents with the given checksum read from r within tx, using the file
+// at tmp as a temporary copy, unless there are contents with the checksum already.
+func (fs *Filestore) importBlob(tx *Tx, r io.Reader, tmp, checksum, hashName string) error {
+	var fileID int64
+	var pulled bool
+	err := tx.tx.QueryRow("select file_id, origin is not null from Files where checksum=?;", checksum).Scan(&fileID, &pulled)
+	if err != nil && err != sql.ErrNoRows {
+		return fs.dbError(err)
+	}
+	if fileID != 0 && !pulled {
+		return nil
+	}
+	hasher, err := newHash(hashName)
+	if err != nil {
+		return err
+	}
+	f, err := os.Create(tmp)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(io.MultiWriter(f, hasher), r); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+	defer os.Remove(tmp)
+	if hex.EncodeToString(hasher.Sum(nil)) != checksum {
+		return ErrChecksumMismatch
+	}
+	if err := fs.checkQuota(tx.tx, tmp); err != nil {
+		return err
+	}
+	if pulled {
+		created, err := fs.localizeFile(tx.tx, fileID, tmp, checksum, nil)
+		tx.created = append(tx.created, created...)
+		return err
+	}
+	sc, created, err := fs.storeContents(tx.tx, tmp, checksum, nil)
+	tx.created = append(tx.created, created...)
+	if err != nil {
+		return err
+	}
+	_, err = fs.insertFile(tx.tx, checksum, hashName, sc)
+	return err
+}
+
+// importedPath returns the imported version v with the given path, stored as the paths of the
+// filestore are. The signature of v is dropped if the path differs from the original, since it
+// covers the path.
+func (fs *Filestore) importedPath(v manifestVersion, path string) manifestVersion {
+	if path = fs.storedPath(path); path != v.Path {
+		v.Path = path
+		v.Signature = nil
+	}
+	return v
+}
+
+// importVersion adds an imported version within tx unless there is a version of its path with
+// the same date and contents already. Versions skipped by importCollisions are ignored.
+func (fs *Filestore) importVersion(tx *Tx, v manifestVersion) error {
+	if v.Path == "" {
+		return nil
+	}
+	// archives of earlier versions of this package have dates in seconds
+	date, err := ParseDBDate(v.Date)
+	if err != nil {
+		return ErrInvalidDate
+	}
+	v.Date = ToDBDate(date)
+	var fileID int64
+	err = tx.tx.QueryRow("select file_id from Files where checksum=?;", v.Checksum).Scan(&fileID)
+	if err == sql.ErrNoRows {
+		return fmt.Errorf("filestore archive lacks the contents of %s: %w", v.Path, ErrInvalidArchive)
+	}
+	if err != nil {
+		return fs.dbError(err)
+	}
+	var exists bool
+	if err := tx.tx.QueryRow("select exists (select 1 from Versions where path=? and date=? and file=?);",
+		v.Path, v.Date, fileID).Scan(&exists); err != nil {
+		return fs.dbError(err)
+	}
+	if exists {
+		return nil
+	}
+	infoID, err := fs.internInfo(tx.tx, v.Info)
+	if err != nil {
+		return err
+	}
+	uuid, err := fs.importedUUID(tx.tx, v.UUID)
+	if err != nil {
+		return err
+	}
+	result, err := tx.tx.Exec("insert into Versions(path, info_id, version, date, file, uuid, mode, mtime) values(?, ?, ?, ?, ?, ?, ?, ?);",
+		v.Path, infoID, v.Version, v.Date, fileID, uuid, int64(os.FileMode(v.Mode)&attributeModes), v.Modified)
+	if err != nil {
+		return fs.dbError(err)
+	}
+	id, err := result.LastInsertId()
+	if err != nil {
+		return fs.dbError(err)
+	}
+	for _, tag := range v.Tags {
+		if _, err := tx.tx.Exec("insert or ignore into Tags(tag, version) values(?, ?);", tag, id); err != nil {
+			return fs.dbError(err)
+		}
+	}
+	if v.Pinned {
+		if _, err := tx.tx.Exec("insert or ignore into Pins(version) values(?);", id); err != nil {
+			return fs.dbError(err)
+		}
+	}
+	if v.Signature != nil {
+		if _, err := tx.tx.Exec("insert into Signatures(version, signature) values(?, ?);", id, v.Signature); err != nil {
+			return fs.dbError(err)
+		}
+	}
+	if err := fs.insertXattrs(tx.tx, id, v.Xattrs); err != nil {
+		return err
+	}
+	tx.added = append(tx.added, id)
+	return nil
+}
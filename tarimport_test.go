@@ -0,0 +1,118 @@
+package filestore
+
+import (
+	"bytes"
+	"errors"
+	"path/filepath"
+	"testing"
+)
+
+func TestImportTarReplaceRoundTrip(t *testing.T) {
+	fs, src := newTestStore(t)
+	path := filepath.Join(src, "a.txt")
+	addFile(t, fs, path, "first", "", "1")
+	addFile(t, fs, path, "second", "", "2")
+	var archive bytes.Buffer
+	if err := fs.ExportTar(&archive, ExportOptions{}); err != nil {
+		t.Fatal(err)
+	}
+	addFile(t, fs, path, "third", "", "3")
+	if err := fs.ImportTar(bytes.NewReader(archive.Bytes()), ImportOptions{Collisions: CollisionReplace}); err != nil {
+		t.Fatal(err)
+	}
+	versions, err := fs.Versions(path, -1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(versions) != 2 || versions[0].Version != "2" || versions[1].Version != "1" {
+		t.Fatalf("Versions = %v after importing the export, want versions 2 and 1", versions)
+	}
+}
+
+func TestImportTarPrefix(t *testing.T) {
+	fs, src := newTestStore(t)
+	path := filepath.Join(src, "a.txt")
+	addFile(t, fs, path, "contents", "", "1")
+	var archive bytes.Buffer
+	if err := fs.ExportTar(&archive, ExportOptions{}); err != nil {
+		t.Fatal(err)
+	}
+	if err := fs.ImportTar(&archive, ImportOptions{Prefix: "/backup"}); err != nil {
+		t.Fatal(err)
+	}
+	v, err := fs.Get(filepath.Join("/backup", path))
+	if err != nil || v.Version != "1" {
+		t.Fatalf("Get = %v, %v, want the version imported below the prefix", v, err)
+	}
+}
+
+func TestImportTar(t *testing.T) {
+	remote, src := openTestStore(t, NewFilestore(filepath.Join(t.TempDir(), "remote"), Compress))
+	a, b := filepath.Join(src, "a.txt"), filepath.Join(src, "b.txt")
+	addFile(t, remote, a, "aaa", "a", "1")
+	vb := addFile(t, remote, b, "bbb", "b", "1")
+	if err := remote.Tag(vb, "t"); err != nil {
+		t.Fatal(err)
+	}
+	if err := remote.Pin(vb); err != nil {
+		t.Fatal(err)
+	}
+	var buf bytes.Buffer
+	if err := remote.ExportTar(&buf, ExportOptions{}); err != nil {
+		t.Fatal(err)
+	}
+	archive := buf.Bytes()
+	fs, _ := openTestStore(t, NewFilestore(filepath.Join(t.TempDir(), "store"), Chunked))
+	addFile(t, fs, a, "local a", "local", "9")
+	if err := fs.ImportTar(bytes.NewReader(archive), ImportOptions{Collisions: CollisionFail}); !errors.Is(err, ErrPathExists) {
+		t.Fatalf("ImportTar of an existing path = %v, want ErrPathExists", err)
+	}
+	if err := fs.ImportTar(bytes.NewReader(archive), ImportOptions{Collisions: CollisionSkip}); err != nil {
+		t.Fatal(err)
+	}
+	if versions, err := fs.Versions(a, -1); err != nil || len(versions) != 1 || versions[0].Version != "9" {
+		t.Fatalf("Versions = %v, %v, want only the local version", versions, err)
+	}
+	// versions are imported with their dates, tags and pins
+	v, err := fs.Get(b)
+	if err != nil || !v.From.Equal(vb.From) {
+		t.Fatalf("Get = %+v, %v, want the imported version added at %v", v, err, vb.From)
+	}
+	if tags, err := fs.Tags(v); err != nil || len(tags) != 1 || tags[0] != "t" {
+		t.Fatalf("Tags = %v, %v, want [t]", tags, err)
+	}
+	if pinned, err := fs.IsPinned(v); err != nil || !pinned {
+		t.Fatalf("IsPinned = %v, %v, want true", pinned, err)
+	}
+	if err := fs.ImportTar(bytes.NewReader(archive), ImportOptions{Collisions: CollisionReplace}); err != nil {
+		t.Fatal(err)
+	}
+	versions, err := fs.Versions(a, -1)
+	if err != nil || len(versions) != 1 || versions[0].Version != "1" {
+		t.Fatalf("Versions = %v, %v, want only the imported version", versions, err)
+	}
+	var out bytes.Buffer
+	if err := fs.RestoreTo(versions[0], &out); err != nil || out.String() != "aaa" {
+		t.Fatalf("RestoreTo = %q, %v, want the imported contents", out.String(), err)
+	}
+	if report, err := fs.Verify(VerifyOptions{}); err != nil || !report.OK() {
+		t.Fatalf("Verify = %v, %v after importing", report.Problems, err)
+	}
+	// nothing is imported from an archive with corrupted contents
+	bad := rewriteArchive(t, archive, func(name string, data []byte) []byte {
+		if string(data) == "bbb" {
+			return []byte("xbb")
+		}
+		return data
+	})
+	if bytes.Equal(bad, archive) {
+		t.Fatal("archive does not contain the contents of b")
+	}
+	other, _ := newTestStore(t)
+	if err := other.ImportTar(bytes.NewReader(bad), ImportOptions{}); !errors.Is(err, ErrChecksumMismatch) {
+		t.Fatalf("ImportTar of a corrupted archive = %v, want ErrChecksumMismatch", err)
+	}
+	if other.Has(a) {
+		t.Fatal("versions have been imported from a corrupted archive")
+	}
+}
@@ -0,0 +1,104 @@
+package filestore
+
+import (
+	"path/filepath"
+	"sort"
+	"time"
+)
+
+// TimelineKind is the kind of an entry in the timeline of a path.
+type TimelineKind int
+
+const (
+	TimelineAdded    TimelineKind = iota + 1 // a new version was added
+	TimelineDeleted                          // the source file was marked as deleted
+	TimelineRenamed                          // the source file was marked as renamed
+	TimelineRestored                         // a version was restored
+)
+
+// String returns a lowercase name of the timeline kind.
+func (k TimelineKind) String() string {
+	switch k {
+	case TimelineAdded:
+		return "added"
+	case TimelineDeleted:
+		return historyDeleted
+	case TimelineRenamed:
+		return historyRenamed
+	case TimelineRestored:
+		return historyRestored
+	}
+	return "unknown"
+}
+
+// TimelineEntry is an event in the activity history of a path.
+type TimelineEntry struct {
+	Kind    TimelineKind // the kind of event
+	Date    time.Time    // the datetime on which the event took place
+	Path    string       // the path the event concerns (os path)
+	Target  string       // the new path of a rename or the destination file of a restore (os path)
+	Version FileVersion  // the version added or restored, zero for other kinds
+	Reason  string       // the reason given for a restore, if any
+	User    string       // the user who restored a version, if known
+}
+
+// Timeline returns all adds, deletions, renames and restores of the file at path ordered from
+// oldest to newest. Renames are listed both in the timeline of the old and of the new path.
+func (fs *Filestore) Timeline(path string) (_ []TimelineEntry, err error) {
+	op := newOp("Timeline", path)
+	defer op.done(&err)
+	if err := fs.ensureOpen(); err != nil {
+		return nil, err
+	}
+	slashPath := fs.storedPath(path)
+	rows, err := fs.db.Query(selectVersions+" where Versions.path=? order by Versions.date;", slashPath)
+	if err != nil {
+		return nil, fs.dbError(err)
+	}
+	versions, err := fs.getVersions(rows)
+	if err != nil {
+		return nil, err
+	}
+	entries := make([]TimelineEntry, 0, len(versions))
+	byID := make(map[int64]FileVersion)
+	for _, v := range versions {
+		byID[v.ID] = v
+		entries = append(entries, TimelineEntry{Kind: TimelineAdded, Date: v.From, Path: v.Path, Version: v})
+	}
+	hist, err := fs.db.Query("select path, kind, target, version, date, reason, username from History where path=?1 or (kind=?2 and target=?1) order by date, history_id;",
+		slashPath, historyRenamed)
+	if err != nil {
+		return nil, fs.dbError(err)
+	}
+	defer hist.Close()
+	for hist.Next() {
+		var e TimelineEntry
+		var kind, timeStr string
+		var versionID int64
+		if err := hist.Scan(&e.Path, &kind, &e.Target, &versionID, &timeStr, &e.Reason, &e.User); err != nil {
+			return nil, fs.dbError(err)
+		}
+		switch kind {
+		case historyDeleted:
+			e.Kind = TimelineDeleted
+		case historyRenamed:
+			e.Kind = TimelineRenamed
+		case historyRestored:
+			e.Kind = TimelineRestored
+		}
+		e.Path = filepath.FromSlash(e.Path)
+		e.Target = filepath.FromSlash(e.Target)
+		e.Version = byID[versionID]
+		if e.Date, err = ParseDBDate(timeStr); err != nil {
+			return nil, ErrInvalidDate
+		}
+		entries = append(entries, e)
+	}
+	if err := hist.Err(); err != nil {
+		return nil, fs.dbError(err)
+	}
+	sort.SliceStable(entries, func(i, j int) bool {
+		return entries[i].Date.Before(entries[j].Date)
+	})
+	return entries, nil
+}
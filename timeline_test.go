@@ -0,0 +1,69 @@
+package filestore
+
+import (
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestTimeline(t *testing.T) {
+	fs, src := newTestStore(t)
+	path := filepath.Join(src, "a.txt")
+	v := addFile(t, fs, path, "a", "", "1")
+	if err := fs.Restore(v, t.TempDir()); err != nil {
+		t.Fatal(err)
+	}
+	renamed := filepath.Join(src, "b.txt")
+	if err := fs.MarkRenamed(path, renamed); err != nil {
+		t.Fatal(err)
+	}
+	if err := fs.MarkDeleted(path); err != nil {
+		t.Fatal(err)
+	}
+	timeline, err := fs.Timeline(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []TimelineKind{TimelineAdded, TimelineRestored, TimelineRenamed, TimelineDeleted}
+	if len(timeline) != len(want) {
+		t.Fatalf("Timeline = %v, want %d entries", timeline, len(want))
+	}
+	for i, entry := range timeline {
+		if entry.Kind != want[i] {
+			t.Fatalf("entry %d of the timeline is %v, want %v", i, entry.Kind, want[i])
+		}
+	}
+	if timeline[1].Version.ID != v.ID {
+		t.Fatalf("restored version %d, want %d", timeline[1].Version.ID, v.ID)
+	}
+	// the rename shows in the timeline of the new path as well
+	if timeline, err = fs.Timeline(renamed); err != nil || len(timeline) != 1 || timeline[0].Kind != TimelineRenamed {
+		t.Fatalf("Timeline of the new path = %v, %v, want the rename", timeline, err)
+	}
+}
+
+func TestRestoreReason(t *testing.T) {
+	fs, src := newTestStore(t)
+	path := filepath.Join(src, "a.txt")
+	first := addFile(t, fs, path, "one", "", "1")
+	addFile(t, fs, path, "two", "", "2")
+	if err := fs.RestoreWith(first, src, RestoreOptions{Reason: "bad edit", User: "ann", Marker: true}); err != nil {
+		t.Fatal(err)
+	}
+	timeline, err := fs.Timeline(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var restored, marker bool
+	for _, e := range timeline {
+		if e.Kind == TimelineRestored && e.Reason == "bad edit" && e.User == "ann" {
+			restored = true
+		}
+		if e.Kind == TimelineAdded && strings.HasPrefix(e.Version.Version, "restored as of ") && e.Version.Checksum == first.Checksum {
+			marker = true
+		}
+	}
+	if !restored || !marker {
+		t.Fatalf("Timeline = %+v, want the restore with its reason and user and the marker version", timeline)
+	}
+}
@@ -0,0 +1,104 @@
+package filestore
+
+import (
+	"bufio"
+	"bytes"
+	"io"
+	"os"
+)
+
+// binarySniffSize is the number of bytes at the start of contents that are checked for NUL bytes
+// to tell binary from text contents.
+const binarySniffSize = 8000
+
+// RestoreTransformer transforms the contents of a version as it is restored, such as converting
+// line endings for the platform, decrypting contents that were encrypted with a key of the user
+// before they were added, or stripping metadata from documents. It is called with the version
+// and a reader of its stored contents and returns a reader of the contents to be written to the
+// restored file. Contents in the filestore are not changed.
+type RestoreTransformer func(version FileVersion, r io.Reader) (io.Reader, error)
+
+// restoreTransformed restores the contents of version to the file dst, passing them through the
+// transformers in order.
+func (fs *Filestore) restoreTransformed(version FileVersion, dst string, transformers []RestoreTransformer, perm os.FileMode, tracker *progressTracker) error {
+	src, err := fs.openBlob(version)
+	if err != nil {
+		return err
+	}
+	defer src.Close()
+	r := tracker.reader(src)
+	for _, transform := range transformers {
+		if r, err = transform(version, r); err != nil {
+			return err
+		}
+	}
+	f, err := os.Create(dst)
+	if err != nil {
+		return err
+	}
+	if perm != 0 {
+		if err := f.Chmod(perm); err != nil {
+			f.Close()
+			return err
+		}
+	}
+	if _, err := io.Copy(f, r); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+// ConvertLineEndings returns a RestoreTransformer that converts the line endings "\r\n" and "\n"
+// of text contents to newline, for example "\r\n" for Windows. Contents with a NUL byte in their
+// first 8000 bytes are considered binary and restored unchanged.
+func ConvertLineEndings(newline string) RestoreTransformer {
+	return func(version FileVersion, r io.Reader) (io.Reader, error) {
+		br := bufio.NewReaderSize(r, binarySniffSize)
+		start, err := br.Peek(binarySniffSize)
+		if err != nil && err != io.EOF && err != bufio.ErrBufferFull {
+			return nil, err
+		}
+		if bytes.IndexByte(start, 0) >= 0 {
+			return br, nil
+		}
+		return &lineEndingReader{r: br, newline: []byte(newline)}, nil
+	}
+}
+
+// lineEndingReader converts the line endings of the text read from r to newline.
+type lineEndingReader struct {
+	r       *bufio.Reader
+	newline []byte
+	pending []byte // converted text not read yet
+}
+
+// Read reads converted text.
+func (l *lineEndingReader) Read(p []byte) (int, error) {
+	var err error
+	for len(l.pending) < len(p) {
+		var b byte
+		if b, err = l.r.ReadByte(); err != nil {
+			break
+		}
+		switch b {
+		case '\r':
+			if next, _ := l.r.Peek(1); len(next) == 1 && next[0] == '\n' {
+				l.r.ReadByte()
+				l.pending = append(l.pending, l.newline...)
+			} else {
+				l.pending = append(l.pending, b)
+			}
+		case '\n':
+			l.pending = append(l.pending, l.newline...)
+		default:
+			l.pending = append(l.pending, b)
+		}
+	}
+	if len(l.pending) == 0 {
+		return 0, err
+	}
+	n := copy(p, l.pending)
+	l.pending = append(l.pending[:0], l.pending[n:]...)
+	return n, nil
+}
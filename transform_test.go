@@ -0,0 +1,43 @@
+package filestore
+
+import (
+	"bytes"
+	"io"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestRestoreTransformers(t *testing.T) {
+	fs, src := newTestStore(t)
+	v := addFile(t, fs, filepath.Join(src, "a.txt"), "one\ntwo\r\nthree\rfour\n", "", "")
+	fs.RestoreTransformers = []RestoreTransformer{ConvertLineEndings("\r\n")}
+	upper := func(v FileVersion, r io.Reader) (io.Reader, error) {
+		data, err := io.ReadAll(r)
+		return bytes.NewReader(bytes.ToUpper(data)), err
+	}
+	// the transformers of the options are applied after those of the filestore
+	dst := t.TempDir()
+	if err := fs.RestoreWith(v, dst, RestoreOptions{Transformers: []RestoreTransformer{upper}}); err != nil {
+		t.Fatal(err)
+	}
+	if got := readFile(t, filepath.Join(dst, "a.txt")); got != "ONE\r\nTWO\r\nTHREE\rFOUR\r\n" {
+		t.Fatalf("restored %q, want upper case with CRLF line endings", got)
+	}
+	// binary contents are left alone
+	v = addFile(t, fs, filepath.Join(src, "b.bin"), "a\x00b\nc", "", "")
+	if err := fs.Restore(v, dst); err != nil {
+		t.Fatal(err)
+	}
+	if got := readFile(t, filepath.Join(dst, "b.bin")); got != "a\x00b\nc" {
+		t.Fatalf("restored %q, want the binary contents unchanged", got)
+	}
+	text := strings.Repeat("line\n", 10000)
+	r, err := ConvertLineEndings("\r\n")(v, strings.NewReader(text))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, err := io.ReadAll(r); err != nil || string(got) != strings.ReplaceAll(text, "\n", "\r\n") {
+		t.Fatalf("converted %d bytes, %v, want %d bytes", len(got), err, len(text)+10000)
+	}
+}
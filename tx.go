@@ -0,0 +1,274 @@
+package filestore
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+)
+
+var ErrUnknownVersion = errors.New("filestore contains no such version")
+var ErrTxDone = errors.New("filestore transaction has already been committed or rolled back")
+
+// Tx is a transaction that groups changes to the filestore, which are either all applied by Commit
+// or all discarded by Rollback. While a transaction is open, other changes to the filestore wait
+// for it to finish, whether they are made by other goroutines or by other processes adding or
+// deleting contents, so transactions should be short. The goroutine that began a transaction
+// must not change the filestore outside of it before it ends, since that would wait forever.
+type Tx struct {
+	fs      *Filestore
+	tx      *sql.Tx
+	created []string      // blobs and chunks created within the transaction, removed on rollback
+	deleted []string      // blob directories and chunks no longer used, removed on commit
+	added   []int64       // IDs of the versions added, for emitting events on commit
+	removed []FileVersion // versions deleted, for emitting events on commit
+	unlock  func()        // releases the lock of the blobs
+}
+
+// Begin starts a new transaction.
+func (fs *Filestore) Begin() (_ *Tx, err error) {
+	op := newOp("Begin", "")
+	defer op.done(&err)
+	return fs.begin()
+}
+
+func (fs *Filestore) begin() (*Tx, error) {
+	if err := fs.ensureOpen(); err != nil {
+		return nil, err
+	}
+	unlock, err := fs.lockBlobs()
+	if err != nil {
+		return nil, err
+	}
+	return fs.beginLocked(unlock)
+}
+
+// beginLocked starts a new transaction while the lock of the blobs is held, which unlock releases
+// when the transaction ends.
+func (fs *Filestore) beginLocked(unlock func()) (*Tx, error) {
+	tx, err := fs.db.Begin()
+	if err != nil {
+		unlock()
+		return nil, fs.dbError(err)
+	}
+	return &Tx{fs: fs, tx: tx, unlock: unlock}, nil
+}
+
+// addLocked adds a version of the file at path with the given checksum in a transaction of its
+// own while the lock of the blobs is held, which unlock releases, so that the version is added
+// with its summary, attributes, tags and signature or not at all. Copying the file is recorded in
+// tracker, which may be nil.
+func (fs *Filestore) addLocked(unlock func(), path, info, version, check string, tracker *progressTracker) error {
+	tx, err := fs.beginLocked(unlock)
+	if err != nil {
+		return err
+	}
+	id, created, err := fs.addVersion(tx.tx, path, info, version, check, tracker)
+	tx.created = append(tx.created, created...)
+	if err != nil {
+		tx.rollback()
+		return err
+	}
+	tx.added = append(tx.added, id)
+	tracker.finish()
+	return tx.commit()
+}
+
+// Add adds a version of the file at path within the transaction, like Filestore.Add.
+func (tx *Tx) Add(path, info, version string) (err error) {
+	op := newOp("Tx.Add", path)
+	defer op.done(&err)
+	check, err := tx.fs.checksum(path, nil)
+	if err != nil {
+		return fmt.Errorf("filestore checksum failed for %s: %w", path, err)
+	}
+	op.checksum = check
+	return tx.addVersion(path, info, version, check)
+}
+
+func (tx *Tx) addVersion(path, info, version, check string) error {
+	_, err := tx.addVersionID(path, info, version, check)
+	return err
+}
+
+// addVersionID adds a version like addVersion and returns the ID of the new version.
+func (tx *Tx) addVersionID(path, info, version, check string) (int64, error) {
+	if tx.tx == nil {
+		return 0, ErrTxDone
+	}
+	id, created, err := tx.fs.addVersion(tx.tx, path, info, version, check, nil)
+	tx.created = append(tx.created, created...)
+	if err == nil {
+		tx.added = append(tx.added, id)
+	}
+	return id, err
+}
+
+// DeleteVersion deletes the given version within the transaction, like Filestore.DeleteVersion.
+func (tx *Tx) DeleteVersion(version FileVersion) (err error) {
+	op := newOp("Tx.DeleteVersion", version.Path)
+	op.checksum = version.Checksum
+	defer op.done(&err)
+	return tx.deleteVersion(version)
+}
+
+func (tx *Tx) deleteVersion(version FileVersion) error {
+	if tx.tx == nil {
+		return ErrTxDone
+	}
+	if tx.fs.hasHooks() {
+		var err error
+		if version, err = tx.fs.versionByID(tx.tx, version.ID); err != nil {
+			return err
+		}
+	}
+	unused, err := tx.fs.deleteVersion(tx.tx, version)
+	tx.deleted = append(tx.deleted, unused...)
+	if err == nil {
+		tx.removed = append(tx.removed, version)
+	}
+	return err
+}
+
+// Commit applies all changes made within the transaction.
+func (tx *Tx) Commit() (err error) {
+	op := newOp("Tx.Commit", "")
+	defer op.done(&err)
+	return tx.commit()
+}
+
+func (tx *Tx) commit() error {
+	if tx.tx == nil {
+		return ErrTxDone
+	}
+	err := tx.tx.Commit()
+	tx.tx = nil
+	if err != nil {
+		tx.fs.removeFiles(tx.created)
+		tx.unlock()
+		return tx.fs.dbError(err)
+	}
+	tx.fs.removeDeleted(tx.deleted)
+	tx.unlock()
+	for _, id := range tx.added {
+		tx.fs.emitAdded(tx.fs.db, id)
+	}
+	if len(tx.added) > 0 {
+		tx.fs.warnQuota()
+	}
+	for _, version := range tx.removed {
+		tx.fs.emit(Event{Kind: EventVersionDeleted, Version: version, Date: time.Now()})
+	}
+	return nil
+}
+
+// Rollback discards all changes made within the transaction.
+func (tx *Tx) Rollback() (err error) {
+	op := newOp("Tx.Rollback", "")
+	defer op.done(&err)
+	return tx.rollback()
+}
+
+func (tx *Tx) rollback() error {
+	if tx.tx == nil {
+		return ErrTxDone
+	}
+	err := tx.tx.Rollback()
+	tx.tx = nil
+	tx.fs.removeFiles(tx.created)
+	tx.unlock()
+	if err != nil {
+		return tx.fs.dbError(err)
+	}
+	return nil
+}
+
+// DeleteVersion deletes the given version from the filestore. The stored contents of the version
+// are removed as well if no other version refers to them and no lease protects them. ErrUnknownVersion is returned if the
+// version is not in the filestore.
+func (fs *Filestore) DeleteVersion(version FileVersion) (err error) {
+	op := newOp("DeleteVersion", version.Path)
+	op.checksum = version.Checksum
+	defer op.done(&err)
+	tx, err := fs.begin()
+	if err != nil {
+		return err
+	}
+	if err := tx.deleteVersion(version); err != nil {
+		tx.rollback()
+		return err
+	}
+	return tx.commit()
+}
+
+// deleteVersion deletes the version within transaction tx and the file entry of its contents if
+// it is no longer used by a version or lease. In the latter case, the directory of the blob and
+// the chunks no longer used are returned so they can be removed after a successful commit. The
+// lock of the blobs must be held until then, so that no version refers to the contents again in
+// the meantime.
+func (fs *Filestore) deleteVersion(tx *sql.Tx, version FileVersion) ([]string, error) {
+	var fileID, infoID int64
+	var checksum string
+	err := tx.QueryRow("select coalesce(file_id, 0), info_id, coalesce(checksum, '') from Versions left join Files on Versions.file=Files.file_id where version_id=?;", version.ID).Scan(&fileID, &infoID, &checksum)
+	if err == sql.ErrNoRows {
+		return nil, ErrUnknownVersion
+	}
+	if err != nil {
+		return nil, fs.dbError(err)
+	}
+	if _, err := tx.Exec("delete from Versions where version_id=?;", version.ID); err != nil {
+		return nil, fs.dbError(err)
+	}
+	if _, err := tx.Exec("delete from Pins where version=?;", version.ID); err != nil {
+		return nil, fs.dbError(err)
+	}
+	if _, err := tx.Exec("delete from Summaries where summary_of=?;", version.ID); err != nil {
+		return nil, fs.dbError(err)
+	}
+	if _, err := tx.Exec("delete from Tags where version=?;", version.ID); err != nil {
+		return nil, fs.dbError(err)
+	}
+	if _, err := tx.Exec("delete from Signatures where version=?;", version.ID); err != nil {
+		return nil, fs.dbError(err)
+	}
+	if _, err := tx.Exec("delete from Xattrs where version=?;", version.ID); err != nil {
+		return nil, fs.dbError(err)
+	}
+	if _, err := tx.Exec("delete from Infos where info_id=?1 and not exists (select 1 from Versions where info_id=?1);", infoID); err != nil {
+		return nil, fs.dbError(err)
+	}
+	if fileID == 0 {
+		// the version referred to contents missing from the database
+		return nil, nil
+	}
+	var used bool
+	if err := tx.QueryRow("select exists (select 1 from Versions where file=?1) or exists (select 1 from Leases where checksum=?2 and expires > ?3);",
+		fileID, checksum, dbNow()).Scan(&used); err != nil {
+		return nil, fs.dbError(err)
+	}
+	if used {
+		return nil, nil
+	}
+	return fs.deleteFile(tx, fileID, checksum)
+}
+
+// deleteFile deletes the file entry with the given ID and checksum within tx, as well as its
+// chunks no other file uses. The directory of the blob, its stable path and the chunks are
+// returned so they can be removed after a successful commit.
+func (fs *Filestore) deleteFile(tx *sql.Tx, fileID int64, checksum string) ([]string, error) {
+	unused, err := fs.deleteChunks(tx, fileID)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := tx.Exec("delete from Files where file_id=?;", fileID); err != nil {
+		return nil, fs.dbError(err)
+	}
+	return append(unused, fs.Root()+checksum, fs.stablePath(checksum)), nil
+}
+
+// removeFiles removes the given blobs, blob directories and chunks, ignoring errors.
+func (fs *Filestore) removeFiles(paths []string) {
+	for _, path := range paths {
+		fs.removeStored(path)
+	}
+}
@@ -0,0 +1,147 @@
+package filestore
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+)
+
+func TestTx(t *testing.T) {
+	fs, src := newTestStore(t)
+	path := filepath.Join(src, "a.txt")
+	writeFile(t, path, "a")
+	tx, err := fs.Begin()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := tx.Add(path, "", "1"); err != nil {
+		t.Fatal(err)
+	}
+	if err := tx.Rollback(); err != nil {
+		t.Fatal(err)
+	}
+	if fs.Has(path) {
+		t.Fatal("Has = true after rolling back the transaction")
+	}
+	// the contents written by the transaction are removed as well
+	check, err := fs.Checksum(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(fs.Root() + check); !os.IsNotExist(err) {
+		t.Fatalf("the contents written by the transaction remain stored: %v", err)
+	}
+	if tx, err = fs.Begin(); err != nil {
+		t.Fatal(err)
+	}
+	for _, version := range []string{"1", "2"} {
+		if err := tx.Add(path, "", version); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := tx.Commit(); err != nil {
+		t.Fatal(err)
+	}
+	versions, err := fs.Versions(path, -1)
+	if err != nil || len(versions) != 2 {
+		t.Fatalf("Versions = %v, %v, want the 2 committed versions", versions, err)
+	}
+	if tx, err = fs.Begin(); err != nil {
+		t.Fatal(err)
+	}
+	if err := tx.DeleteVersion(versions[0]); err != nil {
+		t.Fatal(err)
+	}
+	if err := tx.Commit(); err != nil {
+		t.Fatal(err)
+	}
+	if err := fs.DeleteVersion(versions[0]); !errors.Is(err, ErrUnknownVersion) {
+		t.Fatalf("DeleteVersion of a deleted version = %v, want ErrUnknownVersion", err)
+	}
+	if v, err := fs.Get(path); err != nil || v.ID != versions[1].ID {
+		t.Fatalf("Get = %v, %v, want the remaining version", v, err)
+	}
+}
+
+func TestTxConcurrent(t *testing.T) {
+	fs, src := newTestStore(t)
+	a, b := filepath.Join(src, "a.txt"), filepath.Join(src, "b.txt")
+	writeFile(t, a, "shared")
+	writeFile(t, b, "shared")
+	// transactions of different goroutines wait for each other
+	inTx := func(f func(tx *Tx) error) error {
+		tx, err := fs.Begin()
+		if err != nil {
+			return err
+		}
+		if err := f(tx); err != nil {
+			tx.Rollback()
+			return err
+		}
+		return tx.Commit()
+	}
+	var wg sync.WaitGroup
+	errs := make(chan error, 2)
+	wg.Add(2)
+	go func() {
+		defer wg.Done()
+		for i := 0; i < 100; i++ {
+			if err := inTx(func(tx *Tx) error { return tx.Add(a, "", "") }); err != nil {
+				errs <- err
+				return
+			}
+			v, err := fs.Get(a)
+			if err != nil {
+				errs <- err
+				return
+			}
+			if err := inTx(func(tx *Tx) error { return tx.DeleteVersion(v) }); err != nil {
+				errs <- err
+				return
+			}
+		}
+	}()
+	go func() {
+		defer wg.Done()
+		for i := 0; i < 100; i++ {
+			if err := inTx(func(tx *Tx) error { return tx.Add(b, "", "") }); err != nil {
+				errs <- err
+				return
+			}
+		}
+	}()
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		t.Fatal(err)
+	}
+	if report, err := fs.Verify(VerifyOptions{}); err != nil || !report.OK() {
+		t.Fatalf("Verify = %v, %v, want the contents of all versions", report.Problems, err)
+	}
+}
+
+func TestAddAtomic(t *testing.T) {
+	fs, src := newTestStore(t)
+	fs.TagRules = []TagRule{{Tags: []string{"any"}}}
+	// tagging fails after the version itself has been inserted
+	if _, err := fs.db.Exec("create temp trigger failTags before insert on Tags begin select raise(abort, 'no tags'); end;"); err != nil {
+		t.Fatal(err)
+	}
+	path := filepath.Join(src, "a.txt")
+	writeFile(t, path, "contents")
+	if err := fs.Add(path, "", ""); err == nil {
+		t.Fatal("Add succeeded although tagging failed")
+	}
+	if versions, err := fs.Versions(path, -1); err != nil || len(versions) != 0 {
+		t.Fatalf("Versions = %v, %v, want none after a failed Add", versions, err)
+	}
+	check, err := fs.checksum(path, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(fs.Root() + check); !errors.Is(err, os.ErrNotExist) {
+		t.Fatalf("Stat of the blob of a failed Add = %v, want os.ErrNotExist", err)
+	}
+}
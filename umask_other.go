@@ -0,0 +1,10 @@
+//go:build !(linux || darwin || freebsd || openbsd || netbsd || dragonfly)
+
+package filestore
+
+import "os"
+
+// processUmask returns zero, since processes have no umask on this platform.
+func processUmask() os.FileMode {
+	return 0
+}
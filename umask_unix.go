@@ -0,0 +1,39 @@
+//go:build linux || darwin || freebsd || openbsd || netbsd || dragonfly
+
+package filestore
+
+import (
+	"bufio"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"syscall"
+)
+
+var umaskOnce sync.Once
+var umask os.FileMode
+
+// processUmask returns the umask of the process, which is determined once. Where the kernel
+// reports it in /proc, it is read from there, since otherwise it has to be set to read it, which
+// briefly affects files created concurrently.
+func processUmask() os.FileMode {
+	umaskOnce.Do(func() {
+		if f, err := os.Open("/proc/self/status"); err == nil {
+			defer f.Close()
+			scanner := bufio.NewScanner(f)
+			for scanner.Scan() {
+				if value := strings.TrimPrefix(scanner.Text(), "Umask:"); value != scanner.Text() {
+					if mask, err := strconv.ParseUint(strings.TrimSpace(value), 8, 32); err == nil {
+						umask = os.FileMode(mask)
+						return
+					}
+				}
+			}
+		}
+		mask := syscall.Umask(0)
+		syscall.Umask(mask)
+		umask = os.FileMode(mask)
+	})
+	return umask
+}
@@ -0,0 +1,40 @@
+//go:build linux || darwin || freebsd || openbsd || netbsd || dragonfly
+
+package filestore
+
+import (
+	"os"
+	"path/filepath"
+	"syscall"
+	"testing"
+)
+
+func TestUmask(t *testing.T) {
+	mask := syscall.Umask(0)
+	syscall.Umask(mask)
+	if got := processUmask(); got != os.FileMode(mask) {
+		t.Fatalf("processUmask = %o, want %o", got, mask)
+	}
+	fs := NewFilestore(filepath.Join(t.TempDir(), "store"), Umask)
+	fs.DirMode = 0777
+	fs.FileMode = 0666
+	fs, src := openTestStore(t, fs)
+	if fs.dirMode() != 0777&^processUmask() || fs.fileMode() != 0666&^processUmask() {
+		t.Fatalf("modes %v and %v, want the umask applied to %v and %v", fs.dirMode(), fs.fileMode(), os.FileMode(0777), os.FileMode(0666))
+	}
+	info, err := os.Stat(fs.Root())
+	if err != nil || info.Mode().Perm() != 0777&^processUmask() {
+		t.Fatalf("Stat of the root = %v, %v, want permissions %v", info.Mode(), err, 0777&^processUmask())
+	}
+	addFile(t, fs, filepath.Join(src, "a.txt"), "abc", "", "")
+	shared := NewFilestore(filepath.Join(t.TempDir(), "shared"), Shared|Umask)
+	if shared.dirMode() != (0750|os.ModeSetgid)&^processUmask() || shared.fileMode() != 0640&^processUmask() {
+		t.Fatalf("shared modes %v and %v, want the umask applied", shared.dirMode(), shared.fileMode())
+	}
+	// without the option, the modes are used as they are
+	plain := NewFilestore(filepath.Join(t.TempDir(), "plain"), 0)
+	plain.DirMode = 0777
+	if plain.dirMode() != 0777 || plain.fileMode() != 0 {
+		t.Fatalf("modes %v and %v, want %v and default permissions", plain.dirMode(), plain.fileMode(), os.FileMode(0777))
+	}
+}
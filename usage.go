@@ -0,0 +1,51 @@
+package filestore
+
+import "path/filepath"
+
+// PathUsage is the storage used by the versions of a path.
+type PathUsage struct {
+	Path     string // the path of the file (os path)
+	Versions int64  // the number of versions of the path
+	Bytes    int64  // the total size of the contents of all versions of the path
+	// StoredBytes is the number of bytes taken on disk by the distinct contents of the versions
+	// of the path, which are shared with other paths if they have the same contents. Contents in
+	// chunks only count the chunks they added to the filestore.
+	StoredBytes int64
+	// ExclusiveBytes is the part of StoredBytes taken by contents no other path uses, which is
+	// freed by deleting all versions of the path.
+	ExclusiveBytes int64
+}
+
+// Usage returns the storage used by each path starting with pathPrefix, all paths if it is
+// empty, ordered from the largest StoredBytes to the smallest, to find the files worth pruning.
+func (fs *Filestore) Usage(pathPrefix string) (_ []PathUsage, err error) {
+	op := newOp("Usage", pathPrefix)
+	defer op.done(&err)
+	if err := fs.ensureOpen(); err != nil {
+		return nil, err
+	}
+	rows, err := fs.db.Query(`select path, count(*), coalesce(sum(size), 0),
+		(select coalesce(sum(stored), 0) from Files where file_id in (select file from Versions as V where V.path=Versions.path)),
+		(select coalesce(sum(stored), 0) from Files where file_id in (select file from Versions as V where V.path=Versions.path)
+			and not exists (select 1 from Versions as W where W.file=Files.file_id and W.path!=Versions.path)) as stored
+		from Versions inner join Files on Versions.file=Files.file_id
+		where substr(path, 1, length(?1))=?1 group by path order by 4 desc, path;`,
+		fs.storedPath(pathPrefix))
+	if err != nil {
+		return nil, fs.dbError(err)
+	}
+	defer rows.Close()
+	usage := make([]PathUsage, 0)
+	for rows.Next() {
+		var u PathUsage
+		if err := rows.Scan(&u.Path, &u.Versions, &u.Bytes, &u.StoredBytes, &u.ExclusiveBytes); err != nil {
+			return nil, fs.dbError(err)
+		}
+		u.Path = filepath.FromSlash(u.Path)
+		usage = append(usage, u)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fs.dbError(err)
+	}
+	return usage, nil
+}
@@ -0,0 +1,28 @@
+package filestore
+
+import (
+	"path/filepath"
+	"testing"
+)
+
+func TestUsage(t *testing.T) {
+	fs, src := newTestStore(t)
+	a, b := filepath.Join(src, "a.txt"), filepath.Join(src, "sub", "b.txt")
+	addFile(t, fs, a, "aaaa", "a", "1")
+	addFile(t, fs, a, "aaaaaaaa", "a", "2")
+	addFile(t, fs, b, "aaaa", "b", "1")
+	usage, err := fs.Usage("")
+	if err != nil || len(usage) != 2 {
+		t.Fatalf("Usage = %+v, %v, want 2 paths", usage, err)
+	}
+	// paths are ordered by their stored bytes, shared contents are not exclusive
+	if u := usage[0]; u.Path != a || u.Versions != 2 || u.Bytes != 12 || u.StoredBytes != 12 || u.ExclusiveBytes != 8 {
+		t.Fatalf("usage of a = %+v, want 12 bytes of which 8 are exclusive", u)
+	}
+	if u := usage[1]; u.Path != b || u.StoredBytes != 4 || u.ExclusiveBytes != 0 {
+		t.Fatalf("usage of b = %+v, want 4 shared bytes", u)
+	}
+	if usage, err = fs.Usage(filepath.Join(src, "sub")); err != nil || len(usage) != 1 || usage[0].Path != b {
+		t.Fatalf("Usage of a directory = %+v, %v, want only b", usage, err)
+	}
+}
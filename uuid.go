@@ -0,0 +1,68 @@
+package filestore
+
+import (
+	"crypto/rand"
+	"errors"
+	"fmt"
+)
+
+var ErrInvalidUUID = errors.New("filestore UUID generator returned an empty UUID")
+
+// newUUID returns the UUID of a new version, generated by NewUUID if it is set and otherwise a
+// random (version 4) UUID.
+func (fs *Filestore) newUUID() (string, error) {
+	if fs.NewUUID != nil {
+		uuid := fs.NewUUID()
+		if uuid == "" {
+			return "", ErrInvalidUUID
+		}
+		return uuid, nil
+	}
+	var b [16]byte
+	if _, err := rand.Read(b[:]); err != nil {
+		return "", err
+	}
+	b[6] = b[6]&0x0f | 0x40 // version 4
+	b[8] = b[8]&0x3f | 0x80 // RFC 4122 variant
+	return fmt.Sprintf("%x-%x-%x-%x-%x", b[0:4], b[4:6], b[6:8], b[8:10], b[10:]), nil
+}
+
+// GetByUUID returns the version with the given UUID, which unlike its ID is the same in all
+// filestores the version has been exported, synced or pulled to. ErrUnknownVersion is returned
+// if there is no such version.
+func (fs *Filestore) GetByUUID(uuid string) (_ FileVersion, err error) {
+	op := newOp("GetByUUID", "")
+	defer op.done(&err)
+	if err := fs.ensureOpen(); err != nil {
+		return FileVersion{}, err
+	}
+	rows, err := fs.db.Query(selectVersions+" where uuid=?;", uuid)
+	if err != nil {
+		return FileVersion{}, fs.dbError(err)
+	}
+	versions, err := fs.getVersions(rows)
+	if err != nil {
+		return FileVersion{}, err
+	}
+	if len(versions) == 0 {
+		return FileVersion{}, ErrUnknownVersion
+	}
+	return versions[0], nil
+}
+
+// importedUUID returns the UUID of a version copied from another filestore within q, which is
+// uuid unless it is empty or used by another version already, in which case a new UUID is
+// returned.
+func (fs *Filestore) importedUUID(q querier, uuid string) (string, error) {
+	if uuid == "" {
+		return fs.newUUID()
+	}
+	var used bool
+	if err := q.QueryRow("select exists (select 1 from Versions where uuid=?);", uuid).Scan(&used); err != nil {
+		return "", fs.dbError(err)
+	}
+	if used {
+		return fs.newUUID()
+	}
+	return uuid, nil
+}
@@ -0,0 +1,60 @@
+package filestore
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"path/filepath"
+	"regexp"
+	"testing"
+)
+
+func TestUUIDs(t *testing.T) {
+	fs, src := newTestStore(t)
+	path := filepath.Join(src, "f.txt")
+	v := addFile(t, fs, path, "one", "f", "1")
+	if !regexp.MustCompile(`^[0-9a-f]{8}-[0-9a-f]{4}-4[0-9a-f]{3}-[89ab][0-9a-f]{3}-[0-9a-f]{12}$`).MatchString(v.UUID) {
+		t.Fatalf("UUID = %q, want a random UUID", v.UUID)
+	}
+	if got, err := fs.GetByUUID(v.UUID); err != nil || got.ID != v.ID {
+		t.Fatalf("GetByUUID = %+v, %v, want %+v", got, err, v)
+	}
+	if _, err := fs.GetByUUID("unknown"); !errors.Is(err, ErrUnknownVersion) {
+		t.Fatalf("GetByUUID of an unknown UUID = %v, want ErrUnknownVersion", err)
+	}
+	// UUIDs are kept by SyncTo, and new ones come from NewUUID
+	other := NewFilestore(filepath.Join(t.TempDir(), "other"), 0)
+	n := 0
+	other.NewUUID = func() string { n++; return fmt.Sprintf("custom-%d", n) }
+	openTestStore(t, other)
+	if _, err := fs.SyncTo(other, SyncOptions{}); err != nil {
+		t.Fatal(err)
+	}
+	if got, err := other.GetByUUID(v.UUID); err != nil || got.Path != path {
+		t.Fatalf("GetByUUID = %+v, %v after SyncTo, want the synced version", got, err)
+	}
+	addFile(t, other, path, "two", "f", "2")
+	if got, err := other.GetByUUID("custom-1"); err != nil || got.Version != "2" {
+		t.Fatalf("GetByUUID = %+v, %v, want the version with the custom UUID", got, err)
+	}
+	// and by PullMetadata
+	puller, _ := openTestStore(t, NewFilestore(filepath.Join(t.TempDir(), "puller"), 0))
+	if _, err := puller.PullMetadata(other); err != nil {
+		t.Fatal(err)
+	}
+	if got, err := puller.GetByUUID("custom-1"); err != nil || got.Version != "2" {
+		t.Fatalf("GetByUUID = %+v, %v after PullMetadata, want the pulled version", got, err)
+	}
+	// copies imported with a prefix get new UUIDs
+	var buf bytes.Buffer
+	if err := fs.ExportTar(&buf, ExportOptions{}); err != nil {
+		t.Fatal(err)
+	}
+	if err := fs.ImportTar(bytes.NewReader(buf.Bytes()), ImportOptions{Prefix: "copy/"}); err != nil {
+		t.Fatal(err)
+	}
+	c, err := fs.Get(filepath.Join("copy", path))
+	if err != nil || c.UUID == "" || c.UUID == v.UUID {
+		t.Fatalf("Get of the copy = %+v, %v, want a new UUID", c, err)
+	}
+}
@@ -0,0 +1,453 @@
+package filestore
+
+import (
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"sync"
+	"time"
+
+	"golang.org/x/crypto/blake2b"
+)
+
+var ErrChecksumMismatch = errors.New("filestore contents do not match their checksum")
+
+// VerifyOptions are the options of Verify.
+type VerifyOptions struct {
+	Quick   bool // only check that blobs and chunks exist instead of reading and hashing them
+	Workers int  // the number of contents checked in parallel, the number of CPUs if zero
+	// BytesPerSecond limits the rate at which all workers together read contents, so that
+	// verifying does not starve other users of the disk. There is no limit if it is zero.
+	BytesPerSecond int64
+}
+
+// ProblemKind is the kind of a problem found by Verify.
+type ProblemKind int
+
+const (
+	ProblemCorrupt  ProblemKind = iota + 1 // contents do not match their checksum or cannot be read
+	ProblemMissing                         // the blob or a chunk of contents does not exist
+	ProblemDangling                        // a version refers to contents that are not in the database
+	ProblemOrphan                          // a blob, chunk or file entry is not used by any version or lease
+)
+
+// String returns a lowercase name of the problem kind.
+func (k ProblemKind) String() string {
+	switch k {
+	case ProblemCorrupt:
+		return "corrupt"
+	case ProblemMissing:
+		return "missing"
+	case ProblemDangling:
+		return "dangling"
+	case ProblemOrphan:
+		return "orphan"
+	}
+	return "unknown"
+}
+
+// VerifyProblem is an inconsistency found by Verify.
+type VerifyProblem struct {
+	Kind     ProblemKind
+	Checksum string // the checksum of the contents or chunk concerned, empty if unknown
+	Path     string // the blob or chunk file concerned, empty for problems of the database
+	Version  int64  // the ID of the version concerned by a dangling reference, otherwise 0
+	Err      error  // the error that revealed the problem, may be nil
+}
+
+// VerifyReport is the result of Verify.
+type VerifyReport struct {
+	Contents int             // the number of contents checked
+	Bytes    int64           // the number of bytes of contents read and hashed
+	Problems []VerifyProblem // the problems found
+}
+
+// OK returns true if no problems were found.
+func (r VerifyReport) OK() bool {
+	return len(r.Problems) == 0
+}
+
+// verifyItem describes the contents checked by Verify.
+type verifyItem struct {
+	checksum string
+	hash     string // the name of the hash algorithm of the checksum
+	codec    string
+	sealed   []byte
+	size     int64
+	chunked  bool
+}
+
+// Verify checks the consistency of the filestore. Unless opts.Quick is set, every blob and chunk
+// is read and hashed again and compared against its recorded checksum. Verify also reports
+// versions referring to contents that are not in the database, as well as blobs, chunks and file
+// entries that no version or lease uses. Contents that are encrypted can only be checked for
+// existence if the filestore has no Key. Contents are checked by opts.Workers goroutines in
+// parallel. An error is only returned if the check itself fails.
+func (fs *Filestore) Verify(opts VerifyOptions) (_ VerifyReport, err error) {
+	op := newOp("Verify", fs.Dir)
+	defer op.done(&err)
+	if err := fs.ensureOpen(); err != nil {
+		return VerifyReport{}, err
+	}
+	return fs.verify(opts)
+}
+
+func (fs *Filestore) verify(opts VerifyOptions) (VerifyReport, error) {
+	report := VerifyReport{Problems: make([]VerifyProblem, 0)}
+	items, err := fs.verifyItems()
+	if err != nil {
+		return VerifyReport{}, err
+	}
+	checksums := make(map[string]bool, len(items))
+	for _, item := range items {
+		checksums[item.checksum] = true
+	}
+	for _, result := range fs.verifyAll(items, opts) {
+		report.Contents++
+		report.Bytes += result.n
+		report.Problems = append(report.Problems, result.problems...)
+	}
+	problems, err := fs.verifyReferences()
+	if err != nil {
+		return VerifyReport{}, err
+	}
+	report.Problems = append(report.Problems, problems...)
+	problems, err = fs.verifyOrphans(checksums)
+	if err != nil {
+		return VerifyReport{}, err
+	}
+	report.Problems = append(report.Problems, problems...)
+	return report, nil
+}
+
+// verifyItems returns the contents recorded in the database, except those pulled from another
+// filestore that have not been fetched yet.
+func (fs *Filestore) verifyItems() ([]verifyItem, error) {
+	rows, err := fs.db.Query("select checksum, hash, codec, sealed_key, size, chunked from Files where origin is null order by file_id;")
+	if err != nil {
+		return nil, fs.dbError(err)
+	}
+	defer rows.Close()
+	var items []verifyItem
+	for rows.Next() {
+		var item verifyItem
+		if err := rows.Scan(&item.checksum, &item.hash, &item.codec, &item.sealed, &item.size, &item.chunked); err != nil {
+			return nil, fs.dbError(err)
+		}
+		items = append(items, item)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fs.dbError(err)
+	}
+	return items, nil
+}
+
+// verifyResult is the result of checking contents with verifyContents.
+type verifyResult struct {
+	n        int64
+	problems []VerifyProblem
+}
+
+// verifyAll checks the given contents with opts.Workers workers sharing the IO budget of opts
+// and returns the results in the order of items.
+func (fs *Filestore) verifyAll(items []verifyItem, opts VerifyOptions) []verifyResult {
+	workers := opts.Workers
+	if workers <= 0 {
+		workers = runtime.NumCPU()
+	}
+	limiter := newIOLimiter(opts.BytesPerSecond)
+	results := make([]verifyResult, len(items))
+	next := make(chan int)
+	var wg sync.WaitGroup
+	for w := 0; w < workers; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range next {
+				results[i].n, results[i].problems = fs.verifyContents(items[i], opts.Quick, limiter)
+			}
+		}()
+	}
+	for i := range items {
+		next <- i
+	}
+	close(next)
+	wg.Wait()
+	return results
+}
+
+// verifyContents checks that the blob or chunks of the contents exist and, unless quick is set,
+// that they match their checksums, reading them at the rate allowed by limiter. It returns the
+// number of bytes hashed and the problems found.
+func (fs *Filestore) verifyContents(item verifyItem, quick bool, limiter *ioLimiter) (int64, []VerifyProblem) {
+	corrupt := func(path string, err error) (int64, []VerifyProblem) {
+		return 0, []VerifyProblem{{Kind: ProblemCorrupt, Checksum: item.checksum, Path: path, Err: err}}
+	}
+	quick = quick || item.sealed != nil && fs.Key == nil
+	hasher, err := newHash(item.hash)
+	if err != nil {
+		return corrupt("", err)
+	}
+	if item.chunked {
+		quick = quick || fs.Key == nil && fs.hasSealedChunks(item.checksum)
+		chunks, err := fs.chunkRefs(fs.db, item.checksum, !quick)
+		if err != nil {
+			return corrupt("", err)
+		}
+		var problems []VerifyProblem
+		var n int64
+		for _, ref := range chunks {
+			path := fs.chunkPath(ref.checksum, ref.codec)
+			if quick {
+				if exists, err := fs.storedExists(path); err != nil || !exists {
+					problems = append(problems, VerifyProblem{Kind: ProblemMissing, Checksum: ref.checksum, Path: path, Err: err})
+				}
+				continue
+			}
+			data, err := fs.readChunkFile(path, ref)
+			if errors.Is(err, os.ErrNotExist) {
+				problems = append(problems, VerifyProblem{Kind: ProblemMissing, Checksum: ref.checksum, Path: path, Err: err})
+				continue
+			}
+			if err != nil {
+				problems = append(problems, VerifyProblem{Kind: ProblemCorrupt, Checksum: ref.checksum, Path: path, Err: err})
+				continue
+			}
+			limiter.wait(len(data))
+			hasher.Write(data)
+			n += int64(len(data))
+		}
+		if quick || len(problems) > 0 {
+			return n, problems
+		}
+		if err := checkSum(hasher.Sum(nil), item.checksum, n, item.size); err != nil {
+			return corrupt("", err)
+		}
+		return n, nil
+	}
+	c, err := newCodec(item.codec)
+	if err != nil {
+		return corrupt("", err)
+	}
+	if !quick {
+		if c, err = fs.unsealCodec(c, item.sealed); err != nil {
+			return corrupt("", err)
+		}
+	}
+	path := fs.blobFile("", item.checksum, c)
+	if exists, err := fs.storedExists(path); err != nil || !exists {
+		// the path of a blob is its directory if the directory is empty
+		return 0, []VerifyProblem{{Kind: ProblemMissing, Checksum: item.checksum, Path: path, Err: err}}
+	}
+	if quick {
+		return 0, nil
+	}
+	r, err := fs.openBlobFile("", item.checksum, c)
+	if err != nil {
+		return corrupt(path, err)
+	}
+	defer r.Close()
+	n, err := io.Copy(hasher, limiter.reader(r))
+	if err != nil {
+		return corrupt(path, err)
+	}
+	if err := checkSum(hasher.Sum(nil), item.checksum, n, item.size); err != nil {
+		return corrupt(path, err)
+	}
+	return n, nil
+}
+
+// ioLimiter limits the rate at which bytes are read by several goroutines together.
+type ioLimiter struct {
+	rate  int64 // bytes per second
+	mutex sync.Mutex
+	next  time.Time // the time at which the bytes read so far are within the rate
+}
+
+// newIOLimiter returns a limiter allowing rate bytes per second, or nil if rate is not positive,
+// which does not limit the rate.
+func newIOLimiter(rate int64) *ioLimiter {
+	if rate <= 0 {
+		return nil
+	}
+	return &ioLimiter{rate: rate}
+}
+
+// wait records that n bytes have been read and waits until reading them is within the rate.
+func (l *ioLimiter) wait(n int) {
+	if l == nil || n <= 0 {
+		return
+	}
+	l.mutex.Lock()
+	now := time.Now()
+	if l.next.Before(now) {
+		l.next = now
+	}
+	l.next = l.next.Add(time.Duration(float64(n) / float64(l.rate) * float64(time.Second)))
+	delay := l.next.Sub(now)
+	l.mutex.Unlock()
+	time.Sleep(delay)
+}
+
+// reader returns a reader of r that reads at the rate allowed by the limiter.
+func (l *ioLimiter) reader(r io.Reader) io.Reader {
+	if l == nil {
+		return r
+	}
+	return &limitedReader{r: r, limiter: l}
+}
+
+// limitedReader is a reader whose rate is limited by an ioLimiter.
+type limitedReader struct {
+	r       io.Reader
+	limiter *ioLimiter
+}
+
+// Read reads from the underlying reader and waits until the bytes read are within the rate.
+func (r *limitedReader) Read(p []byte) (int, error) {
+	n, err := r.r.Read(p)
+	r.limiter.wait(n)
+	return n, err
+}
+
+// checkSum returns ErrChecksumMismatch unless sum is the checksum and size the recorded size.
+func checkSum(sum []byte, checksum string, size, recorded int64) error {
+	if hex.EncodeToString(sum) != checksum {
+		return ErrChecksumMismatch
+	}
+	if size != recorded {
+		return fmt.Errorf("filestore contents have %d bytes instead of %d: %w", size, recorded, ErrChecksumMismatch)
+	}
+	return nil
+}
+
+// hasSealedChunks returns true if any chunk of the contents with the given checksum is encrypted.
+func (fs *Filestore) hasSealedChunks(checksum string) bool {
+	var sealed bool
+	fs.db.QueryRow("select exists (select 1 from FileChunks inner join Chunks on FileChunks.chunk=Chunks.chunk_id inner join Files on FileChunks.file=Files.file_id where Files.checksum=? and Chunks.sealed_key is not null);",
+		checksum).Scan(&sealed)
+	return sealed
+}
+
+// readChunkFile reads and checks the data of a chunk from its file at path, bypassing the
+// segment cache.
+func (fs *Filestore) readChunkFile(path string, ref chunkRef) ([]byte, error) {
+	f, err := fs.openStored(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	r, err := ref.codec.reader(f)
+	if err != nil {
+		return nil, err
+	}
+	defer r.Close()
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+	sum := blake2b.Sum256(data)
+	if int64(len(data)) != ref.size || hex.EncodeToString(sum[:]) != ref.checksum {
+		return nil, ErrChecksumMismatch
+	}
+	return data, nil
+}
+
+// verifyReferences returns the versions referring to contents that are not in the database.
+func (fs *Filestore) verifyReferences() ([]VerifyProblem, error) {
+	rows, err := fs.db.Query("select version_id from Versions where not exists (select 1 from Files where file_id=Versions.file) order by version_id;")
+	if err != nil {
+		return nil, fs.dbError(err)
+	}
+	defer rows.Close()
+	var problems []VerifyProblem
+	for rows.Next() {
+		var id int64
+		if err := rows.Scan(&id); err != nil {
+			return nil, fs.dbError(err)
+		}
+		problems = append(problems, VerifyProblem{Kind: ProblemDangling, Version: id})
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fs.dbError(err)
+	}
+	return problems, nil
+}
+
+// verifyOrphans returns the file entries, blob directories and chunk files that are not used.
+// The checksums of all file entries are given.
+func (fs *Filestore) verifyOrphans(checksums map[string]bool) ([]VerifyProblem, error) {
+	var problems []VerifyProblem
+	rows, err := fs.db.Query("select checksum from Files where not exists (select 1 from Versions where file=file_id) and not exists (select 1 from Leases where Leases.checksum=Files.checksum and expires > ?) order by file_id;", dbNow())
+	if err != nil {
+		return nil, fs.dbError(err)
+	}
+	for rows.Next() {
+		var checksum string
+		if err := rows.Scan(&checksum); err != nil {
+			rows.Close()
+			return nil, fs.dbError(err)
+		}
+		problems = append(problems, VerifyProblem{Kind: ProblemOrphan, Checksum: checksum})
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, fs.dbError(err)
+	}
+	names, err := fs.listStored(fs.Root())
+	if err != nil {
+		return nil, err
+	}
+	for _, name := range names {
+		if isHex(name) && !checksums[name] {
+			problems = append(problems, VerifyProblem{Kind: ProblemOrphan, Checksum: name, Path: fs.Root() + name})
+		}
+	}
+	chunks := make(map[string]bool)
+	chunkRows, err := fs.db.Query("select checksum from Chunks;")
+	if err != nil {
+		return nil, fs.dbError(err)
+	}
+	for chunkRows.Next() {
+		var checksum string
+		if err := chunkRows.Scan(&checksum); err != nil {
+			chunkRows.Close()
+			return nil, fs.dbError(err)
+		}
+		chunks[checksum] = true
+	}
+	chunkRows.Close()
+	if err := chunkRows.Err(); err != nil {
+		return nil, fs.dbError(err)
+	}
+	dirs, _ := fs.listStored(fs.Root() + "chunks")
+	for _, dir := range dirs {
+		files, _ := fs.listStored(filepath.Join(fs.Root()+"chunks", dir))
+		for _, file := range files {
+			checksum := strings.SplitN(file, ".", 2)[0]
+			if !chunks[checksum] {
+				problems = append(problems, VerifyProblem{Kind: ProblemOrphan, Checksum: checksum,
+					Path: filepath.Join(fs.Root()+"chunks", dir, file)})
+			}
+		}
+	}
+	return problems, nil
+}
+
+// isHex returns true if s is a non-empty string of lowercase hexadecimal digits.
+func isHex(s string) bool {
+	if s == "" {
+		return false
+	}
+	for _, r := range s {
+		if !(r >= '0' && r <= '9' || r >= 'a' && r <= 'f') {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,100 @@
+package filestore
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/rasteric/flags"
+)
+
+// problemKinds returns the number of problems of each kind in the report.
+func problemKinds(report VerifyReport) map[ProblemKind]int {
+	kinds := make(map[ProblemKind]int)
+	for _, p := range report.Problems {
+		kinds[p.Kind]++
+	}
+	return kinds
+}
+
+func testVerify(t *testing.T, opts flags.Bits) {
+	fs, src := openTestStore(t, NewFilestore(filepath.Join(t.TempDir(), "store"), opts))
+	a := addFile(t, fs, filepath.Join(src, "a"), "alpha contents", "", "1")
+	b := addFile(t, fs, filepath.Join(src, "b"), "beta contents", "", "1")
+	addFile(t, fs, filepath.Join(src, "c"), "gamma contents", "", "1")
+	report, err := fs.Verify(VerifyOptions{})
+	if err != nil || !report.OK() || report.Contents != 3 || report.Bytes == 0 {
+		t.Fatalf("Verify = %+v, %v, want no problems with 3 contents", report, err)
+	}
+	// corrupt the contents of a and remove those of b
+	if flags.Has(opts, Chunked) {
+		chunks, err := fs.chunkList(fs.db, a.Checksum)
+		if err != nil {
+			t.Fatal(err)
+		}
+		writeFile(t, fs.chunkPath(chunks[0].checksum, chunks[0].codec), "garbage")
+		if chunks, err = fs.chunkList(fs.db, b.Checksum); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.Remove(fs.chunkPath(chunks[0].checksum, chunks[0].codec)); err != nil {
+			t.Fatal(err)
+		}
+	} else {
+		c, err := fs.blobCodec(fs.db, a.Checksum)
+		if err != nil {
+			t.Fatal(err)
+		}
+		writeFile(t, fs.blobFile(a.Name, a.Checksum, c), "garbage")
+		if err := os.RemoveAll(fs.Root() + b.Checksum); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := os.Mkdir(fs.Root()+"abcdef", 0755); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := fs.db.Exec("insert into Versions(path, info_id, version, date, file) values('x', 1, '', datetime('now'), 9999);"); err != nil {
+		t.Fatal(err)
+	}
+	if report, err = fs.Verify(VerifyOptions{}); err != nil {
+		t.Fatal(err)
+	}
+	kinds := problemKinds(report)
+	if kinds[ProblemCorrupt] != 1 || kinds[ProblemMissing] != 1 || kinds[ProblemDangling] != 1 || kinds[ProblemOrphan] != 1 {
+		t.Fatalf("Verify found %v, want one problem of each kind", report.Problems)
+	}
+	// a quick check does not read the contents
+	if report, err = fs.Verify(VerifyOptions{Quick: true}); err != nil {
+		t.Fatal(err)
+	}
+	if kinds := problemKinds(report); kinds[ProblemCorrupt] != 0 || kinds[ProblemMissing] != 1 {
+		t.Fatalf("quick Verify found %v, want only the missing contents", report.Problems)
+	}
+}
+
+func TestVerify(t *testing.T) {
+	t.Run("plain", func(t *testing.T) { testVerify(t, 0) })
+	t.Run("compressed", func(t *testing.T) { testVerify(t, Compress) })
+	t.Run("chunked", func(t *testing.T) { testVerify(t, Chunked) })
+}
+
+func TestVerifyParallel(t *testing.T) {
+	fs, src := newTestStore(t)
+	for i := 0; i < 20; i++ {
+		addFile(t, fs, filepath.Join(src, fmt.Sprint(i)), strings.Repeat("x", 10000+i), "", "1")
+	}
+	// 200190 bytes at 400000 bytes per second take about half a second
+	start := time.Now()
+	report, err := fs.Verify(VerifyOptions{Workers: 4, BytesPerSecond: 400000})
+	if err != nil || !report.OK() || report.Contents != 20 {
+		t.Fatalf("Verify = %+v, %v, want 20 contents without problems", report, err)
+	}
+	if d := time.Since(start); d < 300*time.Millisecond {
+		t.Fatalf("Verify took %v, want the rate to be limited", d)
+	}
+	if report, err = fs.Verify(VerifyOptions{}); err != nil || !report.OK() || report.Bytes != 20*10000+190 {
+		t.Fatalf("Verify = %+v, %v, want %d bytes read", report, err, 20*10000+190)
+	}
+}
@@ -0,0 +1,145 @@
+package filestore
+
+import (
+	"database/sql"
+	"errors"
+	"time"
+)
+
+var ErrViewClosed = errors.New("filestore view has already been closed")
+
+// View is a read-only view of the filestore as it was when the view began. All queries made
+// through a view see the same state even while other goroutines or processes continue to change
+// the filestore, so that reports made of several queries are consistent. The view must be closed
+// with Close. Writers continue while views are open, except in filestores in memory, whose
+// writers wait for views to be closed and fail if that takes too long, so views should be short.
+type View struct {
+	fs *Filestore
+	tx *sql.Tx
+}
+
+// BeginView begins a view of the current state of the filestore.
+func (fs *Filestore) BeginView() (_ *View, err error) {
+	op := newOp("BeginView", fs.Dir)
+	defer op.done(&err)
+	if err := fs.ensureOpen(); err != nil {
+		return nil, err
+	}
+	tx, err := fs.db.Begin()
+	if err != nil {
+		return nil, fs.dbError(err)
+	}
+	// SQLite takes the snapshot of a transaction when it first reads from the database
+	var n int
+	if err := tx.QueryRow("select count(*) from Settings;").Scan(&n); err != nil {
+		tx.Rollback()
+		return nil, fs.dbError(err)
+	}
+	return &View{fs: fs, tx: tx}, nil
+}
+
+// Close ends the view.
+func (v *View) Close() (err error) {
+	op := newOp("View.Close", "")
+	defer op.done(&err)
+	if v.tx == nil {
+		return ErrViewClosed
+	}
+	err = v.tx.Rollback()
+	v.tx = nil
+	if err != nil {
+		return v.fs.dbError(err)
+	}
+	return nil
+}
+
+// Get returns the latest version of the file at path in the view, like Filestore.Get.
+func (v *View) Get(path string) (_ FileVersion, err error) {
+	op := newOp("View.Get", path)
+	defer op.done(&err)
+	if v.tx == nil {
+		return FileVersion{}, ErrViewClosed
+	}
+	return v.fs.get(v.tx.Stmt(v.fs.getVersionStmt), path)
+}
+
+// GetAt returns the version of the file at path in the view that was current at time t, like
+// Filestore.GetAt.
+func (v *View) GetAt(path string, t time.Time) (_ FileVersion, err error) {
+	op := newOp("View.GetAt", path)
+	defer op.done(&err)
+	if v.tx == nil {
+		return FileVersion{}, ErrViewClosed
+	}
+	return v.fs.getAt(v.tx, path, t)
+}
+
+// Versions returns the versions of the file at path in the view, like Filestore.Versions.
+func (v *View) Versions(path string, limit int) (_ []FileVersion, err error) {
+	op := newOp("View.Versions", path)
+	defer op.done(&err)
+	if v.tx == nil {
+		return nil, ErrViewClosed
+	}
+	rows, err := v.tx.Stmt(v.fs.getVersionsStmt).Query(v.fs.storedPath(path), limit)
+	if err != nil {
+		return nil, v.fs.dbError(err)
+	}
+	return v.fs.getVersions(rows)
+}
+
+// VersionsAfter returns the versions of the file at path in the view after the given date, like
+// Filestore.VersionsAfter.
+func (v *View) VersionsAfter(path string, after time.Time, limit int) (_ []FileVersion, err error) {
+	op := newOp("View.VersionsAfter", path)
+	defer op.done(&err)
+	if v.tx == nil {
+		return nil, ErrViewClosed
+	}
+	rows, err := v.tx.Stmt(v.fs.getVersionsAfterStmt).Query(v.fs.storedPath(path), ToDBDate(after), limit)
+	if err != nil {
+		return nil, v.fs.dbError(err)
+	}
+	return v.fs.getVersions(rows)
+}
+
+// Paths returns the distinct paths of the files in the view, like Filestore.Paths.
+func (v *View) Paths(limit, offset int) (_ []string, err error) {
+	op := newOp("View.Paths", "")
+	defer op.done(&err)
+	if v.tx == nil {
+		return nil, ErrViewClosed
+	}
+	return v.fs.paths(v.tx, limit, offset)
+}
+
+// SimpleSearch returns the versions in the view whose info strings start with one of the
+// words, like Filestore.SimpleSearch.
+func (v *View) SimpleSearch(words []string, limit int) (_ []FileVersion, err error) {
+	op := newOp("View.SimpleSearch", "")
+	defer op.done(&err)
+	if v.tx == nil {
+		return nil, ErrViewClosed
+	}
+	return v.fs.simpleSearch(v.tx, words, limit)
+}
+
+// Search performs an FTS5 term search in the view, like Filestore.Search.
+func (v *View) Search(term string, limit int) (_ []FileVersion, err error) {
+	op := newOp("View.Search", "")
+	defer op.done(&err)
+	if v.tx == nil {
+		return nil, ErrViewClosed
+	}
+	return v.fs.search(v.tx, term, time.Time{}, time.Time{}, limit)
+}
+
+// Tags returns the tags of the version in the view in alphabetical order, like Filestore.Tags.
+func (v *View) Tags(version FileVersion) (_ []string, err error) {
+	op := newOp("View.Tags", version.Path)
+	defer op.done(&err)
+	if v.tx == nil {
+		return nil, ErrViewClosed
+	}
+	return v.fs.tags(v.tx, version.ID)
+}
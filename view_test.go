@@ -0,0 +1,62 @@
+package filestore
+
+import (
+	"errors"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestView(t *testing.T) {
+	fs, src := openTestStore(t, NewFilestore(filepath.Join(t.TempDir(), "store"), Shared))
+	path := filepath.Join(src, "a.txt")
+	addFile(t, fs, path, "1", "first", "1")
+	view, err := fs.BeginView()
+	if err != nil {
+		t.Fatal(err)
+	}
+	// versions added after the view began are not visible in it
+	addFile(t, fs, path, "2", "second", "2")
+	addFile(t, fs, filepath.Join(src, "b.txt"), "b", "bee", "1")
+	if versions, err := view.Versions(path, -1); err != nil || len(versions) != 1 {
+		t.Fatalf("Versions = %v, %v in the view, want 1 version", versions, err)
+	}
+	if v, err := view.Get(path); err != nil || v.Version != "1" {
+		t.Fatalf("Get = %v, %v in the view, want version 1", v, err)
+	}
+	if paths, err := view.Paths(10, 0); err != nil || len(paths) != 1 {
+		t.Fatalf("Paths = %v, %v in the view, want 1 path", paths, err)
+	}
+	if versions, err := view.SimpleSearch([]string{"bee"}, 10); err != nil || len(versions) != 0 {
+		t.Fatalf("SimpleSearch = %v, %v in the view, want no versions", versions, err)
+	}
+	if versions, err := fs.Versions(path, -1); err != nil || len(versions) != 2 {
+		t.Fatalf("Versions = %v, %v outside of the view, want 2 versions", versions, err)
+	}
+	if err := view.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := view.Get(path); !errors.Is(err, ErrViewClosed) {
+		t.Fatalf("Get = %v after closing the view, want ErrViewClosed", err)
+	}
+}
+
+func TestViewFoldCase(t *testing.T) {
+	fs, src := openTestStore(t, NewFilestore(filepath.Join(t.TempDir(), "store"), FoldCase))
+	addFile(t, fs, filepath.Join(src, "README.md"), "r", "", "1")
+	view, err := fs.BeginView()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer view.Close()
+	path := filepath.Join(src, "readme.MD")
+	if v, err := view.Get(path); err != nil || v.Version != "1" {
+		t.Fatalf("Get = %v, %v in the view, want version 1", v, err)
+	}
+	if versions, err := view.Versions(path, -1); err != nil || len(versions) != 1 {
+		t.Fatalf("Versions = %v, %v in the view, want 1 version", versions, err)
+	}
+	if versions, err := view.VersionsAfter(path, time.Time{}, -1); err != nil || len(versions) != 1 {
+		t.Fatalf("VersionsAfter = %v, %v in the view, want 1 version", versions, err)
+	}
+}
@@ -0,0 +1,275 @@
+package filestore
+
+import (
+	"database/sql"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
+)
+
+// DefaultDebounce is the time a watched file must remain unchanged before it is added, unless
+// WatchOptions specify another one.
+const DefaultDebounce = time.Second
+
+// WatchOptions configure a Watcher.
+type WatchOptions struct {
+	Debounce  time.Duration                // time a file must remain unchanged before it is added, DefaultDebounce if 0
+	Ignore    []string                     // filepath.Match patterns of files and directories to ignore
+	Recursive bool                         // if true, subdirectories are watched as well
+	Info      string                       // the info string of added versions
+	Version   string                       // the version string of added versions
+	OnError   func(path string, err error) // called when a changed file cannot be added, may be nil
+}
+
+// Watcher adds new versions of the files in a directory when they change. It is created by Watch
+// and must be closed after use.
+type Watcher struct {
+	fs      *Filestore
+	dir     string // the absolute path of the watched directory
+	root    string // the absolute path of the filestore directory, which is ignored
+	opts    WatchOptions
+	watcher *fsnotify.Watcher
+	timers  map[string]*time.Timer // pending adds by path
+	closed  bool
+	mutex   sync.Mutex
+	pending sync.WaitGroup // adds in progress
+	done    chan struct{}  // closed when the event loop has ended
+}
+
+// Watch starts watching the directory dir and adds a version of a file whenever it has been
+// created or written and has then remained unchanged for the debounce time of opts. Files whose
+// contents equal those of their latest version are not added again. Files present when Watch is
+// called are not added until they change. Ignore patterns are matched against both the name of
+// a file and its slash-separated path relative to dir, and ignored directories are not watched.
+// The Ignore patterns of the filestore apply in addition to those of opts. The directory of the filestore is always ignored.
+func (fs *Filestore) Watch(dir string, opts WatchOptions) (_ *Watcher, err error) {
+	op := newOp("Watch", dir)
+	defer op.done(&err)
+	if err := fs.ensureOpen(); err != nil {
+		return nil, err
+	}
+	if opts.Debounce <= 0 {
+		opts.Debounce = DefaultDebounce
+	}
+	dir, err = filepath.Abs(dir)
+	if err != nil {
+		return nil, err
+	}
+	root, err := filepath.Abs(fs.Root())
+	if err != nil {
+		return nil, err
+	}
+	fw, err := fsnotify.NewWatcher()
+	if err != nil {
+		return nil, err
+	}
+	w := &Watcher{fs: fs, dir: dir, root: root, opts: opts, watcher: fw, timers: make(map[string]*time.Timer),
+		done: make(chan struct{})}
+	if err := w.watch(dir, false); err != nil {
+		fw.Close()
+		return nil, err
+	}
+	atomic.AddInt32(&fs.watchers, 1)
+	go w.loop()
+	return w, nil
+}
+
+// Close stops watching and waits until adds in progress are complete. Changes whose debounce
+// time has not passed yet are not added.
+func (w *Watcher) Close() error {
+	w.mutex.Lock()
+	if w.closed {
+		w.mutex.Unlock()
+		return nil
+	}
+	w.closed = true
+	atomic.AddInt32(&w.fs.watchers, -1)
+	for path, timer := range w.timers {
+		if timer.Stop() {
+			w.pending.Done()
+		}
+		delete(w.timers, path)
+	}
+	w.mutex.Unlock()
+	err := w.watcher.Close()
+	<-w.done
+	w.pending.Wait()
+	return err
+}
+
+// watch adds dir to the watched directories, including its subdirectories if the watcher is
+// recursive. If files is true, adding the files found in them is scheduled as well, since they
+// may have been created before the directories were watched.
+func (w *Watcher) watch(dir string, files bool) error {
+	if !w.opts.Recursive {
+		return w.watcher.Add(dir)
+	}
+	return filepath.Walk(dir, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if path != w.dir && w.ignored(path) {
+			if info.IsDir() {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if info.IsDir() {
+			return w.watcher.Add(path)
+		}
+		if files && info.Mode().IsRegular() {
+			w.schedule(path)
+		}
+		return nil
+	})
+}
+
+// loop handles the events of the fsnotify watcher until it is closed.
+func (w *Watcher) loop() {
+	defer close(w.done)
+	for {
+		select {
+		case event, ok := <-w.watcher.Events:
+			if !ok {
+				return
+			}
+			w.handle(event)
+		case err, ok := <-w.watcher.Errors:
+			if !ok {
+				return
+			}
+			w.report(w.dir, err)
+		}
+	}
+}
+
+// handle schedules adding the file of a create or write event, or starts watching a new
+// subdirectory. Removed and renamed files are no longer added.
+func (w *Watcher) handle(event fsnotify.Event) {
+	if w.ignored(event.Name) {
+		return
+	}
+	if event.Op&(fsnotify.Remove|fsnotify.Rename) != 0 {
+		w.cancel(event.Name)
+		return
+	}
+	if event.Op&(fsnotify.Create|fsnotify.Write) == 0 {
+		return
+	}
+	info, err := os.Lstat(event.Name)
+	if err != nil {
+		return
+	}
+	if info.IsDir() {
+		if w.opts.Recursive && event.Op&fsnotify.Create != 0 {
+			if err := w.watch(event.Name, true); err != nil {
+				w.report(event.Name, err)
+			}
+		}
+		return
+	}
+	if info.Mode().IsRegular() || info.Mode()&os.ModeSymlink != 0 && w.fs.Symlinks == SymlinkStore {
+		w.schedule(event.Name)
+	}
+}
+
+// schedule adds the file at path after the debounce time, unless it changes again before.
+func (w *Watcher) schedule(path string) {
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+	if w.closed {
+		return
+	}
+	if timer, ok := w.timers[path]; ok && timer.Stop() {
+		timer.Reset(w.opts.Debounce)
+		return
+	}
+	w.pending.Add(1)
+	var timer *time.Timer
+	timer = time.AfterFunc(w.opts.Debounce, func() {
+		defer w.pending.Done()
+		w.mutex.Lock()
+		if w.timers[path] == timer {
+			delete(w.timers, path)
+		}
+		w.mutex.Unlock()
+		if err := w.add(path); err != nil {
+			w.report(path, err)
+		}
+	})
+	w.timers[path] = timer
+}
+
+// cancel cancels adding the file at path if it is scheduled.
+func (w *Watcher) cancel(path string) {
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+	if timer, ok := w.timers[path]; ok {
+		if timer.Stop() {
+			w.pending.Done()
+		}
+		delete(w.timers, path)
+	}
+}
+
+// add adds a version of the file at path unless its contents equal those of its latest version.
+func (w *Watcher) add(path string) (err error) {
+	op := newOp("Watch", path)
+	defer op.done(&err)
+	if err := w.fs.ensureOpen(); err != nil {
+		return err
+	}
+	check, err := w.fs.checksum(path, nil)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil
+		}
+		return fmt.Errorf("filestore checksum failed for %s: %w", path, err)
+	}
+	op.checksum = check
+	var latest string
+	err = w.fs.db.QueryRow("select checksum from Versions inner join Files on Versions.file=Files.file_id where path=? order by date desc, version_id desc limit 1;",
+		w.fs.storedPath(path)).Scan(&latest)
+	if err != nil && err != sql.ErrNoRows {
+		return w.fs.dbError(err)
+	}
+	if latest == check {
+		return nil
+	}
+	if err := w.fs.makeRoomFor(path, check); err != nil {
+		return err
+	}
+	unlock, err := w.fs.lockBlobs()
+	if err != nil {
+		return err
+	}
+	return w.fs.addLocked(unlock, path, w.opts.Info, w.opts.Version, check, nil)
+}
+
+// ignored returns true if the file or directory at path matches an ignore pattern of the options
+// or the filestore, or belongs to the filestore itself.
+func (w *Watcher) ignored(path string) bool {
+	if path == w.root || strings.HasPrefix(path, w.root+string(filepath.Separator)) {
+		return true
+	}
+	name := filepath.Base(path)
+	rel, err := filepath.Rel(w.dir, path)
+	if err != nil {
+		rel = name
+	}
+	rel = filepath.ToSlash(rel)
+	return ignored(w.opts.Ignore, name, rel) || ignored(w.fs.Ignore, name, rel)
+}
+
+// report passes an error to the OnError function of the options, if there is one.
+func (w *Watcher) report(path string, err error) {
+	if w.opts.OnError != nil {
+		w.opts.OnError(path, err)
+	}
+}
@@ -0,0 +1,69 @@
+package filestore
+
+import (
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+)
+
+// waitFor waits up to five seconds until cond returns true and fails the test otherwise.
+func waitFor(t *testing.T, what string, cond func() bool) {
+	t.Helper()
+	for deadline := time.Now().Add(5 * time.Second); !cond(); time.Sleep(20 * time.Millisecond) {
+		if time.Now().After(deadline) {
+			t.Fatalf("timed out waiting for %s", what)
+		}
+	}
+}
+
+func TestWatch(t *testing.T) {
+	fs, src := newTestStore(t)
+	var mutex sync.Mutex
+	var errs []error
+	w, err := fs.Watch(src, WatchOptions{Debounce: 200 * time.Millisecond, Recursive: true, Ignore: []string{"*.tmp"},
+		Version: "watched", OnError: func(path string, err error) {
+			mutex.Lock()
+			errs = append(errs, err)
+			mutex.Unlock()
+		}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer w.Close()
+	// changes in quick succession are added as one version
+	a := filepath.Join(src, "a.txt")
+	for i := 0; i < 5; i++ {
+		if err := os.WriteFile(a, []byte{'0' + byte(i)}, 0644); err != nil {
+			t.Fatal(err)
+		}
+		time.Sleep(20 * time.Millisecond)
+	}
+	writeFile(t, filepath.Join(src, "x.tmp"), "x")
+	if err := os.Mkdir(filepath.Join(src, "sub"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	time.Sleep(100 * time.Millisecond)
+	b := filepath.Join(src, "sub", "b.txt")
+	writeFile(t, b, "b")
+	waitFor(t, "the files to be added", func() bool { return fs.Has(a) && fs.Has(b) })
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	versions, err := fs.Versions(a, -1)
+	if err != nil || len(versions) != 1 || versions[0].Version != "watched" {
+		t.Fatalf("Versions = %v, %v, want one version", versions, err)
+	}
+	if got := readFile(t, versions[0].Local); got != "4" {
+		t.Fatalf("added %q, want the last contents", got)
+	}
+	if fs.Has(filepath.Join(src, "x.tmp")) {
+		t.Fatal("ignored file has been added")
+	}
+	mutex.Lock()
+	defer mutex.Unlock()
+	if len(errs) != 0 {
+		t.Fatalf("errors while watching: %v", errs)
+	}
+}
@@ -0,0 +1,149 @@
+package filestore
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"path/filepath"
+	"time"
+)
+
+// ErrWebhookFailed is passed to the OnError function of a Webhook if the receiver responds to a
+// request with a status other than 2xx.
+var ErrWebhookFailed = errors.New("filestore webhook was not accepted")
+
+// Headers of the requests of webhooks.
+const (
+	WebhookEventHeader     = "X-Filestore-Event"     // the kind of event, such as "version-added"
+	WebhookSignatureHeader = "X-Filestore-Signature" // "sha256=" followed by the hex-encoded HMAC-SHA256 of the body
+)
+
+// webhookTimeout is the timeout of webhook requests if no Client is given.
+const webhookTimeout = 30 * time.Second
+
+// Webhook posts the events of a filestore as JSON to a URL, so that external systems such as
+// chat notifications or CI can react to changes of the filestore. The body of each request is a
+// WebhookPayload. If a Secret is given, the body is signed with HMAC-SHA256 in the
+// X-Filestore-Signature header, which receivers should check to reject forged requests.
+type Webhook struct {
+	URL    string      // the URL events are posted to
+	Secret []byte      // the key with which the bodies are signed, unsigned if empty
+	Kinds  []EventKind // the kinds of events posted, EventVersionAdded and EventVersionDeleted if empty
+	Client *http.Client
+	// OnError is called with the event and the error if an event cannot be delivered, including
+	// ErrWebhookFailed if the response has a status other than 2xx. Errors are ignored if it is nil.
+	OnError func(Event, error)
+}
+
+// WebhookPayload is the JSON body of webhook requests.
+type WebhookPayload struct {
+	Event   string         `json:"event"` // the kind of event, such as "version-added"
+	Date    time.Time      `json:"date"`  // the date of the event
+	Store   string         `json:"store"` // the directory of the filestore
+	Version WebhookVersion `json:"version"`
+	// Used and Threshold are the number of bytes taken and the fraction of the quota crossed for
+	// a "quota-warning" event.
+	Used      int64   `json:"used,omitempty"`
+	Threshold float64 `json:"threshold,omitempty"`
+}
+
+// WebhookVersion describes the version concerned by an event in a WebhookPayload.
+type WebhookVersion struct {
+	ShortID  string         `json:"short_id"`
+	Path     string         `json:"path"` // slash-separated
+	Info     string         `json:"info"`
+	Version  string         `json:"version"`
+	Date     time.Time      `json:"date"`
+	Checksum string         `json:"checksum"`
+	Hash     string         `json:"hash"`
+	Summary  *ChangeSummary `json:"summary,omitempty"` // the changes from the previous version if it was stored
+}
+
+// AddWebhook registers a webhook that is posted the subsequent events of the filestore of its
+// kinds. Events are posted in the background, so that slow receivers do not hold up the
+// filestore, and Close waits for pending requests. Events emitted while the filestore is being
+// closed or after it has been closed are not posted.
+func (fs *Filestore) AddWebhook(hook Webhook) {
+	kinds := hook.Kinds
+	if len(kinds) == 0 {
+		kinds = []EventKind{EventVersionAdded, EventVersionDeleted}
+	}
+	fs.AddHook(func(e Event) {
+		for _, kind := range kinds {
+			if e.Kind == kind {
+				fs.webhooksMutex.Lock()
+				defer fs.webhooksMutex.Unlock()
+				if fs.webhooksClosed {
+					return
+				}
+				fs.webhooks.Add(1)
+				go func() {
+					defer fs.webhooks.Done()
+					if err := fs.postWebhook(hook, e); err != nil && hook.OnError != nil {
+						hook.OnError(e, err)
+					}
+				}()
+				return
+			}
+		}
+	})
+}
+
+// postWebhook posts the event to the webhook.
+func (fs *Filestore) postWebhook(hook Webhook, e Event) error {
+	body, err := json.Marshal(WebhookPayload{
+		Event: e.Kind.String(),
+		Date:  e.Date,
+		Store: fs.Dir,
+		Version: WebhookVersion{
+			ShortID:  e.Version.ShortID,
+			Path:     filepath.ToSlash(e.Version.Path),
+			Info:     e.Version.Info,
+			Version:  e.Version.Version,
+			Date:     e.Version.From,
+			Checksum: e.Version.Checksum,
+			Hash:     e.Version.Hash,
+			Summary:  e.Version.Summary,
+		},
+		Used:      e.Used,
+		Threshold: e.Threshold,
+	})
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequest(http.MethodPost, hook.URL, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set(WebhookEventHeader, e.Kind.String())
+	if len(hook.Secret) > 0 {
+		req.Header.Set(WebhookSignatureHeader, "sha256="+SignWebhook(hook.Secret, body))
+	}
+	client := hook.Client
+	if client == nil {
+		client = &http.Client{Timeout: webhookTimeout}
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return fmt.Errorf("%w: %s returned %s", ErrWebhookFailed, hook.URL, resp.Status)
+	}
+	return nil
+}
+
+// SignWebhook returns the hex-encoded HMAC-SHA256 of the body of a webhook request with the
+// secret, which receivers can compare with the X-Filestore-Signature header using hmac.Equal.
+func SignWebhook(secret, body []byte) string {
+	mac := hmac.New(sha256.New, secret)
+	mac.Write(body)
+	return hex.EncodeToString(mac.Sum(nil))
+}
@@ -0,0 +1,111 @@
+package filestore
+
+import (
+	"crypto/hmac"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+)
+
+func TestWebhookSigned(t *testing.T) {
+	secret := []byte("s3cret")
+	var mutex sync.Mutex
+	var payloads []WebhookPayload
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, err := io.ReadAll(r.Body)
+		if err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		signature := strings.TrimPrefix(r.Header.Get(WebhookSignatureHeader), "sha256=")
+		if !hmac.Equal([]byte(signature), []byte(SignWebhook(secret, body))) {
+			w.WriteHeader(http.StatusForbidden)
+			return
+		}
+		var payload WebhookPayload
+		if err := json.Unmarshal(body, &payload); err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		mutex.Lock()
+		payloads = append(payloads, payload)
+		mutex.Unlock()
+	}))
+	defer server.Close()
+	fs, src := openTestStore(t, NewFilestore(filepath.Join(t.TempDir(), "store"), Summarize))
+	var failed []error
+	fs.AddWebhook(Webhook{URL: server.URL, Secret: secret})
+	fs.AddWebhook(Webhook{URL: server.URL, Secret: []byte("wrong"), OnError: func(e Event, err error) {
+		mutex.Lock()
+		failed = append(failed, err)
+		mutex.Unlock()
+	}})
+	v := addFile(t, fs, filepath.Join(src, "a.txt"), "x\ny\n", "a", "1")
+	if err := fs.DeleteVersion(v); err != nil {
+		t.Fatal(err)
+	}
+	if err := fs.Close(); err != nil {
+		t.Fatal(err)
+	}
+	// requests signed with the wrong secret are rejected
+	if len(payloads) != 2 || len(failed) != 2 {
+		t.Fatalf("%d payloads received and %d failed, want 2 of each", len(payloads), len(failed))
+	}
+}
+
+func TestWebhookClose(t *testing.T) {
+	var posted int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&posted, 1)
+	}))
+	defer server.Close()
+	fs, src := newTestStore(t)
+	fs.AddWebhook(Webhook{URL: server.URL})
+	addFile(t, fs, filepath.Join(src, "a.txt"), "a", "", "1")
+	if err := fs.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if n := atomic.LoadInt32(&posted); n != 1 {
+		t.Fatalf("%d events posted before Close returned, want 1", n)
+	}
+	// events emitted after closing are dropped instead of racing with Close
+	fs.emit(Event{Kind: EventVersionAdded})
+	if err := fs.Close(); !errors.Is(err, ErrNotOpen) {
+		t.Fatalf("Close = %v, want ErrNotOpen", err)
+	}
+	if n := atomic.LoadInt32(&posted); n != 1 {
+		t.Fatalf("%d events posted after closing, want 1", n)
+	}
+	openTestStore(t, fs)
+	addFile(t, fs, filepath.Join(src, "a.txt"), "b", "", "2")
+	if err := fs.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if n := atomic.LoadInt32(&posted); n != 2 {
+		t.Fatalf("%d events posted after reopening, want 2", n)
+	}
+}
+
+func TestWebhookFailed(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusInternalServerError)
+	}))
+	defer server.Close()
+	fs, src := newTestStore(t)
+	var failed error
+	fs.AddWebhook(Webhook{URL: server.URL, OnError: func(e Event, err error) { failed = err }})
+	addFile(t, fs, filepath.Join(src, "a.txt"), "a", "", "1")
+	if err := fs.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if !errors.Is(failed, ErrWebhookFailed) {
+		t.Fatalf("OnError called with %v, want ErrWebhookFailed", failed)
+	}
+}
@@ -0,0 +1,69 @@
+package filestore
+
+import (
+	"fmt"
+)
+
+// Xattrs returns the extended attributes recorded for a version by name, which is empty unless
+// the version was added with the Xattrs option from a file that had extended attributes. On
+// Linux, they include the POSIX ACLs of the file as the attributes system.posix_acl_access and
+// system.posix_acl_default.
+func (fs *Filestore) Xattrs(version FileVersion) (_ map[string][]byte, err error) {
+	op := newOp("Xattrs", version.Path)
+	defer op.done(&err)
+	if err := fs.ensureOpen(); err != nil {
+		return nil, err
+	}
+	return fs.xattrs(fs.db, version.ID)
+}
+
+// xattrs returns the extended attributes recorded for the version with the given ID.
+func (fs *Filestore) xattrs(q querier, id int64) (map[string][]byte, error) {
+	rows, err := q.Query("select name, value from Xattrs where version=?;", id)
+	if err != nil {
+		return nil, fs.dbError(err)
+	}
+	defer rows.Close()
+	attrs := make(map[string][]byte)
+	for rows.Next() {
+		var name string
+		var value []byte
+		if err := rows.Scan(&name, &value); err != nil {
+			return nil, fs.dbError(err)
+		}
+		attrs[name] = value
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fs.dbError(err)
+	}
+	return attrs, nil
+}
+
+// insertXattrs records the extended attributes attrs for the version with the given ID.
+func (fs *Filestore) insertXattrs(q querier, id int64, attrs map[string][]byte) error {
+	for name, value := range attrs {
+		if value == nil {
+			value = []byte{}
+		}
+		if _, err := q.Exec("insert or replace into Xattrs(version, name, value) values(?, ?, ?);", id, name, value); err != nil {
+			return fs.dbError(err)
+		}
+	}
+	return nil
+}
+
+// restoreXattrs sets the extended attributes recorded for version on the restored file dst.
+// Attributes that the file system does not support or the process may not set, such as SELinux
+// labels of unprivileged processes, are skipped.
+func (fs *Filestore) restoreXattrs(version FileVersion, dst string) error {
+	attrs, err := fs.xattrs(fs.db, version.ID)
+	if err != nil {
+		return err
+	}
+	for name, value := range attrs {
+		if err := writeXattr(dst, name, value); err != nil {
+			return fmt.Errorf("filestore could not restore extended attribute %s of %s: %w", name, dst, err)
+		}
+	}
+	return nil
+}
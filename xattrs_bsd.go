@@ -0,0 +1,8 @@
+//go:build darwin || freebsd || netbsd
+
+package filestore
+
+import "golang.org/x/sys/unix"
+
+// errNoXattr is the error of reading an extended attribute that does not exist.
+const errNoXattr = unix.ENOATTR
@@ -0,0 +1,13 @@
+//go:build !(linux || darwin || freebsd || netbsd)
+
+package filestore
+
+// readXattrs returns nil, since extended attributes are not supported on this platform.
+func readXattrs(path string) (map[string][]byte, error) {
+	return nil, nil
+}
+
+// writeXattr does nothing, since extended attributes are not supported on this platform.
+func writeXattr(path, name string, value []byte) error {
+	return nil
+}
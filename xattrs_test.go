@@ -0,0 +1,41 @@
+package filestore
+
+import (
+	"bytes"
+	"path/filepath"
+	"testing"
+)
+
+func TestXattrsPulledAndRestored(t *testing.T) {
+	remote, src := openTestStore(t, NewFilestore(filepath.Join(t.TempDir(), "remote"), Xattrs))
+	path := filepath.Join(src, "a.txt")
+	writeFile(t, path, "contents")
+	value := []byte("value")
+	if err := writeXattr(path, "user.filestore", value); err != nil {
+		t.Fatal(err)
+	}
+	if attrs, err := readXattrs(path); err != nil || !bytes.Equal(attrs["user.filestore"], value) {
+		t.Skip("the file system does not support extended attributes")
+	}
+	if err := remote.Add(path, "", "1"); err != nil {
+		t.Fatal(err)
+	}
+	fs, _ := openTestStore(t, NewFilestore(filepath.Join(t.TempDir(), "store"), Xattrs))
+	if n, err := fs.PullMetadata(remote); err != nil || n != 1 {
+		t.Fatalf("PullMetadata = %d, %v, want 1 version", n, err)
+	}
+	v, err := fs.Get(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if attrs, err := fs.Xattrs(v); err != nil || !bytes.Equal(attrs["user.filestore"], value) {
+		t.Fatalf("Xattrs of the pulled version = %v, %v", attrs, err)
+	}
+	dst := t.TempDir()
+	if err := fs.Restore(v, dst); err != nil {
+		t.Fatal(err)
+	}
+	if attrs, err := readXattrs(filepath.Join(dst, "a.txt")); err != nil || !bytes.Equal(attrs["user.filestore"], value) {
+		t.Fatalf("restored extended attributes %v, %v", attrs, err)
+	}
+}
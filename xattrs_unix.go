@@ -0,0 +1,68 @@
+//go:build linux || darwin || freebsd || netbsd
+
+package filestore
+
+import (
+	"bytes"
+	"errors"
+
+	"golang.org/x/sys/unix"
+)
+
+// readXattrs returns the extended attributes of the file at path by name, or nil if the file
+// system does not support them.
+func readXattrs(path string) (map[string][]byte, error) {
+	names, err := xattrBuffer(func(buf []byte) (int, error) { return unix.Listxattr(path, buf) })
+	if errors.Is(err, unix.ENOTSUP) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	attrs := make(map[string][]byte)
+	for _, name := range bytes.Split(names, []byte{0}) {
+		if len(name) == 0 {
+			continue
+		}
+		value, err := xattrBuffer(func(buf []byte) (int, error) { return unix.Getxattr(path, string(name), buf) })
+		if errors.Is(err, errNoXattr) {
+			// removed since it was listed
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		attrs[string(name)] = value
+	}
+	return attrs, nil
+}
+
+// xattrBuffer calls get with a buffer large enough for the data it returns, which is retried if
+// the data grows in between.
+func xattrBuffer(get func(buf []byte) (int, error)) ([]byte, error) {
+	for {
+		size, err := get(nil)
+		if err != nil {
+			return nil, err
+		}
+		buf := make([]byte, size)
+		n, err := get(buf)
+		if errors.Is(err, unix.ERANGE) {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		return buf[:n], nil
+	}
+}
+
+// writeXattr sets the extended attribute name of the file at path to value. Nothing is done if
+// the file system does not support it or the process may not set it.
+func writeXattr(path, name string, value []byte) error {
+	err := unix.Setxattr(path, name, value, 0)
+	if errors.Is(err, unix.ENOTSUP) || errors.Is(err, unix.EPERM) || errors.Is(err, unix.EACCES) {
+		return nil
+	}
+	return err
+}